@@ -5,6 +5,7 @@ import (
 	"ecommerce/pkg/ecommerce/product"
 	"ecommerce/pkg/mock"
 	"ecommerce/pkg/storage"
+	"ecommerce/pkg/storage/local"
 	"ecommerce/pkg/storage/postgres"
 	"flag"
 	"fmt"
@@ -42,7 +43,7 @@ func main() {
 	defer db.Close()
 
 	productRepo := postgres.NewProductStorage(db)
-	productService := product.New(db, productRepo)
+	productService := product.New(db, productRepo, local.NewBlobStore("./media", "http://localhost:5000/media"))
 
 	mocker := &mock.Mock{
 		DB:                db,
@@ -1,22 +1,65 @@
 package main
 
 import (
+	"ecommerce/pkg/ecommerce/address"
+	"ecommerce/pkg/ecommerce/apikey"
+	"ecommerce/pkg/ecommerce/checkout"
+	"ecommerce/pkg/ecommerce/fulfilment"
+	"ecommerce/pkg/ecommerce/mail"
+	"ecommerce/pkg/ecommerce/currency"
+	"ecommerce/pkg/ecommerce/media"
 	"ecommerce/pkg/ecommerce/product"
+	"ecommerce/pkg/ecommerce/promotion"
+	"ecommerce/pkg/ecommerce/returns"
+	"ecommerce/pkg/ecommerce/review"
+	"ecommerce/pkg/ecommerce/shipping"
+	"ecommerce/pkg/ecommerce/subscription"
+	"ecommerce/pkg/ecommerce/tax"
 	"ecommerce/pkg/ecommerce/user"
+	"ecommerce/pkg/ecommerce/wishlist"
 	http2 "ecommerce/pkg/http"
+	"ecommerce/pkg/ecommerce"
+	"ecommerce/pkg/mock/email"
+	"ecommerce/pkg/oidc"
+	"ecommerce/pkg/smtp"
 	"ecommerce/pkg/storage"
+	"ecommerce/pkg/storage/local"
 	"ecommerce/pkg/storage/postgres"
 	"flag"
 	"fmt"
 	_ "github.com/lib/pq"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
 	addr := flag.String("addr", ":5000", "HTTP network address")
 	dsn := flag.String("dsn", "host=localhost port=5432 user=ecommerce password=password dbname=ecommerce sslmode=disable", "Postgresql database connection info")
+	mediaDir := flag.String("media_dir", "./media", "Directory uploaded media is stored in")
+	mediaURL := flag.String("media_url", "http://localhost:5000/media", "Base URL uploaded media is served from")
+	ratesCSV := flag.String("rates_csv", "", "CSV file of exchange rates to import on startup")
+	shopURL := flag.String("shop_url", "http://localhost:4200", "Base URL of the shop front end linked to in emails")
+	subscriptionKey := flag.String("subscription_key", "my_secrete_subscription_key", "Key unsubscribe tokens are signed with")
+	alertInterval := flag.Duration("alert_interval", time.Minute, "How often queued subscription alerts are emailed")
+	shopName := flag.String("shop_name", "Ecommerce", "Name of the shop in emails")
+	smtpAddr := flag.String("smtp_addr", "", "SMTP server (host:port) emails are sent through, emails are written to /tmp/emails if empty")
+	smtpUser := flag.String("smtp_user", "", "SMTP user name, if the server requires authentication")
+	smtpPassword := flag.String("smtp_password", "", "SMTP password")
+	mailFrom := flag.String("mail_from", "Ecommerce <no-reply@localhost>", "Sender of emails")
+	requireVerifiedEmail := flag.Bool("require_verified_email", false, "Block checkout for customers who have not verified their email address")
+	passwordMinLength := flag.Int("password_min_length", 8, "Minimum number of characters of user passwords")
+	breachedPasswords := flag.String("breached_passwords", "", "File of breached passwords to reject, one per line in plain text or as SHA-1 hashes")
+	bcryptCost := flag.Int("bcrypt_cost", 12, "bcrypt cost passwords are hashed with, existing passwords are rehashed at login")
+	requireAdminTwoFactor := flag.Bool("require_admin_2fa", true, "Require admins to log in with two-factor authentication to use admin routes")
+	oidcProviders := flag.String("oidc_providers", "", "JSON file of OpenID Connect providers customers can log in with")
+	deletionGrace := flag.Duration("account_deletion_grace", 30 * 24 * time.Hour, "How long after a user asks for it their account is deleted")
+	purgeInterval := flag.Duration("purge_interval", time.Hour, "How often accounts due for deletion are deleted")
+	mailInterval := flag.Duration("mail_interval", 10 * time.Second, "How often the email outbox is delivered")
+	allowedOrigins := flag.String("allowed_origins", "http://localhost:4200", "Comma separated origins of the front ends allowed to call the API from a browser")
 	flag.Parse()
 
 	//infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
@@ -30,18 +73,143 @@ func main() {
 
 	response := http2.NewResponse(errorLog)
 
+	blobStore := local.NewBlobStore(*mediaDir, *mediaURL)
+	var emailer ecommerce.Email
+	if *smtpAddr != "" {
+		emailer = smtp.New(*smtpAddr, *smtpUser, *smtpPassword, *mailFrom)
+	} else {
+		emailer = email.New()
+	}
+
+	mailRepo := postgres.NewMailStorage(db)
+	mailService := mail.New(db, mailRepo, emailer, *shopName, *shopURL)
+	go func() {
+		for range time.Tick(*mailInterval) {
+			if _, err := mailService.DeliverPending(); err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+
 	productRepo := postgres.NewProductStorage(db)
-	productService := product.New(db, productRepo)
+	productService := product.New(db, productRepo, blobStore)
+
+	mediaRepo := postgres.NewMediaStorage(db)
+	mediaService := media.New(db, mediaRepo, blobStore, productService)
 
 	userRepo := postgres.NewUserStorage(db)
 	addressRepo := postgres.NewAddressStorage(db)
 	orderRepo := postgres.NewOrderStorage(db)
-	userService := user.New(db, userRepo, addressRepo, orderRepo, productService)
+	passwordPolicy, err := user.NewPasswordPolicy(*passwordMinLength, *bcryptCost, nil)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if *breachedPasswords != "" {
+		f, err := os.Open(*breachedPasswords)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		passwordPolicy, err = user.NewPasswordPolicy(*passwordMinLength, *bcryptCost, f)
+		_ = f.Close()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+	userService := user.New(db, userRepo, addressRepo, address.New(address.Rules), orderRepo, productService, mailService, *shopName, *shopURL, passwordPolicy, *deletionGrace)
+	go func() {
+		for range time.Tick(*purgeInterval) {
+			if _, err := userService.PurgeDeletedAccounts(); err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+
+	if *oidcProviders != "" {
+		f, err := os.Open(*oidcProviders)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		cc, err := oidc.ReadConfig(f, func(name string) string {
+			return strings.TrimRight(*shopURL, "/") + "/login/" + url.PathEscape(name)
+		})
+		_ = f.Close()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		for _, c := range cc {
+			userService.AddIdentityProvider(c.Name, oidc.New(c, nil))
+		}
+	}
+
+	promotionRepo := postgres.NewPromotionStorage(db)
+	promotionService := promotion.New(db, promotionRepo, userService, productService)
+
+	currencyRepo := postgres.NewCurrencyStorage(db)
+	currencyService := currency.New(db, currencyRepo)
+	if *ratesCSV != "" {
+		f, err := os.Open(*ratesCSV)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		n, err := currencyService.ImportRates(f)
+		_ = f.Close()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		fmt.Printf("Imported %d exchange rates from %s\n", n, *ratesCSV)
+	}
+
+	taxRepo := postgres.NewTaxStorage(db)
+	taxService := tax.New(db, taxRepo)
+	shippingRepo := postgres.NewShippingStorage(db)
+	shippingService := shipping.New(db, shippingRepo)
+
+	checkoutService := checkout.New(db, orderRepo, userService, productService, promotionService, currencyService, taxService, shippingService, mailService, *requireVerifiedEmail)
+
+	shipmentRepo := postgres.NewShipmentStorage(db)
+	fulfilmentService := fulfilment.New(db, shipmentRepo, orderRepo, userService, mailService)
+
+	returnRepo := postgres.NewReturnStorage(db)
+	returnService := returns.New(db, returnRepo, orderRepo, userService, productService, fulfilmentService, mailService)
+
+	wishlistRepo := postgres.NewWishlistStorage(db)
+	wishlistService := wishlist.New(db, wishlistRepo, userService, productService)
+
+	subscriptionRepo := postgres.NewSubscriptionStorage(db)
+	subscriptionService := subscription.New(db, subscriptionRepo, productRepo, mailService, []byte(*subscriptionKey), *shopURL)
+	productService.Watch(subscriptionService)
+	go func() {
+		for range time.Tick(*alertInterval) {
+			if _, err := subscriptionService.DeliverAlerts(); err != nil {
+				errorLog.Println(err)
+			}
+		}
+	}()
+
+	reviewRepo := postgres.NewReviewStorage(db)
+	reviewService := review.New(db, reviewRepo, productService)
+
+	apiKeyRepo := postgres.NewAPIKeyStorage(db)
+	apiKeyService := apikey.New(db, apiKeyRepo)
 
 	httpEndpoint := &http2.Http{
 		Response: response,
 		ProductService: productService,
 		UserService: userService,
+		MediaService: mediaService,
+		ReviewService: reviewService,
+		PromotionService: promotionService,
+		CheckoutService: checkoutService,
+		CurrencyService: currencyService,
+		TaxService: taxService,
+		ShippingService: shippingService,
+		FulfilmentService: fulfilmentService,
+		ReturnService: returnService,
+		WishlistService: wishlistService,
+		SubscriptionService: subscriptionService,
+		APIKeyService: apiKeyService,
+		RequireAdminTwoFactor: *requireAdminTwoFactor,
+		AllowedOrigins: strings.Split(*allowedOrigins, ","),
 	}
 	router := httpEndpoint.Routes()
 
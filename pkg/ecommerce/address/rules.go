@@ -0,0 +1,108 @@
+package address
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Rules are the built-in rules, keyed by ISO 3166-1 alpha-2 country code.
+var Rules = map[string]Rule{
+	"AE": {NoPostalCode: true},
+	"AU": {
+		States: map[string]string{
+			"ACT": "Australian Capital Territory", "NSW": "New South Wales", "NT": "Northern Territory",
+			"QLD": "Queensland", "SA": "South Australia", "TAS": "Tasmania", "VIC": "Victoria",
+			"WA": "Western Australia",
+		},
+		PostalCode: regexp.MustCompile(`^[0-9]{4}$`),
+	},
+	"CA": {
+		States: map[string]string{
+			"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick",
+			"NL": "Newfoundland and Labrador", "NS": "Nova Scotia", "NT": "Northwest Territories",
+			"NU": "Nunavut", "ON": "Ontario", "PE": "Prince Edward Island", "QC": "Quebec",
+			"SK": "Saskatchewan", "YT": "Yukon",
+		},
+		PostalCode: regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY][0-9][ABCEGHJ-NPRSTV-Z] ?[0-9][ABCEGHJ-NPRSTV-Z][0-9]$`),
+		FormatPostalCode: separate(" ", 3),
+	},
+	"DE": {PostalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"ES": {PostalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"FR": {PostalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"GB": {
+		PostalCode: regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]? ?[0-9][A-Z]{2}$`),
+		FormatPostalCode: separate(" ", 3),
+	},
+	"HK": {NoPostalCode: true},
+	"IN": {PostalCode: regexp.MustCompile(`^[1-9][0-9]{2} ?[0-9]{3}$`), FormatPostalCode: compact},
+	"IT": {PostalCode: regexp.MustCompile(`^[0-9]{5}$`)},
+	"JP": {PostalCode: regexp.MustCompile(`^[0-9]{3}[- ]?[0-9]{4}$`), FormatPostalCode: separate("-", 4)},
+	"NL": {PostalCode: regexp.MustCompile(`^[1-9][0-9]{3} ?[A-Z]{2}$`), FormatPostalCode: separate(" ", 2)},
+	"US": {
+		States: map[string]string{
+			"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+			"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "DC": "District of Columbia",
+			"FL": "Florida", "GA": "Georgia", "HI": "Hawaii", "ID": "Idaho", "IL": "Illinois",
+			"IN": "Indiana", "IA": "Iowa", "KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana",
+			"ME": "Maine", "MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota",
+			"MS": "Mississippi", "MO": "Missouri", "MT": "Montana", "NE": "Nebraska", "NV": "Nevada",
+			"NH": "New Hampshire", "NJ": "New Jersey", "NM": "New Mexico", "NY": "New York",
+			"NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio", "OK": "Oklahoma", "OR": "Oregon",
+			"PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina", "SD": "South Dakota",
+			"TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont", "VA": "Virginia",
+			"WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+			"AS": "American Samoa", "GU": "Guam", "MP": "Northern Mariana Islands", "PR": "Puerto Rico",
+			"VI": "U.S. Virgin Islands", "AA": "Armed Forces Americas", "AE": "Armed Forces Europe",
+			"AP": "Armed Forces Pacific",
+		},
+		PostalCode: regexp.MustCompile(`^[0-9]{5}([- ]?[0-9]{4})?$`),
+		FormatPostalCode: zip,
+	},
+}
+
+// zip formats US ZIP codes and ZIP+4 codes with a dash before the last four digits.
+func zip(code string) string {
+	if len(code) == 5 {
+		return code
+	}
+	return separate("-", 4)(code)
+}
+
+// compact removes the separators from a postal code.
+func compact(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// countries are the ISO 3166-1 alpha-2 country codes.
+var countries = map[string]bool{}
+
+func init() {
+	for _, c := range strings.Fields(`
+		AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ
+		BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+		CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ
+		DE DJ DK DM DO DZ
+		EC EE EG EH ER ES ET
+		FI FJ FK FM FO FR
+		GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY
+		HK HM HN HR HT HU
+		ID IE IL IM IN IO IQ IR IS IT
+		JE JM JO JP
+		KE KG KH KI KM KN KP KR KW KY KZ
+		LA LB LC LI LK LR LS LT LU LV LY
+		MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ
+		NA NC NE NF NG NI NL NO NP NR NU NZ
+		OM
+		PA PE PF PG PH PK PL PM PN PR PS PT PW PY
+		QA
+		RE RO RS RU RW
+		SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ
+		TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ
+		UA UG UM US UY UZ
+		VA VC VE VG VI VN VU
+		WF WS
+		YE YT
+		ZA ZM ZW`) {
+		countries[c] = true
+	}
+}
@@ -0,0 +1,159 @@
+package address
+
+import (
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule is what addresses of a country must look like.
+type Rule struct {
+	// States maps the codes of the states of the country to their names. If it is
+	// set, a state is required and must be one of them, given by code or name.
+	States map[string]string
+	// PostalCode is the pattern of the postal codes of the country in upper case. If
+	// it is set, a postal code is required and must match it.
+	PostalCode *regexp.Regexp
+	// FormatPostalCode returns the canonical form of a postal code that matches
+	// PostalCode, e.g. with the separator some countries use.
+	FormatPostalCode func(code string) string
+	// NoPostalCode is set for countries without postal codes.
+	NoPostalCode bool
+}
+
+// New returns a validator with rules keyed by ISO 3166-1 alpha-2 country code.
+// Addresses in countries without a rule only get the checks every address gets.
+func New(rules map[string]Rule) *validator {
+	return &validator{rules: rules}
+}
+
+type validator struct {
+	rules map[string]Rule
+}
+
+// maximum lengths of the address fields, see the addresses table
+const (
+	maxState = 32
+	maxCity = 32
+	maxPostalCode = 16
+	maxAddress = 64
+)
+
+func (v *validator) Validate(a *ecommerce.Address) error {
+	fe := errors2.FieldErrors{}
+
+	a.Country = strings.ToUpper(collapse(a.Country))
+	a.State = collapse(a.State)
+	a.City = recase(collapse(a.City))
+	a.PostalCode = strings.ToUpper(collapse(a.PostalCode))
+	a.Address = recase(collapse(a.Address))
+
+	if a.Country == "" {
+		fe["country"] = "is required"
+	} else if !countries[a.Country] {
+		fe["country"] = "must be an ISO 3166-1 alpha-2 country code"
+	}
+	if a.City == "" {
+		fe["city"] = "is required"
+	}
+	if a.Address == "" {
+		fe["address"] = "is required"
+	}
+
+	rule := v.rules[a.Country]
+
+	if rule.States != nil {
+		if code, ok := stateCode(rule.States, a.State); ok {
+			a.State = code
+		} else if a.State == "" {
+			fe["state"] = "is required"
+		} else {
+			fe["state"] = "is not a state of " + a.Country
+		}
+	}
+
+	switch {
+	case rule.NoPostalCode:
+		a.PostalCode = ""
+	case rule.PostalCode != nil && a.PostalCode == "":
+		fe["postal_code"] = "is required"
+	case rule.PostalCode != nil && !rule.PostalCode.MatchString(a.PostalCode):
+		fe["postal_code"] = "is not a valid postal code of " + a.Country
+	case rule.FormatPostalCode != nil:
+		a.PostalCode = rule.FormatPostalCode(a.PostalCode)
+	}
+
+	for _, f := range []struct {
+		name string
+		value string
+		max int
+	}{
+		{"state", a.State, maxState},
+		{"city", a.City, maxCity},
+		{"postal_code", a.PostalCode, maxPostalCode},
+		{"address", a.Address, maxAddress},
+	} {
+		if _, ok := fe[f.name]; !ok && utf8.RuneCountInString(f.value) > f.max {
+			fe[f.name] = "is too long"
+		}
+	}
+
+	if len(fe) > 0 {
+		return &errors2.Invalid{Err: fe}
+	}
+
+	return nil
+}
+
+// collapse trims s and replaces every run of white space in it, line breaks included,
+// with a single space.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// recase title cases s if it is all upper or all lower case, which is how addresses
+// typed in a hurry usually look. Mixed case is left alone, so that names like
+// McAllen keep their casing.
+func recase(s string) string {
+	if s != strings.ToUpper(s) && s != strings.ToLower(s) {
+		return s
+	}
+
+	words := strings.Fields(strings.ToLower(s))
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// stateCode returns the code of the state of states with code or name s.
+func stateCode(states map[string]string, s string) (string, bool) {
+	if _, ok := states[strings.ToUpper(s)]; ok {
+		return strings.ToUpper(s), true
+	}
+
+	for code, name := range states {
+		if strings.EqualFold(name, s) {
+			return code, true
+		}
+	}
+
+	return "", false
+}
+
+// separate returns a FormatPostalCode that puts sep before the last n characters of a
+// postal code, e.g. separate(" ", 3) formats SW1A1AA as SW1A 1AA.
+func separate(sep string, n int) func(string) string {
+	return func(code string) string {
+		code = compact(code)
+		if len(code) <= n {
+			return code
+		}
+		return code[:len(code) - n] + sep + code[len(code) - n:]
+	}
+}
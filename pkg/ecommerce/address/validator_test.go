@@ -0,0 +1,96 @@
+package address
+
+import (
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCountries(t *testing.T) {
+	if len(countries) != 249 {
+		t.Fatalf("wanted 249 country codes, got %d", len(countries))
+	}
+	for c := range Rules {
+		if !countries[c] {
+			t.Fatalf("rule for unknown country %s", c)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		a ecommerce.Address
+		want ecommerce.Address
+		errs errors2.FieldErrors
+	}{
+		{
+			name: "normalized US address",
+			a: ecommerce.Address{Country: " us", State: "california", City: "SAN  FRANCISCO", PostalCode: "941031234", Address: "1 market st\n"},
+			want: ecommerce.Address{Country: "US", State: "CA", City: "San Francisco", PostalCode: "94103-1234", Address: "1 Market St"},
+		},
+		{
+			name: "mixed case is kept",
+			a: ecommerce.Address{Country: "US", State: "TX", City: "McAllen", PostalCode: "78501", Address: "12 McColl Rd"},
+			want: ecommerce.Address{Country: "US", State: "TX", City: "McAllen", PostalCode: "78501", Address: "12 McColl Rd"},
+		},
+		{
+			name: "postal code of GB",
+			a: ecommerce.Address{Country: "gb", City: "London", PostalCode: "sw1a1aa", Address: "10 Downing Street"},
+			want: ecommerce.Address{Country: "GB", City: "London", PostalCode: "SW1A 1AA", Address: "10 Downing Street"},
+		},
+		{
+			name: "postal code of a country without postal codes",
+			a: ecommerce.Address{Country: "HK", City: "Central", PostalCode: "000", Address: "1 Queen's Road"},
+			want: ecommerce.Address{Country: "HK", City: "Central", Address: "1 Queen's Road"},
+		},
+		{
+			name: "country without rule",
+			a: ecommerce.Address{Country: "BE", City: "Brussels", PostalCode: "1000", Address: "Rue Neuve 1"},
+			want: ecommerce.Address{Country: "BE", City: "Brussels", PostalCode: "1000", Address: "Rue Neuve 1"},
+		},
+		{
+			name: "field errors",
+			a: ecommerce.Address{Country: "US", State: "Ontario", PostalCode: "K1A 0B1", Address: strings.Repeat("a", 65)},
+			errs: errors2.FieldErrors{
+				"city": "is required",
+				"state": "is not a state of US",
+				"postal_code": "is not a valid postal code of US",
+				"address": "is too long",
+			},
+		},
+		{
+			name: "unknown country",
+			a: ecommerce.Address{Country: "United States", City: "Boston", Address: "1 Main St"},
+			errs: errors2.FieldErrors{"country": "must be an ISO 3166-1 alpha-2 country code"},
+		},
+		{
+			name: "missing state and postal code",
+			a: ecommerce.Address{Country: "CA", City: "Ottawa", Address: "24 Sussex Dr"},
+			errs: errors2.FieldErrors{"state": "is required", "postal_code": "is required"},
+		},
+	}
+
+	v := New(Rules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.a
+			err := v.Validate(&a)
+			if tt.errs != nil {
+				invalid, ok := err.(*errors2.Invalid)
+				if !ok || !reflect.DeepEqual(invalid.Err, tt.errs) {
+					t.Fatalf("wanted %v, got %v", tt.errs, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if a != tt.want {
+				t.Fatalf("wanted %+v, got %+v", tt.want, a)
+			}
+		})
+	}
+}
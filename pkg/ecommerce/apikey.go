@@ -0,0 +1,79 @@
+package ecommerce
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Scopes of API keys, each lets a key use the routes for one kind of integration.
+const (
+	ScopeCatalogRead = "catalog:read"
+	ScopeCatalogWrite = "catalog:write"
+	ScopeOrdersRead = "orders:read"
+	ScopeInventoryWrite = "inventory:write"
+)
+
+// APIKeyScopes are the scopes API keys can have.
+var APIKeyScopes = []string{ScopeCatalogRead, ScopeCatalogWrite, ScopeOrdersRead, ScopeInventoryWrite}
+
+// APIKeyPrefix starts every API key, which tells them apart from auth tokens.
+const APIKeyPrefix = "ek_"
+
+type APIKeyService interface {
+	// CreateAPIKey issues a key with the name, scopes and expiry of k, and returns it.
+	// Only its hash is stored, so it cannot be shown again.
+	CreateAPIKey(k *APIKey) (string, error)
+	// APIKeys returns the keys that were not revoked, newest first.
+	APIKeys() ([]APIKey, error)
+	RevokeAPIKey(id int) error
+	// AuthenticateAPIKey returns the API key key if it works and records that it was
+	// used. It returns NotFound for unknown, revoked and expired keys.
+	AuthenticateAPIKey(key string) (*APIKey, error)
+}
+
+// APIKey lets a system of the shop, e.g. an ERP, use the API without a user.
+type APIKey struct {
+	ID int `json:"id"`
+	Name string `json:"name"`
+	// Prefix is the start of the key, stored in plain text to tell keys apart.
+	Prefix string `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// CreatedBy is the id of the admin who issued the key.
+	CreatedBy int `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is nil for keys that work until revoked.
+	ExpiresAt *time.Time `json:"expires_at"`
+	// LastUsedAt is when the key was last used, to the minute.
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt *time.Time `json:"-"`
+}
+
+// HasScope returns true if scope is one of the key's scopes.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsAPIKey returns true if the bearer token t is an API key rather than an auth token.
+func IsAPIKey(t string) bool {
+	return strings.HasPrefix(t, APIKeyPrefix)
+}
+
+var apiKeyKey key = 1
+
+// NewAPIKeyContext returns a new Context that carries value k.
+func NewAPIKeyContext(ctx context.Context, k *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey, k)
+}
+
+// APIKeyFromContext returns the APIKey value stored in ctx, if any.
+func APIKeyFromContext(ctx context.Context) (*APIKey, bool) {
+	k, ok := ctx.Value(apiKeyKey).(*APIKey)
+	return k, ok
+}
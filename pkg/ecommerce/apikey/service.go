@@ -0,0 +1,199 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// prefixBytes and secretBytes are the random bytes of the visible prefix and the
+	// secret of a key.
+	prefixBytes = 4
+	secretBytes = 32
+	// usedEvery is how often the last use of a key is recorded at most, so that using a
+	// key does not cost a write per request.
+	usedEvery = time.Minute
+)
+
+type repository interface {
+	SaveAPIKey(k *ecommerce.APIKey, hash string) (int, error)
+	APIKeys() ([]ecommerce.APIKey, error)
+	// APIKeyByPrefix returns the key with prefix and the hash of the key.
+	APIKeyByPrefix(prefix string) (*ecommerce.APIKey, string, error)
+	// RevokeAPIKey revokes the unrevoked key with id at now.
+	RevokeAPIKey(id int, now time.Time) error
+	// TouchAPIKey records that the key with id was used at now, unless it was since
+	// usedSince.
+	TouchAPIKey(id int, now, usedSince time.Time) error
+}
+
+func New(db *sql.DB, repo repository) *service {
+	return &service{db: db, r: repo}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+}
+
+func (s *service) CreateAPIKey(k *ecommerce.APIKey) (string, error) {
+	const op = "apiKeyService.CreateAPIKey"
+
+	now := time.Now()
+	if err := validateAPIKey(k, now); err != nil {
+		return "", errors2.Wrap(err, op, "validating key")
+	}
+
+	key, prefix, err := newKey()
+	if err != nil {
+		return "", errors2.Wrap(err, op, "generating key")
+	}
+
+	k.Prefix = prefix
+	k.CreatedAt = now
+	k.LastUsedAt = nil
+	k.RevokedAt = nil
+	id, err := s.r.SaveAPIKey(k, hashKey(key))
+	if err != nil {
+		return "", errors2.Wrap(err, op, "saving key")
+	}
+	k.ID = id
+
+	return key, nil
+}
+
+func (s *service) APIKeys() ([]ecommerce.APIKey, error) {
+	const op = "apiKeyService.APIKeys"
+
+	kk, err := s.r.APIKeys()
+	return kk, errors2.Wrap(err, op, "getting keys")
+}
+
+func (s *service) RevokeAPIKey(id int) error {
+	const op = "apiKeyService.RevokeAPIKey"
+
+	return errors2.Wrap(s.r.RevokeAPIKey(id, time.Now()), op, "revoking key")
+}
+
+// AuthenticateAPIKey looks the key up by its prefix and compares the hashes in
+// constant time, so that the time it takes does not tell how much of a hash matched.
+func (s *service) AuthenticateAPIKey(key string) (*ecommerce.APIKey, error) {
+	const op = "apiKeyService.AuthenticateAPIKey"
+
+	notFound := errors2.Wrap(&errors2.NotFound{Err: errors.New("invalid API key")}, op, "checking key")
+
+	prefix, ok := keyPrefix(key)
+	if !ok {
+		return nil, notFound
+	}
+
+	k, hash, err := s.r.APIKeyByPrefix(prefix)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return nil, notFound
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "getting key")
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashKey(key))) != 1 || k.RevokedAt != nil ||
+		k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return nil, notFound
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= usedEvery {
+		if err = s.r.TouchAPIKey(k.ID, now, now.Add(-usedEvery)); err != nil {
+			return nil, errors2.Wrap(err, op, "touching key")
+		}
+		k.LastUsedAt = &now
+	}
+
+	return k, nil
+}
+
+// validateAPIKey trims the name of k and sorts its scopes, which must be known.
+func validateAPIKey(k *ecommerce.APIKey, now time.Time) error {
+	k.Name = strings.TrimSpace(k.Name)
+	if k.Name == "" || len(k.Name) > 64 {
+		return &errors2.Invalid{Err: errors.New("name is required and must be at most 64 characters")}
+	}
+
+	if len(k.Scopes) == 0 {
+		return &errors2.Invalid{Err: errors.New("at least one scope is required")}
+	}
+
+	seen := map[string]bool{}
+	var scopes []string
+	for _, scope := range k.Scopes {
+		if !known(scope) {
+			return &errors2.Invalid{Err: fmt.Errorf("unknown scope %q, the scopes are %s", scope,
+				strings.Join(ecommerce.APIKeyScopes, ", "))}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	k.Scopes = scopes
+
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return &errors2.Invalid{Err: errors.New("expiry must be in the future")}
+	}
+
+	return nil
+}
+
+func known(scope string) bool {
+	for _, s := range ecommerce.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newKey returns a new key and its prefix. A key is the prefix, an underscore and the
+// secret, e.g. ek_1a2b3c4d_<43 characters>.
+func newKey() (string, string, error) {
+	b := make([]byte, prefixBytes+secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	prefix := ecommerce.APIKeyPrefix + hex.EncodeToString(b[:prefixBytes])
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(b[prefixBytes:]), prefix, nil
+}
+
+// keyPrefix returns the prefix of key if it is shaped like a key.
+func keyPrefix(key string) (string, bool) {
+	if !ecommerce.IsAPIKey(key) {
+		return "", false
+	}
+
+	// the secret may contain underscores too, so the key is split by length
+	n := len(ecommerce.APIKeyPrefix) + 2*prefixBytes
+	if len(key) != n+1+base64.RawURLEncoding.EncodedLen(secretBytes) || key[n] != '_' {
+		return "", false
+	}
+
+	return key[:n], true
+}
+
+// hashKey returns the hex SHA-256 hash of key. Keys are random enough that a fast
+// hash is as good as a password hash.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
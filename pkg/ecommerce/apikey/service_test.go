@@ -0,0 +1,64 @@
+package apikey
+
+import (
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewKey(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		key, prefix, err := newKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(key, prefix+"_") || !ecommerce.IsAPIKey(key) {
+			t.Fatalf("wanted key %q to start with its prefix %q", key, prefix)
+		}
+
+		got, ok := keyPrefix(key)
+		if !ok || got != prefix {
+			t.Fatalf("wanted prefix %q of key %q, got %q, %v", prefix, key, got, ok)
+		}
+	}
+}
+
+func TestKeyPrefixRejectsMalformedKeys(t *testing.T) {
+	key, _, err := newKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"", "ek_", key[:len(key)-1], key + "a", "xx" + key[2:], strings.Replace(key, "_", "-", 2)} {
+		if _, ok := keyPrefix(k); ok {
+			t.Errorf("wanted %q to be rejected", k)
+		}
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	now := time.Now()
+
+	k := &ecommerce.APIKey{Name: " ERP ", Scopes: []string{ecommerce.ScopeOrdersRead, ecommerce.ScopeCatalogRead,
+		ecommerce.ScopeOrdersRead}}
+	if err := validateAPIKey(k, now); err != nil {
+		t.Fatal(err)
+	}
+	if k.Name != "ERP" || len(k.Scopes) != 2 || k.Scopes[0] != ecommerce.ScopeCatalogRead {
+		t.Fatalf("wanted the name trimmed and the scopes sorted without duplicates, got %+v", k)
+	}
+
+	past := now.Add(-time.Minute)
+	for _, k := range []*ecommerce.APIKey{
+		{Name: "", Scopes: []string{ecommerce.ScopeCatalogRead}},
+		{Name: "ERP"},
+		{Name: "ERP", Scopes: []string{"orders:write"}},
+		{Name: "ERP", Scopes: []string{ecommerce.ScopeCatalogRead}, ExpiresAt: &past},
+	} {
+		if _, ok := validateAPIKey(k, now).(*errors2.Invalid); !ok {
+			t.Errorf("wanted %+v to be invalid", k)
+		}
+	}
+}
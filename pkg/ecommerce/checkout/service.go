@@ -0,0 +1,312 @@
+package checkout
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type orderRepo interface {
+	SaveOrder(tx *sql.Tx, o *ecommerce.Order) (int, error)
+	Tx() (*sql.Tx, error)
+}
+
+func New(
+	db *sql.DB,
+	orderRepo orderRepo,
+	userService ecommerce.UserService,
+	productService ecommerce.ProductService,
+	promotionService ecommerce.PromotionService,
+	currencyService ecommerce.CurrencyService,
+	taxCalculator ecommerce.TaxCalculator,
+	shippingQuoter ecommerce.ShippingQuoter,
+	mailService ecommerce.MailService,
+	requireVerifiedEmail bool) *service {
+	return &service{
+		db: db,
+		orderRepo: orderRepo,
+		userService: userService,
+		productService: productService,
+		promotionService: promotionService,
+		currencyService: currencyService,
+		taxCalculator: taxCalculator,
+		shippingQuoter: shippingQuoter,
+		mailService: mailService,
+		requireVerifiedEmail: requireVerifiedEmail,
+	}
+}
+
+type service struct {
+	db *sql.DB
+	orderRepo orderRepo
+	userService ecommerce.UserService
+	productService ecommerce.ProductService
+	promotionService ecommerce.PromotionService
+	currencyService ecommerce.CurrencyService
+	taxCalculator ecommerce.TaxCalculator
+	shippingQuoter ecommerce.ShippingQuoter
+	mailService ecommerce.MailService
+	// requireVerifiedEmail blocks checkout for customers who have not verified their
+	// email address.
+	requireVerifiedEmail bool
+}
+
+func (s *service) CartTotals(custID int, currency string) (*ecommerce.CartTotals, error) {
+	const op = "checkoutService.CartTotals"
+
+	rate, err := s.rate(currency)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting exchange rate")
+	}
+
+	a, err := s.userService.CustomerAddress(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting shipping address")
+	}
+
+	_, t, err := s.price(custID, a, rate)
+
+	return t, errors2.Wrap(err, op, "pricing cart")
+}
+
+func (s *service) ShippingOptions(custID int, currency string) ([]ecommerce.ShippingQuote, error) {
+	const op = "checkoutService.ShippingOptions"
+
+	rate, err := s.rate(currency)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting exchange rate")
+	}
+
+	a, err := s.userService.CustomerAddress(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting shipping address")
+	} else if a == nil {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("a shipping address is required")}, op, "getting shipping address")
+	}
+
+	totals, err := s.promotionService.CartTotals(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting cart totals")
+	} else if len(totals.Lines) < 1 {
+		return nil, nil
+	}
+
+	qq, err := s.shippingQuotes(a, totals, rate)
+
+	return qq, errors2.Wrap(err, op, "quoting shipping")
+}
+
+// Checkout turns the cart of a customer into an order at the current prices and
+// promotions, shipped with the shipping method with shippingMethodID, takes the ordered
+// units out of stock and empties the cart. The order is in currency and keeps the
+// exchange rate it was converted with.
+func (s *service) Checkout(custID int, currency string, shippingMethodID int) (*ecommerce.Order, error) {
+	const op = "checkoutService.Checkout"
+
+	u, err := s.userService.User(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting customer")
+	} else if s.requireVerifiedEmail && !u.EmailVerified {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("please verify your email address before checking out")}, op, "checking customer")
+	}
+
+	a, err := s.userService.CustomerAddress(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting shipping address")
+	} else if a == nil {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("a shipping address is required")}, op, "getting shipping address")
+	}
+
+	rate, err := s.rate(currency)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting exchange rate")
+	}
+
+	totals, converted, err := s.price(custID, a, rate)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "pricing cart")
+	} else if len(totals.Lines) < 1 {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("cart is empty")}, op, "pricing cart")
+	}
+
+	qq, err := s.shippingQuotes(a, totals, rate)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "quoting shipping")
+	}
+	var shipping *ecommerce.ShippingQuote
+	for i := range qq {
+		if qq[i].MethodID == shippingMethodID {
+			shipping = &qq[i]
+		}
+	}
+	if shipping == nil {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("the shipping method is not available for this cart")}, op, "quoting shipping")
+	}
+
+	o := &ecommerce.Order{
+		CustomerID: custID,
+		ShippingAddress: a.Snapshot(),
+		OrderedAt: time.Now(),
+		Status: ecommerce.OrderStatusPending,
+		Subtotal: converted.Subtotal,
+		Discount: converted.Discount,
+		Tax: converted.Tax,
+		TaxInclusive: converted.TaxInclusive,
+		ShippingMethodID: shipping.MethodID,
+		ShippingMethod: shipping.Name,
+		ShippingCost: shipping.Cost,
+		Total: converted.Total.Add(shipping.Cost),
+		FreeShipping: converted.FreeShipping,
+		ExchangeRate: rate.Rate,
+	}
+
+	tx, err := s.orderRepo.Tx()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	for _, l := range converted.Lines {
+		name, err := s.takeFromStockWithTx(tx, l)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, errors2.Wrap(err, op, "updating stock")
+		}
+
+		o.Items = append(o.Items, ecommerce.OrderItem{
+			Product: ecommerce.Product{ID: l.ProductID, Name: name},
+			VariantID: l.VariantID,
+			Quantity: l.Quantity,
+			UnitPrice: l.UnitPrice,
+			Discount: l.Discount,
+			Tax: l.Tax,
+			Taxes: l.Taxes,
+		})
+	}
+
+	o.ID, err = s.orderRepo.SaveOrder(tx, o)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "saving order")
+	}
+
+	err = s.promotionService.RedeemWithTx(tx, custID, o.ID, totals)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "redeeming promotions")
+	}
+
+	err = s.userService.ClearCartWithTx(tx, custID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "clearing cart")
+	}
+
+	err = s.mailService.EnqueueWithTx(tx, u.Email, ecommerce.EmailOrderConfirmation,
+		&ecommerce.OrderConfirmationEmail{Name: u.FirstName, Order: o})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "enqueueing order confirmation")
+	}
+
+	return o, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// rate returns the exchange rate of currency.
+func (s *service) rate(currency string) (*ecommerce.ExchangeRate, error) {
+	rate, err := s.currencyService.Rate(currency)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return nil, &errors2.Invalid{Err: fmt.Errorf("currency %s is not available", currency)}
+	}
+	return rate, err
+}
+
+// price returns the cart of a customer with promotions applied in the catalog currency,
+// which promotions are redeemed with, and converted with rate and taxed for address a.
+// An order without an address is not taxed.
+func (s *service) price(custID int, a *ecommerce.Address, rate *ecommerce.ExchangeRate) (*ecommerce.CartTotals, *ecommerce.CartTotals, error) {
+	totals, err := s.promotionService.CartTotals(custID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := rate.ConvertCartTotals(totals)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := make([]ecommerce.TaxableLine, len(t.Lines))
+	for i, l := range t.Lines {
+		lines[i] = ecommerce.TaxableLine{TaxCategory: l.TaxCategory, Amount: l.Subtotal.Sub(l.Discount)}
+	}
+	res, err := s.taxCalculator.Calculate(a, lines)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zero := ecommerce.NewMoney(0, rate.Currency)
+	for i := range t.Lines {
+		t.Lines[i].Tax = zero.Add(res.Lines[i].Tax)
+		t.Lines[i].Taxes = res.Lines[i].Taxes
+		if t.Lines[i].Taxes == nil { t.Lines[i].Taxes = []ecommerce.TaxAmount{} }
+	}
+	t.Tax = zero.Add(res.Tax)
+	t.TaxInclusive = res.Inclusive
+	t.Taxes = res.Taxes
+	if t.Taxes == nil { t.Taxes = []ecommerce.TaxAmount{} }
+	if !t.TaxInclusive {
+		t.Total = t.Total.Add(t.Tax)
+	}
+
+	return totals, t, nil
+}
+
+// shippingQuotes returns the shipping quotes for the cart totals in the catalog currency,
+// converted with rate. Shipping is not taxed.
+func (s *service) shippingQuotes(a *ecommerce.Address, totals *ecommerce.CartTotals, rate *ecommerce.ExchangeRate) ([]ecommerce.ShippingQuote, error) {
+	p := ecommerce.Parcel{Subtotal: totals.Subtotal.Sub(totals.Discount), FreeShipping: totals.FreeShipping}
+	for _, l := range totals.Lines {
+		p.Weight += l.Weight * l.Quantity
+	}
+
+	qq, err := s.shippingQuoter.Quotes(a, p)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range qq {
+		qq[i].Cost, err = rate.ConvertPrice(qq[i].Cost)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return qq, nil
+}
+
+// takeFromStockWithTx reduces the stock of the product or variant of l by its quantity
+// and returns the name of the product. The stock is checked by the update itself,
+// so that concurrent checkouts cannot sell the same units twice.
+func (s *service) takeFromStockWithTx(tx *sql.Tx, l ecommerce.CartLine) (string, error) {
+	p, err := s.productService.Product(l.ProductID)
+	if err != nil {
+		return "", err
+	}
+
+	if l.VariantID > 0 && p.Variant(l.VariantID) == nil {
+		return "", &errors2.Invalid{Err: fmt.Errorf("%s is no longer available in the selected variant", p.Name)}
+	} else if l.VariantID == 0 && len(p.Variants) > 0 {
+		return "", &errors2.Invalid{Err: fmt.Errorf("a variant of %s must be selected", p.Name)}
+	}
+
+	err = s.productService.AdjustStockWithTx(tx, p.ID, l.VariantID, -l.Quantity)
+	if _, ok := errors2.Unwrap(err).(*errors2.Invalid); ok {
+		return "", &errors2.Invalid{Err: fmt.Errorf("not enough %s in stock", p.Name)}
+	} else if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok && l.VariantID > 0 {
+		return "", &errors2.Invalid{Err: fmt.Errorf("%s is no longer available in the selected variant", p.Name)}
+	}
+
+	return p.Name, err
+}
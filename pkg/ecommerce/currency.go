@@ -0,0 +1,234 @@
+package ecommerce
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// maxRateDecimals is the precision exchange rates are stored with.
+const maxRateDecimals = 8
+
+type CurrencyService interface {
+	SetRate(r *ExchangeRate) error
+	DeleteRate(currency string) error
+	// Rate returns the rate of currency. The rate of DefaultCurrency is always 1.
+	Rate(currency string) (*ExchangeRate, error)
+	Rates() ([]ExchangeRate, error)
+	// ImportRates sets the rates of a CSV with currency, rate and optionally rounding
+	// columns and returns the number of rates set.
+	ImportRates(r io.Reader) (int, error)
+}
+
+// ExchangeRate converts amounts in DefaultCurrency to Currency.
+type ExchangeRate struct {
+	Currency string `json:"currency"`
+	// Rate is the amount of Currency one unit of DefaultCurrency buys as a decimal, e.g. "0.92".
+	Rate string `json:"rate"`
+	// Rounding is the increment in minor units converted prices are rounded to,
+	// e.g. 5 rounds CHF prices to 0.05. It is 1 for plain rounding to the minor unit.
+	Rounding int64 `json:"rounding"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BaseRate returns the rate of DefaultCurrency to itself.
+func BaseRate() *ExchangeRate {
+	return &ExchangeRate{Currency: DefaultCurrency, Rate: "1", Rounding: 1}
+}
+
+// ParseRate parses a decimal exchange rate. It fails if the rate is not positive
+// or has more than 8 decimals.
+func ParseRate(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '.'); i >= 0 && len(s)-i-1 > maxRateDecimals {
+		return nil, fmt.Errorf("rate %q has more than %d decimals", s, maxRateDecimals)
+	}
+
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "eE/") {
+		return nil, fmt.Errorf("invalid rate %q", s)
+	} else if rat.Sign() <= 0 {
+		return nil, fmt.Errorf("rate %q must be greater than 0", s)
+	}
+
+	return rat, nil
+}
+
+// FormatRate returns rat as a decimal without trailing zeros, e.g. "0.92".
+func FormatRate(rat *big.Rat) string {
+	s := rat.FloatString(maxRateDecimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Convert converts m from DefaultCurrency to the currency of r, rounded half away
+// from zero to the minor unit.
+func (r *ExchangeRate) Convert(m Money) (Money, error) {
+	return r.convert(m, 1)
+}
+
+// ConvertPrice converts m like Convert but rounds to the rounding increment of r.
+func (r *ExchangeRate) ConvertPrice(m Money) (Money, error) {
+	return r.convert(m, r.Rounding)
+}
+
+func (r *ExchangeRate) convert(m Money, increment int64) (Money, error) {
+	if m.Currency == r.Currency || (m.Currency == "" && m.Amount == 0) {
+		return Money{Amount: m.Amount, Currency: r.Currency}, nil
+	} else if m.Currency != DefaultCurrency {
+		return Money{}, fmt.Errorf("cannot convert %s amounts with a %s rate", m.Currency, r.Currency)
+	}
+
+	rat, err := ParseRate(r.Rate)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return convertAmount(m, rat, r.Currency, increment)
+}
+
+// ToBase converts m from the currency of r back to DefaultCurrency, rounded half
+// away from zero to the minor unit, e.g. for a price filter entered in that currency.
+func (r *ExchangeRate) ToBase(m Money) (Money, error) {
+	if m.Currency == DefaultCurrency {
+		return m, nil
+	} else if m.Currency != r.Currency {
+		return Money{}, fmt.Errorf("cannot convert %s amounts with a %s rate", m.Currency, r.Currency)
+	}
+
+	rat, err := ParseRate(r.Rate)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return convertAmount(m, new(big.Rat).Inv(rat), DefaultCurrency, 1)
+}
+
+// convertAmount returns m * rate in currency, rounded to a multiple of increment minor units.
+func convertAmount(m Money, rate *big.Rat, currency string, increment int64) (Money, error) {
+	from, ok := CurrencyDecimals(m.Currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", m.Currency)
+	}
+	to, ok := CurrencyDecimals(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+	if increment < 1 {
+		increment = 1
+	}
+
+	// amount * rate * 10^(to - from), in units of increment
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate)
+	v.Mul(v, new(big.Rat).SetFrac(pow10(to), pow10(from)))
+	v.Quo(v, new(big.Rat).SetInt64(increment))
+
+	q := roundRat(v)
+	if !q.IsInt64() {
+		return Money{}, fmt.Errorf("converted amount of %s %s is out of range", m, m.Currency)
+	}
+
+	return Money{Amount: q.Int64() * increment, Currency: currency}, nil
+}
+
+// ConvertProduct converts the prices of p and its variants in place.
+func (r *ExchangeRate) ConvertProduct(p *Product) error {
+	err := r.convertPriceInPlace(&p.Price)
+	if err != nil {
+		return err
+	}
+
+	for i := range p.Variants {
+		if p.Variants[i].Price == nil {
+			continue
+		}
+		err = r.convertPriceInPlace(p.Variants[i].Price)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ExchangeRate) convertPriceInPlace(p *Price) error {
+	current, err := r.ConvertPrice(p.Current)
+	if err != nil {
+		return err
+	}
+	p.Current = current
+
+	if p.Old != nil {
+		old, err := r.ConvertPrice(*p.Old)
+		if err != nil {
+			return err
+		}
+		p.Old = &old
+	}
+
+	return nil
+}
+
+// ConvertCartTotals returns t converted to the currency of r. Unit prices are converted
+// like product prices and line discounts to the minor unit, and the cart totals are
+// the sums of the converted lines, so they always add up.
+func (r *ExchangeRate) ConvertCartTotals(t *CartTotals) (*CartTotals, error) {
+	c := *t
+	c.Lines = make([]CartLine, len(t.Lines))
+	c.Applied = make([]AppliedPromotion, len(t.Applied))
+
+	zero := NewMoney(0, r.Currency)
+	c.Subtotal, c.Discount = zero, zero
+	for i, l := range t.Lines {
+		unitPrice, err := r.ConvertPrice(l.UnitPrice)
+		if err != nil {
+			return nil, err
+		}
+		discount, err := r.Convert(l.Discount)
+		if err != nil {
+			return nil, err
+		}
+
+		l.UnitPrice = unitPrice
+		l.Subtotal = unitPrice.Mul(int64(l.Quantity))
+		l.Discount = discount
+		if l.Discount.Cmp(l.Subtotal) > 0 {
+			l.Discount = l.Subtotal
+		}
+		c.Lines[i] = l
+
+		c.Subtotal = c.Subtotal.Add(l.Subtotal)
+		c.Discount = c.Discount.Add(l.Discount)
+	}
+	c.Total = c.Subtotal.Sub(c.Discount)
+
+	for i, a := range t.Applied {
+		discount, err := r.Convert(a.Discount)
+		if err != nil {
+			return nil, err
+		}
+		a.Discount = discount
+		c.Applied[i] = a
+	}
+
+	return &c, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// roundRat rounds v half away from zero.
+func roundRat(v *big.Rat) *big.Int {
+	num := new(big.Int).Abs(v.Num())
+	q, rem := new(big.Int).QuoRem(num, v.Denom(), new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q
+}
@@ -0,0 +1,178 @@
+package currency
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type repository interface {
+	SaveRateWithTx(tx *sql.Tx, r *ecommerce.ExchangeRate) error
+	DeleteRate(currency string) error
+	Rate(currency string) (*ecommerce.ExchangeRate, error)
+	Rates() ([]ecommerce.ExchangeRate, error)
+	Tx() (*sql.Tx, error)
+}
+
+func New(db *sql.DB, repo repository) *service {
+	return &service{db: db, r: repo}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+}
+
+// SetRate creates or replaces the rate of a currency.
+func (s *service) SetRate(r *ecommerce.ExchangeRate) error {
+	const op = "currencyService.SetRate"
+
+	if err := validateRate(r); err != nil {
+		return errors2.Wrap(err, op, "validating rate")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	err = s.r.SaveRateWithTx(tx, r)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "saving rate")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) DeleteRate(currency string) error {
+	const op = "currencyService.DeleteRate"
+
+	err := s.r.DeleteRate(strings.ToUpper(currency))
+
+	return errors2.Wrap(err, op, "deleting rate from repo")
+}
+
+// Rate returns the rate of currency, which is always 1 for the catalog currency.
+func (s *service) Rate(currency string) (*ecommerce.ExchangeRate, error) {
+	const op = "currencyService.Rate"
+
+	currency = strings.ToUpper(currency)
+	if currency == ecommerce.DefaultCurrency {
+		return ecommerce.BaseRate(), nil
+	}
+
+	r, err := s.r.Rate(currency)
+
+	return r, errors2.Wrap(err, op, "getting rate from repo")
+}
+
+func (s *service) Rates() ([]ecommerce.ExchangeRate, error) {
+	const op = "currencyService.Rates"
+
+	rr, err := s.r.Rates()
+
+	return rr, errors2.Wrap(err, op, "getting rates from repo")
+}
+
+// ImportRates sets all rates of a CSV in one go. Every record holds a currency, a
+// rate and optionally a rounding increment, and a leading header record is skipped.
+// Nothing is imported if any record is invalid.
+func (s *service) ImportRates(in io.Reader) (int, error) {
+	const op = "currencyService.ImportRates"
+
+	cr := csv.NewReader(in)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var rates []ecommerce.ExchangeRate
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, errors2.Wrap(&errors2.Invalid{Err: fmt.Errorf("malformed csv: %v", err)}, op, "reading csv")
+		}
+
+		if line == 1 && strings.EqualFold(strings.TrimSpace(rec[0]), "currency") {
+			continue
+		}
+
+		r, err := parseRecord(rec)
+		if err == nil {
+			err = validateRate(r)
+		}
+		if err != nil {
+			err = &errors2.Invalid{Err: fmt.Errorf("line %d: %v", line, err)}
+			return 0, errors2.Wrap(err, op, "parsing csv")
+		}
+
+		rates = append(rates, *r)
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	for i := range rates {
+		err = s.r.SaveRateWithTx(tx, &rates[i])
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "saving rate")
+		}
+	}
+
+	return len(rates), errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func parseRecord(rec []string) (*ecommerce.ExchangeRate, error) {
+	if len(rec) < 2 || len(rec) > 3 {
+		return nil, errors.New("expected currency, rate and optionally rounding")
+	}
+
+	r := &ecommerce.ExchangeRate{Currency: strings.TrimSpace(rec[0]), Rate: strings.TrimSpace(rec[1])}
+	if len(rec) == 3 && strings.TrimSpace(rec[2]) != "" {
+		rounding, err := strconv.ParseInt(strings.TrimSpace(rec[2]), 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid rounding")
+		}
+		r.Rounding = rounding
+	}
+
+	return r, nil
+}
+
+// validateRate normalizes the currency and rate of r and checks that they are valid.
+// Rounding defaults to the minor unit.
+func validateRate(r *ecommerce.ExchangeRate) error {
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	if !ecommerce.ValidCurrency(r.Currency) {
+		return &errors2.Invalid{Err: fmt.Errorf("unsupported currency %q", r.Currency)}
+	} else if r.Currency == ecommerce.DefaultCurrency {
+		return &errors2.Invalid{Err: fmt.Errorf("the rate of %s is always 1", ecommerce.DefaultCurrency)}
+	}
+
+	rat, err := ecommerce.ParseRate(r.Rate)
+	if err != nil {
+		return &errors2.Invalid{Err: err}
+	}
+	r.Rate = ecommerce.FormatRate(rat)
+
+	if r.Rounding == 0 {
+		r.Rounding = 1
+	} else if r.Rounding < 0 || r.Rounding > 10000 {
+		return &errors2.Invalid{Err: errors.New("rounding must be between 1 and 10000 minor units")}
+	}
+
+	r.UpdatedAt = time.Now()
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package ecommerce
+
+import (
+	"testing"
+)
+
+func TestExchangeRateConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		rate ExchangeRate
+		amount int64
+		price bool
+		want Money
+		wantErr bool
+	}{
+		{
+			name: "rounds to the minor unit",
+			rate: ExchangeRate{Currency: "EUR", Rate: "0.9234", Rounding: 1},
+			amount: 1999,
+			want: Money{Amount: 1846, Currency: "EUR"},
+		},
+		{
+			name: "half rounds away from zero",
+			rate: ExchangeRate{Currency: "EUR", Rate: "0.5", Rounding: 1},
+			amount: 5,
+			want: Money{Amount: 3, Currency: "EUR"},
+		},
+		{
+			name: "currency without minor unit",
+			rate: ExchangeRate{Currency: "JPY", Rate: "151.37", Rounding: 1},
+			amount: 1999,
+			want: Money{Amount: 3026, Currency: "JPY"},
+		},
+		{
+			name: "currency with three decimals",
+			rate: ExchangeRate{Currency: "KWD", Rate: "0.3075", Rounding: 1},
+			amount: 1000,
+			want: Money{Amount: 3075, Currency: "KWD"},
+		},
+		{
+			name: "price rounds to the increment",
+			rate: ExchangeRate{Currency: "CHF", Rate: "0.8812", Rounding: 5},
+			amount: 1999,
+			price: true,
+			want: Money{Amount: 1760, Currency: "CHF"},
+		},
+		{
+			name: "amount ignores the increment",
+			rate: ExchangeRate{Currency: "CHF", Rate: "0.8812", Rounding: 5},
+			amount: 1999,
+			want: Money{Amount: 1762, Currency: "CHF"},
+		},
+		{
+			name: "invalid rate",
+			rate: ExchangeRate{Currency: "EUR", Rate: "abc", Rounding: 1},
+			amount: 1999,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convert := tt.rate.Convert
+			if tt.price {
+				convert = tt.rate.ConvertPrice
+			}
+
+			got, err := convert(NewMoney(tt.amount, DefaultCurrency))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("wanted %v %v, got %v %v", tt.want, tt.want.Currency, got, got.Currency)
+			}
+		})
+	}
+}
+
+func TestExchangeRateToBase(t *testing.T) {
+	rate := ExchangeRate{Currency: "EUR", Rate: "0.8", Rounding: 1}
+
+	got, err := rate.ToBase(NewMoney(1000, "EUR"))
+	if err != nil {
+		t.Fatalf("wanted no error, got %v", err)
+	}
+	if want := NewMoney(1250, DefaultCurrency); got != want {
+		t.Fatalf("wanted %v, got %v", want, got)
+	}
+
+	if _, err = rate.ToBase(NewMoney(1000, "GBP")); err == nil {
+		t.Fatalf("wanted error converting from another currency, got none")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		s string
+		want string
+		wantErr bool
+	}{
+		{s: "0.92", want: "0.92"},
+		{s: "0.92000000", want: "0.92"},
+		{s: "151", want: "151"},
+		{s: "0.123456789", wantErr: true},
+		{s: "0", wantErr: true},
+		{s: "-1", wantErr: true},
+		{s: "1/3", wantErr: true},
+		{s: "1e2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			rat, err := ParseRate(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && FormatRate(rat) != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, FormatRate(rat))
+			}
+		})
+	}
+}
+
+func TestConvertCartTotalsAddsUp(t *testing.T) {
+	usd := func(amount int64) Money { return NewMoney(amount, DefaultCurrency) }
+	totals := &CartTotals{
+		Lines: []CartLine{
+			{ProductID: 1, Quantity: 3, UnitPrice: usd(333), Subtotal: usd(999), Discount: usd(100)},
+			{ProductID: 2, Quantity: 1, UnitPrice: usd(1), Subtotal: usd(1), Discount: usd(1)},
+		},
+		Subtotal: usd(1000),
+		Discount: usd(101),
+		Total: usd(899),
+		Applied: []AppliedPromotion{{ID: 1, Discount: usd(101)}},
+	}
+	rate := ExchangeRate{Currency: "CHF", Rate: "0.8812", Rounding: 5}
+
+	got, err := rate.ConvertCartTotals(totals)
+	if err != nil {
+		t.Fatalf("wanted no error, got %v", err)
+	}
+
+	subtotal, discount := NewMoney(0, "CHF"), NewMoney(0, "CHF")
+	for _, l := range got.Lines {
+		if l.Subtotal != l.UnitPrice.Mul(int64(l.Quantity)) {
+			t.Fatalf("wanted line subtotal %v, got %v", l.UnitPrice.Mul(int64(l.Quantity)), l.Subtotal)
+		} else if l.Discount.Cmp(l.Subtotal) > 0 {
+			t.Fatalf("wanted discount of at most %v, got %v", l.Subtotal, l.Discount)
+		}
+		subtotal = subtotal.Add(l.Subtotal)
+		discount = discount.Add(l.Discount)
+	}
+
+	if got.Subtotal != subtotal || got.Discount != discount || got.Total != subtotal.Sub(discount) {
+		t.Fatalf("wanted totals %v - %v = %v, got %v - %v = %v",
+			subtotal, discount, subtotal.Sub(discount), got.Subtotal, got.Discount, got.Total)
+	}
+	if totals.Lines[0].UnitPrice.Currency != DefaultCurrency {
+		t.Fatalf("wanted input to be left unchanged, got %v", totals.Lines[0].UnitPrice.Currency)
+	}
+}
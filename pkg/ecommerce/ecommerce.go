@@ -2,6 +2,7 @@ package ecommerce
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -19,19 +20,21 @@ func (t Time) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t)
 }
 
-type Email interface {
-	Send(msg string) error
-}
-
 type Price struct {
-	Current float32 `json:"current"`
-	Old float32 `json:"old,omitempty"`
+	Current Money `json:"current"`
+	Old *Money `json:"old,omitempty"`
 }
 
 type ProductFilter struct {
-	MinPrice float32 `json:"min_price"`
-	MaxPrice float32 `json:"max_price"`
+	MinPrice Money `json:"min_price"`
+	MaxPrice Money `json:"max_price"`
 	Discount int `json:"discount"`
+	// Options maps an option name (e.g. "size") to the values a product
+	// variant must have for one of them to match.
+	Options map[string][]string `json:"options,omitempty"`
+	// Attributes maps an attribute code to the values a product must
+	// have one of, e.g. {"brand": ["acme", "globex"]}.
+	Attributes map[string][]string `json:"attributes,omitempty"`
 }
 
 type CreditCard struct {
@@ -42,25 +45,124 @@ type CreditCard struct {
 	CVC string`json:"cvc"`
 }
 
+// Masked returns c with all but the last four digits of the number hidden and
+// without the CVC.
+func (c CreditCard) Masked() CreditCard {
+	n := len(c.Number) - 4
+	if n < 0 {
+		n = len(c.Number)
+	}
+
+	c.Number = strings.Repeat("*", n) + c.Number[n:]
+	c.CVC = ""
+	return c
+}
+
+// Address is an entry of the address book of a customer, or a copy of one on an order.
 type Address struct {
 	ID int `json:"id"`
+	CustomerID int `json:"-"`
 	Country string `json:"country"`
 	State string `json:"state"`
 	City string `json:"city"`
 	PostalCode string `json:"postal_code"`
 	Address string `json:"address"`
+	// DefaultShipping and DefaultBilling mark the address orders are shipped and billed
+	// to. A customer has at most one default of each kind.
+	DefaultShipping bool `json:"default_shipping"`
+	DefaultBilling bool `json:"default_billing"`
+}
+
+// AddressValidator normalizes the fields of addresses and checks them against the
+// rules of their country.
+type AddressValidator interface {
+	// Validate normalizes a in place. It returns an Invalid error wrapping FieldErrors
+	// if fields of a are invalid.
+	Validate(a *Address) error
+}
+
+// Snapshot returns a copy of a that is not tied to an address book entry, so that it
+// outlives changes to and the deletion of the entry.
+func (a Address) Snapshot() Address {
+	return Address{Country: a.Country, State: a.State, City: a.City, PostalCode: a.PostalCode, Address: a.Address}
 }
 
+const (
+	OrderStatusPending = "pending"
+	// OrderStatusPartiallyShipped is the status of orders of which some but not all
+	// units have shipped.
+	OrderStatusPartiallyShipped = "partially_shipped"
+	OrderStatusShipped = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
+// ValidOrderStatus returns true if status is one of the known order statuses.
+func ValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+type CheckoutService interface {
+	// CartTotals returns the cart of a customer priced in currency with promotions
+	// and the tax of the customer's address applied.
+	CartTotals(custID int, currency string) (*CartTotals, error)
+	// ShippingOptions returns what shipping the cart of a customer to their address
+	// costs in currency with every available method, cheapest first.
+	ShippingOptions(custID int, currency string) ([]ShippingQuote, error)
+	Checkout(custID int, currency string, shippingMethodID int) (*Order, error)
+}
+
+// Order is a checked out cart. Prices are those at checkout time.
 type Order struct {
 	ID int `json:"id"`
-	Product Product `json:"product"`
-	ShippingAddressID int `json:"shipping_address_id"`
+	CustomerID int `json:"customer_id"`
+	// ShippingAddress is a snapshot of the address the order is shipped to.
+	ShippingAddress Address `json:"shipping_address"`
 	OrderedAt time.Time `json:"ordered_at"`
+	Status string `json:"status"`
+	Items []OrderItem `json:"items"`
+	Subtotal Money `json:"subtotal"`
+	Discount Money `json:"discount"`
+	Tax Money `json:"tax"`
+	TaxInclusive bool `json:"tax_inclusive"`
+	ShippingMethodID int `json:"shipping_method_id"`
+	// ShippingMethod is the name of the shipping method at checkout.
+	ShippingMethod string `json:"shipping_method"`
+	// ShippingCost is part of Total.
+	ShippingCost Money `json:"shipping_cost"`
+	Total Money `json:"total"`
+	FreeShipping bool `json:"free_shipping"`
+	// ExchangeRate is the rate the catalog prices were converted to the order currency
+	// with at checkout.
+	ExchangeRate string `json:"exchange_rate"`
+}
+
+type OrderItem struct {
+	ID int `json:"id"`
+	Product Product `json:"product"`
+	VariantID int `json:"variant_id,omitempty"`
 	Quantity int `json:"quantity"`
-	CustomerID int `json:"customer_id"`
+	UnitPrice Money `json:"unit_price"`
+	Discount Money `json:"discount"`
+	Tax Money `json:"tax"`
+	Taxes []TaxAmount `json:"taxes"`
 }
 
 type CartItem struct {
 	Product Product `json:"product"`
+	VariantID int `json:"variant_id,omitempty"`
 	Quantity int `json:"quantity"`
 }
+
+// UnitPrice returns the price of the selected variant if it has its own price
+// and the product price otherwise.
+func (c *CartItem) UnitPrice() Money {
+	if v := c.Product.Variant(c.VariantID); v != nil && v.Price != nil {
+		return v.Price.Current
+	}
+	return c.Product.Price.Current
+}
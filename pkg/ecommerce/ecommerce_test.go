@@ -0,0 +1,19 @@
+package ecommerce
+
+import "testing"
+
+func TestCreditCardMasked(t *testing.T) {
+	c := CreditCard{ID: 1, Name: "Ada", Number: "4242424242424242", CVC: "123"}
+
+	m := c.Masked()
+	if m.Number != "************4242" || m.CVC != "" || m.Name != "Ada" {
+		t.Fatalf("wanted the last four digits only and no cvc, got %+v", m)
+	}
+	if c.Number != "4242424242424242" {
+		t.Fatal("wanted the card itself unchanged")
+	}
+
+	if m = (CreditCard{Number: "42"}).Masked(); m.Number != "**" {
+		t.Fatalf("wanted a short number hidden completely, got %q", m.Number)
+	}
+}
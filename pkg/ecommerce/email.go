@@ -0,0 +1,115 @@
+package ecommerce
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Names of the email templates, see MailService.
+const (
+	EmailWelcome = "welcome"
+	EmailOrderConfirmation = "order_confirmation"
+	EmailShipping = "shipping"
+	EmailPasswordReset = "password_reset"
+	EmailVerification = "email_verification"
+	EmailReturnUpdate = "return_update"
+	EmailSubscriptionAlerts = "subscription_alerts"
+	EmailAccountDeletion = "account_deletion"
+)
+
+// Email delivers email messages, e.g. to an SMTP server.
+type Email interface {
+	Send(m *EmailMessage) error
+}
+
+// MailService sends transactional emails through an outbox: messages are rendered
+// from templates and saved in the same transaction as the change they are about,
+// and a background sender delivers them afterwards.
+type MailService interface {
+	// EnqueueWithTx renders the template with name for data and adds the message to
+	// the outbox as part of tx, the caller is responsible for committing or rolling
+	// back the transaction. data is the type of email the template is named for,
+	// e.g. WelcomeEmail for EmailWelcome.
+	EnqueueWithTx(tx *sql.Tx, to string, name string, data interface{}) error
+	// DeliverPending sends the messages in the outbox that are due and returns the
+	// number of messages sent. Messages that fail are retried later.
+	DeliverPending() (int, error)
+}
+
+type EmailMessage struct {
+	To string
+	Subject string
+	HTML string
+	Text string
+	// Headers are added to the standard headers of the message.
+	Headers map[string]string
+}
+
+// OutboxMessage is an email message waiting in the outbox. NextAttemptAt is nil once
+// the message is sent or has failed too often to be retried.
+type OutboxMessage struct {
+	ID int
+	Template string
+	Message EmailMessage
+	Attempts int
+	NextAttemptAt *time.Time
+	LastError string
+	CreatedAt time.Time
+	SentAt *time.Time
+}
+
+type WelcomeEmail struct {
+	Name string
+	// VerifyURL is the link to verify the email address with, valid for ValidFor.
+	VerifyURL string
+	ValidFor time.Duration
+}
+
+type EmailVerificationEmail struct {
+	Name string
+	VerifyURL string
+	ValidFor time.Duration
+}
+
+type OrderConfirmationEmail struct {
+	Name string
+	// Order has the names of its products set.
+	Order *Order
+}
+
+type ShippingEmail struct {
+	Name string
+	Shipment *Shipment
+}
+
+type PasswordResetEmail struct {
+	Name string
+	ResetURL string
+	// ValidFor is how long ResetURL works.
+	ValidFor time.Duration
+}
+
+type AccountDeletionEmail struct {
+	Name string
+	// DeleteAt is when the account is deleted unless the user logs in and cancels it.
+	DeleteAt time.Time
+}
+
+type ReturnUpdateEmail struct {
+	Name string
+	ReturnID int
+	Message string
+	// Note is what the admin wrote about the update, if anything.
+	Note string
+}
+
+type SubscriptionAlertsEmail struct {
+	Alerts []SubscriptionAlertLinks
+}
+
+// SubscriptionAlertLinks is an alert with the links of its email.
+type SubscriptionAlertLinks struct {
+	SubscriptionAlert
+	ProductURL string
+	UnsubscribeURL string
+}
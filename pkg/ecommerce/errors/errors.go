@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"time"
 )
 
 // SetMessage sets public message on error wrapper, this message is to be displayed to the client
@@ -127,3 +129,59 @@ func (e *NotFound) Cause() error {
 	return e.Err
 }
 
+
+// Invalid is returned when input fails domain validation. Unlike other errors,
+// the message of the wrapped error is meant to be displayed to the client.
+type Invalid struct {
+	Err     error
+}
+
+func (e *Invalid) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Invalid) Cause() error {
+	return e.Err
+}
+
+// RateLimited is returned when a client does something more often than allowed. The
+// message of the wrapped error is meant to be displayed to the client.
+type RateLimited struct {
+	Err error
+	// RetryAfter is how long the client has to wait before trying again.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimited) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimited) Cause() error {
+	return e.Err
+}
+
+// FieldErrors maps the fields of an input to why they are invalid. Wrapped in Invalid,
+// it is displayed to the client field by field.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var buf bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		_, _ = fmt.Fprintf(&buf, "%s: %s", f, e[f])
+	}
+
+	return buf.String()
+}
+
+func (e FieldErrors) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string(e))
+}
@@ -0,0 +1,94 @@
+package fulfilment
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"fmt"
+)
+
+// shippedQuantities returns the units of every order item in ss keyed by order item id.
+func shippedQuantities(ss []ecommerce.Shipment) map[int]int {
+	shipped := make(map[int]int)
+	for _, s := range ss {
+		for _, item := range s.Items {
+			shipped[item.OrderItemID] += item.Quantity
+		}
+	}
+	return shipped
+}
+
+// unshipped returns the units of the items of o that are not in shipped, in item order.
+func unshipped(o *ecommerce.Order, shipped map[int]int) []ecommerce.ShipmentItem {
+	var left []ecommerce.ShipmentItem
+	for _, item := range o.Items {
+		if n := item.Quantity - shipped[item.ID]; n > 0 {
+			left = append(left, ecommerce.ShipmentItem{OrderItemID: item.ID, Quantity: n})
+		}
+	}
+	return left
+}
+
+// shippable merges items by order item and checks that they are units of o that
+// have not shipped yet.
+func shippable(o *ecommerce.Order, shipped map[int]int, items []ecommerce.ShipmentItem) ([]ecommerce.ShipmentItem, error) {
+	if len(items) < 1 {
+		return nil, errors.New("a shipment needs at least one item")
+	}
+
+	left := make(map[int]int)
+	for _, item := range unshipped(o, shipped) {
+		left[item.OrderItemID] = item.Quantity
+	}
+
+	var merged []ecommerce.ShipmentItem
+	index := make(map[int]int)
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, errors.New("shipment item quantities must be at least 1")
+		}
+
+		i, ok := index[item.OrderItemID]
+		if !ok {
+			i = len(merged)
+			index[item.OrderItemID] = i
+			merged = append(merged, ecommerce.ShipmentItem{OrderItemID: item.OrderItemID})
+		}
+		merged[i].Quantity += item.Quantity
+	}
+
+	for _, item := range merged {
+		if !hasItem(o, item.OrderItemID) {
+			return nil, fmt.Errorf("order %d has no item %d", o.ID, item.OrderItemID)
+		} else if item.Quantity > left[item.OrderItemID] {
+			return nil, fmt.Errorf("only %d units of order item %d are left to ship", left[item.OrderItemID], item.OrderItemID)
+		}
+	}
+
+	return merged, nil
+}
+
+func hasItem(o *ecommerce.Order, itemID int) bool {
+	for _, item := range o.Items {
+		if item.ID == itemID {
+			return true
+		}
+	}
+	return false
+}
+
+// orderStatus returns the status of an order with status after shipments ss, of which
+// left are the units that have not shipped. Cancelled orders keep their status.
+func orderStatus(status string, left []ecommerce.ShipmentItem, ss []ecommerce.Shipment) string {
+	if status == ecommerce.OrderStatusCancelled || len(ss) < 1 {
+		return status
+	} else if len(left) > 0 {
+		return ecommerce.OrderStatusPartiallyShipped
+	}
+
+	for _, s := range ss {
+		if s.Status != ecommerce.ShipmentStatusDelivered {
+			return ecommerce.OrderStatusShipped
+		}
+	}
+	return ecommerce.OrderStatusDelivered
+}
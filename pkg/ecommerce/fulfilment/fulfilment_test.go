@@ -0,0 +1,107 @@
+package fulfilment
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"reflect"
+	"testing"
+)
+
+// testOrder has two units of item 10 and one unit of item 11.
+var testOrder = &ecommerce.Order{
+	ID: 1,
+	Items: []ecommerce.OrderItem{{ID: 10, Quantity: 2}, {ID: 11, Quantity: 1}},
+}
+
+func TestShippable(t *testing.T) {
+	tests := []struct {
+		name string
+		shipped map[int]int
+		items []ecommerce.ShipmentItem
+		want []ecommerce.ShipmentItem
+		ok bool
+	}{
+		{
+			name: "part of the order",
+			items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 1}},
+			want: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 1}},
+			ok: true,
+		},
+		{
+			name: "duplicates are merged",
+			items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 1}, {OrderItemID: 11, Quantity: 1}, {OrderItemID: 10, Quantity: 1}},
+			want: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 2}, {OrderItemID: 11, Quantity: 1}},
+			ok: true,
+		},
+		{
+			name: "rest of a partially shipped item",
+			shipped: map[int]int{10: 1},
+			items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 1}},
+			want: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 1}},
+			ok: true,
+		},
+		{
+			name: "more than is left",
+			shipped: map[int]int{10: 1},
+			items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 2}},
+		},
+		{
+			name: "item of another order",
+			items: []ecommerce.ShipmentItem{{OrderItemID: 12, Quantity: 1}},
+		},
+		{
+			name: "zero quantity",
+			items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 0}},
+		},
+		{
+			name: "no items",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shippable(testOrder, tt.shipped, tt.items)
+			if (err == nil) != tt.ok {
+				t.Fatalf("wanted ok %v, got error %v", tt.ok, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestOrderStatus(t *testing.T) {
+	shipped := ecommerce.Shipment{Status: ecommerce.ShipmentStatusShipped,
+		Items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 2}}}
+	delivered := ecommerce.Shipment{Status: ecommerce.ShipmentStatusDelivered,
+		Items: []ecommerce.ShipmentItem{{OrderItemID: 11, Quantity: 1}}}
+	partial := ecommerce.Shipment{Status: ecommerce.ShipmentStatusDelivered,
+		Items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 1}}}
+
+	tests := []struct {
+		name string
+		status string
+		ss []ecommerce.Shipment
+		want string
+	}{
+		{"no shipments", ecommerce.OrderStatusPending, nil, ecommerce.OrderStatusPending},
+		{"some units shipped", ecommerce.OrderStatusPending, []ecommerce.Shipment{partial}, ecommerce.OrderStatusPartiallyShipped},
+		{"all units shipped", ecommerce.OrderStatusPartiallyShipped, []ecommerce.Shipment{shipped, delivered}, ecommerce.OrderStatusShipped},
+		{"all shipments delivered", ecommerce.OrderStatusShipped, []ecommerce.Shipment{delivered, with(shipped, ecommerce.ShipmentStatusDelivered)}, ecommerce.OrderStatusDelivered},
+		{"cancelled", ecommerce.OrderStatusCancelled, []ecommerce.Shipment{partial}, ecommerce.OrderStatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := orderStatus(tt.status, unshipped(testOrder, shippedQuantities(tt.ss)), tt.ss)
+			if got != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func with(s ecommerce.Shipment, status string) ecommerce.Shipment {
+	s.Status = status
+	return s
+}
@@ -0,0 +1,247 @@
+package fulfilment
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type repository interface {
+	SaveShipmentWithTx(tx *sql.Tx, s *ecommerce.Shipment) (int, error)
+	UpdateShipmentStatusWithTx(tx *sql.Tx, s *ecommerce.Shipment) error
+	Shipment(id int) (*ecommerce.Shipment, error)
+	Shipments(orderID int) ([]ecommerce.Shipment, error)
+	ShipmentsWithTx(tx *sql.Tx, orderID int) ([]ecommerce.Shipment, error)
+	Tx() (*sql.Tx, error)
+}
+
+type orderRepo interface {
+	Order(id int) (*ecommerce.Order, error)
+	// OrderStatusWithTx returns the status of an order and locks it until tx ends.
+	OrderStatusWithTx(tx *sql.Tx, id int) (string, error)
+	UpdateOrderStatusWithTx(tx *sql.Tx, id int, status string) error
+}
+
+func New(
+	db *sql.DB,
+	repo repository,
+	orderRepo orderRepo,
+	userService ecommerce.UserService,
+	mailService ecommerce.MailService) *service {
+	return &service{db: db, r: repo, orderRepo: orderRepo, userService: userService, mailService: mailService}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	orderRepo orderRepo
+	userService ecommerce.UserService
+	mailService ecommerce.MailService
+}
+
+// CreateShipment records that the items of s left the warehouse, advances the status
+// of the order and emails the tracking details to the customer.
+func (s *service) CreateShipment(sh *ecommerce.Shipment) (int, error) {
+	const op = "fulfilmentService.CreateShipment"
+
+	if err := validateShipment(sh); err != nil {
+		return 0, errors2.Wrap(err, op, "validating shipment")
+	}
+
+	o, err := s.orderRepo.Order(sh.OrderID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting order")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	// the order is locked so that concurrent shipments cannot ship the same units
+	status, err := s.orderRepo.OrderStatusWithTx(tx, o.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "locking order")
+	} else if status == ecommerce.OrderStatusCancelled {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("cancelled orders cannot ship")}, op, "checking status")
+	}
+
+	ss, err := s.r.ShipmentsWithTx(tx, o.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "getting shipments")
+	}
+
+	sh.Items, err = shippable(o, shippedQuantities(ss), sh.Items)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(&errors2.Invalid{Err: err}, op, "checking items")
+	}
+	sh.Status = ecommerce.ShipmentStatusShipped
+	sh.ShippedAt = time.Now()
+	sh.DeliveredAt = nil
+
+	sh.ID, err = s.r.SaveShipmentWithTx(tx, sh)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving shipment")
+	}
+
+	err = s.advanceWithTx(tx, o, status, append(ss, *sh))
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "advancing order status")
+	}
+
+	// the customer may have deleted their account since they ordered
+	if o.CustomerID != 0 {
+		u, err := s.userService.User(o.CustomerID)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "getting customer")
+		}
+
+		err = s.mailService.EnqueueWithTx(tx, u.Email, ecommerce.EmailShipping, &ecommerce.ShippingEmail{Name: u.FirstName, Shipment: sh})
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "enqueueing shipping email")
+		}
+	}
+
+	return sh.ID, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// UpdateShipmentStatus marks a shipment of an order as delivered, or as shipped to
+// undo that, and advances the status of the order.
+func (s *service) UpdateShipmentStatus(orderID, id int, status string) error {
+	const op = "fulfilmentService.UpdateShipmentStatus"
+
+	if status != ecommerce.ShipmentStatusShipped && status != ecommerce.ShipmentStatusDelivered {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("status must be shipped or delivered")}, op, "validating status")
+	}
+
+	sh, err := s.r.Shipment(id)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting shipment")
+	} else if sh.OrderID != orderID {
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting shipment")
+	}
+
+	o, err := s.orderRepo.Order(orderID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting order")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	orderStatus, err := s.orderRepo.OrderStatusWithTx(tx, orderID)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "locking order")
+	}
+
+	sh.Status = status
+	sh.DeliveredAt = nil
+	if status == ecommerce.ShipmentStatusDelivered {
+		now := time.Now()
+		sh.DeliveredAt = &now
+	}
+	err = s.r.UpdateShipmentStatusWithTx(tx, sh)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating shipment")
+	}
+
+	ss, err := s.r.ShipmentsWithTx(tx, orderID)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "getting shipments")
+	}
+
+	err = s.advanceWithTx(tx, o, orderStatus, ss)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "advancing order status")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) Shipments(orderID int) ([]ecommerce.Shipment, error) {
+	const op = "fulfilmentService.Shipments"
+
+	if _, err := s.orderRepo.Order(orderID); err != nil {
+		return nil, errors2.Wrap(err, op, "getting order")
+	}
+
+	ss, err := s.r.Shipments(orderID)
+
+	return ss, errors2.Wrap(err, op, "getting shipments from repo")
+}
+
+func (s *service) Tracking(custID, orderID int) (*ecommerce.OrderTracking, error) {
+	const op = "fulfilmentService.Tracking"
+
+	o, err := s.orderRepo.Order(orderID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting order")
+	} else if o.CustomerID != custID {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting order")
+	}
+
+	ss, err := s.r.Shipments(orderID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting shipments from repo")
+	}
+
+	t := &ecommerce.OrderTracking{
+		OrderID: o.ID,
+		Status: o.Status,
+		Shipments: ss,
+		Unshipped: unshipped(o, shippedQuantities(ss)),
+	}
+	if t.Shipments == nil { t.Shipments = []ecommerce.Shipment{} }
+	if t.Unshipped == nil { t.Unshipped = []ecommerce.ShipmentItem{} }
+
+	return t, nil
+}
+
+// advanceWithTx sets the status of o, which is status, to the one that follows from ss.
+func (s *service) advanceWithTx(tx *sql.Tx, o *ecommerce.Order, status string, ss []ecommerce.Shipment) error {
+	next := orderStatus(status, unshipped(o, shippedQuantities(ss)), ss)
+	if next == status {
+		return nil
+	}
+
+	return s.orderRepo.UpdateOrderStatusWithTx(tx, o.ID, next)
+}
+
+func validateShipment(sh *ecommerce.Shipment) error {
+	sh.Carrier = strings.TrimSpace(sh.Carrier)
+	sh.TrackingNumber = strings.TrimSpace(sh.TrackingNumber)
+	sh.TrackingURL = strings.TrimSpace(sh.TrackingURL)
+
+	if sh.Carrier == "" || len(sh.Carrier) > 64 {
+		return &errors2.Invalid{Err: errors.New("carrier is required and must be at most 64 characters")}
+	} else if sh.TrackingNumber == "" || len(sh.TrackingNumber) > 64 {
+		return &errors2.Invalid{Err: errors.New("tracking number is required and must be at most 64 characters")}
+	}
+
+	if sh.TrackingURL != "" {
+		u, err := url.Parse(sh.TrackingURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(sh.TrackingURL) > 512 {
+			return &errors2.Invalid{Err: errors.New("tracking url must be an http or https url of at most 512 characters")}
+		}
+	}
+
+	return nil
+}
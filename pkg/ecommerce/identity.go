@@ -0,0 +1,50 @@
+package ecommerce
+
+import "time"
+
+// IdentityProvider is an external OpenID Connect provider users can log in with, using
+// the authorization code flow with PKCE.
+type IdentityProvider interface {
+	// AuthURL returns the URL of the provider to send the user to, with the PKCE
+	// challenge of codeVerifier. The provider sends them back to the redirect URL with a
+	// code and state.
+	AuthURL(state, nonce, codeVerifier string) (string, error)
+	// Exchange redeems code for the ID token of the user and returns its claims once the
+	// signature, issuer, audience, expiry and nonce of the token are verified.
+	Exchange(code, codeVerifier, nonce string) (*IdentityClaims, error)
+}
+
+// IdentityClaims are what an identity provider tells about a user.
+type IdentityClaims struct {
+	// Subject identifies the user at the provider, unlike their email it does not change.
+	Subject string
+	Email string
+	EmailVerified bool
+	GivenName string
+	FamilyName string
+}
+
+// Identity links a user to their account at an identity provider.
+type Identity struct {
+	ID int
+	UserID int
+	Provider string
+	Subject string
+	// Email is the address the provider had for the user when they were linked.
+	Email string
+	CreatedAt time.Time
+}
+
+// ExternalLoginValidFor is how long a user has to log in at an identity provider.
+const ExternalLoginValidFor = 10 * time.Minute
+
+// ExternalLogin is a login with an identity provider the user was sent to and did not
+// come back from yet. Only the SHA-256 hash of the state and the binding of the login
+// to the browser it was started in is stored.
+type ExternalLogin struct {
+	StateHash string
+	Provider string
+	Nonce string
+	CodeVerifier string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,141 @@
+package mail
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// batchSize is how many messages a delivery sends at most.
+	batchSize = 50
+	// maxAttempts is how often a message is tried before it is given up on.
+	maxAttempts = 8
+	// firstRetry is how long a message waits after its first failed attempt, the wait
+	// doubles with every further attempt up to maxRetry.
+	firstRetry = time.Minute
+	maxRetry = 6 * time.Hour
+)
+
+// tokenTemplates are the templates whose messages can carry single use tokens, e.g. links
+// to reset a password. Their bodies are cleared once they are sent or given up on, so that
+// the outbox does not keep usable tokens around.
+var tokenTemplates = map[string]bool{
+	ecommerce.EmailWelcome: true,
+	ecommerce.EmailVerification: true,
+	ecommerce.EmailPasswordReset: true,
+}
+
+type repository interface {
+	SaveMessageWithTx(tx *sql.Tx, m *ecommerce.OutboxMessage) (int, error)
+	// DueMessagesWithTx returns up to limit messages due at now and locks them until
+	// tx ends. Messages locked by other transactions are skipped.
+	DueMessagesWithTx(tx *sql.Tx, now time.Time, limit int) ([]ecommerce.OutboxMessage, error)
+	UpdateMessageWithTx(tx *sql.Tx, m *ecommerce.OutboxMessage) error
+	Tx() (*sql.Tx, error)
+}
+
+// New returns a mail service that delivers the messages of the outbox in repo with
+// email. The templates link to the shop with shopName at shopURL.
+func New(db *sql.DB, repo repository, email ecommerce.Email, shopName, shopURL string) *service {
+	t, err := parseTemplates(shopName, strings.TrimRight(shopURL, "/"))
+	if err != nil {
+		// the templates are embedded, so this is a programming error
+		panic(err)
+	}
+
+	return &service{db: db, r: repo, email: email, templates: t}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	email ecommerce.Email
+	templates *templates
+}
+
+func (s *service) EnqueueWithTx(tx *sql.Tx, to string, name string, data interface{}) error {
+	const op = "mailService.EnqueueWithTx"
+
+	if to == "" || strings.ContainsAny(to, "\r\n") {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("invalid recipient")}, op, "validating recipient")
+	}
+
+	msg, err := s.templates.render(to, name, data)
+	if err != nil {
+		return errors2.Wrap(err, op, "rendering template")
+	}
+
+	now := time.Now()
+	m := ecommerce.OutboxMessage{Template: name, Message: *msg, NextAttemptAt: &now, CreatedAt: now}
+	m.ID, err = s.r.SaveMessageWithTx(tx, &m)
+
+	return errors2.Wrap(err, op, "saving message")
+}
+
+// DeliverPending sends the due messages of the outbox. The messages are locked while
+// they are sent, so that concurrent deliveries do not send them twice. A message is
+// sent at least once: if the delivery fails after sending it and before committing,
+// it is sent again. Messages with tokens lose their bodies once they are done with.
+func (s *service) DeliverPending() (int, error) {
+	const op = "mailService.DeliverPending"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	now := time.Now()
+	mm, err := s.r.DueMessagesWithTx(tx, now, batchSize)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "getting due messages")
+	}
+
+	var sent int
+	for i := range mm {
+		m := &mm[i]
+		m.Attempts++
+		if err := s.email.Send(&m.Message); err != nil {
+			m.LastError = err.Error()
+			m.NextAttemptAt = nextAttempt(now, m.Attempts)
+		} else {
+			m.LastError = ""
+			m.NextAttemptAt = nil
+			m.SentAt = &now
+			sent++
+		}
+		if m.NextAttemptAt == nil && tokenTemplates[m.Template] {
+			m.Message.HTML, m.Message.Text = "", ""
+		}
+
+		if err = s.r.UpdateMessageWithTx(tx, m); err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "updating message")
+		}
+	}
+
+	return sent, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// nextAttempt returns when a message that failed at now for the attempts time is tried
+// again, or nil if it is not.
+func nextAttempt(now time.Time, attempts int) *time.Time {
+	if attempts >= maxAttempts {
+		return nil
+	}
+
+	wait := firstRetry
+	for i := 1; i < attempts && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	if wait > maxRetry {
+		wait = maxRetry
+	}
+
+	next := now.Add(wait)
+	return &next
+}
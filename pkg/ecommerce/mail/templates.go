@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"bytes"
+	"ecommerce/pkg/ecommerce"
+	"embed"
+	"fmt"
+	html "html/template"
+	"reflect"
+	"strings"
+	text "text/template"
+	"time"
+)
+
+//go:embed templates
+var files embed.FS
+
+// names are the templates there are files for: name.html with the "content" of the
+// HTML body, and name.txt with the text body and a "subject" definition.
+var names = []string{
+	ecommerce.EmailWelcome,
+	ecommerce.EmailOrderConfirmation,
+	ecommerce.EmailShipping,
+	ecommerce.EmailPasswordReset,
+	ecommerce.EmailVerification,
+	ecommerce.EmailReturnUpdate,
+	ecommerce.EmailSubscriptionAlerts,
+	ecommerce.EmailAccountDeletion,
+}
+
+// dataTypes are the types of data the templates are executed with, so that a message
+// is not rendered with data meant for another template.
+var dataTypes = map[string]interface{}{
+	ecommerce.EmailWelcome: &ecommerce.WelcomeEmail{},
+	ecommerce.EmailOrderConfirmation: &ecommerce.OrderConfirmationEmail{},
+	ecommerce.EmailShipping: &ecommerce.ShippingEmail{},
+	ecommerce.EmailPasswordReset: &ecommerce.PasswordResetEmail{},
+	ecommerce.EmailVerification: &ecommerce.EmailVerificationEmail{},
+	ecommerce.EmailReturnUpdate: &ecommerce.ReturnUpdateEmail{},
+	ecommerce.EmailSubscriptionAlerts: &ecommerce.SubscriptionAlertsEmail{},
+	ecommerce.EmailAccountDeletion: &ecommerce.AccountDeletionEmail{},
+}
+
+type templates struct {
+	html map[string]*html.Template
+	text map[string]*text.Template
+}
+
+// parseTemplates parses the embedded templates with the shop name and URL available
+// to them as the shopName and shopURL functions.
+func parseTemplates(shopName, shopURL string) (*templates, error) {
+	funcs := map[string]interface{}{
+		"shopName": func() string { return shopName },
+		"shopURL": func() string { return shopURL },
+		"money": func(m ecommerce.Money) string { return m.String() + " " + m.Currency },
+		"duration": duration,
+	}
+
+	t := &templates{html: map[string]*html.Template{}, text: map[string]*text.Template{}}
+	for _, name := range names {
+		h, err := html.New("layout.html").Funcs(funcs).ParseFS(files, "templates/layout.html", "templates/" + name + ".html")
+		if err != nil {
+			return nil, err
+		}
+		t.html[name] = h
+
+		txt, err := text.New(name + ".txt").Funcs(funcs).ParseFS(files, "templates/" + name + ".txt")
+		if err != nil {
+			return nil, err
+		}
+		t.text[name] = txt
+	}
+
+	return t, nil
+}
+
+// render returns the message of the template with name for data, addressed to to.
+func (t *templates) render(to, name string, data interface{}) (*ecommerce.EmailMessage, error) {
+	h, ok := t.html[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	if want := reflect.TypeOf(dataTypes[name]); reflect.TypeOf(data) != want {
+		return nil, fmt.Errorf("email template %q needs %s data, got %T", name, want, data)
+	}
+
+	var subject, body, htmlBody bytes.Buffer
+	if err := t.text[name].ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := t.text[name].Execute(&body, data); err != nil {
+		return nil, err
+	}
+	if err := h.Execute(&htmlBody, data); err != nil {
+		return nil, err
+	}
+
+	return &ecommerce.EmailMessage{
+		To: to,
+		// the subject goes into a header line
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		HTML: htmlBody.String(),
+		Text: strings.TrimSpace(body.String()) + "\n",
+		Headers: map[string]string{"Auto-Submitted": "auto-generated"},
+	}, nil
+}
+
+// duration returns d in words rounded down to hours or minutes, e.g. "2 hours".
+func duration(d time.Duration) string {
+	n, unit := int(d / time.Minute), "minute"
+	if d >= time.Hour {
+		n, unit = int(d / time.Hour), "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+
+	return fmt.Sprintf("%d %s", n, unit)
+}
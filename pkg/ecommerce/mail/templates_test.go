@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	tt, err := parseTemplates("Shop", "https://shop.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usd := func(amount int64) ecommerce.Money {
+		return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+	}
+	order := &ecommerce.Order{ID: 7, Items: []ecommerce.OrderItem{
+		{Product: ecommerce.Product{Name: "Mug"}, Quantity: 2, UnitPrice: usd(1250)},
+	}, ShippingCost: usd(500), Tax: usd(0), Discount: usd(0), Total: usd(3000)}
+
+	tests := []struct {
+		name string
+		data interface{}
+		subject string
+		contains []string
+	}{
+		{ecommerce.EmailWelcome, &ecommerce.WelcomeEmail{Name: "Ada"}, "Welcome to Shop", []string{"Hi Ada", "https://shop.example"}},
+		{ecommerce.EmailOrderConfirmation, &ecommerce.OrderConfirmationEmail{Name: "Ada", Order: order}, "Your order #7",
+			[]string{"Mug", "12.50 USD", "30.00 USD"}},
+		{ecommerce.EmailShipping, &ecommerce.ShippingEmail{Name: "Ada", Shipment: &ecommerce.Shipment{OrderID: 7,
+			Carrier: "DHL", TrackingNumber: "123"}}, "Your order #7 has shipped", []string{"DHL", "123"}},
+		{ecommerce.EmailPasswordReset, &ecommerce.PasswordResetEmail{Name: "Ada", ResetURL: "https://shop.example/reset?t=1",
+			ValidFor: time.Hour}, "Reset your Shop password", []string{"1 hour", "https://shop.example/reset"}},
+		{ecommerce.EmailVerification, &ecommerce.EmailVerificationEmail{Name: "Ada", VerifyURL: "https://shop.example/verify-email?t=1",
+			ValidFor: 48 * time.Hour}, "Verify your email address", []string{"48 hours", "https://shop.example/verify-email"}},
+		{ecommerce.EmailReturnUpdate, &ecommerce.ReturnUpdateEmail{Name: "Ada", ReturnID: 3, Message: "It was approved."},
+			"Your return #3", []string{"It was approved."}},
+		{ecommerce.EmailSubscriptionAlerts, &ecommerce.SubscriptionAlertsEmail{Alerts: []ecommerce.SubscriptionAlertLinks{{
+			SubscriptionAlert: ecommerce.SubscriptionAlert{Type: ecommerce.SubscriptionPriceDrop, ProductName: "Mug", Price: usd(900)},
+			UnsubscribeURL: "https://shop.example/unsubscribe"}}}, "Products you are watching", []string{"Mug", "dropped to 9.00 USD", "https://shop.example/unsubscribe"}},
+		{ecommerce.EmailAccountDeletion, &ecommerce.AccountDeletionEmail{Name: "Ada", DeleteAt: time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)},
+			"Your Shop account will be deleted", []string{"4 March 2021", "https://shop.example"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := tt.render("ada@example.com", test.name, test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.To != "ada@example.com" || m.Subject != test.subject {
+				t.Fatalf("wanted subject %q, got %q", test.subject, m.Subject)
+			}
+			for _, s := range test.contains {
+				if !strings.Contains(m.Text, s) {
+					t.Errorf("wanted text body to contain %q, got %q", s, m.Text)
+				}
+				if !strings.Contains(m.HTML, s) {
+					t.Errorf("wanted html body to contain %q, got %q", s, m.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	tt, err := parseTemplates("Shop", "https://shop.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := tt.render("ada@example.com", ecommerce.EmailWelcome, &ecommerce.WelcomeEmail{Name: "<b>Ada</b>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(m.HTML, "<b>Ada</b>") || !strings.Contains(m.Text, "<b>Ada</b>") {
+		t.Fatalf("wanted the name escaped in the html body only, got %q and %q", m.HTML, m.Text)
+	}
+}
+
+func TestRenderChecksData(t *testing.T) {
+	tt, err := parseTemplates("Shop", "https://shop.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = tt.render("ada@example.com", ecommerce.EmailWelcome, &ecommerce.ShippingEmail{}); err == nil {
+		t.Fatal("wanted an error rendering a template with data of another template")
+	}
+	if _, err = tt.render("ada@example.com", "unknown", &ecommerce.WelcomeEmail{}); err == nil {
+		t.Fatal("wanted an error rendering an unknown template")
+	}
+}
+
+func TestNextAttempt(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		attempts int
+		want time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{maxAttempts - 1, 64 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		next := nextAttempt(now, tt.attempts)
+		if next == nil || next.Sub(now) != tt.want {
+			t.Fatalf("attempt %d: wanted retry in %v, got %v", tt.attempts, tt.want, next)
+		}
+	}
+
+	if next := nextAttempt(now, maxAttempts); next != nil {
+		t.Fatalf("wanted no retry after %d attempts, got %v", maxAttempts, next)
+	}
+}
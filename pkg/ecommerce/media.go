@@ -0,0 +1,38 @@
+package ecommerce
+
+import "io"
+
+const (
+	RenditionOriginal = "original"
+	RenditionThumbnail = "thumbnail"
+	RenditionMedium = "medium"
+	RenditionLarge = "large"
+)
+
+// BlobStore stores binary objects such as images under slash separated keys.
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	// URL returns the public URL the object stored under key is served from.
+	URL(key string) string
+}
+
+type MediaService interface {
+	UploadProductImage(productID int, r io.Reader) (*ProductImage, error)
+	DeleteProductImage(productID, imageID int) error
+	ReorderProductImages(productID int, imageIDs []int) error
+	Blob(key string) (io.ReadCloser, error)
+}
+
+// ProductImage is an image of a product along with its resized renditions.
+// Keys holds the blob store key of every rendition, URLs the public URL
+// derived from it.
+type ProductImage struct {
+	ID int `json:"id"`
+	ProductID int `json:"product_id"`
+	Position int `json:"position"`
+	ContentType string `json:"content_type"`
+	URLs map[string]string `json:"urls"`
+	Keys map[string]string `json:"-"`
+}
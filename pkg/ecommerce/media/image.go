@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bytes"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	// MaxImageSize is the largest image upload accepted in bytes.
+	MaxImageSize = 10 << 20
+	// maxImagePixels guards against small files that decode into huge images.
+	maxImagePixels = 50000000
+)
+
+// renditions maps every generated rendition to the length of its longest side.
+var renditions = map[string]int{
+	ecommerce.RenditionThumbnail: 150,
+	ecommerce.RenditionMedium:    600,
+	ecommerce.RenditionLarge:     1200,
+}
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// processedImage holds the original upload and its encoded renditions keyed by rendition name.
+type processedImage struct {
+	contentType string
+	files       map[string][]byte
+	exts        map[string]string
+}
+
+// processImage reads an image of at most MaxImageSize bytes from r, detects its
+// type from its content and generates all renditions. Renditions of JPEG images
+// are JPEG encoded, any other type is PNG encoded.
+func processImage(r io.Reader) (*processedImage, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(data) > MaxImageSize {
+		return nil, &errors2.Invalid{Err: fmt.Errorf("image must not be larger than %dMB", MaxImageSize>>20)}
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return nil, &errors2.Invalid{Err: errors.New("image must be a JPEG, PNG or GIF file")}
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &errors2.Invalid{Err: errors.New("image could not be decoded")}
+	} else if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, &errors2.Invalid{Err: errors.New("image dimensions are too large")}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &errors2.Invalid{Err: errors.New("image could not be decoded")}
+	}
+
+	p := &processedImage{
+		contentType: contentType,
+		files:       map[string][]byte{ecommerce.RenditionOriginal: data},
+		exts:        map[string]string{ecommerce.RenditionOriginal: ext},
+	}
+
+	// the renditions are all made from the same copy, which can be hundreds of megabytes
+	src := toRGBA(img)
+	for name, size := range renditions {
+		var buf bytes.Buffer
+		resized := resize(src, size)
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+			p.exts[name] = "jpg"
+		} else {
+			err = png.Encode(&buf, resized)
+			p.exts[name] = "png"
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.files[name] = buf.Bytes()
+	}
+
+	return p, nil
+}
+
+// toRGBA returns img as an RGBA image with its origin at 0,0, which is img itself
+// if it already is one.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	return rgba
+}
+
+// resize scales src, see toRGBA, down so that its longest side is at most maxSize
+// pixels, preserving the aspect ratio. Every destination pixel is the average of the
+// source pixels it covers. Images that are already small enough are returned as is.
+func resize(src *image.RGBA, maxSize int) image.Image {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if w <= maxSize && h <= maxSize {
+		return src
+	}
+
+	dw, dh := maxSize, h*maxSize/w
+	if h > w {
+		dw, dh = w*maxSize/h, maxSize
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := y*h/dh, (y+1)*h/dh
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+
+		for x := 0; x < dw; x++ {
+			sx0, sx1 := x*w/dw, (x+1)*w/dw
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var sum [4]int
+			for sy := sy0; sy < sy1; sy++ {
+				off := sy*src.Stride + sx0*4
+				for sx := sx0; sx < sx1; sx++ {
+					sum[0] += int(src.Pix[off])
+					sum[1] += int(src.Pix[off+1])
+					sum[2] += int(src.Pix[off+2])
+					sum[3] += int(src.Pix[off+3])
+					off += 4
+				}
+			}
+
+			n := (sy1 - sy0) * (sx1 - sx0)
+			off := y*dst.Stride + x*4
+			for i := 0; i < 4; i++ {
+				dst.Pix[off+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+
+	return dst
+}
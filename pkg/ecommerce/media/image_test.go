@@ -0,0 +1,138 @@
+package media
+
+import (
+	"bytes"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct{
+		name    string
+		width   int
+		height  int
+		maxSize int
+		wantW   int
+		wantH   int
+	} {
+		{
+			name: "landscape",
+			width: 400,
+			height: 200,
+			maxSize: 100,
+			wantW: 100,
+			wantH: 50,
+		},
+		{
+			name: "portrait",
+			width: 200,
+			height: 400,
+			maxSize: 100,
+			wantW: 50,
+			wantH: 100,
+		},
+		{
+			name: "smaller than max size is not enlarged",
+			width: 80,
+			height: 60,
+			maxSize: 100,
+			wantW: 80,
+			wantH: 60,
+		},
+		{
+			name: "very thin image keeps at least one pixel",
+			width: 1000,
+			height: 2,
+			maxSize: 100,
+			wantW: 100,
+			wantH: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resize(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), tt.maxSize).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Fatalf("wanted %dx%d, got %dx%d", tt.wantW, tt.wantH, got.Dx(), got.Dy())
+			}
+		})
+	}
+}
+
+func TestResizeAveragesPixels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{R: 255, A: 255})
+	img.Set(0, 1, color.RGBA{A: 255})
+	img.Set(1, 1, color.RGBA{A: 255})
+
+	got := resize(img, 1).(*image.RGBA).RGBAAt(0, 0)
+	want := color.RGBA{R: 127, A: 255}
+	if got != want {
+		t.Fatalf("wanted %v, got %v", want, got)
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1600, 800))); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := processImage(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p.contentType != "image/png" {
+		t.Fatalf("wanted content type image/png, got %s", p.contentType)
+	}
+
+	for name, size := range renditions {
+		img, err := png.Decode(bytes.NewReader(p.files[name]))
+		if err != nil {
+			t.Fatalf("decoding %s: %v", name, err)
+		}
+		if img.Bounds().Dx() != size {
+			t.Fatalf("wanted %s width %d, got %d", name, size, img.Bounds().Dx())
+		}
+	}
+
+	if _, ok := p.files[ecommerce.RenditionOriginal]; !ok {
+		t.Fatal("original is missing")
+	}
+}
+
+func TestProcessImageRejectsNonImages(t *testing.T) {
+	_, err := processImage(strings.NewReader("<html><body>not an image</body></html>"))
+	if _, ok := err.(*errors2.Invalid); !ok {
+		t.Fatalf("wanted *errors.Invalid, got %v", err)
+	}
+}
+
+func TestToRGBA(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	if toRGBA(rgba) != rgba {
+		t.Fatal("wanted an RGBA image used as it is")
+	}
+
+	gray := image.NewGray(image.Rect(5, 5, 7, 8))
+	gray.Set(5, 5, color.Gray{Y: 200})
+	got := toRGBA(gray)
+	if got.Rect != image.Rect(0, 0, 2, 3) {
+		t.Fatalf("wanted the image moved to the origin, got %v", got.Rect)
+	}
+	if c := got.RGBAAt(0, 0); c != (color.RGBA{R: 200, G: 200, B: 200, A: 255}) {
+		t.Fatalf("wanted the pixels copied, got %v", c)
+	}
+
+	sub := rgba.SubImage(image.Rect(1, 1, 2, 2)).(*image.RGBA)
+	if got := toRGBA(sub); got == sub || got.Rect != image.Rect(0, 0, 1, 1) {
+		t.Fatalf("wanted an image off the origin copied, got %v", got.Rect)
+	}
+}
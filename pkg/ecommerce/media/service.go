@@ -0,0 +1,194 @@
+package media
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/slice"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type repository interface {
+	SaveProductImageWithTx(tx *sql.Tx, img *ecommerce.ProductImage) (int, error)
+	ProductImages(productID int) ([]ecommerce.ProductImage, error)
+	DeleteProductImage(productID, imageID int) error
+	UpdateImagePositionsWithTx(tx *sql.Tx, productID int, imageIDs []int) error
+	Tx() (*sql.Tx, error)
+}
+
+func New(db *sql.DB, repo repository, blobStore ecommerce.BlobStore, productService ecommerce.ProductService) *service {
+	return &service{db: db, r: repo, blobStore: blobStore, productService: productService}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	blobStore ecommerce.BlobStore
+	productService ecommerce.ProductService
+}
+
+func (s *service) UploadProductImage(productID int, r io.Reader) (*ecommerce.ProductImage, error) {
+	const op = "mediaService.UploadProductImage"
+
+	if _, err := s.productService.Product(productID); err != nil {
+		return nil, errors2.Wrap(err, op, "getting product")
+	}
+
+	p, err := processImage(r)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "processing image")
+	}
+
+	prefix, err := randomHex(16)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "generating key prefix")
+	}
+
+	img := &ecommerce.ProductImage{
+		ProductID:   productID,
+		ContentType: p.contentType,
+		Keys:        make(map[string]string),
+	}
+
+	for name, data := range p.files {
+		key := fmt.Sprintf("products/%d/%s-%s.%s", productID, prefix, name, p.exts[name])
+		if err := s.blobStore.Put(key, bytes.NewReader(data)); err != nil {
+			s.deleteBlobs(img.Keys)
+			return nil, errors2.Wrap(err, op, "storing rendition " + name)
+		}
+		img.Keys[name] = key
+	}
+
+	existing, err := s.r.ProductImages(productID)
+	if err != nil {
+		s.deleteBlobs(img.Keys)
+		return nil, errors2.Wrap(err, op, "getting product images")
+	}
+	img.Position = len(existing)
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		s.deleteBlobs(img.Keys)
+		return nil, errors2.Wrap(err, op, "getting tx")
+	}
+
+	img.ID, err = s.r.SaveProductImageWithTx(tx, img)
+	if err != nil {
+		_ = tx.Rollback()
+		s.deleteBlobs(img.Keys)
+		return nil, errors2.Wrap(err, op, "saving image")
+	}
+
+	if err = tx.Commit(); err != nil {
+		s.deleteBlobs(img.Keys)
+		return nil, errors2.Wrap(err, op, "committing tx")
+	}
+
+	img.URLs = ImageURLs(s.blobStore, img.Keys)
+
+	return img, nil
+}
+
+func (s *service) DeleteProductImage(productID, imageID int) error {
+	const op = "mediaService.DeleteProductImage"
+
+	ii, err := s.r.ProductImages(productID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting product images")
+	}
+
+	var img *ecommerce.ProductImage
+	for i := range ii {
+		if ii[i].ID == imageID {
+			img = &ii[i]
+		}
+	}
+	if img == nil {
+		return errors2.Wrap(&errors2.NotFound{Err: errors.New("image not found")}, op, "finding image")
+	}
+
+	err = s.r.DeleteProductImage(productID, imageID)
+	if err != nil {
+		return errors2.Wrap(err, op, "deleting image via repo")
+	}
+
+	return errors2.Wrap(s.deleteBlobs(img.Keys), op, "deleting image files")
+}
+
+// ReorderProductImages sets the position of every image of a product to its
+// index in imageIDs, which must contain the ids of all images of the product.
+func (s *service) ReorderProductImages(productID int, imageIDs []int) error {
+	const op = "mediaService.ReorderProductImages"
+
+	ii, err := s.r.ProductImages(productID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting product images")
+	}
+
+	if len(ii) != len(imageIDs) || !slice.IsUniqueIntSlice(imageIDs) {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("image ids must list every product image once")}, op, "validating image ids")
+	}
+
+	for _, img := range ii {
+		if !slice.IntSliceContainsIntValue(imageIDs, img.ID) {
+			return errors2.Wrap(&errors2.Invalid{Err: fmt.Errorf("image %d is missing", img.ID)}, op, "validating image ids")
+		}
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	err = s.r.UpdateImagePositionsWithTx(tx, productID, imageIDs)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating positions")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) Blob(key string) (io.ReadCloser, error) {
+	const op = "mediaService.Blob"
+
+	rc, err := s.blobStore.Get(key)
+
+	return rc, errors2.Wrap(err, op, "getting blob")
+}
+
+// deleteBlobs removes every key from the blob store and returns the last error encountered.
+func (s *service) deleteBlobs(keys map[string]string) error {
+	var err error
+	for _, key := range keys {
+		if e := s.blobStore.Delete(key); e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// ImageURLs maps rendition keys to the URLs they are served from.
+func ImageURLs(blobStore ecommerce.BlobStore, keys map[string]string) map[string]string {
+	urls := make(map[string]string, len(keys))
+	for name, key := range keys {
+		urls[name] = blobStore.URL(key)
+	}
+
+	return urls
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
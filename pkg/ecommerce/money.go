@@ -0,0 +1,285 @@
+package ecommerce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of the catalog and of amounts sent without a currency.
+const DefaultCurrency = "USD"
+
+// currencyDecimals holds the number of minor unit digits of the supported ISO 4217 currencies.
+var currencyDecimals = map[string]int{
+	"AUD": 2, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "DKK": 2, "EUR": 2, "GBP": 2, "GHS": 2, "INR": 2,
+	"KES": 2, "MXN": 2, "NGN": 2, "NOK": 2, "PLN": 2, "SEK": 2, "USD": 2, "ZAR": 2,
+	"JPY": 0, "KRW": 0,
+	"BHD": 3, "JOD": 3, "KWD": 3,
+}
+
+// CurrencyDecimals returns the number of minor unit digits of currency, e.g. 2 for USD
+// and 0 for JPY, and false if the currency is not supported.
+func CurrencyDecimals(currency string) (int, bool) {
+	d, ok := currencyDecimals[currency]
+	return d, ok
+}
+
+// ValidCurrency returns true if currency is a supported ISO 4217 code.
+func ValidCurrency(currency string) bool {
+	_, ok := currencyDecimals[currency]
+	return ok
+}
+
+// Money is an exact amount in the minor unit of its currency, e.g. cents. The zero
+// value is zero in no particular currency and can be added to any amount.
+//
+// Results of multiplying or dividing amounts are rounded half away from zero to the
+// minor unit. Amounts that have to add up exactly, like a discount spread over cart
+// lines, are split with Allocate.
+//
+// In JSON it is an object with the amount as a decimal string, e.g.
+// {"amount": "19.99", "currency": "USD"}. When decoding, the amount may also be a
+// number and the object may be replaced by the bare amount, with the currency
+// defaulting to DefaultCurrency.
+type Money struct {
+	Amount int64
+	Currency string
+}
+
+// MoneyError is returned for amounts that cannot be parsed.
+type MoneyError struct {
+	msg string
+}
+
+func (e *MoneyError) Error() string {
+	return e.msg
+}
+
+func moneyErrorf(format string, a ...interface{}) error {
+	return &MoneyError{msg: fmt.Sprintf(format, a...)}
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal amount like "19.99" in currency. It fails if the
+// amount has more decimals than the currency has minor unit digits.
+func ParseMoney(s string, currency string) (Money, error) {
+	decimals, ok := CurrencyDecimals(currency)
+	if !ok {
+		return Money{}, moneyErrorf("unsupported currency %q", currency)
+	}
+
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return Money{}, moneyErrorf("invalid amount %q", s)
+	} else if len(frac) > decimals {
+		return Money{}, moneyErrorf("amount %q has more than %d decimals", s, decimals)
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return Money{}, moneyErrorf("invalid amount %q", s)
+		}
+	}
+
+	amount, err := strconv.ParseInt(whole+frac+strings.Repeat("0", decimals-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, moneyErrorf("amount %q is out of range", s)
+	}
+
+	if neg {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// String returns the amount as a decimal, e.g. "19.99".
+func (m Money) String() string {
+	decimals, ok := CurrencyDecimals(m.Currency)
+	if !ok {
+		decimals = 2
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	s := strconv.FormatInt(amount, 10)
+	if decimals == 0 {
+		return sign + s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+
+	return sign + s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Cmp compares m and o and returns -1, 0 or +1. It panics if the currencies differ.
+func (m Money) Cmp(o Money) int {
+	m.currency(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Add returns m + o. It panics if the currencies differ.
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currency(o)}
+}
+
+// Sub returns m - o. It panics if the currencies differ.
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currency(o)}
+}
+
+// Mul returns m multiplied by n, e.g. a unit price by a quantity.
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// MulFrac returns m * num / den rounded half away from zero. den must be positive. Percentages are
+// applied in basis points, e.g. 12.5% is m.MulFrac(1250, 10000).
+func (m Money) MulFrac(num, den int64) Money {
+	return Money{Amount: divRound(m.Amount*num, den), Currency: m.Currency}
+}
+
+// Allocate splits m into parts proportional to weights that add up to exactly m.
+// Units lost to rounding go to the parts with the largest remainders, earlier parts
+// first on ties. All parts are zero if the weights add up to zero.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	var total int64
+	for i, w := range weights {
+		parts[i].Currency = m.Currency
+		total += w
+	}
+	if total <= 0 {
+		return parts
+	}
+
+	remainders := make([]int64, len(weights))
+	left := m.Amount
+	for i, w := range weights {
+		parts[i].Amount = m.Amount * w / total
+		remainders[i] = m.Amount * w % total
+		left -= parts[i].Amount
+	}
+
+	for left > 0 {
+		best := -1
+		for i, r := range remainders {
+			if r > 0 && (best < 0 || r > remainders[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best].Amount++
+		remainders[best] = 0
+		left--
+	}
+
+	return parts
+}
+
+// currency returns the currency of m and o, which may only differ if one of them
+// is the zero value.
+func (m Money) currency(o Money) string {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency
+	case m.Currency == "" && m.Amount == 0:
+		return o.Currency
+	case o.Currency == "" && o.Amount == 0:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("mixing currencies %s and %s", m.Currency, o.Currency))
+}
+
+// divRound returns a / b rounded half away from zero. b must be positive.
+func divRound(a, b int64) int64 {
+	q, r := a/b, a%b
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	return json.Marshal(struct {
+		Amount string `json:"amount"`
+		Currency string `json:"currency"`
+	}{Amount: Money{Amount: m.Amount, Currency: currency}.String(), Currency: currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var v struct {
+		Amount json.RawMessage `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	if len(data) > 0 && data[0] == '{' {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+	} else {
+		v.Amount = data
+	}
+
+	if v.Currency == "" {
+		v.Currency = DefaultCurrency
+	}
+
+	amount := strings.Trim(string(v.Amount), `"`)
+	if amount == "" {
+		return moneyErrorf("amount is required")
+	}
+
+	parsed, err := ParseMoney(amount, strings.ToUpper(v.Currency))
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,146 @@
+package ecommerce
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		s string
+		currency string
+		want Money
+		wantErr bool
+	}{
+		{s: "19.99", currency: "USD", want: Money{Amount: 1999, Currency: "USD"}},
+		{s: "19.9", currency: "USD", want: Money{Amount: 1990, Currency: "USD"}},
+		{s: "19", currency: "USD", want: Money{Amount: 1900, Currency: "USD"}},
+		{s: ".5", currency: "USD", want: Money{Amount: 50, Currency: "USD"}},
+		{s: "-0.01", currency: "USD", want: Money{Amount: -1, Currency: "USD"}},
+		{s: "1500", currency: "JPY", want: Money{Amount: 1500, Currency: "JPY"}},
+		{s: "1.234", currency: "KWD", want: Money{Amount: 1234, Currency: "KWD"}},
+		{s: "19.999", currency: "USD", wantErr: true},
+		{s: "1.5", currency: "JPY", wantErr: true},
+		{s: "1e3", currency: "USD", wantErr: true},
+		{s: ".", currency: "USD", wantErr: true},
+		{s: "1", currency: "XXX", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.s, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m Money
+		want string
+	}{
+		{m: Money{Amount: 1999, Currency: "USD"}, want: "19.99"},
+		{m: Money{Amount: 5, Currency: "USD"}, want: "0.05"},
+		{m: Money{Amount: -150, Currency: "EUR"}, want: "-1.50"},
+		{m: Money{Amount: 1500, Currency: "JPY"}, want: "1500"},
+		{m: Money{Amount: 1, Currency: "KWD"}, want: "0.001"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.m.String(); got != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMoneyMulFrac(t *testing.T) {
+	tests := []struct {
+		name string
+		amount, num, den int64
+		want int64
+	}{
+		{name: "exact", amount: 1000, num: 1, den: 10, want: 100},
+		{name: "half rounds up", amount: 5, num: 1, den: 2, want: 3},
+		{name: "below half rounds down", amount: 1001, num: 1250, den: 10000, want: 125},
+		{name: "negative half rounds away from zero", amount: -5, num: 1, den: 2, want: -3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewMoney(tt.amount, "USD").MulFrac(tt.num, tt.den)
+			if got.Amount != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got.Amount)
+			}
+		})
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	tests := []struct {
+		name string
+		amount int64
+		weights []int64
+		want []int64
+	}{
+		{name: "even", amount: 100, weights: []int64{1, 1}, want: []int64{50, 50}},
+		{name: "remainder to earliest on ties", amount: 100, weights: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "remainder to largest remainder", amount: 10, weights: []int64{1, 2}, want: []int64{3, 7}},
+		{name: "zero weights", amount: 10, weights: []int64{0, 0}, want: []int64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int64
+			for _, p := range NewMoney(tt.amount, "USD").Allocate(tt.weights) {
+				got = append(got, p.Amount)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(NewMoney(1999, "USD"))
+	if err != nil {
+		t.Fatalf("wanted no error, got %v", err)
+	}
+	if want := `{"amount":"19.99","currency":"USD"}`; string(b) != want {
+		t.Fatalf("wanted %v, got %v", want, string(b))
+	}
+
+	tests := []struct {
+		data string
+		want Money
+		wantErr bool
+	}{
+		{data: `{"amount":"19.99","currency":"USD"}`, want: Money{Amount: 1999, Currency: "USD"}},
+		{data: `{"amount":19.99,"currency":"eur"}`, want: Money{Amount: 1999, Currency: "EUR"}},
+		{data: `"5"`, want: Money{Amount: 500, Currency: DefaultCurrency}},
+		{data: `5.25`, want: Money{Amount: 525, Currency: DefaultCurrency}},
+		{data: `{"amount":"0.001"}`, wantErr: true},
+		{data: `{"currency":"USD"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
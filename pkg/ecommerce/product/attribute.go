@@ -0,0 +1,213 @@
+package product
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/slice"
+	errors2 "errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var attributeCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// CreateAttributeDefinition defines an attribute for a category and its descendants.
+// The code must not already be defined for an ancestor or descendant category.
+func (s *service) CreateAttributeDefinition(d *ecommerce.AttributeDefinition) (int, error) {
+	const op = "productService.CreateAttributeDefinition"
+
+	d.Name = strings.TrimSpace(d.Name)
+	if !attributeCodePattern.MatchString(d.Code) {
+		return 0, errors.Wrap(&errors.Invalid{Err: errors2.New("attribute code must be lower case letters, digits or underscores")}, op, "validating definition")
+	} else if d.Name == "" {
+		return 0, errors.Wrap(&errors.Invalid{Err: errors2.New("attribute name is required")}, op, "validating definition")
+	}
+
+	switch d.Type {
+	case ecommerce.AttributeTypeString, ecommerce.AttributeTypeNumber, ecommerce.AttributeTypeBoolean:
+	default:
+		return 0, errors.Wrap(&errors.Invalid{Err: fmt.Errorf("unknown attribute type %q", d.Type)}, op, "validating definition")
+	}
+
+	categories, err := s.r.AllCategories()
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting categories")
+	} else if findCategory(categories, d.CategoryID) == nil {
+		return 0, errors.Wrap(&errors.Invalid{Err: errors2.New("category does not exist")}, op, "checking category")
+	}
+
+	defs, err := s.r.AllAttributeDefinitions()
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting definitions")
+	}
+
+	related := append(ancestorIDs(categories, d.CategoryID), subtreeIDs(categories, d.CategoryID)...)
+	for _, other := range defs {
+		if other.Code == d.Code && slice.IntSliceContainsIntValue(related, other.CategoryID) {
+			return 0, errors.Wrap(&errors.Invalid{Err: fmt.Errorf("attribute %s is already defined for a related category", d.Code)}, op, "checking code")
+		}
+	}
+
+	id, err := s.r.CreateAttributeDefinition(d)
+
+	return id, errors.Wrap(err, op, "saving definition")
+}
+
+// AttributeDefinitions returns the attributes defined for categoryID and all of its ancestors.
+func (s *service) AttributeDefinitions(categoryID int) ([]ecommerce.AttributeDefinition, error) {
+	const op = "productService.AttributeDefinitions"
+
+	categories, err := s.r.AllCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting categories")
+	}
+
+	defs, err := s.r.AllAttributeDefinitions()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting definitions")
+	}
+
+	ids := ancestorIDs(categories, categoryID)
+	var dd []ecommerce.AttributeDefinition
+	for _, d := range defs {
+		if slice.IntSliceContainsIntValue(ids, d.CategoryID) {
+			dd = append(dd, d)
+		}
+	}
+
+	return dd, nil
+}
+
+// ProductFacets returns value counts of the filterable attributes that apply to the
+// products listed for categoryID, searchTerm and filter.
+func (s *service) ProductFacets(categoryID int, searchTerm string, filter *ecommerce.ProductFilter) ([]ecommerce.Facet, error) {
+	const op = "productService.ProductFacets"
+
+	categories, err := s.r.AllCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting categories")
+	}
+
+	defs, err := s.r.AllAttributeDefinitions()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting definitions")
+	}
+
+	if filter != nil {
+		filter.Attributes = normalizeAttributeFilter(defs, filter.Attributes)
+	}
+
+	// attributes of ancestors apply to every listed product, those of
+	// descendants to some of them
+	var related []int
+	if categoryID > 0 {
+		related = append(ancestorIDs(categories, categoryID), subtreeIDs(categories, categoryID)...)
+	}
+
+	var codes []string
+	for _, d := range defs {
+		if !d.Filterable || (categoryID > 0 && !slice.IntSliceContainsIntValue(related, d.CategoryID)) {
+			continue
+		}
+		if len(codes) < 1 || codes[len(codes)-1] != d.Code {
+			codes = append(codes, d.Code)
+		}
+	}
+
+	ff, err := s.r.AttributeFacets(categoryID, searchTerm, filter, codes)
+
+	return ff, errors.Wrap(err, op, "getting facets")
+}
+
+// productAttributeDefinitions validates and normalizes the attributes of p against the
+// attributes defined for its category and returns these definitions.
+func (s *service) productAttributeDefinitions(p *ecommerce.Product) ([]ecommerce.AttributeDefinition, error) {
+	if len(p.Attributes) < 1 {
+		return nil, nil
+	}
+
+	defs, err := s.AttributeDefinitions(p.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	return defs, normalizeAttributes(defs, p.Attributes)
+}
+
+// normalizeAttributes checks that every attribute in attrs is defined in defs and that
+// its value has the defined type. String values are trimmed in place.
+func normalizeAttributes(defs []ecommerce.AttributeDefinition, attrs map[string]interface{}) error {
+	for code, v := range attrs {
+		var d *ecommerce.AttributeDefinition
+		for i := range defs {
+			if defs[i].Code == code {
+				d = &defs[i]
+			}
+		}
+		if d == nil {
+			return &errors.Invalid{Err: fmt.Errorf("attribute %s is not defined for the product category", code)}
+		}
+
+		switch d.Type {
+		case ecommerce.AttributeTypeString:
+			str, ok := v.(string)
+			if !ok || strings.TrimSpace(str) == "" {
+				return &errors.Invalid{Err: fmt.Errorf("attribute %s must be a non empty string", code)}
+			}
+			attrs[code] = strings.TrimSpace(str)
+		case ecommerce.AttributeTypeNumber:
+			if _, ok := v.(float64); !ok {
+				return &errors.Invalid{Err: fmt.Errorf("attribute %s must be a number", code)}
+			}
+		case ecommerce.AttributeTypeBoolean:
+			if _, ok := v.(bool); !ok {
+				return &errors.Invalid{Err: fmt.Errorf("attribute %s must be a boolean", code)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeAttributeFilter rewrites number and boolean filter values to the canonical
+// text they are stored as so that e.g. weight=1.50 matches a weight of 1.5.
+// Values that cannot be parsed are kept as they are and simply match nothing.
+func normalizeAttributeFilter(defs []ecommerce.AttributeDefinition, filter map[string][]string) map[string][]string {
+	normalized := make(map[string][]string, len(filter))
+	for code, values := range filter {
+		var typ string
+		for _, d := range defs {
+			if d.Code == code {
+				typ = d.Type
+			}
+		}
+
+		for _, v := range values {
+			switch typ {
+			case ecommerce.AttributeTypeNumber:
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					v = ecommerce.AttributeText(n)
+				}
+			case ecommerce.AttributeTypeBoolean:
+				if b, err := strconv.ParseBool(v); err == nil {
+					v = ecommerce.AttributeText(b)
+				}
+			}
+			normalized[code] = append(normalized[code], v)
+		}
+	}
+
+	return normalized
+}
+
+// ancestorIDs returns id and the ids of all its ancestors.
+func ancestorIDs(all []ecommerce.Category, id int) []int {
+	var ids []int
+	for c := findCategory(all, id); c != nil && !slice.IntSliceContainsIntValue(ids, c.ID); c = findCategory(all, c.ParentID) {
+		ids = append(ids, c.ID)
+	}
+
+	return ids
+}
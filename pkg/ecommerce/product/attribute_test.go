@@ -0,0 +1,73 @@
+package product
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"reflect"
+	"testing"
+)
+
+var testDefinitions = []ecommerce.AttributeDefinition{
+	{ID: 1, Code: "brand", Type: ecommerce.AttributeTypeString},
+	{ID: 2, Code: "weight", Type: ecommerce.AttributeTypeNumber},
+	{ID: 3, Code: "waterproof", Type: ecommerce.AttributeTypeBoolean},
+}
+
+func TestNormalizeAttributes(t *testing.T) {
+	tests := []struct{
+		name    string
+		attrs   map[string]interface{}
+		wantErr bool
+	} {
+		{
+			name: "valid values of every type",
+			attrs: map[string]interface{}{"brand": " acme ", "weight": 1.5, "waterproof": true},
+		},
+		{
+			name: "undefined attribute",
+			attrs: map[string]interface{}{"colour": "red"},
+			wantErr: true,
+		},
+		{
+			name: "string for number",
+			attrs: map[string]interface{}{"weight": "heavy"},
+			wantErr: true,
+		},
+		{
+			name: "number for boolean",
+			attrs: map[string]interface{}{"waterproof": 1.0},
+			wantErr: true,
+		},
+		{
+			name: "blank string",
+			attrs: map[string]interface{}{"brand": "  "},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeAttributes(testDefinitions, tt.attrs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wanted error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeAttributeFilter(t *testing.T) {
+	got := normalizeAttributeFilter(testDefinitions, map[string][]string{
+		"brand":      {"Acme", "1.50"},
+		"weight":     {"1.50", "abc"},
+		"waterproof": {"1"},
+	})
+
+	want := map[string][]string{
+		"brand":      {"Acme", "1.50"},
+		"weight":     {"1.5", "abc"},
+		"waterproof": {"true"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wanted %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,230 @@
+package product
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/slice"
+	errors2 "errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maximum lengths of the category fields, see the product_categories table
+const (
+	maxCategoryName = 32
+	maxCategorySlug = 64
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify lower cases name and replaces every run of characters other than
+// ASCII letters and digits with a single hyphen.
+func slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// CreateCategory saves c under c.ParentID or at the top level if it has no parent.
+// A slug is derived from the name if none is given and made unique by appending
+// a number to it.
+func (s *service) CreateCategory(c *ecommerce.Category) (int, error) {
+	const op = "productService.CreateCategory"
+
+	if err := validateCategory(c); err != nil {
+		return 0, errors.Wrap(err, op, "validating category")
+	}
+
+	if c.ParentID > 0 {
+		all, err := s.r.AllCategories()
+		if err != nil {
+			return 0, errors.Wrap(err, op, "getting categories")
+		}
+		if findCategory(all, c.ParentID) == nil {
+			return 0, errors.Wrap(&errors.Invalid{Err: errors2.New("parent category does not exist")}, op, "checking parent")
+		}
+	}
+
+	base := slugify(c.Slug)
+	if base == "" {
+		base = slugify(c.Name)
+	}
+	if base == "" {
+		base = "category"
+	}
+
+	c.Slug = base
+	for i := 2; ; i++ {
+		exists, err := s.r.CategorySlugExists(c.Slug)
+		if err != nil {
+			return 0, errors.Wrap(err, op, "checking slug")
+		} else if !exists {
+			break
+		}
+		c.Slug = numberedSlug(base, i)
+	}
+
+	id, err := s.r.CreateCategory(c)
+
+	return id, errors.Wrap(err, op, "saving category")
+}
+
+// validateCategory trims the name of c and checks that it and the slug, if one is
+// given, fit their columns.
+func validateCategory(c *ecommerce.Category) error {
+	fe := errors.FieldErrors{}
+
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		fe["name"] = "is required"
+	} else if utf8.RuneCountInString(c.Name) > maxCategoryName {
+		fe["name"] = fmt.Sprintf("must be at most %d characters", maxCategoryName)
+	}
+
+	if len(slugify(c.Slug)) > maxCategorySlug {
+		fe["slug"] = fmt.Sprintf("must be at most %d characters", maxCategorySlug)
+	}
+
+	if len(fe) > 0 {
+		return &errors.Invalid{Err: fe}
+	}
+
+	return nil
+}
+
+// numberedSlug appends i to base, cutting base short if the result would not fit
+// the slug column.
+func numberedSlug(base string, i int) string {
+	suffix := fmt.Sprintf("-%d", i)
+	if len(base)+len(suffix) > maxCategorySlug {
+		base = strings.TrimRight(base[:maxCategorySlug-len(suffix)], "-")
+	}
+
+	return base + suffix
+}
+
+// Categories returns the top level categories with their descendants attached.
+func (s *service) Categories() ([]ecommerce.Category, error) {
+	const op = "productService.Categories"
+
+	all, err := s.r.AllCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting categories")
+	}
+
+	return buildCategoryTree(all, 0), nil
+}
+
+// Category returns the category with id and its descendants.
+func (s *service) Category(id int) (*ecommerce.Category, error) {
+	const op = "productService.Category"
+
+	all, err := s.r.AllCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting categories")
+	}
+
+	c := findCategory(all, id)
+	if c == nil {
+		return nil, errors.Wrap(&errors.NotFound{Err: errors2.New("category not found")}, op, "finding category")
+	}
+	c.Children = buildCategoryTree(all, id)
+
+	return c, nil
+}
+
+// CategoryBreadcrumbs returns the path from the top level category down to
+// and including the category with id.
+func (s *service) CategoryBreadcrumbs(id int) ([]ecommerce.Category, error) {
+	const op = "productService.CategoryBreadcrumbs"
+
+	all, err := s.r.AllCategories()
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting categories")
+	}
+
+	var crumbs []ecommerce.Category
+	for c := findCategory(all, id); c != nil; c = findCategory(all, c.ParentID) {
+		// guard against cycles in corrupt data
+		if len(crumbs) > len(all) {
+			return nil, errors.Wrap(errors2.New("category tree contains a cycle"), op, "walking parents")
+		}
+		crumbs = append([]ecommerce.Category{*c}, crumbs...)
+	}
+
+	if len(crumbs) < 1 {
+		return nil, errors.Wrap(&errors.NotFound{Err: errors2.New("category not found")}, op, "finding category")
+	}
+
+	return crumbs, nil
+}
+
+// MoveCategory attaches the category with id and its whole subtree to parentID,
+// or makes it a top level category if parentID is zero.
+func (s *service) MoveCategory(id, parentID int) error {
+	const op = "productService.MoveCategory"
+
+	all, err := s.r.AllCategories()
+	if err != nil {
+		return errors.Wrap(err, op, "getting categories")
+	}
+
+	if findCategory(all, id) == nil {
+		return errors.Wrap(&errors.NotFound{Err: errors2.New("category not found")}, op, "finding category")
+	}
+
+	if parentID > 0 {
+		if findCategory(all, parentID) == nil {
+			return errors.Wrap(&errors.Invalid{Err: errors2.New("parent category does not exist")}, op, "checking parent")
+		}
+
+		for _, d := range subtreeIDs(all, id) {
+			if d == parentID {
+				return errors.Wrap(&errors.Invalid{Err: errors2.New("category cannot be moved below itself")}, op, "checking parent")
+			}
+		}
+	}
+
+	return errors.Wrap(s.r.UpdateCategoryParent(id, parentID), op, "updating parent")
+}
+
+func findCategory(all []ecommerce.Category, id int) *ecommerce.Category {
+	if id < 1 {
+		return nil
+	}
+
+	for _, c := range all {
+		if c.ID == id {
+			return &c
+		}
+	}
+
+	return nil
+}
+
+// buildCategoryTree returns the children of parentID with their own children attached.
+func buildCategoryTree(all []ecommerce.Category, parentID int) []ecommerce.Category {
+	var children []ecommerce.Category
+	for _, c := range all {
+		if c.ParentID == parentID && c.ID != parentID {
+			c.Children = buildCategoryTree(all, c.ID)
+			children = append(children, c)
+		}
+	}
+
+	return children
+}
+
+// subtreeIDs returns id and the ids of all its descendants.
+func subtreeIDs(all []ecommerce.Category, id int) []int {
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range all {
+			if c.ParentID == ids[i] && !slice.IntSliceContainsIntValue(ids, c.ID) {
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+
+	return ids
+}
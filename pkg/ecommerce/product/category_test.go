@@ -0,0 +1,105 @@
+package product
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"ecommerce/pkg/ecommerce/errors"
+	errors2 "errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct{
+		name string
+		in   string
+		want string
+	} {
+		{name: "single word", in: "Shoes", want: "shoes"},
+		{name: "spaces and symbols", in: "  Home & Garden ", want: "home-garden"},
+		{name: "non ascii only", in: "éé", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slugify(tt.in)
+			if got != tt.want {
+				t.Fatalf("wanted %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateCategory(t *testing.T) {
+	tests := []struct{
+		name string
+		c ecommerce.Category
+		errs errors.FieldErrors
+	} {
+		{name: "valid", c: ecommerce.Category{Name: " Shoes ", Slug: "shoes"}},
+		{name: "derived slug", c: ecommerce.Category{Name: strings.Repeat("a", maxCategoryName)}},
+		{name: "no name", c: ecommerce.Category{Name: "  "}, errs: errors.FieldErrors{"name": "is required"}},
+		{name: "long name", c: ecommerce.Category{Name: strings.Repeat("é", maxCategoryName+1)},
+			errs: errors.FieldErrors{"name": "must be at most 32 characters"}},
+		{name: "long slug", c: ecommerce.Category{Name: "Shoes", Slug: strings.Repeat("a", maxCategorySlug+1)},
+			errs: errors.FieldErrors{"slug": "must be at most 64 characters"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCategory(&tt.c)
+			if tt.errs == nil {
+				if err != nil {
+					t.Fatalf("wanted no error, got %v", err)
+				}
+				return
+			}
+
+			var invalid *errors.Invalid
+			if !errors2.As(err, &invalid) {
+				t.Fatalf("wanted an invalid error, got %v", err)
+			}
+			if !reflect.DeepEqual(invalid.Err, tt.errs) {
+				t.Fatalf("wanted %v, got %v", tt.errs, invalid.Err)
+			}
+		})
+	}
+}
+
+func TestNumberedSlug(t *testing.T) {
+	if got := numberedSlug("shoes", 2); got != "shoes-2" {
+		t.Fatalf("wanted shoes-2, got %q", got)
+	}
+
+	long := strings.Repeat("a", maxCategorySlug-2) + "-b"
+	got := numberedSlug(long, 12)
+	if len(got) > maxCategorySlug || !strings.HasSuffix(got, "a-12") {
+		t.Fatalf("wanted the slug cut to fit with its number, got %q", got)
+	}
+}
+
+func TestCategoryTree(t *testing.T) {
+	all := []ecommerce.Category{
+		{ID: 1, Name: "Clothing"},
+		{ID: 2, Name: "Shirts", ParentID: 1},
+		{ID: 3, Name: "T-Shirts", ParentID: 2},
+		{ID: 4, Name: "Books"},
+	}
+
+	tree := buildCategoryTree(all, 0)
+	if len(tree) != 2 || tree[0].ID != 1 || tree[1].ID != 4 {
+		t.Fatalf("unexpected top level categories: %+v", tree)
+	}
+
+	if len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 || tree[0].Children[0].Children[0].ID != 3 {
+		t.Fatalf("unexpected subtree: %+v", tree[0])
+	}
+
+	if got, want := subtreeIDs(all, 1), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wanted subtree %v, got %v", want, got)
+	}
+
+	if got, want := subtreeIDs(all, 4), []int{4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wanted subtree %v, got %v", want, got)
+	}
+}
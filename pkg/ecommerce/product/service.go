@@ -4,6 +4,11 @@ import (
 	"database/sql"
 	"ecommerce/pkg/ecommerce"
 	"ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/ecommerce/media"
+	"ecommerce/pkg/slice"
+	errors2 "errors"
+	"fmt"
+	"strings"
 )
 
 type repository interface {
@@ -15,19 +20,83 @@ type repository interface {
 		size int) ([]int, error)
 	ProductsFromIDs(ids []int) ([]ecommerce.Product, error)
 	Product(id int) (*ecommerce.Product, error)
-	CreateCategory(name string) (int, error)
-	CreateProduct(p *ecommerce.Product) (int, error)
+	CreateCategory(c *ecommerce.Category) (int, error)
+	AllCategories() ([]ecommerce.Category, error)
+	CategorySlugExists(slug string) (bool, error)
+	UpdateCategoryParent(id, parentID int) error
+	CreateProductWithTx(tx *sql.Tx, p *ecommerce.Product) (int, error)
+	CreateAttributeDefinition(d *ecommerce.AttributeDefinition) (int, error)
+	AllAttributeDefinitions() ([]ecommerce.AttributeDefinition, error)
+	ReplaceProductAttributesWithTx(
+		tx *sql.Tx,
+		productID int,
+		defs []ecommerce.AttributeDefinition,
+		attrs map[string]interface{}) error
+	AttributeFacets(
+		categoryID int,
+		searchTerm string,
+		filter *ecommerce.ProductFilter,
+		codes []string) ([]ecommerce.Facet, error)
 	UpdateProductWithTx(tx *sql.Tx, p *ecommerce.Product) error
+	SaveOptionWithTx(tx *sql.Tx, o *ecommerce.ProductOption) (int, error)
+	SaveVariantWithTx(tx *sql.Tx, v *ecommerce.ProductVariant) (int, error)
+	UpdateVariantWithTx(tx *sql.Tx, v *ecommerce.ProductVariant) error
+	UpdateVariantQuantityWithTx(tx *sql.Tx, variantID, quantity int) error
+	AdjustProductQuantityWithTx(tx *sql.Tx, productID, delta int) (int, error)
+	AdjustVariantQuantityWithTx(tx *sql.Tx, productID, variantID, delta int) (int, error)
+	DeleteVariant(productID, variantID int) error
+	Variant(id int) (*ecommerce.ProductVariant, error)
 	Tx() (*sql.Tx, error)
 }
 
-func New(db *sql.DB, repo repository) *service {
-	return &service{db: db, r: repo}
+func New(db *sql.DB, repo repository, blobStore ecommerce.BlobStore) *service {
+	return &service{db: db, r: repo, blobStore: blobStore}
 }
 
 type service struct {
 	db *sql.DB
 	r repository
+	blobStore ecommerce.BlobStore
+	watchers []ecommerce.ProductWatcher
+}
+
+// Watch adds w to the watchers that are told about changes to the price, stock
+// or name of products.
+func (s *service) Watch(w ecommerce.ProductWatcher) {
+	s.watchers = append(s.watchers, w)
+}
+
+// changedWithTx tells the watchers about the change of a product from before to after.
+func (s *service) changedWithTx(tx *sql.Tx, before, after *ecommerce.Product) error {
+	for _, w := range s.watchers {
+		if err := w.ProductChangedWithTx(tx, before, after); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updated returns a copy of before with the fields of p that watchers care about.
+func updated(before, p *ecommerce.Product) *ecommerce.Product {
+	after := *before
+	after.Name = p.Name
+	after.Price = p.Price
+	after.Quantity = p.Quantity
+
+	return &after
+}
+
+// variantUpdated returns a copy of before with its variant with the id of v replaced by v.
+func variantUpdated(before *ecommerce.Product, v *ecommerce.ProductVariant) *ecommerce.Product {
+	after := *before
+	after.Variants = make([]ecommerce.ProductVariant, len(before.Variants))
+	copy(after.Variants, before.Variants)
+	if old := after.Variant(v.ID); old != nil {
+		*old = *v
+	}
+
+	return &after
 }
 
 func (s *service) Products(
@@ -38,6 +107,14 @@ func (s *service) Products(
 	size int) ([]ecommerce.Product, error) {
 	const op = "productService.Products"
 
+	if filter != nil && len(filter.Attributes) > 0 {
+		defs, err := s.r.AllAttributeDefinitions()
+		if err != nil {
+			return nil, errors.Wrap(err, op, "getting attribute definitions")
+		}
+		filter.Attributes = normalizeAttributeFilter(defs, filter.Attributes)
+	}
+
 	ids, err := s.r.ProductIDs(categoryID, searchTerm, filter, page, size)
 	if err != nil {
 		return nil, errors.Wrap(err, op, "getting product ids")
@@ -48,15 +125,57 @@ func (s *service) Products(
 	return pp, errors.Wrap(err, op, "getting products from ids")
 }
 
-func (s *service) CreateCategory(name string) (int, error) {
-	return s.r.CreateCategory(name)
-}
 func (s *service) CreateProduct(p *ecommerce.Product) (int, error) {
-	return s.r.CreateProduct(p)
+	const op = "productService.CreateProduct"
+
+	if err := validateProduct(p); err != nil {
+		return 0, errors.Wrap(err, op, "validating product")
+	}
+
+	defs, err := s.productAttributeDefinitions(p)
+	if err != nil {
+		return 0, errors.Wrap(err, op, "validating attributes")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting tx")
+	}
+
+	id, err := s.r.CreateProductWithTx(tx, p)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors.Wrap(err, op, "saving product")
+	}
+
+	if len(p.Attributes) > 0 {
+		err = s.r.ReplaceProductAttributesWithTx(tx, id, defs, p.Attributes)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, errors.Wrap(err, op, "saving attributes")
+		}
+	}
+
+	return id, errors.Wrap(tx.Commit(), op, "committing tx")
 }
 
-func (s *service) UpdateProductWithTx(tx *sql.Tx, p *ecommerce.Product) error {
-	const op = "productService.UpdateProductWithTx"
+// UpdateProduct updates the details and attributes of p, its variants and images are left untouched.
+func (s *service) UpdateProduct(p *ecommerce.Product) error {
+	const op = "productService.UpdateProduct"
+
+	if err := validateProduct(p); err != nil {
+		return errors.Wrap(err, op, "validating product")
+	}
+
+	before, err := s.r.Product(p.ID)
+	if err != nil {
+		return errors.Wrap(err, op, "getting product")
+	}
+
+	defs, err := s.productAttributeDefinitions(p)
+	if err != nil {
+		return errors.Wrap(err, op, "validating attributes")
+	}
 
 	tx, err := s.r.Tx()
 	if err != nil {
@@ -65,24 +184,435 @@ func (s *service) UpdateProductWithTx(tx *sql.Tx, p *ecommerce.Product) error {
 
 	err = s.r.UpdateProductWithTx(tx, p)
 	if err != nil {
+		_ = tx.Rollback()
 		return errors.Wrap(err, op, "updating product")
 	}
 
+	err = s.r.ReplaceProductAttributesWithTx(tx, p.ID, defs, p.Attributes)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, op, "saving attributes")
+	}
+
+	err = s.changedWithTx(tx, before, updated(before, p))
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, op, "notifying watchers")
+	}
+
 	return errors.Wrap(tx.Commit(), op, "committing tx")
 }
 
+// UpdateProductWithTx updates p as part of tx, the caller is responsible
+// for committing or rolling back the transaction.
+func (s *service) UpdateProductWithTx(tx *sql.Tx, p *ecommerce.Product) error {
+	const op = "productService.UpdateProductWithTx"
+
+	var before *ecommerce.Product
+	if len(s.watchers) > 0 {
+		var err error
+		before, err = s.r.Product(p.ID)
+		if err != nil {
+			return errors.Wrap(err, op, "getting product")
+		}
+	}
+
+	if err := s.r.UpdateProductWithTx(tx, p); err != nil {
+		return errors.Wrap(err, op, "updating product")
+	}
+
+	if before == nil {
+		return nil
+	}
+
+	return errors.Wrap(s.changedWithTx(tx, before, updated(before, p)), op, "notifying watchers")
+}
+
 func (s *service) Product(id int) (*ecommerce.Product, error) {
 	const op  = "service.Product"
 
 	p, err := s.r.Product(id)
+	if err != nil {
+		return nil, errors.Wrap(err, op, "getting product from repo")
+	}
+	s.setImageURLs(p)
 
-	return p, errors.Wrap(err, op, "getting product from repo")
+	return p, nil
 }
 
 func (s *service) ProductsFromIDs(ids []int) ([]ecommerce.Product, error) {
 	const op = "userService.ProductsFromID"
 
 	pp, err := s.r.ProductsFromIDs(ids)
+	for i := range pp {
+		s.setImageURLs(&pp[i])
+	}
 
 	return pp, errors.Wrap(err, op, "getting product ids from repo")
 }
+
+func (s *service) setImageURLs(p *ecommerce.Product) {
+	for i := range p.Images {
+		p.Images[i].URLs = media.ImageURLs(s.blobStore, p.Images[i].Keys)
+	}
+}
+
+func (s *service) CreateOption(productID int, o *ecommerce.ProductOption) (int, error) {
+	const op = "productService.CreateOption"
+
+	p, err := s.r.Product(productID)
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting product")
+	}
+
+	if err := validateOption(p, o); err != nil {
+		return 0, errors.Wrap(err, op, "validating option")
+	}
+	o.ProductID = productID
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting tx")
+	}
+
+	id, err := s.r.SaveOptionWithTx(tx, o)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors.Wrap(err, op, "saving option")
+	}
+
+	return id, errors.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) CreateVariant(productID int, v *ecommerce.ProductVariant) (int, error) {
+	const op = "productService.CreateVariant"
+
+	p, err := s.r.Product(productID)
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting product")
+	}
+
+	v.ProductID = productID
+	if err := validateVariant(p, v); err != nil {
+		return 0, errors.Wrap(err, op, "validating variant")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors.Wrap(err, op, "getting tx")
+	}
+
+	id, err := s.r.SaveVariantWithTx(tx, v)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors.Wrap(err, op, "saving variant")
+	}
+
+	return id, errors.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) UpdateVariant(v *ecommerce.ProductVariant) error {
+	const op = "productService.UpdateVariant"
+
+	p, err := s.r.Product(v.ProductID)
+	if err != nil {
+		return errors.Wrap(err, op, "getting product")
+	}
+
+	if p.Variant(v.ID) == nil {
+		return errors.Wrap(&errors.NotFound{Err: errors2.New("variant not found")}, op, "checking variant")
+	}
+
+	if err := validateVariant(p, v); err != nil {
+		return errors.Wrap(err, op, "validating variant")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors.Wrap(err, op, "getting tx")
+	}
+
+	err = s.r.UpdateVariantWithTx(tx, v)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, op, "updating variant")
+	}
+
+	err = s.changedWithTx(tx, p, variantUpdated(p, v))
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, op, "notifying watchers")
+	}
+
+	return errors.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) DeleteVariant(productID, variantID int) error {
+	const op = "productService.DeleteVariant"
+
+	return errors.Wrap(s.r.DeleteVariant(productID, variantID), op, "deleting variant via repo")
+}
+
+func (s *service) Variant(id int) (*ecommerce.ProductVariant, error) {
+	const op = "productService.Variant"
+
+	v, err := s.r.Variant(id)
+
+	return v, errors.Wrap(err, op, "getting variant from repo")
+}
+
+// UpdateVariantQuantityWithTx sets the stock of a variant as part of tx, the caller
+// is responsible for committing or rolling back the transaction.
+func (s *service) UpdateVariantQuantityWithTx(tx *sql.Tx, variantID, quantity int) error {
+	const op = "productService.UpdateVariantQuantityWithTx"
+
+	if quantity < 0 {
+		return errors.Wrap(&errors.Invalid{Err: errors2.New("not enough items in stock")}, op, "checking quantity")
+	}
+
+	var before *ecommerce.Product
+	if len(s.watchers) > 0 {
+		v, err := s.r.Variant(variantID)
+		if err != nil {
+			return errors.Wrap(err, op, "getting variant")
+		}
+		before, err = s.r.Product(v.ProductID)
+		if err != nil {
+			return errors.Wrap(err, op, "getting product")
+		}
+	}
+
+	if err := s.r.UpdateVariantQuantityWithTx(tx, variantID, quantity); err != nil {
+		return errors.Wrap(err, op, "updating variant quantity")
+	}
+
+	if before == nil || before.Variant(variantID) == nil {
+		return nil
+	}
+
+	v := *before.Variant(variantID)
+	v.Quantity = quantity
+
+	return errors.Wrap(s.changedWithTx(tx, before, variantUpdated(before, &v)), op, "notifying watchers")
+}
+
+// AdjustStockWithTx changes the stock of a product, or of its variant if variantID is set,
+// by delta as part of tx, the caller is responsible for committing or rolling back the
+// transaction. The stock is changed relative to its value at the time of the update, so
+// concurrent changes are not lost. It fails with errors.Invalid if there is not enough
+// stock to take and with errors.NotFound if there is no such product or variant.
+func (s *service) AdjustStockWithTx(tx *sql.Tx, productID, variantID, delta int) error {
+	const op = "productService.AdjustStockWithTx"
+
+	var quantity int
+	var err error
+	if variantID > 0 {
+		quantity, err = s.r.AdjustVariantQuantityWithTx(tx, productID, variantID, delta)
+	} else {
+		quantity, err = s.r.AdjustProductQuantityWithTx(tx, productID, delta)
+	}
+	if _, ok := errors.Unwrap(err).(*errors.NotFound); ok && delta < 0 {
+		p, err := s.r.Product(productID)
+		if err != nil {
+			return errors.Wrap(err, op, "getting product")
+		} else if variantID > 0 && p.Variant(variantID) == nil {
+			return errors.Wrap(&errors.NotFound{Err: errors2.New("variant not found")}, op, "checking variant")
+		}
+		return errors.Wrap(&errors.Invalid{Err: errors2.New("not enough items in stock")}, op, "updating quantity")
+	} else if err != nil {
+		return errors.Wrap(err, op, "updating quantity")
+	}
+
+	if len(s.watchers) == 0 {
+		return nil
+	}
+
+	before, err := s.r.Product(productID)
+	if err != nil {
+		return errors.Wrap(err, op, "getting product")
+	}
+
+	// before was read outside of tx, so its stock is set from the result of the update
+	if variantID > 0 {
+		v := before.Variant(variantID)
+		if v == nil {
+			return nil
+		}
+		v.Quantity = quantity - delta
+		after := *v
+		after.Quantity = quantity
+
+		return errors.Wrap(s.changedWithTx(tx, before, variantUpdated(before, &after)), op, "notifying watchers")
+	}
+
+	before.Quantity = quantity - delta
+	after := *before
+	after.Quantity = quantity
+
+	return errors.Wrap(s.changedWithTx(tx, before, &after), op, "notifying watchers")
+}
+
+func (s *service) SetVariantQuantity(productID, variantID, quantity int) error {
+	const op = "productService.SetVariantQuantity"
+
+	if quantity < 0 {
+		return errors.Wrap(&errors.Invalid{Err: errors2.New("quantity cannot be negative")}, op, "checking quantity")
+	}
+
+	p, err := s.r.Product(productID)
+	if err != nil {
+		return errors.Wrap(err, op, "getting product")
+	}
+
+	if p.Variant(variantID) == nil {
+		return errors.Wrap(&errors.NotFound{Err: errors2.New("variant not found")}, op, "checking variant")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors.Wrap(err, op, "getting tx")
+	}
+
+	err = s.UpdateVariantQuantityWithTx(tx, variantID, quantity)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, op, "updating variant quantity")
+	}
+
+	return errors.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func validateProduct(p *ecommerce.Product) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return &errors.Invalid{Err: errors2.New("product name is required")}
+	} else if p.CategoryID < 1 {
+		return &errors.Invalid{Err: errors2.New("product category is required")}
+	} else if p.Quantity < 0 {
+		return &errors.Invalid{Err: errors2.New("quantity cannot be negative")}
+	} else if p.Weight < 0 {
+		return &errors.Invalid{Err: errors2.New("weight cannot be negative")}
+	}
+
+	p.TaxCategory = strings.ToLower(strings.TrimSpace(p.TaxCategory))
+	if p.TaxCategory == "" {
+		p.TaxCategory = ecommerce.TaxCategoryStandard
+	} else if !attributeCodePattern.MatchString(p.TaxCategory) {
+		return &errors.Invalid{Err: errors2.New("tax category must start with a letter and be at most 32 lower case letters, digits or underscores")}
+	}
+
+	return validatePrice(&p.Price, "product")
+}
+
+// validatePrice checks that the current price of a product or variant is positive, that an
+// old price is higher and that both are in the catalog currency.
+func validatePrice(price *ecommerce.Price, what string) error {
+	if price.Current.Amount <= 0 {
+		return &errors.Invalid{Err: fmt.Errorf("%s price must be greater than zero", what)}
+	} else if price.Current.Currency != ecommerce.DefaultCurrency {
+		return &errors.Invalid{Err: fmt.Errorf("%s price must be in %s", what, ecommerce.DefaultCurrency)}
+	}
+
+	if price.Old != nil {
+		if price.Old.Currency != price.Current.Currency {
+			return &errors.Invalid{Err: fmt.Errorf("old %s price must be in %s", what, ecommerce.DefaultCurrency)}
+		} else if price.Old.Amount <= price.Current.Amount {
+			return &errors.Invalid{Err: fmt.Errorf("old %s price must be higher than the current price", what)}
+		}
+	}
+
+	return nil
+}
+
+// validateOption checks that o can be added to p. Variants select a value of every
+// option of their product, so options cannot be added to a product that has variants.
+func validateOption(p *ecommerce.Product, o *ecommerce.ProductOption) error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return &errors.Invalid{Err: errors2.New("option name is required")}
+	}
+
+	if len(o.Values) < 1 {
+		return &errors.Invalid{Err: errors2.New("option must have at least one value")}
+	}
+
+	seen := make(map[string]bool)
+	for i := range o.Values {
+		o.Values[i].Value = strings.TrimSpace(o.Values[i].Value)
+		v := strings.ToLower(o.Values[i].Value)
+		if v == "" || seen[v] {
+			return &errors.Invalid{Err: errors2.New("option values must be unique and not empty")}
+		}
+		seen[v] = true
+	}
+
+	if len(p.Variants) > 0 {
+		return &errors.Invalid{Err: errors2.New("options cannot be added to a product with variants, delete its variants first")}
+	}
+
+	return nil
+}
+
+// validateVariant checks that v has a SKU and selects exactly one value
+// for every option of p.
+func validateVariant(p *ecommerce.Product, v *ecommerce.ProductVariant) error {
+	v.SKU = strings.TrimSpace(v.SKU)
+	if v.SKU == "" {
+		return &errors.Invalid{Err: errors2.New("sku is required")}
+	}
+
+	if v.Quantity < 0 {
+		return &errors.Invalid{Err: errors2.New("quantity cannot be negative")}
+	}
+
+	if v.Price != nil {
+		if err := validatePrice(v.Price, "variant"); err != nil {
+			return err
+		}
+	}
+
+	if len(v.OptionValueIDs) != len(p.Options) {
+		return &errors.Invalid{Err: fmt.Errorf("variant must select one value for each of the %d product options", len(p.Options))}
+	}
+
+	used := make(map[int]bool)
+	for _, valueID := range v.OptionValueIDs {
+		optionID := 0
+		for _, o := range p.Options {
+			for _, ov := range o.Values {
+				if ov.ID == valueID {
+					optionID = o.ID
+				}
+			}
+		}
+
+		if optionID == 0 {
+			return &errors.Invalid{Err: fmt.Errorf("option value %d does not belong to product", valueID)}
+		} else if used[optionID] {
+			return &errors.Invalid{Err: errors2.New("variant selects more than one value for the same option")}
+		}
+		used[optionID] = true
+	}
+
+	for _, other := range p.Variants {
+		if other.ID != v.ID && sameIntSet(other.OptionValueIDs, v.OptionValueIDs) {
+			return &errors.Invalid{Err: fmt.Errorf("variant %s already has these option values", other.SKU)}
+		}
+	}
+
+	return nil
+}
+
+func sameIntSet(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, n := range a {
+		if !slice.IntSliceContainsIntValue(b, n) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,99 @@
+package product
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+// testProduct comes in sizes S (1) and M (2) and colours red (3) and blue (4) and has
+// one variant in S and red.
+var testProduct = &ecommerce.Product{
+	ID: 1,
+	Options: []ecommerce.ProductOption{
+		{ID: 1, Name: "Size", Values: []ecommerce.ProductOptionValue{{ID: 1, Value: "S"}, {ID: 2, Value: "M"}}},
+		{ID: 2, Name: "Colour", Values: []ecommerce.ProductOptionValue{{ID: 3, Value: "Red"}, {ID: 4, Value: "Blue"}}},
+	},
+	Variants: []ecommerce.ProductVariant{{ID: 10, SKU: "TEE-S-RED", OptionValueIDs: []int{1, 3}}},
+}
+
+func TestValidateVariant(t *testing.T) {
+	usd := func(amount int64) ecommerce.Money { return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency) }
+	old := usd(500)
+
+	tests := []struct {
+		name string
+		v ecommerce.ProductVariant
+		ok bool
+	}{
+		{name: "one value per option", v: ecommerce.ProductVariant{SKU: "TEE-M-BLUE", OptionValueIDs: []int{2, 4}}, ok: true},
+		{name: "values in any order", v: ecommerce.ProductVariant{SKU: "TEE-M-RED", OptionValueIDs: []int{3, 2}}, ok: true},
+		{name: "own price", v: ecommerce.ProductVariant{SKU: "TEE-M-BLUE", Price: &ecommerce.Price{Current: usd(1000)}, OptionValueIDs: []int{2, 4}}, ok: true},
+		{name: "the variant itself", v: ecommerce.ProductVariant{ID: 10, SKU: "TEE-S-RED", OptionValueIDs: []int{1, 3}}, ok: true},
+		{name: "no sku", v: ecommerce.ProductVariant{SKU: " ", OptionValueIDs: []int{2, 4}}},
+		{name: "negative quantity", v: ecommerce.ProductVariant{SKU: "TEE-M-BLUE", Quantity: -1, OptionValueIDs: []int{2, 4}}},
+		{name: "old price lower than price", v: ecommerce.ProductVariant{SKU: "TEE-M-BLUE", Price: &ecommerce.Price{Current: usd(1000), Old: &old}, OptionValueIDs: []int{2, 4}}},
+		{name: "value missing for an option", v: ecommerce.ProductVariant{SKU: "TEE-M", OptionValueIDs: []int{2}}},
+		{name: "two values of one option", v: ecommerce.ProductVariant{SKU: "TEE-SM", OptionValueIDs: []int{1, 2}}},
+		{name: "value of another product", v: ecommerce.ProductVariant{SKU: "TEE-M-X", OptionValueIDs: []int{2, 99}}},
+		{name: "values of another variant", v: ecommerce.ProductVariant{SKU: "TEE-S-RED-2", OptionValueIDs: []int{3, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := tt.v
+			err := validateVariant(testProduct, &v)
+			if (err == nil) != tt.ok {
+				t.Fatalf("wanted ok %t, got %v", tt.ok, err)
+			}
+		})
+	}
+}
+
+func TestValidateOption(t *testing.T) {
+	tests := []struct {
+		name string
+		p *ecommerce.Product
+		o ecommerce.ProductOption
+		ok bool
+	}{
+		{
+			name: "product without variants",
+			p: &ecommerce.Product{ID: 2},
+			o: ecommerce.ProductOption{Name: " Size ", Values: []ecommerce.ProductOptionValue{{Value: "S"}, {Value: "M"}}},
+			ok: true,
+		},
+		{
+			name: "no name",
+			p: &ecommerce.Product{ID: 2},
+			o: ecommerce.ProductOption{Values: []ecommerce.ProductOptionValue{{Value: "S"}}},
+		},
+		{
+			name: "no values",
+			p: &ecommerce.Product{ID: 2},
+			o: ecommerce.ProductOption{Name: "Size"},
+		},
+		{
+			name: "values differing in case only",
+			p: &ecommerce.Product{ID: 2},
+			o: ecommerce.ProductOption{Name: "Size", Values: []ecommerce.ProductOptionValue{{Value: "s"}, {Value: "S "}}},
+		},
+		{
+			name: "product with variants",
+			p: testProduct,
+			o: ecommerce.ProductOption{Name: "Fit", Values: []ecommerce.ProductOptionValue{{Value: "Slim"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.o
+			err := validateOption(tt.p, &o)
+			if (err == nil) != tt.ok {
+				t.Fatalf("wanted ok %t, got %v", tt.ok, err)
+			}
+			if err == nil && o.Name != "Size" {
+				t.Fatalf("wanted the name trimmed, got %q", o.Name)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package ecommerce
 
-import "database/sql"
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+)
 
 type ProductService interface {
 	Products(
@@ -9,11 +13,30 @@ type ProductService interface {
 		filter *ProductFilter,
 		page int,
 		size int) ([]Product, error)
-	CreateCategory(name string) (int, error)
+	CreateCategory(c *Category) (int, error)
+	Categories() ([]Category, error)
+	Category(id int) (*Category, error)
+	CategoryBreadcrumbs(id int) ([]Category, error)
+	MoveCategory(id, parentID int) error
+	CreateAttributeDefinition(d *AttributeDefinition) (int, error)
+	AttributeDefinitions(categoryID int) ([]AttributeDefinition, error)
+	ProductFacets(categoryID int, searchTerm string, filter *ProductFilter) ([]Facet, error)
 	CreateProduct(p *Product) (int, error)
+	UpdateProduct(p *Product) error
 	UpdateProductWithTx(tx *sql.Tx, p *Product) error
 	Product(id int) (*Product, error)
 	ProductsFromIDs(ids []int) ([]Product, error)
+	CreateOption(productID int, o *ProductOption) (int, error)
+	CreateVariant(productID int, v *ProductVariant) (int, error)
+	UpdateVariant(v *ProductVariant) error
+	DeleteVariant(productID, variantID int) error
+	Variant(id int) (*ProductVariant, error)
+	UpdateVariantQuantityWithTx(tx *sql.Tx, variantID, quantity int) error
+	// AdjustStockWithTx changes the stock of a product, or of its variant if variantID
+	// is set, by delta, e.g. -2 when two units are sold.
+	AdjustStockWithTx(tx *sql.Tx, productID, variantID, delta int) error
+	// SetVariantQuantity sets the stock of a variant of a product, e.g. from a stock take.
+	SetVariantQuantity(productID, variantID, quantity int) error
 }
 
 type Product struct {
@@ -22,11 +45,106 @@ type Product struct {
 	CategoryID int `json:"category_id"`
 	Price Price `json:"price"`
 	Rating int `json:"rating,omitempty"`
+	AverageRating float32 `json:"average_rating,omitempty"`
+	ReviewCount int `json:"review_count,omitempty"`
 	Description string `json:"description,omitempty"`
 	Quantity int `json:"quantity,omitempty"`
+	// TaxCategory selects the tax rates of the product, see TaxRate.
+	TaxCategory string `json:"tax_category,omitempty"`
+	// Weight is the shipping weight in grams.
+	Weight int `json:"weight,omitempty"`
+	Options []ProductOption `json:"options,omitempty"`
+	Variants []ProductVariant `json:"variants,omitempty"`
+	Images []ProductImage `json:"images,omitempty"`
+	// Attributes maps attribute codes to string, float64 or bool values
+	// depending on the type of the attribute definition.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
+// Variant returns the product variant with id or nil if the product
+// does not have such a variant.
+func (p *Product) Variant(id int) *ProductVariant {
+	for i := range p.Variants {
+		if p.Variants[i].ID == id {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// ProductOption is a dimension along which a product varies, e.g. size or colour.
+type ProductOption struct {
+	ID int `json:"id"`
+	ProductID int `json:"product_id"`
+	Name string `json:"name"`
+	Values []ProductOptionValue `json:"values"`
+}
+
+type ProductOptionValue struct {
+	ID int `json:"id"`
+	OptionID int `json:"option_id"`
+	Value string `json:"value"`
+}
+
+// ProductVariant is a sellable combination of option values with its own SKU
+// and stock. A nil Price means the variant sells at the product price.
+type ProductVariant struct {
+	ID int `json:"id"`
+	ProductID int `json:"product_id"`
+	SKU string `json:"sku"`
+	Price *Price `json:"price,omitempty"`
+	Quantity int `json:"quantity"`
+	Images []string `json:"images,omitempty"`
+	OptionValueIDs []int `json:"option_value_ids"`
+}
+
+// Category is a node in the category tree. Top level categories have no ParentID.
 type Category struct {
 	ID int `json:"id"`
 	Name string `json:"name"`
+	Slug string `json:"slug"`
+	ParentID int `json:"parent_id,omitempty"`
+	Children []Category `json:"children,omitempty"`
+}
+
+const (
+	AttributeTypeString = "string"
+	AttributeTypeNumber = "number"
+	AttributeTypeBoolean = "boolean"
+)
+
+// AttributeDefinition declares a typed attribute, e.g. brand or weight, that products
+// of a category and all of its descendant categories may have.
+type AttributeDefinition struct {
+	ID int `json:"id"`
+	CategoryID int `json:"category_id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Filterable bool `json:"filterable"`
+}
+
+// Facet lists the values of a filterable attribute among listed products
+// and the number of products having each value.
+type Facet struct {
+	Code string `json:"code"`
+	Values []FacetValue `json:"values"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int `json:"count"`
+}
+
+// AttributeText returns the canonical text form of an attribute value which
+// is what attribute filters are matched against.
+func AttributeText(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		return fmt.Sprint(t)
+	}
 }
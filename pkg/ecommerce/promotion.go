@@ -0,0 +1,107 @@
+package ecommerce
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	PromotionTypePercentage = "percentage"
+	PromotionTypeFixedAmount = "fixed_amount"
+	PromotionTypeFreeShipping = "free_shipping"
+	PromotionTypeBuyXGetY = "buy_x_get_y"
+)
+
+type PromotionService interface {
+	CreatePromotion(p *Promotion) (int, error)
+	UpdatePromotion(p *Promotion) error
+	Promotion(id int) (*Promotion, error)
+	Promotions() ([]Promotion, error)
+	ApplyCoupon(custID int, code string) (*CartTotals, error)
+	RemoveCoupon(custID int, code string) error
+	CartTotals(custID int) (*CartTotals, error)
+	RedeemWithTx(tx *sql.Tx, custID, orderID int, totals *CartTotals) error
+}
+
+// Promotion is a discount rule. Promotions with a code are coupons that customers
+// apply to their cart, promotions without one apply to every cart automatically.
+type Promotion struct {
+	ID int `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Value is the percentage off for percentage promotions, with up to two decimals.
+	Value float32 `json:"value,omitempty"`
+	// Amount is the amount off for fixed amount promotions.
+	Amount Money `json:"amount"`
+	// BuyQuantity and GetQuantity configure buy X get Y promotions: of every
+	// BuyQuantity + GetQuantity eligible units, the GetQuantity cheapest are free.
+	BuyQuantity int `json:"buy_quantity,omitempty"`
+	GetQuantity int `json:"get_quantity,omitempty"`
+	// MinSpend is the amount the eligible cart lines must add up to before
+	// any discount for the promotion to apply.
+	MinSpend Money `json:"min_spend"`
+	// UsageLimit caps the redemptions of all customers and PerCustomerLimit those of
+	// every single customer. Zero means unlimited.
+	UsageLimit int `json:"usage_limit"`
+	PerCustomerLimit int `json:"per_customer_limit"`
+	// ProductIDs and CategoryIDs scope the promotion to those products and to products
+	// in those categories or their subcategories. An unscoped promotion applies to all products.
+	ProductIDs []int `json:"product_ids"`
+	CategoryIDs []int `json:"category_ids"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt *time.Time `json:"ends_at,omitempty"`
+	// Stackable promotions can be combined with each other. A promotion that is not
+	// stackable only applies on its own.
+	Stackable bool `json:"stackable"`
+	// Priority decides the evaluation order, higher first.
+	Priority int `json:"priority"`
+	Active bool `json:"active"`
+}
+
+// CartTotals is the priced content of a cart with all applicable promotions applied.
+type CartTotals struct {
+	Lines []CartLine `json:"lines"`
+	Subtotal Money `json:"subtotal"`
+	Discount Money `json:"discount"`
+	// Tax is the tax of all lines. It is part of Total, and with inclusive tax
+	// already of Subtotal.
+	Tax Money `json:"tax"`
+	TaxInclusive bool `json:"tax_inclusive"`
+	// Taxes is the tax of all lines per jurisdiction.
+	Taxes []TaxAmount `json:"taxes"`
+	Total Money `json:"total"`
+	FreeShipping bool `json:"free_shipping"`
+	Applied []AppliedPromotion `json:"applied_promotions"`
+	// Rejected lists the promotions of the cart that currently do not apply and why,
+	// e.g. a coupon whose minimum spend is no longer met.
+	Rejected []RejectedPromotion `json:"rejected_promotions"`
+}
+
+type CartLine struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id,omitempty"`
+	Quantity int `json:"quantity"`
+	UnitPrice Money `json:"unit_price"`
+	Subtotal Money `json:"subtotal"`
+	Discount Money `json:"discount"`
+	TaxCategory string `json:"-"`
+	// Weight is the shipping weight of a unit in grams.
+	Weight int `json:"-"`
+	Tax Money `json:"tax"`
+	Taxes []TaxAmount `json:"taxes"`
+}
+
+type AppliedPromotion struct {
+	ID int `json:"id"`
+	Code string `json:"code,omitempty"`
+	Name string `json:"name"`
+	Discount Money `json:"discount"`
+}
+
+type RejectedPromotion struct {
+	ID int `json:"id"`
+	Code string `json:"code,omitempty"`
+	Name string `json:"name"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,267 @@
+package promotion
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// The engine evaluates promotions against the lines of a cart. It is deterministic:
+// the same lines and promotions always give the same discounts, following these rules.
+//
+//  1. Promotions are evaluated by priority, highest first, then by type in the order
+//     buy X get Y, percentage, fixed amount, free shipping, then by id.
+//  2. Each discount applies to what is left of the line amounts after the promotions
+//     evaluated before it, so discounts compound and a line never drops below zero.
+//  3. A promotion that is not stackable only applies if no promotion has been applied
+//     before it. Once it has been applied, no later promotion applies.
+//  4. The minimum spend is checked against the eligible lines before any discount.
+//  5. A promotion that would not change the cart, e.g. a buy X get Y promotion
+//     without enough units, is rejected and does not count as applied.
+//
+// All lines and amounts of a promotion must be in the same currency.
+
+const (
+	reasonInactive = "promotion is not active"
+	reasonNotStarted = "promotion has not started yet"
+	reasonExpired = "promotion has expired"
+	reasonUsageLimit = "promotion has reached its usage limit"
+	reasonCustomerLimit = "promotion has already been used the maximum number of times"
+	reasonNoEligibleProducts = "cart has no products the promotion applies to"
+	reasonMinSpend = "cart does not reach the minimum spend of %s"
+	reasonNotCombinable = "promotion cannot be combined with other promotions"
+	reasonNoDiscount = "cart does not meet the conditions of the promotion"
+)
+
+var typeRank = map[string]int{
+	ecommerce.PromotionTypeBuyXGetY: 0,
+	ecommerce.PromotionTypePercentage: 1,
+	ecommerce.PromotionTypeFixedAmount: 2,
+	ecommerce.PromotionTypeFreeShipping: 3,
+}
+
+// line is a cart line as seen by the engine.
+type line struct {
+	productID int
+	// categoryIDs are the category of the product and all its ancestors.
+	categoryIDs []int
+	quantity int
+	unitPrice ecommerce.Money
+}
+
+// usage is the number of times a promotion has been redeemed in total and by the customer.
+type usage struct {
+	total int
+	customer int
+}
+
+type result struct {
+	lineDiscounts []ecommerce.Money
+	freeShipping bool
+	applied []ecommerce.AppliedPromotion
+	rejected []ecommerce.RejectedPromotion
+}
+
+// evaluate applies promos to lines at time now. usages holds the redemptions of
+// the promotions by id.
+func evaluate(lines []line, promos []ecommerce.Promotion, usages map[int]usage, now time.Time) result {
+	sorted := make([]ecommerce.Promotion, len(promos))
+	copy(sorted, promos)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		} else if typeRank[a.Type] != typeRank[b.Type] {
+			return typeRank[a.Type] < typeRank[b.Type]
+		}
+		return a.ID < b.ID
+	})
+
+	res := result{lineDiscounts: make([]ecommerce.Money, len(lines))}
+	remaining := make([]ecommerce.Money, len(lines))
+	for i, l := range lines {
+		remaining[i] = l.unitPrice.Mul(int64(l.quantity))
+	}
+
+	exclusive := false
+	for _, p := range sorted {
+		var discounts []ecommerce.Money
+		reason := availability(p, usages[p.ID], now)
+		if reason == "" {
+			eligible := eligibleLines(lines, p)
+			if len(eligible) < 1 {
+				reason = reasonNoEligibleProducts
+			} else if spend(lines, eligible).Cmp(p.MinSpend) < 0 {
+				reason = fmt.Sprintf(reasonMinSpend, p.MinSpend)
+			} else if exclusive || (!p.Stackable && len(res.applied) > 0) {
+				reason = reasonNotCombinable
+			} else {
+				discounts = discount(p, lines, remaining, eligible)
+				if p.Type == ecommerce.PromotionTypeFreeShipping {
+					if res.freeShipping {
+						reason = reasonNoDiscount
+					}
+				} else if sum(discounts).IsZero() {
+					reason = reasonNoDiscount
+				}
+			}
+		}
+
+		if reason != "" {
+			res.rejected = append(res.rejected, ecommerce.RejectedPromotion{ID: p.ID, Code: p.Code, Name: p.Name, Reason: reason})
+			continue
+		}
+
+		for i, d := range discounts {
+			res.lineDiscounts[i] = res.lineDiscounts[i].Add(d)
+			remaining[i] = remaining[i].Sub(d)
+		}
+		if p.Type == ecommerce.PromotionTypeFreeShipping {
+			res.freeShipping = true
+		}
+		res.applied = append(res.applied, ecommerce.AppliedPromotion{ID: p.ID, Code: p.Code, Name: p.Name, Discount: sum(discounts)})
+
+		if !p.Stackable {
+			exclusive = true
+		}
+	}
+
+	return res
+}
+
+// availability returns why p cannot be used at all at time now or an empty string if it can.
+func availability(p ecommerce.Promotion, u usage, now time.Time) string {
+	switch {
+	case !p.Active:
+		return reasonInactive
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return reasonNotStarted
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return reasonExpired
+	case p.UsageLimit > 0 && u.total >= p.UsageLimit:
+		return reasonUsageLimit
+	case p.PerCustomerLimit > 0 && u.customer >= p.PerCustomerLimit:
+		return reasonCustomerLimit
+	}
+	return ""
+}
+
+// eligibleLines returns the indices of the lines p applies to.
+func eligibleLines(lines []line, p ecommerce.Promotion) []int {
+	var eligible []int
+	for i, l := range lines {
+		if inScope(l, p) {
+			eligible = append(eligible, i)
+		}
+	}
+	return eligible
+}
+
+func inScope(l line, p ecommerce.Promotion) bool {
+	if len(p.ProductIDs) < 1 && len(p.CategoryIDs) < 1 {
+		return true
+	}
+
+	for _, id := range p.ProductIDs {
+		if id == l.productID {
+			return true
+		}
+	}
+	for _, id := range p.CategoryIDs {
+		for _, catID := range l.categoryIDs {
+			if id == catID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// spend returns the undiscounted amount of the eligible lines.
+func spend(lines []line, eligible []int) ecommerce.Money {
+	var total ecommerce.Money
+	for _, i := range eligible {
+		total = total.Add(lines[i].unitPrice.Mul(int64(lines[i].quantity)))
+	}
+	return total
+}
+
+// discount returns the discount p gives on every line given the remaining line amounts.
+func discount(p ecommerce.Promotion, lines []line, remaining []ecommerce.Money, eligible []int) []ecommerce.Money {
+	discounts := make([]ecommerce.Money, len(lines))
+
+	switch p.Type {
+	case ecommerce.PromotionTypePercentage:
+		basisPoints := int64(math.Round(float64(p.Value) * 100))
+		for _, i := range eligible {
+			discounts[i] = remaining[i].MulFrac(basisPoints, 10000)
+			if discounts[i].Cmp(remaining[i]) > 0 {
+				discounts[i] = remaining[i]
+			}
+		}
+	case ecommerce.PromotionTypeFixedAmount:
+		distribute(p.Amount, remaining, eligible, discounts)
+	case ecommerce.PromotionTypeBuyXGetY:
+		buyXGetY(p, lines, remaining, eligible, discounts)
+	}
+
+	return discounts
+}
+
+// distribute spreads amount over the eligible lines in proportion to their remaining
+// amounts. The amount is capped at the sum of the remaining amounts.
+func distribute(amount ecommerce.Money, remaining []ecommerce.Money, eligible []int, discounts []ecommerce.Money) {
+	var total ecommerce.Money
+	weights := make([]int64, len(eligible))
+	for k, i := range eligible {
+		total = total.Add(remaining[i])
+		weights[k] = remaining[i].Amount
+	}
+	if amount.Cmp(total) > 0 {
+		amount = total
+	}
+
+	for k, part := range amount.Allocate(weights) {
+		discounts[eligible[k]] = part
+	}
+}
+
+// buyXGetY makes the cheapest GetQuantity units of every BuyQuantity + GetQuantity
+// eligible units free, with units ranked by unit price.
+func buyXGetY(p ecommerce.Promotion, lines []line, remaining []ecommerce.Money, eligible []int, discounts []ecommerce.Money) {
+	group := p.BuyQuantity + p.GetQuantity
+	if p.BuyQuantity < 1 || p.GetQuantity < 1 {
+		return
+	}
+
+	var units []int // line index of every unit
+	for _, i := range eligible {
+		for n := 0; n < lines[i].quantity; n++ {
+			units = append(units, i)
+		}
+	}
+	sort.SliceStable(units, func(a, b int) bool {
+		return lines[units[a]].unitPrice.Cmp(lines[units[b]].unitPrice) > 0
+	})
+
+	free := make(map[int]int)
+	for pos, i := range units {
+		if pos%group >= p.BuyQuantity {
+			free[i]++
+		}
+	}
+
+	for i, n := range free {
+		discounts[i] = remaining[i].MulFrac(int64(n), int64(lines[i].quantity))
+	}
+}
+
+func sum(amounts []ecommerce.Money) ecommerce.Money {
+	var total ecommerce.Money
+	for _, a := range amounts {
+		total = total.Add(a)
+	}
+	return total
+}
@@ -0,0 +1,356 @@
+package promotion
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testLines is a cart of two units of product 1 at 10.00 in category 2, a subcategory
+// of category 1, and one unit of product 2 at 5.00 in category 3.
+var testLines = []line{
+	{productID: 1, categoryIDs: []int{1, 2}, quantity: 2, unitPrice: usd(1000)},
+	{productID: 2, categoryIDs: []int{3}, quantity: 1, unitPrice: usd(500)},
+}
+
+func usd(amount int64) ecommerce.Money {
+	return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+}
+
+func percentage(id int, value float32, stackable bool) ecommerce.Promotion {
+	return ecommerce.Promotion{ID: id, Type: ecommerce.PromotionTypePercentage, Value: value, Stackable: stackable, Active: true}
+}
+
+func fixed(id int, amount int64, stackable bool) ecommerce.Promotion {
+	return ecommerce.Promotion{ID: id, Type: ecommerce.PromotionTypeFixedAmount, Amount: usd(amount), Stackable: stackable, Active: true}
+}
+
+func freeShipping(id int, stackable bool) ecommerce.Promotion {
+	return ecommerce.Promotion{ID: id, Type: ecommerce.PromotionTypeFreeShipping, Stackable: stackable, Active: true}
+}
+
+func buyXGetYPromo(id, buy, get int, stackable bool) ecommerce.Promotion {
+	return ecommerce.Promotion{ID: id, Type: ecommerce.PromotionTypeBuyXGetY, BuyQuantity: buy, GetQuantity: get, Stackable: stackable, Active: true}
+}
+
+func with(p ecommerce.Promotion, f func(p *ecommerce.Promotion)) ecommerce.Promotion {
+	f(&p)
+	return p
+}
+
+func timeRef(t time.Time) *time.Time {
+	return &t
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct{
+		name string
+		lines []line
+		promos []ecommerce.Promotion
+		usages map[int]usage
+		wantDiscounts []int64
+		wantFreeShipping bool
+		wantApplied []int
+		wantRejected map[int]string
+	} {
+		{
+			name: "no promotions",
+			promos: nil,
+			wantDiscounts: []int64{0, 0},
+		},
+		{
+			name: "single percentage",
+			promos: []ecommerce.Promotion{percentage(1, 10, true)},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{1},
+		},
+		{
+			name: "stackable percentages compound in id order",
+			promos: []ecommerce.Promotion{percentage(2, 20, true), percentage(1, 10, true)},
+			wantDiscounts: []int64{560, 140},
+			wantApplied: []int{1, 2},
+		},
+		{
+			name: "percentage is evaluated before fixed amount of equal priority",
+			promos: []ecommerce.Promotion{fixed(1, 500, true), percentage(2, 10, true)},
+			wantDiscounts: []int64{600, 150},
+			wantApplied: []int{2, 1},
+		},
+		{
+			name: "priority overrides type order",
+			promos: []ecommerce.Promotion{
+				with(fixed(1, 500, true), func(p *ecommerce.Promotion) { p.Priority = 1 }),
+				percentage(2, 10, true),
+			},
+			wantDiscounts: []int64{560, 140},
+			wantApplied: []int{1, 2},
+		},
+		{
+			name: "buy x get y is evaluated before percentage",
+			promos: []ecommerce.Promotion{percentage(1, 10, true), buyXGetYPromo(2, 1, 1, true)},
+			wantDiscounts: []int64{1100, 50},
+			wantApplied: []int{2, 1},
+		},
+		{
+			name: "free shipping is evaluated last",
+			promos: []ecommerce.Promotion{freeShipping(1, true), fixed(2, 100, true)},
+			wantDiscounts: []int64{80, 20},
+			wantFreeShipping: true,
+			wantApplied: []int{2, 1},
+		},
+		{
+			name: "exclusive promotion blocks later stackable promotion",
+			promos: []ecommerce.Promotion{percentage(1, 10, false), percentage(2, 20, true)},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{1},
+			wantRejected: map[int]string{2: reasonNotCombinable},
+		},
+		{
+			name: "exclusive promotion is rejected after stackable promotion",
+			promos: []ecommerce.Promotion{percentage(1, 10, true), percentage(2, 20, false)},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{1},
+			wantRejected: map[int]string{2: reasonNotCombinable},
+		},
+		{
+			name: "exclusive promotion with higher priority wins",
+			promos: []ecommerce.Promotion{
+				percentage(1, 10, true),
+				with(percentage(2, 20, false), func(p *ecommerce.Promotion) { p.Priority = 1 }),
+			},
+			wantDiscounts: []int64{400, 100},
+			wantApplied: []int{2},
+			wantRejected: map[int]string{1: reasonNotCombinable},
+		},
+		{
+			name: "only the first of two exclusive promotions applies",
+			promos: []ecommerce.Promotion{percentage(2, 20, false), percentage(1, 10, false)},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{1},
+			wantRejected: map[int]string{2: reasonNotCombinable},
+		},
+		{
+			name: "exclusive free shipping cannot join a discount",
+			promos: []ecommerce.Promotion{freeShipping(1, false), percentage(2, 10, true)},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{2},
+			wantRejected: map[int]string{1: reasonNotCombinable},
+		},
+		{
+			name: "exclusive promotion that is not eligible does not block others",
+			promos: []ecommerce.Promotion{
+				with(percentage(1, 50, false), func(p *ecommerce.Promotion) { p.MinSpend = usd(10000) }),
+				percentage(2, 10, true),
+			},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{2},
+			wantRejected: map[int]string{1: fmt.Sprintf(reasonMinSpend, "100.00")},
+		},
+		{
+			name: "promotion without effect does not block exclusive promotion",
+			promos: []ecommerce.Promotion{
+				with(buyXGetYPromo(1, 2, 1, true), func(p *ecommerce.Promotion) { p.ProductIDs = []int{2} }),
+				percentage(2, 10, false),
+			},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{2},
+			wantRejected: map[int]string{1: reasonNoDiscount},
+		},
+		{
+			name: "second free shipping has no effect",
+			promos: []ecommerce.Promotion{freeShipping(1, true), freeShipping(2, true)},
+			wantDiscounts: []int64{0, 0},
+			wantFreeShipping: true,
+			wantApplied: []int{1},
+			wantRejected: map[int]string{2: reasonNoDiscount},
+		},
+		{
+			name: "discounts never exceed the line amounts",
+			promos: []ecommerce.Promotion{
+				fixed(1, 10000, true),
+				percentage(2, 10, true),
+			},
+			wantDiscounts: []int64{2000, 500},
+			wantApplied: []int{2, 1},
+		},
+		{
+			name: "nothing left to discount",
+			promos: []ecommerce.Promotion{
+				with(fixed(1, 10000, true), func(p *ecommerce.Promotion) { p.Priority = 1 }),
+				percentage(2, 10, true),
+			},
+			wantDiscounts: []int64{2000, 500},
+			wantApplied: []int{1},
+			wantRejected: map[int]string{2: reasonNoDiscount},
+		},
+		{
+			name: "buy one get one free",
+			promos: []ecommerce.Promotion{with(buyXGetYPromo(1, 1, 1, true), func(p *ecommerce.Promotion) { p.ProductIDs = []int{1} })},
+			wantDiscounts: []int64{1000, 0},
+			wantApplied: []int{1},
+		},
+		{
+			name: "buy x get y makes the cheapest units free",
+			promos: []ecommerce.Promotion{buyXGetYPromo(1, 2, 1, true)},
+			wantDiscounts: []int64{0, 500},
+			wantApplied: []int{1},
+		},
+		{
+			name: "category scope includes subcategories",
+			promos: []ecommerce.Promotion{with(percentage(1, 50, true), func(p *ecommerce.Promotion) { p.CategoryIDs = []int{1} })},
+			wantDiscounts: []int64{1000, 0},
+			wantApplied: []int{1},
+		},
+		{
+			name: "product scope without matching lines",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.ProductIDs = []int{99} })},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: reasonNoEligibleProducts},
+		},
+		{
+			name: "minimum spend counts eligible lines only",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) {
+				p.ProductIDs = []int{2}
+				p.MinSpend = usd(1000)
+			})},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: fmt.Sprintf(reasonMinSpend, "10.00")},
+		},
+		{
+			name: "minimum spend is checked before earlier discounts",
+			promos: []ecommerce.Promotion{
+				percentage(1, 50, true),
+				with(fixed(2, 100, true), func(p *ecommerce.Promotion) { p.MinSpend = usd(2500) }),
+			},
+			wantDiscounts: []int64{1080, 270},
+			wantApplied: []int{1, 2},
+		},
+		{
+			name: "fixed amount rounding goes to the earliest lines",
+			lines: []line{
+				{productID: 1, quantity: 1, unitPrice: usd(1000)},
+				{productID: 2, quantity: 1, unitPrice: usd(1000)},
+				{productID: 3, quantity: 1, unitPrice: usd(1000)},
+			},
+			promos: []ecommerce.Promotion{fixed(1, 100, true)},
+			wantDiscounts: []int64{34, 33, 33},
+			wantApplied: []int{1},
+		},
+		{
+			name: "inactive",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.Active = false })},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: reasonInactive},
+		},
+		{
+			name: "not started",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.StartsAt = timeRef(now.Add(time.Second)) })},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: reasonNotStarted},
+		},
+		{
+			name: "starts now",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.StartsAt = timeRef(now) })},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{1},
+		},
+		{
+			name: "ends now",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.EndsAt = timeRef(now) })},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: reasonExpired},
+		},
+		{
+			name: "global usage limit reached",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.UsageLimit = 5 })},
+			usages: map[int]usage{1: {total: 5}},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: reasonUsageLimit},
+		},
+		{
+			name: "customer usage limit reached",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) { p.PerCustomerLimit = 1 })},
+			usages: map[int]usage{1: {total: 3, customer: 1}},
+			wantDiscounts: []int64{0, 0},
+			wantRejected: map[int]string{1: reasonCustomerLimit},
+		},
+		{
+			name: "usage below limits",
+			promos: []ecommerce.Promotion{with(percentage(1, 10, true), func(p *ecommerce.Promotion) {
+				p.UsageLimit = 5
+				p.PerCustomerLimit = 2
+			})},
+			usages: map[int]usage{1: {total: 4, customer: 1}},
+			wantDiscounts: []int64{200, 50},
+			wantApplied: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := tt.lines
+			if lines == nil {
+				lines = testLines
+			}
+
+			res := evaluate(lines, tt.promos, tt.usages, now)
+
+			discounts := make([]int64, len(res.lineDiscounts))
+			for i, d := range res.lineDiscounts {
+				discounts[i] = d.Amount
+			}
+			if !reflect.DeepEqual(discounts, tt.wantDiscounts) {
+				t.Fatalf("wanted discounts %v, got %v", tt.wantDiscounts, discounts)
+			}
+
+			if res.freeShipping != tt.wantFreeShipping {
+				t.Fatalf("wanted free shipping %v, got %v", tt.wantFreeShipping, res.freeShipping)
+			}
+
+			var applied []int
+			for _, a := range res.applied {
+				applied = append(applied, a.ID)
+			}
+			if !reflect.DeepEqual(applied, tt.wantApplied) {
+				t.Fatalf("wanted applied %v, got %v", tt.wantApplied, applied)
+			}
+
+			rejected := make(map[int]string)
+			for _, r := range res.rejected {
+				rejected[r.ID] = r.Reason
+			}
+			if tt.wantRejected == nil {
+				tt.wantRejected = map[int]string{}
+			}
+			if !reflect.DeepEqual(rejected, tt.wantRejected) {
+				t.Fatalf("wanted rejected %v, got %v", tt.wantRejected, rejected)
+			}
+		})
+	}
+}
+
+func TestEvaluateIsIndependentOfInputOrder(t *testing.T) {
+	promos := []ecommerce.Promotion{
+		percentage(1, 10, true),
+		fixed(2, 300, true),
+		buyXGetYPromo(3, 1, 1, true),
+		with(percentage(4, 15, false), func(p *ecommerce.Promotion) { p.Priority = -1 }),
+		freeShipping(5, true),
+	}
+
+	want := evaluate(testLines, promos, nil, now)
+
+	reversed := make([]ecommerce.Promotion, len(promos))
+	for i, p := range promos {
+		reversed[len(promos)-1-i] = p
+	}
+	got := evaluate(testLines, reversed, nil, now)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wanted %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,386 @@
+package promotion
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type repository interface {
+	SavePromotionWithTx(tx *sql.Tx, p *ecommerce.Promotion) (int, error)
+	UpdatePromotionWithTx(tx *sql.Tx, p *ecommerce.Promotion) error
+	Promotion(id int) (*ecommerce.Promotion, error)
+	PromotionByCode(code string) (*ecommerce.Promotion, error)
+	Promotions() ([]ecommerce.Promotion, error)
+	AutomaticPromotions() ([]ecommerce.Promotion, error)
+	CartPromotions(custID int) ([]ecommerce.Promotion, error)
+	AddCartPromotion(custID, promotionID int) error
+	DeleteCartPromotion(custID, promotionID int) error
+	DeleteCartPromotionsWithTx(tx *sql.Tx, custID int) error
+	RedemptionCounts(ids []int, custID int) (map[int]int, map[int]int, error)
+	LockPromotionWithTx(tx *sql.Tx, id int) error
+	RedemptionCountWithTx(tx *sql.Tx, id, custID int) (int, int, error)
+	SaveRedemptionWithTx(tx *sql.Tx, promotionID, custID, orderID int, discount ecommerce.Money) error
+	Tx() (*sql.Tx, error)
+}
+
+func New(db *sql.DB, repo repository, userService ecommerce.UserService, productService ecommerce.ProductService) *service {
+	return &service{db: db, r: repo, userService: userService, productService: productService}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	userService ecommerce.UserService
+	productService ecommerce.ProductService
+}
+
+func (s *service) CreatePromotion(p *ecommerce.Promotion) (int, error) {
+	const op = "promotionService.CreatePromotion"
+
+	if err := s.validatePromotion(p); err != nil {
+		return 0, errors2.Wrap(err, op, "validating promotion")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	id, err := s.r.SavePromotionWithTx(tx, p)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving promotion")
+	}
+	p.ID = id
+
+	return id, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) UpdatePromotion(p *ecommerce.Promotion) error {
+	const op = "promotionService.UpdatePromotion"
+
+	if _, err := s.r.Promotion(p.ID); err != nil {
+		return errors2.Wrap(err, op, "getting promotion")
+	}
+
+	if err := s.validatePromotion(p); err != nil {
+		return errors2.Wrap(err, op, "validating promotion")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	err = s.r.UpdatePromotionWithTx(tx, p)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating promotion")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) Promotion(id int) (*ecommerce.Promotion, error) {
+	const op = "promotionService.Promotion"
+
+	p, err := s.r.Promotion(id)
+
+	return p, errors2.Wrap(err, op, "getting promotion from repo")
+}
+
+func (s *service) Promotions() ([]ecommerce.Promotion, error) {
+	const op = "promotionService.Promotions"
+
+	pp, err := s.r.Promotions()
+
+	return pp, errors2.Wrap(err, op, "getting promotions from repo")
+}
+
+// validatePromotion normalizes the code of p to upper case and checks that p
+// is well formed and that no other promotion uses its code.
+func (s *service) validatePromotion(p *ecommerce.Promotion) error {
+	p.Code = strings.ToUpper(strings.TrimSpace(p.Code))
+	p.Name = strings.TrimSpace(p.Name)
+
+	invalid := func(msg string) error {
+		return &errors2.Invalid{Err: errors.New(msg)}
+	}
+
+	switch {
+	case len(p.Code) > 32:
+		return invalid("code must be at most 32 characters")
+	case strings.ContainsAny(p.Code, " \t\n"):
+		return invalid("code cannot contain spaces")
+	case p.Name == "" || len(p.Name) > 64:
+		return invalid("name is required and must be at most 64 characters")
+	case p.MinSpend.Amount < 0:
+		return invalid("minimum spend cannot be negative")
+	case p.MinSpend.Currency != "" && p.MinSpend.Currency != ecommerce.DefaultCurrency:
+		return invalid("minimum spend must be in " + ecommerce.DefaultCurrency)
+	case p.UsageLimit < 0 || p.PerCustomerLimit < 0:
+		return invalid("usage limits cannot be negative")
+	case p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt):
+		return invalid("promotion must end after it starts")
+	}
+
+	switch p.Type {
+	case ecommerce.PromotionTypePercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return invalid("percentage must be greater than 0 and at most 100")
+		}
+	case ecommerce.PromotionTypeFixedAmount:
+		if p.Amount.Amount <= 0 {
+			return invalid("amount must be greater than 0")
+		} else if p.Amount.Currency != ecommerce.DefaultCurrency {
+			return invalid("amount must be in " + ecommerce.DefaultCurrency)
+		}
+		p.Value = 0
+	case ecommerce.PromotionTypeBuyXGetY:
+		if p.BuyQuantity < 1 || p.GetQuantity < 1 {
+			return invalid("buy and get quantities must be at least 1")
+		}
+		p.Value = 0
+	case ecommerce.PromotionTypeFreeShipping:
+		p.Value = 0
+	default:
+		return invalid("unknown promotion type")
+	}
+
+	if p.Type != ecommerce.PromotionTypeBuyXGetY {
+		p.BuyQuantity, p.GetQuantity = 0, 0
+	}
+	if p.Type != ecommerce.PromotionTypeFixedAmount {
+		p.Amount = ecommerce.Money{}
+	}
+	// the engine compares the minimum spend with cart totals in the catalog currency
+	p.MinSpend.Currency = ecommerce.DefaultCurrency
+
+	if p.Code != "" {
+		other, err := s.r.PromotionByCode(p.Code)
+		if err != nil {
+			if _, ok := errors2.Unwrap(err).(*errors2.NotFound); !ok {
+				return err
+			}
+		} else if other.ID != p.ID {
+			return invalid("code is already used by another promotion")
+		}
+	}
+
+	return nil
+}
+
+// ApplyCoupon adds the promotion with code to the cart of a customer if it applies
+// to the cart together with the promotions already there and returns the new totals.
+func (s *service) ApplyCoupon(custID int, code string) (*ecommerce.CartTotals, error) {
+	const op = "promotionService.ApplyCoupon"
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("coupon code is required")}, op, "validating code")
+	}
+
+	p, err := s.r.PromotionByCode(code)
+	if err != nil {
+		if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+			return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("coupon code is not valid")}, op, "getting promotion")
+		}
+		return nil, errors2.Wrap(err, op, "getting promotion")
+	}
+
+	promos, err := s.cartPromotions(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting cart promotions")
+	}
+
+	applied := false
+	for _, cp := range promos {
+		if cp.ID == p.ID {
+			applied = true
+		}
+	}
+	if !applied {
+		promos = append(promos, *p)
+	}
+
+	totals, err := s.totals(custID, promos)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "computing totals")
+	}
+
+	for _, r := range totals.Rejected {
+		if r.ID == p.ID {
+			return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New(r.Reason)}, op, "evaluating coupon")
+		}
+	}
+
+	if !applied {
+		err = s.r.AddCartPromotion(custID, p.ID)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "adding coupon to cart")
+		}
+	}
+
+	return totals, nil
+}
+
+func (s *service) RemoveCoupon(custID int, code string) error {
+	const op = "promotionService.RemoveCoupon"
+
+	p, err := s.r.PromotionByCode(strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return errors2.Wrap(err, op, "getting promotion")
+	}
+
+	return errors2.Wrap(s.r.DeleteCartPromotion(custID, p.ID), op, "removing coupon from cart")
+}
+
+// CartTotals prices the cart of a customer with its coupons and all automatic promotions.
+func (s *service) CartTotals(custID int) (*ecommerce.CartTotals, error) {
+	const op = "promotionService.CartTotals"
+
+	promos, err := s.cartPromotions(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting cart promotions")
+	}
+
+	totals, err := s.totals(custID, promos)
+
+	return totals, errors2.Wrap(err, op, "computing totals")
+}
+
+// RedeemWithTx records the promotions applied to totals as redeemed by an order and
+// removes the coupons from the cart. It fails if a usage limit was reached since the
+// totals were computed.
+func (s *service) RedeemWithTx(tx *sql.Tx, custID, orderID int, totals *ecommerce.CartTotals) error {
+	const op = "promotionService.RedeemWithTx"
+
+	for _, a := range totals.Applied {
+		p, err := s.r.Promotion(a.ID)
+		if err != nil {
+			return errors2.Wrap(err, op, "getting promotion")
+		}
+
+		// lock the promotion so concurrent checkouts cannot both take its last use
+		err = s.r.LockPromotionWithTx(tx, p.ID)
+		if err != nil {
+			return errors2.Wrap(err, op, "locking promotion")
+		}
+
+		total, customer, err := s.r.RedemptionCountWithTx(tx, p.ID, custID)
+		if err != nil {
+			return errors2.Wrap(err, op, "counting redemptions")
+		}
+
+		if (p.UsageLimit > 0 && total >= p.UsageLimit) || (p.PerCustomerLimit > 0 && customer >= p.PerCustomerLimit) {
+			msg := fmt.Sprintf("promotion %q has reached its usage limit", p.Name)
+			return errors2.Wrap(&errors2.Invalid{Err: errors.New(msg)}, op, "checking usage limits")
+		}
+
+		err = s.r.SaveRedemptionWithTx(tx, p.ID, custID, orderID, a.Discount)
+		if err != nil {
+			return errors2.Wrap(err, op, "saving redemption")
+		}
+	}
+
+	return errors2.Wrap(s.r.DeleteCartPromotionsWithTx(tx, custID), op, "removing coupons from cart")
+}
+
+// cartPromotions returns the automatic promotions followed by the coupons of the cart.
+func (s *service) cartPromotions(custID int) ([]ecommerce.Promotion, error) {
+	promos, err := s.r.AutomaticPromotions()
+	if err != nil {
+		return nil, err
+	}
+
+	coupons, err := s.r.CartPromotions(custID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(promos, coupons...), nil
+}
+
+// totals evaluates promos against the cart of a customer.
+func (s *service) totals(custID int, promos []ecommerce.Promotion) (*ecommerce.CartTotals, error) {
+	items, err := s.userService.CartItems(custID)
+	if err != nil {
+		return nil, err
+	}
+
+	// category chains are shared by many lines, so look each one up once
+	chains := make(map[int][]int)
+	lines := make([]line, len(items))
+	for i, item := range items {
+		chain, ok := chains[item.Product.CategoryID]
+		if !ok {
+			crumbs, err := s.productService.CategoryBreadcrumbs(item.Product.CategoryID)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range crumbs {
+				chain = append(chain, c.ID)
+			}
+			chains[item.Product.CategoryID] = chain
+		}
+
+		lines[i] = line{
+			productID: item.Product.ID,
+			categoryIDs: chain,
+			quantity: item.Quantity,
+			unitPrice: item.UnitPrice(),
+		}
+	}
+
+	ids := make([]int, len(promos))
+	for i, p := range promos {
+		ids[i] = p.ID
+	}
+	totalCounts, customerCounts, err := s.r.RedemptionCounts(ids, custID)
+	if err != nil {
+		return nil, err
+	}
+	usages := make(map[int]usage)
+	for _, id := range ids {
+		usages[id] = usage{total: totalCounts[id], customer: customerCounts[id]}
+	}
+
+	res := evaluate(lines, promos, usages, time.Now())
+
+	t := &ecommerce.CartTotals{
+		Lines: make([]ecommerce.CartLine, len(items)),
+		FreeShipping: res.freeShipping,
+		Applied: res.applied,
+		Rejected: res.rejected,
+	}
+	zero := ecommerce.NewMoney(0, ecommerce.DefaultCurrency)
+	subtotal, discount := zero, zero
+	for i, item := range items {
+		lineTotal := lines[i].unitPrice.Mul(int64(lines[i].quantity))
+		t.Lines[i] = ecommerce.CartLine{
+			ProductID: item.Product.ID,
+			VariantID: item.VariantID,
+			Quantity: item.Quantity,
+			UnitPrice: lines[i].unitPrice,
+			Subtotal: lineTotal,
+			Discount: zero.Add(res.lineDiscounts[i]),
+			TaxCategory: item.Product.TaxCategory,
+			Weight: item.Product.Weight,
+		}
+		subtotal = subtotal.Add(lineTotal)
+		discount = discount.Add(res.lineDiscounts[i])
+	}
+	t.Subtotal = subtotal
+	t.Discount = discount
+	t.Total = subtotal.Sub(discount)
+
+	if t.Applied == nil { t.Applied = []ecommerce.AppliedPromotion{} }
+	if t.Rejected == nil { t.Rejected = []ecommerce.RejectedPromotion{} }
+
+	return t, nil
+}
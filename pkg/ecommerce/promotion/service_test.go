@@ -0,0 +1,33 @@
+package promotion
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+func TestValidatePromotionMinSpendCurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		minSpend ecommerce.Money
+		ok bool
+	}{
+		{"no minimum spend", ecommerce.Money{}, true},
+		{"minimum spend in the catalog currency", usd(1000), true},
+		{"zero minimum spend in another currency", ecommerce.NewMoney(0, "EUR"), false},
+		{"minimum spend in another currency", ecommerce.NewMoney(1000, "EUR"), false},
+	}
+
+	s := &service{}
+	for _, tt := range tests {
+		p := percentage(1, 10, false)
+		p.Name = "Summer sale"
+		p.MinSpend = tt.minSpend
+
+		err := s.validatePromotion(&p)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: wanted ok %t, got %v", tt.name, tt.ok, err)
+		} else if err == nil && p.MinSpend.Currency != ecommerce.DefaultCurrency {
+			t.Errorf("%s: wanted the minimum spend in %s, got %s", tt.name, ecommerce.DefaultCurrency, p.MinSpend.Currency)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ecommerce
+
+import "time"
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved = "approved"
+	ReturnStatusRejected = "rejected"
+	ReturnStatusReceived = "received"
+	// ReturnStatusRefunded is the status of returns with at least one refund. Returns
+	// can be refunded in several parts until the refundable amount is used up.
+	ReturnStatusRefunded = "refunded"
+)
+
+// ReturnService handles returns of delivered order items (RMA). A customer requests a
+// return, an admin approves or rejects it, receives the items, which puts them back
+// into stock, and refunds them. Every step is recorded in the return's events and
+// the customer is notified by email.
+type ReturnService interface {
+	RequestReturn(r *Return) (int, error)
+	Return(id int) (*Return, error)
+	// Returns returns the returns of a customer, or of all customers if custID is 0,
+	// with status, or with any status if it is empty.
+	Returns(custID int, status string) ([]Return, error)
+	// UpdateReturnStatus moves a return to approved, rejected or received.
+	UpdateReturnStatus(id, adminID int, status, note string) error
+	// Refund refunds amount, in the currency of the order, of a received return. The
+	// refunds of a return cannot exceed what was paid for its items.
+	Refund(id, adminID int, amount Money, note string) (*Return, error)
+}
+
+type Return struct {
+	ID int `json:"id"`
+	OrderID int `json:"order_id"`
+	CustomerID int `json:"customer_id"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	Items []ReturnItem `json:"items"`
+	// Refunded is the sum of the refunds of the return.
+	Refunded Money `json:"refunded"`
+	CreatedAt time.Time `json:"created_at"`
+	Events []ReturnEvent `json:"events"`
+}
+
+type ReturnItem struct {
+	OrderItemID int `json:"order_item_id"`
+	Quantity int `json:"quantity"`
+}
+
+// ReturnEvent is an entry of the audit trail of a return: a change of its status or
+// a refund, by whom and when.
+type ReturnEvent struct {
+	ID int `json:"id"`
+	Status string `json:"status"`
+	// ActorID is the user who made the change.
+	ActorID int `json:"actor_id"`
+	Note string `json:"note,omitempty"`
+	// Amount is the amount refunded by refund events.
+	Amount *Money `json:"amount,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,144 @@
+package returns
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"fmt"
+)
+
+// transitions lists the statuses admins can move a return to from each status.
+// Refunds move received returns to refunded on their own.
+var transitions = map[string][]string{
+	ecommerce.ReturnStatusRequested: {ecommerce.ReturnStatusApproved, ecommerce.ReturnStatusRejected},
+	ecommerce.ReturnStatusApproved: {ecommerce.ReturnStatusReceived, ecommerce.ReturnStatusRejected},
+}
+
+func canMove(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// deliveredQuantities returns the delivered units of every item of o keyed by order
+// item id. All units of delivered orders count, e.g. when the status was set by hand.
+func deliveredQuantities(o *ecommerce.Order, ss []ecommerce.Shipment) map[int]int {
+	delivered := make(map[int]int)
+	if o.Status == ecommerce.OrderStatusDelivered {
+		for _, item := range o.Items {
+			delivered[item.ID] = item.Quantity
+		}
+		return delivered
+	}
+
+	for _, s := range ss {
+		if s.Status != ecommerce.ShipmentStatusDelivered {
+			continue
+		}
+		for _, item := range s.Items {
+			delivered[item.OrderItemID] += item.Quantity
+		}
+	}
+	return delivered
+}
+
+// returnable merges items by order item and checks that they are delivered units of
+// o that are not part of another return that was not rejected.
+func returnable(o *ecommerce.Order, delivered map[int]int, others []ecommerce.Return, items []ecommerce.ReturnItem) ([]ecommerce.ReturnItem, error) {
+	if len(items) < 1 {
+		return nil, errors.New("a return needs at least one item")
+	}
+
+	left := make(map[int]int)
+	for id, n := range delivered {
+		left[id] = n
+	}
+	for _, r := range others {
+		if r.Status == ecommerce.ReturnStatusRejected {
+			continue
+		}
+		for _, item := range r.Items {
+			left[item.OrderItemID] -= item.Quantity
+		}
+	}
+
+	var merged []ecommerce.ReturnItem
+	index := make(map[int]int)
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, errors.New("return item quantities must be at least 1")
+		}
+
+		i, ok := index[item.OrderItemID]
+		if !ok {
+			i = len(merged)
+			index[item.OrderItemID] = i
+			merged = append(merged, ecommerce.ReturnItem{OrderItemID: item.OrderItemID})
+		}
+		merged[i].Quantity += item.Quantity
+	}
+
+	for _, item := range merged {
+		if orderItem(o, item.OrderItemID) == nil {
+			return nil, fmt.Errorf("order %d has no item %d", o.ID, item.OrderItemID)
+		} else if item.Quantity > left[item.OrderItemID] {
+			return nil, fmt.Errorf("only %d delivered units of order item %d can be returned", max(left[item.OrderItemID], 0), item.OrderItemID)
+		}
+	}
+
+	return merged, nil
+}
+
+func orderItem(o *ecommerce.Order, id int) *ecommerce.OrderItem {
+	for i := range o.Items {
+		if o.Items[i].ID == id {
+			return &o.Items[i]
+		}
+	}
+	return nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// paid returns what the customer paid for quantity units of item: their share of the
+// line after discount, including tax that was added on top of the prices.
+func paid(item *ecommerce.OrderItem, taxInclusive bool, quantity int) ecommerce.Money {
+	line := item.UnitPrice.Mul(int64(item.Quantity)).Sub(item.Discount)
+	if !taxInclusive {
+		line = line.Add(item.Tax)
+	}
+	return line.MulFrac(int64(quantity), int64(item.Quantity))
+}
+
+// refundable returns what can still be refunded for r, a return of o: what was paid
+// for its items less its refunds, but no more than the order total less the refunds
+// of all returns of the order.
+func refundable(o *ecommerce.Order, r *ecommerce.Return, all []ecommerce.Return) ecommerce.Money {
+	left := ecommerce.NewMoney(0, o.Total.Currency)
+	for _, ri := range r.Items {
+		if item := orderItem(o, ri.OrderItemID); item != nil {
+			left = left.Add(paid(item, o.TaxInclusive, ri.Quantity))
+		}
+	}
+	left = left.Sub(r.Refunded)
+
+	orderLeft := o.Total
+	for _, other := range all {
+		orderLeft = orderLeft.Sub(other.Refunded)
+	}
+
+	if orderLeft.Cmp(left) < 0 {
+		left = orderLeft
+	}
+	if left.Amount < 0 {
+		left.Amount = 0
+	}
+	return left
+}
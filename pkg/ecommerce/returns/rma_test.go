@@ -0,0 +1,135 @@
+package returns
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"reflect"
+	"testing"
+)
+
+func usd(amount int64) ecommerce.Money {
+	return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+}
+
+// testOrder has two units of item 10 at 10.00 with 2.00 off and 1.44 tax on top and
+// one unit of item 11 at 5.00 without discount and 0.40 tax, plus 4.99 shipping.
+var testOrder = &ecommerce.Order{
+	ID: 1,
+	Status: ecommerce.OrderStatusShipped,
+	Items: []ecommerce.OrderItem{
+		{ID: 10, Quantity: 2, UnitPrice: usd(1000), Discount: usd(200), Tax: usd(144)},
+		{ID: 11, Quantity: 1, UnitPrice: usd(500), Discount: usd(0), Tax: usd(40)},
+	},
+	Total: usd(2783),
+}
+
+func TestReturnable(t *testing.T) {
+	delivered := deliveredQuantities(testOrder, []ecommerce.Shipment{
+		{Status: ecommerce.ShipmentStatusDelivered, Items: []ecommerce.ShipmentItem{{OrderItemID: 10, Quantity: 2}}},
+		{Status: ecommerce.ShipmentStatusShipped, Items: []ecommerce.ShipmentItem{{OrderItemID: 11, Quantity: 1}}},
+	})
+
+	tests := []struct {
+		name string
+		others []ecommerce.Return
+		items []ecommerce.ReturnItem
+		want []ecommerce.ReturnItem
+		ok bool
+	}{
+		{
+			name: "delivered units",
+			items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 1}, {OrderItemID: 10, Quantity: 1}},
+			want: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 2}},
+			ok: true,
+		},
+		{
+			name: "units that are not delivered yet",
+			items: []ecommerce.ReturnItem{{OrderItemID: 11, Quantity: 1}},
+		},
+		{
+			name: "units of another return",
+			others: []ecommerce.Return{{Status: ecommerce.ReturnStatusApproved, Items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 2}}}},
+			items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 1}},
+		},
+		{
+			name: "units of a rejected return",
+			others: []ecommerce.Return{{Status: ecommerce.ReturnStatusRejected, Items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 2}}}},
+			items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 1}},
+			want: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 1}},
+			ok: true,
+		},
+		{
+			name: "item of another order",
+			items: []ecommerce.ReturnItem{{OrderItemID: 12, Quantity: 1}},
+		},
+		{
+			name: "no items",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := returnable(testOrder, delivered, tt.others, tt.items)
+			if (err == nil) != tt.ok {
+				t.Fatalf("wanted ok %v, got error %v", tt.ok, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRefundable(t *testing.T) {
+	one := ecommerce.Return{ID: 1, Items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 1}}, Refunded: usd(0)}
+	both := ecommerce.Return{ID: 2, Items: []ecommerce.ReturnItem{{OrderItemID: 10, Quantity: 2}, {OrderItemID: 11, Quantity: 1}}, Refunded: usd(0)}
+
+	tests := []struct {
+		name string
+		r ecommerce.Return
+		all []ecommerce.Return
+		want int64
+	}{
+		// (2 * 10.00 - 2.00 + 1.44) / 2
+		{"one unit", one, nil, 972},
+		{"one unit partly refunded", with(one, 500), nil, 472},
+		{"all items", both, nil, 1944 + 540},
+		{"capped at the order total", both, []ecommerce.Return{with(one, 2000)}, 783},
+		{"fully refunded", with(one, 972), nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all := append(tt.all, tt.r)
+			got := refundable(testOrder, &tt.r, all)
+			if got.Amount != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got.Amount)
+			}
+		})
+	}
+}
+
+func with(r ecommerce.Return, refunded int64) ecommerce.Return {
+	r.Refunded = usd(refunded)
+	return r
+}
+
+func TestCanMove(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want bool
+	}{
+		{ecommerce.ReturnStatusRequested, ecommerce.ReturnStatusApproved, true},
+		{ecommerce.ReturnStatusRequested, ecommerce.ReturnStatusReceived, false},
+		{ecommerce.ReturnStatusApproved, ecommerce.ReturnStatusReceived, true},
+		{ecommerce.ReturnStatusRejected, ecommerce.ReturnStatusApproved, false},
+		{ecommerce.ReturnStatusReceived, ecommerce.ReturnStatusRejected, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := canMove(tt.from, tt.to); got != tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
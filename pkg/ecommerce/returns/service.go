@@ -0,0 +1,322 @@
+package returns
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type repository interface {
+	SaveReturnWithTx(tx *sql.Tx, r *ecommerce.Return) (int, error)
+	UpdateReturnStatusWithTx(tx *sql.Tx, id int, status string) error
+	SaveEventWithTx(tx *sql.Tx, returnID int, e *ecommerce.ReturnEvent) error
+	Return(id int) (*ecommerce.Return, error)
+	Returns(custID int, status string) ([]ecommerce.Return, error)
+	OrderReturnsWithTx(tx *sql.Tx, orderID int) ([]ecommerce.Return, error)
+	Tx() (*sql.Tx, error)
+}
+
+type orderRepo interface {
+	Order(id int) (*ecommerce.Order, error)
+	OrderStatusWithTx(tx *sql.Tx, id int) (string, error)
+}
+
+func New(
+	db *sql.DB,
+	repo repository,
+	orderRepo orderRepo,
+	userService ecommerce.UserService,
+	productService ecommerce.ProductService,
+	fulfilmentService ecommerce.FulfilmentService,
+	mailService ecommerce.MailService) *service {
+	return &service{
+		db: db,
+		r: repo,
+		orderRepo: orderRepo,
+		userService: userService,
+		productService: productService,
+		fulfilmentService: fulfilmentService,
+		mailService: mailService,
+	}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	orderRepo orderRepo
+	userService ecommerce.UserService
+	productService ecommerce.ProductService
+	fulfilmentService ecommerce.FulfilmentService
+	mailService ecommerce.MailService
+}
+
+// RequestReturn requests the return of delivered items of an order of r.CustomerID.
+func (s *service) RequestReturn(r *ecommerce.Return) (int, error) {
+	const op = "returnService.RequestReturn"
+
+	r.Reason = strings.TrimSpace(r.Reason)
+	if r.Reason == "" || len(r.Reason) > 1024 {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("reason is required and must be at most 1024 characters")}, op, "validating return")
+	}
+
+	o, err := s.orderRepo.Order(r.OrderID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting order")
+	} else if o.CustomerID != r.CustomerID {
+		return 0, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting order")
+	}
+
+	ss, err := s.fulfilmentService.Shipments(o.ID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting shipments")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	// returns of an order are changed with the order locked
+	if _, err = s.orderRepo.OrderStatusWithTx(tx, o.ID); err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "locking order")
+	}
+
+	others, err := s.r.OrderReturnsWithTx(tx, o.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "getting returns of order")
+	}
+
+	r.Items, err = returnable(o, deliveredQuantities(o, ss), others, r.Items)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(&errors2.Invalid{Err: err}, op, "checking items")
+	}
+	r.Status = ecommerce.ReturnStatusRequested
+	r.Refunded = ecommerce.NewMoney(0, o.Total.Currency)
+	r.CreatedAt = time.Now()
+
+	r.ID, err = s.r.SaveReturnWithTx(tx, r)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving return")
+	}
+
+	e := ecommerce.ReturnEvent{Status: r.Status, ActorID: r.CustomerID, Note: r.Reason, CreatedAt: r.CreatedAt}
+	if err = s.r.SaveEventWithTx(tx, r.ID, &e); err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving event")
+	}
+	r.Events = []ecommerce.ReturnEvent{e}
+
+	msg := fmt.Sprintf("We received your return request #%d for order #%d and will get back to you shortly.", r.ID, r.OrderID)
+	if err = s.notifyWithTx(tx, r, msg, ""); err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "notifying customer")
+	}
+
+	return r.ID, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) Return(id int) (*ecommerce.Return, error) {
+	const op = "returnService.Return"
+
+	r, err := s.r.Return(id)
+
+	return r, errors2.Wrap(err, op, "getting return from repo")
+}
+
+func (s *service) Returns(custID int, status string) ([]ecommerce.Return, error) {
+	const op = "returnService.Returns"
+
+	switch status {
+	case "", ecommerce.ReturnStatusRequested, ecommerce.ReturnStatusApproved, ecommerce.ReturnStatusRejected,
+		ecommerce.ReturnStatusReceived, ecommerce.ReturnStatusRefunded:
+	default:
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("unknown return status")}, op, "validating status")
+	}
+
+	rr, err := s.r.Returns(custID, status)
+
+	return rr, errors2.Wrap(err, op, "getting returns from repo")
+}
+
+// UpdateReturnStatus approves, rejects or receives a return. Received items are put
+// back into stock.
+func (s *service) UpdateReturnStatus(id, adminID int, status, note string) error {
+	const op = "returnService.UpdateReturnStatus"
+
+	if len(note) > 1024 {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("note must be at most 1024 characters")}, op, "validating note")
+	}
+
+	r, o, _, tx, err := s.lock(id)
+	if err != nil {
+		return errors2.Wrap(err, op, "locking return")
+	}
+
+	if !canMove(r.Status, status) {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.Invalid{Err: fmt.Errorf("a %s return cannot be %s", r.Status, status)}, op, "checking status")
+	}
+
+	if status == ecommerce.ReturnStatusReceived {
+		for _, ri := range r.Items {
+			if err = s.restockWithTx(tx, orderItem(o, ri.OrderItemID), ri.Quantity); err != nil {
+				_ = tx.Rollback()
+				return errors2.Wrap(err, op, "restocking")
+			}
+		}
+	}
+
+	err = s.r.UpdateReturnStatusWithTx(tx, r.ID, status)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating status")
+	}
+
+	e := ecommerce.ReturnEvent{Status: status, ActorID: adminID, Note: strings.TrimSpace(note), CreatedAt: time.Now()}
+	if err = s.r.SaveEventWithTx(tx, r.ID, &e); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "saving event")
+	}
+
+	msg := fmt.Sprintf("Your return #%d for order #%d was %s.", r.ID, r.OrderID, status)
+	if err = s.notifyWithTx(tx, r, msg, e.Note); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "notifying customer")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) Refund(id, adminID int, amount ecommerce.Money, note string) (*ecommerce.Return, error) {
+	const op = "returnService.Refund"
+
+	if len(note) > 1024 {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("note must be at most 1024 characters")}, op, "validating note")
+	}
+
+	r, o, all, tx, err := s.lock(id)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "locking return")
+	}
+
+	var invalid error
+	left := refundable(o, r, all)
+	switch {
+	case r.Status != ecommerce.ReturnStatusReceived && r.Status != ecommerce.ReturnStatusRefunded:
+		invalid = fmt.Errorf("a %s return cannot be refunded, its items must be received first", r.Status)
+	case amount.Currency != o.Total.Currency:
+		invalid = fmt.Errorf("refunds of order %d must be in %s", o.ID, o.Total.Currency)
+	case amount.Amount <= 0:
+		invalid = errors.New("refund amount must be greater than zero")
+	case amount.Cmp(left) > 0:
+		invalid = fmt.Errorf("at most %s %s can be refunded", left, left.Currency)
+	}
+	if invalid != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(&errors2.Invalid{Err: invalid}, op, "validating amount")
+	}
+
+	err = s.r.UpdateReturnStatusWithTx(tx, r.ID, ecommerce.ReturnStatusRefunded)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "updating status")
+	}
+
+	e := ecommerce.ReturnEvent{Status: ecommerce.ReturnStatusRefunded, ActorID: adminID, Note: strings.TrimSpace(note),
+		Amount: &amount, CreatedAt: time.Now()}
+	if err = s.r.SaveEventWithTx(tx, r.ID, &e); err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "saving event")
+	}
+
+	msg := fmt.Sprintf("We refunded %s %s for your return #%d for order #%d.", amount, amount.Currency, r.ID, r.OrderID)
+	if err = s.notifyWithTx(tx, r, msg, ""); err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "notifying customer")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors2.Wrap(err, op, "committing tx")
+	}
+
+	r, err = s.r.Return(id)
+
+	return r, errors2.Wrap(err, op, "getting return from repo")
+}
+
+// lock returns the return with id, its order and all returns of the order as seen by
+// a new tx, in which the order is locked so that its returns cannot change concurrently.
+// The caller is responsible for committing or rolling back the transaction.
+func (s *service) lock(id int) (*ecommerce.Return, *ecommerce.Order, []ecommerce.Return, *sql.Tx, error) {
+	r, err := s.r.Return(id)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	o, err := s.orderRepo.Order(r.OrderID)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if _, err = s.orderRepo.OrderStatusWithTx(tx, o.ID); err != nil {
+		_ = tx.Rollback()
+		return nil, nil, nil, nil, err
+	}
+
+	rr, err := s.r.OrderReturnsWithTx(tx, o.ID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, nil, nil, nil, err
+	}
+	for i := range rr {
+		if rr[i].ID == id {
+			return &rr[i], o, rr, tx, nil
+		}
+	}
+
+	_ = tx.Rollback()
+	return nil, nil, nil, nil, &errors2.NotFound{Err: sql.ErrNoRows}
+}
+
+// restockWithTx puts quantity units of item back into the stock of its product or variant.
+// The stock is changed relative to its current value, so that a restock racing a checkout
+// of the same product does not lose either change.
+func (s *service) restockWithTx(tx *sql.Tx, item *ecommerce.OrderItem, quantity int) error {
+	err := s.productService.AdjustStockWithTx(tx, item.Product.ID, item.VariantID, quantity)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		// the product or variant no longer exists, so there is no stock to put the units back into
+		return nil
+	}
+
+	return err
+}
+
+// notifyWithTx emails msg and the note of an admin, if any, about r to its customer
+// as part of tx, so that the email is only sent if the change it reports is committed.
+// Nobody is emailed if the customer deleted their account.
+func (s *service) notifyWithTx(tx *sql.Tx, r *ecommerce.Return, msg, note string) error {
+	if r.CustomerID == 0 {
+		return nil
+	}
+
+	u, err := s.userService.User(r.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	return s.mailService.EnqueueWithTx(tx, u.Email, ecommerce.EmailReturnUpdate,
+		&ecommerce.ReturnUpdateEmail{Name: u.FirstName, ReturnID: r.ID, Message: msg, Note: note})
+}
@@ -0,0 +1,39 @@
+package ecommerce
+
+import "time"
+
+const (
+	ReviewStatusPending = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+const (
+	ReviewSortNewest = "newest"
+	ReviewSortOldest = "oldest"
+	ReviewSortHighestRating = "rating_high"
+	ReviewSortLowestRating = "rating_low"
+	ReviewSortMostHelpful = "helpful"
+)
+
+type ReviewService interface {
+	CreateReview(r *Review) (int, error)
+	ProductReviews(productID int, sort string, page int, size int) ([]Review, error)
+	ReviewsByStatus(status string, page int, size int) ([]Review, error)
+	ModerateReview(reviewID int, status string) error
+	VoteReviewHelpful(reviewID, userID int) (int, error)
+}
+
+// Review is a customer's rating of a product. Only approved reviews are
+// shown publicly and count towards the product rating.
+type Review struct {
+	ID int `json:"id"`
+	ProductID int `json:"product_id"`
+	CustomerID int `json:"customer_id"`
+	Rating int `json:"rating"`
+	Title string `json:"title"`
+	Body string `json:"body"`
+	Status string `json:"status"`
+	HelpfulCount int `json:"helpful_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package review
+
+import "ecommerce/pkg/ecommerce"
+
+// ratingChange returns what moving r to status adds to the rating sum and review count
+// of its product. Only approved reviews count towards the rating.
+func ratingChange(r *ecommerce.Review, status string) (ratingDelta, countDelta int) {
+	if r.Status == status {
+		return 0, 0
+	} else if status == ecommerce.ReviewStatusApproved {
+		return r.Rating, 1
+	} else if r.Status == ecommerce.ReviewStatusApproved {
+		return -r.Rating, -1
+	}
+
+	return 0, 0
+}
+
@@ -0,0 +1,70 @@
+package review
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+func TestRatingChange(t *testing.T) {
+	tests := []struct {
+		from string
+		to string
+		ratingDelta int
+		countDelta int
+	}{
+		{ecommerce.ReviewStatusPending, ecommerce.ReviewStatusApproved, 4, 1},
+		{ecommerce.ReviewStatusRejected, ecommerce.ReviewStatusApproved, 4, 1},
+		{ecommerce.ReviewStatusApproved, ecommerce.ReviewStatusRejected, -4, -1},
+		{ecommerce.ReviewStatusApproved, ecommerce.ReviewStatusPending, -4, -1},
+		{ecommerce.ReviewStatusPending, ecommerce.ReviewStatusRejected, 0, 0},
+		{ecommerce.ReviewStatusRejected, ecommerce.ReviewStatusPending, 0, 0},
+		{ecommerce.ReviewStatusApproved, ecommerce.ReviewStatusApproved, 0, 0},
+	}
+
+	for _, tt := range tests {
+		r := &ecommerce.Review{Rating: 4, Status: tt.from}
+		ratingDelta, countDelta := ratingChange(r, tt.to)
+		if ratingDelta != tt.ratingDelta || countDelta != tt.countDelta {
+			t.Errorf("%s to %s: wanted %d, %d, got %d, %d",
+				tt.from, tt.to, tt.ratingDelta, tt.countDelta, ratingDelta, countDelta)
+		}
+	}
+}
+
+func TestRatingChangeKeepsTotalsInStep(t *testing.T) {
+	reviews := []ecommerce.Review{
+		{Rating: 5, Status: ecommerce.ReviewStatusPending},
+		{Rating: 2, Status: ecommerce.ReviewStatusPending},
+		{Rating: 4, Status: ecommerce.ReviewStatusPending},
+	}
+	moves := []struct {
+		review int
+		status string
+	}{
+		{0, ecommerce.ReviewStatusApproved},
+		{1, ecommerce.ReviewStatusApproved},
+		{2, ecommerce.ReviewStatusRejected},
+		{1, ecommerce.ReviewStatusRejected},
+		{2, ecommerce.ReviewStatusApproved},
+		{0, ecommerce.ReviewStatusPending},
+		{0, ecommerce.ReviewStatusApproved},
+	}
+
+	var sum, count int
+	for _, m := range moves {
+		ratingDelta, countDelta := ratingChange(&reviews[m.review], m.status)
+		sum, count = sum + ratingDelta, count + countDelta
+		reviews[m.review].Status = m.status
+
+		var wantSum, wantCount int
+		for _, r := range reviews {
+			if r.Status == ecommerce.ReviewStatusApproved {
+				wantSum, wantCount = wantSum + r.Rating, wantCount + 1
+			}
+		}
+		if sum != wantSum || count != wantCount {
+			t.Fatalf("after moving review %d to %s: wanted sum %d and count %d, got %d and %d",
+				m.review, m.status, wantSum, wantCount, sum, count)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package review
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"strings"
+	"time"
+)
+
+type repository interface {
+	SaveReview(r *ecommerce.Review) (int, error)
+	Review(id int) (*ecommerce.Review, error)
+	CustomerReviewExists(custID, productID int) (bool, error)
+	HasDeliveredOrder(custID, productID int) (bool, error)
+	ProductReviews(productID int, status string, sort string, page int, size int) ([]ecommerce.Review, error)
+	UpdateReviewStatusWithTx(tx *sql.Tx, id int, from, to string) (bool, error)
+	AdjustProductRatingWithTx(tx *sql.Tx, productID, ratingDelta, countDelta int) error
+	SaveHelpfulVoteWithTx(tx *sql.Tx, reviewID, userID int) (bool, error)
+	IncrementHelpfulCountWithTx(tx *sql.Tx, reviewID int) (int, error)
+	Tx() (*sql.Tx, error)
+}
+
+func New(db *sql.DB, repo repository, productService ecommerce.ProductService) *service {
+	return &service{db: db, r: repo, productService: productService}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	productService ecommerce.ProductService
+}
+
+// CreateReview saves a pending review. Customers may only review products they
+// have received and only once per product.
+func (s *service) CreateReview(r *ecommerce.Review) (int, error) {
+	const op = "reviewService.CreateReview"
+
+	r.Title = strings.TrimSpace(r.Title)
+	r.Body = strings.TrimSpace(r.Body)
+	if r.Rating < 1 || r.Rating > 5 {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("rating must be between 1 and 5 stars")}, op, "validating review")
+	} else if r.Title == "" || len(r.Title) > 128 {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("title is required and must be at most 128 characters")}, op, "validating review")
+	} else if len(r.Body) > 4096 {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("review must be at most 4096 characters")}, op, "validating review")
+	}
+
+	if _, err := s.productService.Product(r.ProductID); err != nil {
+		return 0, errors2.Wrap(err, op, "getting product")
+	}
+
+	delivered, err := s.r.HasDeliveredOrder(r.CustomerID, r.ProductID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "checking orders")
+	} else if !delivered {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("only customers who received the product can review it")}, op, "checking orders")
+	}
+
+	exists, err := s.r.CustomerReviewExists(r.CustomerID, r.ProductID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "checking existing review")
+	} else if exists {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("product has already been reviewed")}, op, "checking existing review")
+	}
+
+	r.Status = ecommerce.ReviewStatusPending
+	r.HelpfulCount = 0
+	r.CreatedAt = time.Now()
+
+	id, err := s.r.SaveReview(r)
+
+	return id, errors2.Wrap(err, op, "saving review")
+}
+
+// ProductReviews returns a page of approved reviews of a product in the given sort order,
+// which defaults to newest first.
+func (s *service) ProductReviews(productID int, sort string, page int, size int) ([]ecommerce.Review, error) {
+	const op = "reviewService.ProductReviews"
+
+	switch sort {
+	case "":
+		sort = ecommerce.ReviewSortNewest
+	case ecommerce.ReviewSortNewest, ecommerce.ReviewSortOldest, ecommerce.ReviewSortHighestRating,
+		ecommerce.ReviewSortLowestRating, ecommerce.ReviewSortMostHelpful:
+	default:
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("unknown sort order")}, op, "validating sort")
+	}
+
+	if page < 1 {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("page cannot be less than one")}, op, "validating page")
+	}
+
+	rr, err := s.r.ProductReviews(productID, ecommerce.ReviewStatusApproved, sort, page, size)
+
+	return rr, errors2.Wrap(err, op, "getting reviews from repo")
+}
+
+// ReviewsByStatus returns a page of reviews of all products with status, oldest first,
+// so that moderators work through the queue in order.
+func (s *service) ReviewsByStatus(status string, page int, size int) ([]ecommerce.Review, error) {
+	const op = "reviewService.ReviewsByStatus"
+
+	if !validStatus(status) {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("unknown review status")}, op, "validating status")
+	} else if page < 1 {
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("page cannot be less than one")}, op, "validating page")
+	}
+
+	rr, err := s.r.ProductReviews(0, status, ecommerce.ReviewSortOldest, page, size)
+
+	return rr, errors2.Wrap(err, op, "getting reviews from repo")
+}
+
+// ModerateReview changes the status of a review and keeps the rating sum and review
+// count of the product in step with the set of approved reviews. The status only
+// changes if nobody moderated the review in the meantime, so that the rating of the
+// product is adjusted once per change.
+func (s *service) ModerateReview(reviewID int, status string) error {
+	const op = "reviewService.ModerateReview"
+
+	if !validStatus(status) {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("unknown review status")}, op, "validating status")
+	}
+
+	r, err := s.r.Review(reviewID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting review")
+	}
+
+	if r.Status == status {
+		return nil
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	updated, err := s.r.UpdateReviewStatusWithTx(tx, reviewID, r.Status, status)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating status")
+	} else if !updated {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("the review was moderated by someone else, please reload it")}, op, "updating status")
+	}
+
+	if ratingDelta, countDelta := ratingChange(r, status); countDelta != 0 {
+		err = s.r.AdjustProductRatingWithTx(tx, r.ProductID, ratingDelta, countDelta)
+		if err != nil {
+			_ = tx.Rollback()
+			return errors2.Wrap(err, op, "adjusting product rating")
+		}
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// VoteReviewHelpful records that userID found a review helpful and returns the new
+// helpful count. Every user can vote once per review but not on their own review.
+func (s *service) VoteReviewHelpful(reviewID, userID int) (int, error) {
+	const op = "reviewService.VoteReviewHelpful"
+
+	r, err := s.r.Review(reviewID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting review")
+	}
+
+	if r.Status != ecommerce.ReviewStatusApproved {
+		return 0, errors2.Wrap(&errors2.NotFound{Err: errors.New("review not found")}, op, "checking status")
+	} else if r.CustomerID == userID {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("you cannot vote on your own review")}, op, "checking author")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	saved, err := s.r.SaveHelpfulVoteWithTx(tx, reviewID, userID)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving vote")
+	} else if !saved {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("you already voted on this review")}, op, "saving vote")
+	}
+
+	count, err := s.r.IncrementHelpfulCountWithTx(tx, reviewID)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "incrementing helpful count")
+	}
+
+	return count, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case ecommerce.ReviewStatusPending, ecommerce.ReviewStatusApproved, ecommerce.ReviewStatusRejected:
+		return true
+	}
+	return false
+}
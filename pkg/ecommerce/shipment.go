@@ -0,0 +1,48 @@
+package ecommerce
+
+import "time"
+
+const (
+	ShipmentStatusShipped = "shipped"
+	ShipmentStatusDelivered = "delivered"
+)
+
+// FulfilmentService records how orders leave the warehouse. An order can ship in
+// several shipments, and its status follows them: it is partially shipped until all
+// of its units have shipped, shipped then and delivered once every shipment is.
+type FulfilmentService interface {
+	CreateShipment(s *Shipment) (int, error)
+	UpdateShipmentStatus(orderID, id int, status string) error
+	Shipments(orderID int) ([]Shipment, error)
+	// Tracking returns the shipments of an order of a customer. It returns NotFound
+	// if the order is not one of the customer's.
+	Tracking(custID, orderID int) (*OrderTracking, error)
+}
+
+type Shipment struct {
+	ID int `json:"id"`
+	OrderID int `json:"order_id"`
+	Carrier string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	// TrackingURL is the page of the carrier to track the shipment on, if any.
+	TrackingURL string `json:"tracking_url,omitempty"`
+	Status string `json:"status"`
+	ShippedAt time.Time `json:"shipped_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	Items []ShipmentItem `json:"items"`
+}
+
+// ShipmentItem is the number of units of an order item in a shipment.
+type ShipmentItem struct {
+	OrderItemID int `json:"order_item_id"`
+	Quantity int `json:"quantity"`
+}
+
+// OrderTracking is the fulfilment of an order as shown to its customer.
+type OrderTracking struct {
+	OrderID int `json:"order_id"`
+	Status string `json:"status"`
+	Shipments []Shipment `json:"shipments"`
+	// Unshipped lists the units of the order that have not shipped yet.
+	Unshipped []ShipmentItem `json:"unshipped"`
+}
@@ -0,0 +1,97 @@
+package ecommerce
+
+const (
+	ShippingMethodStandard = "standard"
+	ShippingMethodExpress = "express"
+	ShippingMethodPickup = "pickup"
+)
+
+const (
+	// ShippingRateFlat charges the rate of the method for every parcel.
+	ShippingRateFlat = "flat"
+	// ShippingRateWeight charges the rate of the heaviest tier the parcel weighs at least.
+	ShippingRateWeight = "weight"
+	// ShippingRatePrice charges the rate of the highest tier the parcel subtotal reaches.
+	ShippingRatePrice = "price"
+)
+
+// ShippingQuoter works out what it costs to ship a parcel to an address.
+type ShippingQuoter interface {
+	// Quotes returns the cost of every active method of the zone of a for shipping p,
+	// cheapest first. It returns no quotes if no zone covers a.
+	Quotes(a *Address, p Parcel) ([]ShippingQuote, error)
+}
+
+type ShippingService interface {
+	ShippingQuoter
+	CreateZone(z *ShippingZone) (int, error)
+	UpdateZone(z *ShippingZone) error
+	DeleteZone(id int) error
+	Zones() ([]ShippingZone, error)
+	CreateMethod(m *ShippingMethod) (int, error)
+	UpdateMethod(m *ShippingMethod) error
+	DeleteMethod(zoneID, id int) error
+}
+
+// ShippingZone is a group of regions that share shipping methods. A region is either
+// a whole country or a state of it, and a state region takes precedence over the zone
+// of its country, e.g. to ship to Alaska and Hawaii differently than to the rest of the US.
+type ShippingZone struct {
+	ID int `json:"id"`
+	Name string `json:"name"`
+	Regions []ShippingRegion `json:"regions"`
+	// Methods are the methods of the zone, they are managed on their own.
+	Methods []ShippingMethod `json:"methods"`
+}
+
+type ShippingRegion struct {
+	Country string `json:"country"`
+	// State is empty for the whole country.
+	State string `json:"state,omitempty"`
+}
+
+// ShippingMethod is a way of shipping to a zone and what it costs. Rates are in
+// DefaultCurrency and converted like product prices.
+type ShippingMethod struct {
+	ID int `json:"id"`
+	ZoneID int `json:"zone_id"`
+	Name string `json:"name"`
+	// Type is one of standard, express or pickup.
+	Type string `json:"type"`
+	// RateType is one of flat, weight or price.
+	RateType string `json:"rate_type"`
+	// Rate is the cost of flat rate methods.
+	Rate Money `json:"rate"`
+	// Tiers are the costs of weight and price based methods. A parcel below the lowest
+	// tier cannot be shipped with the method.
+	Tiers []ShippingTier `json:"tiers"`
+	// FreeOver makes the method free for parcels whose subtotal after discounts is at
+	// least FreeOver. Zero means the method is never free.
+	FreeOver Money `json:"free_over"`
+	Active bool `json:"active"`
+}
+
+type ShippingTier struct {
+	// MinWeight is the weight in grams a parcel must have at least for weight based rates.
+	MinWeight int `json:"min_weight,omitempty"`
+	// MinSubtotal is the subtotal a parcel must have at least for price based rates.
+	MinSubtotal Money `json:"min_subtotal"`
+	Rate Money `json:"rate"`
+}
+
+// Parcel is what is quoted for shipping: the weight in grams and the subtotal after
+// discounts in DefaultCurrency of the lines of a cart.
+type Parcel struct {
+	Weight int
+	Subtotal Money
+	// FreeShipping is set when a promotion makes standard shipping free.
+	FreeShipping bool
+}
+
+type ShippingQuote struct {
+	MethodID int `json:"method_id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Cost Money `json:"cost"`
+	Free bool `json:"free"`
+}
@@ -0,0 +1,95 @@
+package shipping
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"sort"
+	"strings"
+)
+
+// normalize returns the form regions are compared in: trimmed and upper case.
+func normalize(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// zoneFor returns the zone a is shipped to, which is the zone of the state of a if there
+// is one and the zone of its country otherwise, or nil if no zone covers a.
+func zoneFor(zones []ecommerce.ShippingZone, a *ecommerce.Address) *ecommerce.ShippingZone {
+	var country *ecommerce.ShippingZone
+	for i := range zones {
+		for _, r := range zones[i].Regions {
+			if normalize(r.Country) != normalize(a.Country) {
+				continue
+			}
+
+			if r.State == "" {
+				country = &zones[i]
+			} else if normalize(r.State) == normalize(a.State) {
+				return &zones[i]
+			}
+		}
+	}
+
+	return country
+}
+
+// quote returns the cost of shipping p with m, and false if m cannot ship p because
+// p is below the lowest tier of m.
+func quote(m ecommerce.ShippingMethod, p ecommerce.Parcel) (ecommerce.ShippingQuote, bool) {
+	q := ecommerce.ShippingQuote{MethodID: m.ID, Name: m.Name, Type: m.Type}
+
+	switch m.RateType {
+	case ecommerce.ShippingRateFlat:
+		q.Cost = m.Rate
+	case ecommerce.ShippingRateWeight, ecommerce.ShippingRatePrice:
+		var tier *ecommerce.ShippingTier
+		for i := range m.Tiers {
+			t := &m.Tiers[i]
+			if m.RateType == ecommerce.ShippingRateWeight {
+				if t.MinWeight <= p.Weight && (tier == nil || t.MinWeight > tier.MinWeight) {
+					tier = t
+				}
+			} else if t.MinSubtotal.Amount <= p.Subtotal.Amount && (tier == nil || t.MinSubtotal.Amount > tier.MinSubtotal.Amount) {
+				tier = t
+			}
+		}
+		if tier == nil {
+			return q, false
+		}
+		q.Cost = tier.Rate
+	default:
+		return q, false
+	}
+
+	if (m.FreeOver.Amount > 0 && p.Subtotal.Amount >= m.FreeOver.Amount) ||
+		(p.FreeShipping && m.Type == ecommerce.ShippingMethodStandard) {
+		q.Cost = ecommerce.NewMoney(0, q.Cost.Currency)
+		q.Free = true
+	}
+
+	return q, true
+}
+
+// quotes returns the quotes of the active methods of the zone of a that can ship p,
+// cheapest first.
+func quotes(zones []ecommerce.ShippingZone, a *ecommerce.Address, p ecommerce.Parcel) []ecommerce.ShippingQuote {
+	z := zoneFor(zones, a)
+	if z == nil {
+		return nil
+	}
+
+	var qq []ecommerce.ShippingQuote
+	for _, m := range z.Methods {
+		if !m.Active {
+			continue
+		}
+		if q, ok := quote(m, p); ok {
+			qq = append(qq, q)
+		}
+	}
+
+	sort.SliceStable(qq, func(i, j int) bool {
+		return qq[i].Cost.Amount < qq[j].Cost.Amount
+	})
+
+	return qq
+}
@@ -0,0 +1,105 @@
+package shipping
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"reflect"
+	"testing"
+)
+
+func usd(amount int64) ecommerce.Money {
+	return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+}
+
+// testZones are the US with a flat standard rate that is free from 50.00, a weight
+// based express rate and pickup, and Alaska and Hawaii with a price tiered standard rate.
+var testZones = []ecommerce.ShippingZone{
+	{
+		ID: 1,
+		Name: "US",
+		Regions: []ecommerce.ShippingRegion{{Country: "US"}},
+		Methods: []ecommerce.ShippingMethod{
+			{ID: 1, ZoneID: 1, Name: "Standard", Type: ecommerce.ShippingMethodStandard, RateType: ecommerce.ShippingRateFlat,
+				Rate: usd(500), FreeOver: usd(5000), Active: true},
+			{ID: 2, ZoneID: 1, Name: "Express", Type: ecommerce.ShippingMethodExpress, RateType: ecommerce.ShippingRateWeight,
+				Tiers: []ecommerce.ShippingTier{{MinWeight: 0, Rate: usd(1500)}, {MinWeight: 2000, Rate: usd(2500)}}, Active: true},
+			{ID: 3, ZoneID: 1, Name: "Pickup", Type: ecommerce.ShippingMethodPickup, RateType: ecommerce.ShippingRateFlat,
+				Rate: usd(0), Active: true},
+			{ID: 4, ZoneID: 1, Name: "Overnight", Type: ecommerce.ShippingMethodExpress, RateType: ecommerce.ShippingRateFlat,
+				Rate: usd(4000), Active: false},
+		},
+	},
+	{
+		ID: 2,
+		Name: "Non-contiguous US",
+		Regions: []ecommerce.ShippingRegion{{Country: "US", State: "AK"}, {Country: "US", State: "HI"}},
+		Methods: []ecommerce.ShippingMethod{
+			{ID: 5, ZoneID: 2, Name: "Standard", Type: ecommerce.ShippingMethodStandard, RateType: ecommerce.ShippingRatePrice,
+				Tiers: []ecommerce.ShippingTier{{MinSubtotal: usd(1000), Rate: usd(2000)}, {MinSubtotal: usd(10000), Rate: usd(1000)}},
+				Active: true},
+		},
+	},
+}
+
+func TestQuotes(t *testing.T) {
+	type cost struct {
+		methodID int
+		amount int64
+		free bool
+	}
+
+	tests := []struct {
+		name string
+		address ecommerce.Address
+		parcel ecommerce.Parcel
+		want []cost
+	}{
+		{
+			name: "country zone cheapest first",
+			address: ecommerce.Address{Country: "us", State: "CA"},
+			parcel: ecommerce.Parcel{Weight: 1500, Subtotal: usd(2000)},
+			want: []cost{{3, 0, false}, {1, 500, false}, {2, 1500, false}},
+		},
+		{
+			name: "heavier weight tier and free over threshold",
+			address: ecommerce.Address{Country: "US", State: "CA"},
+			parcel: ecommerce.Parcel{Weight: 2000, Subtotal: usd(5000)},
+			want: []cost{{1, 0, true}, {3, 0, false}, {2, 2500, false}},
+		},
+		{
+			name: "free shipping promotion only frees standard",
+			address: ecommerce.Address{Country: "US", State: "NY"},
+			parcel: ecommerce.Parcel{Weight: 100, Subtotal: usd(1000), FreeShipping: true},
+			want: []cost{{1, 0, true}, {3, 0, false}, {2, 1500, false}},
+		},
+		{
+			name: "state zone takes precedence",
+			address: ecommerce.Address{Country: "US", State: "hi"},
+			parcel: ecommerce.Parcel{Subtotal: usd(12000)},
+			want: []cost{{5, 1000, false}},
+		},
+		{
+			name: "below the lowest price tier",
+			address: ecommerce.Address{Country: "US", State: "AK"},
+			parcel: ecommerce.Parcel{Subtotal: usd(500)},
+			want: nil,
+		},
+		{
+			name: "no zone",
+			address: ecommerce.Address{Country: "CA"},
+			parcel: ecommerce.Parcel{Subtotal: usd(500)},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []cost
+			for _, q := range quotes(testZones, &tt.address, tt.parcel) {
+				got = append(got, cost{q.MethodID, q.Cost.Amount, q.Free})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
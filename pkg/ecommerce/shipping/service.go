@@ -0,0 +1,304 @@
+package shipping
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type repository interface {
+	SaveZoneWithTx(tx *sql.Tx, z *ecommerce.ShippingZone) (int, error)
+	UpdateZoneWithTx(tx *sql.Tx, z *ecommerce.ShippingZone) error
+	DeleteZone(id int) error
+	Zone(id int) (*ecommerce.ShippingZone, error)
+	Zones() ([]ecommerce.ShippingZone, error)
+	SaveMethodWithTx(tx *sql.Tx, m *ecommerce.ShippingMethod) (int, error)
+	UpdateMethodWithTx(tx *sql.Tx, m *ecommerce.ShippingMethod) error
+	DeleteMethod(zoneID, id int) error
+	Method(id int) (*ecommerce.ShippingMethod, error)
+	Tx() (*sql.Tx, error)
+}
+
+func New(db *sql.DB, repo repository) *service {
+	return &service{db: db, r: repo}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+}
+
+func (s *service) CreateZone(z *ecommerce.ShippingZone) (int, error) {
+	const op = "shippingService.CreateZone"
+
+	if err := s.validateZone(z); err != nil {
+		return 0, errors2.Wrap(err, op, "validating zone")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	z.ID, err = s.r.SaveZoneWithTx(tx, z)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving zone")
+	}
+	z.Methods = []ecommerce.ShippingMethod{}
+
+	return z.ID, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) UpdateZone(z *ecommerce.ShippingZone) error {
+	const op = "shippingService.UpdateZone"
+
+	old, err := s.r.Zone(z.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting zone")
+	}
+
+	if err := s.validateZone(z); err != nil {
+		return errors2.Wrap(err, op, "validating zone")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	err = s.r.UpdateZoneWithTx(tx, z)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating zone")
+	}
+	z.Methods = old.Methods
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// DeleteZone deletes a zone together with its methods.
+func (s *service) DeleteZone(id int) error {
+	const op = "shippingService.DeleteZone"
+
+	return errors2.Wrap(s.r.DeleteZone(id), op, "deleting zone")
+}
+
+func (s *service) Zones() ([]ecommerce.ShippingZone, error) {
+	const op = "shippingService.Zones"
+
+	zz, err := s.r.Zones()
+
+	return zz, errors2.Wrap(err, op, "getting zones from repo")
+}
+
+func (s *service) CreateMethod(m *ecommerce.ShippingMethod) (int, error) {
+	const op = "shippingService.CreateMethod"
+
+	if _, err := s.r.Zone(m.ZoneID); err != nil {
+		return 0, errors2.Wrap(err, op, "getting zone")
+	}
+
+	if err := validateMethod(m); err != nil {
+		return 0, errors2.Wrap(err, op, "validating method")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	m.ID, err = s.r.SaveMethodWithTx(tx, m)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving method")
+	}
+
+	return m.ID, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) UpdateMethod(m *ecommerce.ShippingMethod) error {
+	const op = "shippingService.UpdateMethod"
+
+	old, err := s.r.Method(m.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting method")
+	} else if old.ZoneID != m.ZoneID {
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting method")
+	}
+
+	if err := validateMethod(m); err != nil {
+		return errors2.Wrap(err, op, "validating method")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "obtaining tx")
+	}
+
+	err = s.r.UpdateMethodWithTx(tx, m)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating method")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) DeleteMethod(zoneID, id int) error {
+	const op = "shippingService.DeleteMethod"
+
+	return errors2.Wrap(s.r.DeleteMethod(zoneID, id), op, "deleting method")
+}
+
+func (s *service) Quotes(a *ecommerce.Address, p ecommerce.Parcel) ([]ecommerce.ShippingQuote, error) {
+	const op = "shippingService.Quotes"
+
+	if a == nil {
+		return nil, nil
+	}
+
+	zz, err := s.r.Zones()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting zones from repo")
+	}
+
+	return quotes(zz, a, p), nil
+}
+
+// validateZone normalizes the regions of z and checks that none of them is covered
+// twice or already belongs to another zone.
+func (s *service) validateZone(z *ecommerce.ShippingZone) error {
+	z.Name = strings.TrimSpace(z.Name)
+	if z.Name == "" || len(z.Name) > 64 {
+		return &errors2.Invalid{Err: errors.New("name is required and must be at most 64 characters")}
+	} else if len(z.Regions) < 1 {
+		return &errors2.Invalid{Err: errors.New("a zone needs at least one region")}
+	}
+
+	seen := make(map[ecommerce.ShippingRegion]bool)
+	for i := range z.Regions {
+		r := &z.Regions[i]
+		r.Country = normalize(r.Country)
+		r.State = normalize(r.State)
+		if r.Country == "" || len(r.Country) > 64 || len(r.State) > 64 {
+			return &errors2.Invalid{Err: errors.New("regions need a country and country and state must be at most 64 characters")}
+		} else if seen[*r] {
+			return &errors2.Invalid{Err: fmt.Errorf("%s is listed more than once", regionName(*r))}
+		}
+		seen[*r] = true
+	}
+
+	zz, err := s.r.Zones()
+	if err != nil {
+		return err
+	}
+	for _, o := range zz {
+		if o.ID == z.ID {
+			continue
+		}
+		for _, r := range o.Regions {
+			if seen[r] {
+				return &errors2.Invalid{Err: fmt.Errorf("%s already belongs to zone %s", regionName(r), o.Name)}
+			}
+		}
+	}
+
+	return nil
+}
+
+func regionName(r ecommerce.ShippingRegion) string {
+	if r.State == "" {
+		return r.Country
+	}
+	return r.Country + "/" + r.State
+}
+
+// validateMethod checks m and normalizes it to the fields of its rate type, with the
+// tiers in ascending order.
+func validateMethod(m *ecommerce.ShippingMethod) error {
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Name == "" || len(m.Name) > 64 {
+		return &errors2.Invalid{Err: errors.New("name is required and must be at most 64 characters")}
+	}
+
+	switch m.Type {
+	case ecommerce.ShippingMethodStandard, ecommerce.ShippingMethodExpress, ecommerce.ShippingMethodPickup:
+	default:
+		return &errors2.Invalid{Err: errors.New("type must be one of standard, express or pickup")}
+	}
+
+	if err := validateAmount(&m.FreeOver, "free shipping threshold"); err != nil {
+		return err
+	}
+
+	switch m.RateType {
+	case ecommerce.ShippingRateFlat:
+		if len(m.Tiers) > 0 {
+			return &errors2.Invalid{Err: errors.New("flat rates cannot have tiers")}
+		}
+		m.Tiers = []ecommerce.ShippingTier{}
+		return validateAmount(&m.Rate, "rate")
+	case ecommerce.ShippingRateWeight, ecommerce.ShippingRatePrice:
+		if len(m.Tiers) < 1 {
+			return &errors2.Invalid{Err: fmt.Errorf("%s based rates need at least one tier", m.RateType)}
+		}
+	default:
+		return &errors2.Invalid{Err: errors.New("rate type must be one of flat, weight or price")}
+	}
+
+	m.Rate = ecommerce.NewMoney(0, ecommerce.DefaultCurrency)
+	seen := make(map[int64]bool)
+	for i := range m.Tiers {
+		t := &m.Tiers[i]
+		if err := validateAmount(&t.Rate, "tier rate"); err != nil {
+			return err
+		}
+
+		var min int64
+		if m.RateType == ecommerce.ShippingRateWeight {
+			if t.MinWeight < 0 {
+				return &errors2.Invalid{Err: errors.New("tier minimum weight cannot be negative")}
+			}
+			t.MinSubtotal = ecommerce.NewMoney(0, ecommerce.DefaultCurrency)
+			min = int64(t.MinWeight)
+		} else {
+			if err := validateAmount(&t.MinSubtotal, "tier minimum subtotal"); err != nil {
+				return err
+			}
+			t.MinWeight = 0
+			min = t.MinSubtotal.Amount
+		}
+
+		if seen[min] {
+			return &errors2.Invalid{Err: errors.New("tiers must have different minimums")}
+		}
+		seen[min] = true
+	}
+
+	sort.Slice(m.Tiers, func(i, j int) bool {
+		return m.Tiers[i].MinWeight < m.Tiers[j].MinWeight || m.Tiers[i].MinSubtotal.Amount < m.Tiers[j].MinSubtotal.Amount
+	})
+
+	return nil
+}
+
+// validateAmount checks that m is not negative and in the catalog currency. An omitted
+// amount is zero.
+func validateAmount(m *ecommerce.Money, what string) error {
+	if m.Currency == "" && m.Amount == 0 {
+		m.Currency = ecommerce.DefaultCurrency
+	}
+
+	if m.Amount < 0 {
+		return &errors2.Invalid{Err: fmt.Errorf("%s cannot be negative", what)}
+	} else if m.Currency != ecommerce.DefaultCurrency {
+		return &errors2.Invalid{Err: fmt.Errorf("%s must be in %s", what, ecommerce.DefaultCurrency)}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package ecommerce
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// SubscriptionBackInStock alerts when a sold out product is back in stock.
+	SubscriptionBackInStock = "back_in_stock"
+	// SubscriptionPriceDrop alerts when the price of a product drops to or below the
+	// threshold of the subscription.
+	SubscriptionPriceDrop = "price_drop"
+)
+
+// ProductWatcher is told about changes to products as part of the transaction that
+// makes them, so that what it does with them is rolled back with the change.
+type ProductWatcher interface {
+	ProductChangedWithTx(tx *sql.Tx, before, after *Product) error
+}
+
+// SubscriptionService handles the back-in-stock and price-drop subscriptions of
+// shoppers. Product changes that trigger a subscription queue an alert, and queued
+// alerts are emailed in batches per address with a limit on emails per day.
+type SubscriptionService interface {
+	ProductWatcher
+	Subscribe(s *Subscription) (int, error)
+	// Unsubscribe deletes the subscription a signed unsubscribe token was issued for.
+	Unsubscribe(token string) error
+	// DeliverAlerts emails the queued alerts and returns the number of emails sent.
+	DeliverAlerts() (int, error)
+}
+
+type Subscription struct {
+	ID int `json:"id"`
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id,omitempty"`
+	Type string `json:"type"`
+	Email string `json:"email"`
+	// Threshold is the price price-drop subscriptions alert at.
+	Threshold *Money `json:"threshold,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SubscriptionAlert is a triggered subscription waiting to be emailed. The product
+// name and price are those at the time it was triggered.
+type SubscriptionAlert struct {
+	ID int
+	SubscriptionID int
+	Email string
+	Type string
+	ProductID int
+	ProductName string
+	Price Money
+	CreatedAt time.Time
+}
@@ -0,0 +1,119 @@
+package subscription
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"ecommerce/pkg/ecommerce"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// stock returns the units in stock of the variant with variantID of p, or of p if it
+// is 0, which for products with variants are the units of all variants.
+func stock(p *ecommerce.Product, variantID int) int {
+	if variantID > 0 {
+		if v := p.Variant(variantID); v != nil {
+			return v.Quantity
+		}
+		return 0
+	}
+
+	if len(p.Variants) > 0 {
+		var n int
+		for _, v := range p.Variants {
+			n += v.Quantity
+		}
+		return n
+	}
+
+	return p.Quantity
+}
+
+// price returns the unit price of the variant with variantID of p, or of p if it is 0
+// or the variant sells at the product price.
+func price(p *ecommerce.Product, variantID int) ecommerce.Money {
+	if v := p.Variant(variantID); v != nil && v.Price != nil {
+		return v.Price.Current
+	}
+
+	return p.Price.Current
+}
+
+// triggered returns the subscriptions of ss the change of a product from before to
+// after alerts: back-in-stock subscriptions if it was sold out and is not anymore and
+// price-drop subscriptions if its price dropped to or below their threshold.
+func triggered(before, after *ecommerce.Product, ss []ecommerce.Subscription) []ecommerce.Subscription {
+	var tt []ecommerce.Subscription
+	for _, s := range ss {
+		switch s.Type {
+		case ecommerce.SubscriptionBackInStock:
+			if stock(before, s.VariantID) <= 0 && stock(after, s.VariantID) > 0 {
+				tt = append(tt, s)
+			}
+		case ecommerce.SubscriptionPriceDrop:
+			was, is := price(before, s.VariantID), price(after, s.VariantID)
+			if s.Threshold == nil || is.Currency != was.Currency || is.Currency != s.Threshold.Currency {
+				continue
+			}
+			if is.Cmp(was) < 0 && is.Cmp(*s.Threshold) <= 0 {
+				tt = append(tt, s)
+			}
+		}
+	}
+
+	return tt
+}
+
+// mayTrigger returns false if the change of a product from before to after cannot
+// trigger any subscription, because nothing came back in stock and no price dropped.
+func mayTrigger(before, after *ecommerce.Product) bool {
+	ids := []int{0}
+	for _, v := range after.Variants {
+		ids = append(ids, v.ID)
+	}
+
+	for _, id := range ids {
+		if stock(before, id) <= 0 && stock(after, id) > 0 {
+			return true
+		}
+		was, is := price(before, id), price(after, id)
+		if is.Currency == was.Currency && is.Cmp(was) < 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sign returns the unsubscribe token of the subscription with id: the id and its
+// HMAC-SHA256 under key.
+func sign(key []byte, id int) string {
+	return strconv.Itoa(id) + "." + base64.RawURLEncoding.EncodeToString(mac(key, id))
+}
+
+// verify returns the subscription id of token if it was signed with key.
+func verify(key []byte, token string) (int, bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id < 1 {
+		return 0, false
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, mac(key, id)) {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func mac(key []byte, id int) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte("unsubscribe:" + strconv.Itoa(id)))
+	return h.Sum(nil)
+}
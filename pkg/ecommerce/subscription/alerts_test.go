@@ -0,0 +1,84 @@
+package subscription
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+func usd(amount int64) ecommerce.Money {
+	return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+}
+
+func TestTriggered(t *testing.T) {
+	threshold := usd(900)
+	backInStock := ecommerce.Subscription{ID: 1, Type: ecommerce.SubscriptionBackInStock}
+	variantBackInStock := ecommerce.Subscription{ID: 2, Type: ecommerce.SubscriptionBackInStock, VariantID: 20}
+	priceDrop := ecommerce.Subscription{ID: 3, Type: ecommerce.SubscriptionPriceDrop, Threshold: &threshold}
+	ss := []ecommerce.Subscription{backInStock, variantBackInStock, priceDrop}
+
+	product := func(price int64, quantity int, variantQuantity int) *ecommerce.Product {
+		return &ecommerce.Product{Price: ecommerce.Price{Current: usd(price)}, Quantity: quantity,
+			Variants: []ecommerce.ProductVariant{{ID: 20, Quantity: variantQuantity}}}
+	}
+
+	tests := []struct {
+		name string
+		before, after *ecommerce.Product
+		want []int
+	}{
+		{"nothing changed", product(1000, 0, 0), product(1000, 0, 0), nil},
+		{"variant back in stock", product(1000, 0, 0), product(1000, 0, 2), []int{1, 2}},
+		{"stock raised but not from zero", product(1000, 0, 1), product(1000, 0, 5), nil},
+		{"price dropped below threshold", product(1000, 0, 1), product(850, 0, 1), []int{3}},
+		{"price dropped to threshold", product(1000, 0, 1), product(900, 0, 1), []int{3}},
+		{"price dropped above threshold", product(1000, 0, 1), product(950, 0, 1), nil},
+		{"price raised below threshold", product(800, 0, 1), product(850, 0, 1), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, s := range triggered(tt.before, tt.after, ss) {
+				got = append(got, s.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("wanted %v, got %v", tt.want, got)
+				}
+			}
+			if len(tt.want) > 0 && !mayTrigger(tt.before, tt.after) {
+				t.Fatalf("wanted change to be able to trigger subscriptions")
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("key")
+	token := sign(key, 42)
+
+	tests := []struct {
+		name string
+		token string
+		want int
+		ok bool
+	}{
+		{"signed token", token, 42, true},
+		{"other key", sign([]byte("other"), 42), 0, false},
+		{"other id", "43" + token[2:], 0, false},
+		{"no signature", "42", 0, false},
+		{"garbage", "x.y", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := verify(key, tt.token)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("wanted %v %v, got %v %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package subscription
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxEmailsPerDay is how many alert emails an address gets per 24 hours at most.
+// Alerts over the limit wait and go out together with the next email.
+const maxEmailsPerDay = 3
+
+type repository interface {
+	SaveSubscription(s *ecommerce.Subscription) (int, error)
+	DeleteSubscription(id int) error
+	SubscriptionsWithTx(tx *sql.Tx, productID int) ([]ecommerce.Subscription, error)
+	QueueAlertWithTx(tx *sql.Tx, a *ecommerce.SubscriptionAlert) error
+	PendingAlertsWithTx(tx *sql.Tx) ([]ecommerce.SubscriptionAlert, error)
+	EmailsSentSinceWithTx(tx *sql.Tx, email string, since time.Time) (int, error)
+	MarkAlertsSentWithTx(tx *sql.Tx, ids []int, sentAt time.Time) error
+	Tx() (*sql.Tx, error)
+}
+
+type productRepo interface {
+	Product(id int) (*ecommerce.Product, error)
+}
+
+// New returns a subscription service that signs unsubscribe tokens with key and links
+// to the shop at baseURL in alerts.
+func New(db *sql.DB, repo repository, productRepo productRepo, mailService ecommerce.MailService, key []byte, baseURL string) *service {
+	return &service{
+		db: db,
+		r: repo,
+		productRepo: productRepo,
+		mailService: mailService,
+		key: key,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	productRepo productRepo
+	mailService ecommerce.MailService
+	key []byte
+	baseURL string
+}
+
+// Subscribe subscribes s.Email to alerts about a product. Subscribing again to the same
+// alert updates the threshold of the existing subscription.
+func (s *service) Subscribe(sub *ecommerce.Subscription) (int, error) {
+	const op = "subscriptionService.Subscribe"
+
+	sub.Email = strings.ToLower(strings.TrimSpace(sub.Email))
+	if err := validateEmail(sub.Email); err != nil {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: err}, op, "validating email")
+	}
+
+	p, err := s.productRepo.Product(sub.ProductID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting product")
+	} else if sub.VariantID > 0 && p.Variant(sub.VariantID) == nil {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("variant does not belong to product")}, op, "checking variant")
+	}
+
+	var invalid error
+	switch sub.Type {
+	case ecommerce.SubscriptionBackInStock:
+		sub.Threshold = nil
+		if stock(p, sub.VariantID) > 0 {
+			invalid = errors.New("the product is in stock")
+		}
+	case ecommerce.SubscriptionPriceDrop:
+		current := price(p, sub.VariantID)
+		switch {
+		case sub.Threshold == nil:
+			invalid = errors.New("a threshold is required")
+		case sub.Threshold.Currency != current.Currency:
+			invalid = fmt.Errorf("the threshold must be in %s", current.Currency)
+		case sub.Threshold.Amount <= 0:
+			invalid = errors.New("the threshold must be greater than zero")
+		case sub.Threshold.Cmp(current) >= 0:
+			invalid = fmt.Errorf("the price is %s %s already", current, current.Currency)
+		}
+	default:
+		invalid = errors.New("unknown subscription type")
+	}
+	if invalid != nil {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: invalid}, op, "validating subscription")
+	}
+
+	sub.CreatedAt = time.Now()
+	sub.ID, err = s.r.SaveSubscription(sub)
+
+	return sub.ID, errors2.Wrap(err, op, "saving subscription")
+}
+
+func (s *service) Unsubscribe(token string) error {
+	const op = "subscriptionService.Unsubscribe"
+
+	id, ok := verify(s.key, token)
+	if !ok {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("invalid unsubscribe token")}, op, "verifying token")
+	}
+
+	err := s.r.DeleteSubscription(id)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		// unsubscribing twice is not an error
+		return nil
+	}
+
+	return errors2.Wrap(err, op, "deleting subscription")
+}
+
+// ProductChangedWithTx queues an alert for every subscription the change of a product
+// from before to after triggers. A subscription has at most one queued alert, which
+// is updated to the latest price if it is triggered again before it is sent.
+func (s *service) ProductChangedWithTx(tx *sql.Tx, before, after *ecommerce.Product) error {
+	const op = "subscriptionService.ProductChangedWithTx"
+
+	if !mayTrigger(before, after) {
+		return nil
+	}
+
+	ss, err := s.r.SubscriptionsWithTx(tx, after.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting subscriptions")
+	}
+
+	now := time.Now()
+	for _, sub := range triggered(before, after, ss) {
+		a := ecommerce.SubscriptionAlert{
+			SubscriptionID: sub.ID,
+			Email: sub.Email,
+			Type: sub.Type,
+			ProductID: after.ID,
+			ProductName: after.Name,
+			Price: price(after, sub.VariantID),
+			CreatedAt: now,
+		}
+		if err = s.r.QueueAlertWithTx(tx, &a); err != nil {
+			return errors2.Wrap(err, op, "queueing alert")
+		}
+	}
+
+	return nil
+}
+
+// DeliverAlerts emails the queued alerts, one email per address, by adding the emails
+// to the mail outbox. The alerts are locked while they are delivered, so that
+// concurrent deliveries do not send them twice.
+func (s *service) DeliverAlerts() (int, error) {
+	const op = "subscriptionService.DeliverAlerts"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	aa, err := s.r.PendingAlertsWithTx(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "getting pending alerts")
+	}
+
+	now := time.Now()
+	var sent int
+	for _, batch := range byEmail(aa) {
+		n, err := s.r.EmailsSentSinceWithTx(tx, batch[0].Email, now.Add(-24 * time.Hour))
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "counting emails sent")
+		} else if n >= maxEmailsPerDay {
+			continue
+		}
+
+		err = s.mailService.EnqueueWithTx(tx, batch[0].Email, ecommerce.EmailSubscriptionAlerts, s.message(batch))
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "enqueueing email")
+		}
+
+		ids := make([]int, len(batch))
+		for i, a := range batch {
+			ids[i] = a.ID
+		}
+		if err = s.r.MarkAlertsSentWithTx(tx, ids, now); err != nil {
+			_ = tx.Rollback()
+			return 0, errors2.Wrap(err, op, "marking alerts sent")
+		}
+		sent++
+	}
+
+	return sent, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// byEmail groups aa by email address in the order the addresses first occur in aa.
+func byEmail(aa []ecommerce.SubscriptionAlert) [][]ecommerce.SubscriptionAlert {
+	var batches [][]ecommerce.SubscriptionAlert
+	index := map[string]int{}
+	for _, a := range aa {
+		i, ok := index[a.Email]
+		if !ok {
+			i = len(batches)
+			index[a.Email] = i
+			batches = append(batches, nil)
+		}
+		batches[i] = append(batches[i], a)
+	}
+
+	return batches
+}
+
+// message returns the email data of batch with the product and unsubscribe links.
+func (s *service) message(batch []ecommerce.SubscriptionAlert) *ecommerce.SubscriptionAlertsEmail {
+	m := &ecommerce.SubscriptionAlertsEmail{}
+	for _, a := range batch {
+		m.Alerts = append(m.Alerts, ecommerce.SubscriptionAlertLinks{
+			SubscriptionAlert: a,
+			ProductURL: fmt.Sprintf("%s/products/%d", s.baseURL, a.ProductID),
+			UnsubscribeURL: s.unsubscribeURL(a.SubscriptionID),
+		})
+	}
+
+	return m
+}
+
+func (s *service) unsubscribeURL(subscriptionID int) string {
+	return s.baseURL + "/subscriptions/unsubscribe?token=" + url.QueryEscape(sign(s.key, subscriptionID))
+}
+
+// validateEmail checks that email looks like an address. Line breaks are rejected in
+// particular, since the address ends up in the header of the alert emails.
+func validateEmail(email string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email) - 1 || len(email) > 128 || strings.ContainsAny(email, " \t\r\n<>,;\"") {
+		return errors.New("a valid email address is required")
+	}
+
+	return nil
+}
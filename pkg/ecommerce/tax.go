@@ -0,0 +1,68 @@
+package ecommerce
+
+// TaxCategoryStandard is the tax category of products that do not have one.
+const TaxCategoryStandard = "standard"
+
+// TaxCalculator works out the tax of order lines shipped to an address.
+type TaxCalculator interface {
+	// Calculate returns the tax of lines shipped to a. The amounts of the lines are
+	// after discounts and may be in any currency.
+	Calculate(a *Address, lines []TaxableLine) (*TaxResult, error)
+}
+
+type TaxService interface {
+	TaxCalculator
+	CreateRate(r *TaxRate) (int, error)
+	UpdateRate(r *TaxRate) error
+	DeleteRate(id int) error
+	// Rates returns the rates of a country or all rates if country is empty.
+	Rates(country string) ([]TaxRate, error)
+}
+
+// TaxRate is the tax a jurisdiction levies on products shipped to it. Country is
+// required, an empty State matches every state and PostalCode matches all postal
+// codes that start with it, so a country, a state and a city can each have their
+// own rate and all of them apply to an address within the city.
+type TaxRate struct {
+	ID int `json:"id"`
+	// Name identifies the jurisdiction in tax breakdowns, e.g. "California state tax".
+	Name string `json:"name"`
+	Country string `json:"country"`
+	State string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	// TaxCategory limits the rate to products of that category. For the same region,
+	// rates of a product's category replace the rates without a category, e.g. to
+	// apply a reduced rate to books.
+	TaxCategory string `json:"tax_category,omitempty"`
+	// Rate is the percentage as a decimal with up to four decimals, e.g. "8.875".
+	Rate string `json:"rate"`
+	// Inclusive rates are included in the prices shown to customers of the country,
+	// exclusive rates are added on top. All rates of a country must agree.
+	Inclusive bool `json:"inclusive"`
+}
+
+type TaxableLine struct {
+	TaxCategory string
+	Amount Money
+}
+
+// TaxResult is the tax of every line and the tax of all lines per jurisdiction.
+type TaxResult struct {
+	Lines []LineTax
+	Tax Money
+	Inclusive bool
+	Taxes []TaxAmount
+}
+
+type LineTax struct {
+	Tax Money
+	Taxes []TaxAmount
+}
+
+// TaxAmount is the tax levied under a single rate.
+type TaxAmount struct {
+	RateID int `json:"rate_id"`
+	Name string `json:"name"`
+	Rate string `json:"rate"`
+	Amount Money `json:"amount"`
+}
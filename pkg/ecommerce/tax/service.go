@@ -0,0 +1,137 @@
+package tax
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var categoryRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+type repository interface {
+	SaveRate(r *ecommerce.TaxRate) (int, error)
+	UpdateRate(r *ecommerce.TaxRate) error
+	DeleteRate(id int) error
+	Rate(id int) (*ecommerce.TaxRate, error)
+	Rates(country string) ([]ecommerce.TaxRate, error)
+}
+
+func New(db *sql.DB, repo repository) *service {
+	return &service{db: db, r: repo}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+}
+
+func (s *service) CreateRate(r *ecommerce.TaxRate) (int, error) {
+	const op = "taxService.CreateRate"
+
+	if err := s.validateRate(r); err != nil {
+		return 0, errors2.Wrap(err, op, "validating rate")
+	}
+
+	id, err := s.r.SaveRate(r)
+	r.ID = id
+
+	return id, errors2.Wrap(err, op, "saving rate")
+}
+
+func (s *service) UpdateRate(r *ecommerce.TaxRate) error {
+	const op = "taxService.UpdateRate"
+
+	if _, err := s.r.Rate(r.ID); err != nil {
+		return errors2.Wrap(err, op, "getting rate")
+	}
+
+	if err := s.validateRate(r); err != nil {
+		return errors2.Wrap(err, op, "validating rate")
+	}
+
+	return errors2.Wrap(s.r.UpdateRate(r), op, "updating rate")
+}
+
+func (s *service) DeleteRate(id int) error {
+	const op = "taxService.DeleteRate"
+
+	return errors2.Wrap(s.r.DeleteRate(id), op, "deleting rate")
+}
+
+func (s *service) Rates(country string) ([]ecommerce.TaxRate, error) {
+	const op = "taxService.Rates"
+
+	rr, err := s.r.Rates(normalize(country))
+
+	return rr, errors2.Wrap(err, op, "getting rates from repo")
+}
+
+// Calculate works out the tax of lines from the rates of the country of a. Lines
+// shipped to an address without a country are not taxed.
+func (s *service) Calculate(a *ecommerce.Address, lines []ecommerce.TaxableLine) (*ecommerce.TaxResult, error) {
+	const op = "taxService.Calculate"
+
+	var rates []ecommerce.TaxRate
+	if a != nil && normalize(a.Country) != "" {
+		var err error
+		rates, err = s.r.Rates(normalize(a.Country))
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "getting rates from repo")
+		}
+	} else {
+		a = &ecommerce.Address{}
+	}
+
+	res, err := calculate(rates, a, lines)
+
+	return res, errors2.Wrap(err, op, "calculating tax")
+}
+
+// validateRate normalizes r and checks that it is well formed and that it agrees
+// with the other rates of its country on whether prices include tax.
+func (s *service) validateRate(r *ecommerce.TaxRate) error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Country = normalize(r.Country)
+	r.State = normalize(r.State)
+	r.PostalCode = normalize(r.PostalCode)
+	r.TaxCategory = strings.ToLower(strings.TrimSpace(r.TaxCategory))
+
+	invalid := func(msg string) error {
+		return &errors2.Invalid{Err: errors.New(msg)}
+	}
+
+	switch {
+	case r.Name == "" || len(r.Name) > 64:
+		return invalid("name is required and must be at most 64 characters")
+	case r.Country == "" || len(r.Country) > 64:
+		return invalid("country is required and must be at most 64 characters")
+	case len(r.State) > 64:
+		return invalid("state must be at most 64 characters")
+	case len(r.PostalCode) > 16:
+		return invalid("postal code must be at most 16 characters")
+	case r.TaxCategory != "" && !categoryRegexp.MatchString(r.TaxCategory):
+		return invalid("tax category must start with a letter and be at most 32 lower case letters, digits or underscores")
+	}
+
+	units, err := parseRate(r.Rate)
+	if err != nil {
+		return &errors2.Invalid{Err: err}
+	}
+	r.Rate = formatRate(units)
+
+	others, err := s.r.Rates(r.Country)
+	if err != nil {
+		return err
+	}
+	for _, o := range others {
+		if o.ID != r.ID && o.Inclusive != r.Inclusive {
+			return &errors2.Invalid{Err: fmt.Errorf("rates of %s must all be inclusive or all exclusive", r.Country)}
+		}
+	}
+
+	return nil
+}
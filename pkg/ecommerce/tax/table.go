@@ -0,0 +1,159 @@
+package tax
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rates are percentages with up to four decimals, which are kept as integers in
+// units of 1/10000 percent so that the tax of a line is exact before rounding.
+const (
+	rateDecimals = 4
+	rateScale = 10000
+	// fullRate is 100% in rate units.
+	fullRate = 100 * rateScale
+)
+
+// parseRate parses a percentage like "8.875" into rate units.
+func parseRate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" || len(frac) > rateDecimals || strings.HasPrefix(whole, "+") {
+		return 0, fmt.Errorf("rate must be a percentage with up to %d decimals", rateDecimals)
+	}
+
+	units, err := strconv.ParseUint(whole+frac+strings.Repeat("0", rateDecimals-len(frac)), 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("rate must be a percentage with up to %d decimals", rateDecimals)
+	} else if units > fullRate {
+		return 0, fmt.Errorf("rate cannot be more than 100%%")
+	}
+
+	return int64(units), nil
+}
+
+// formatRate returns rate units as a percentage without trailing zeros.
+func formatRate(units int64) string {
+	s := fmt.Sprintf("%d.%04d", units/rateScale, units%rateScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// normalize returns the form regions are compared in: trimmed, upper case and,
+// for postal codes, without spaces.
+func normalize(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+}
+
+// applicableRates returns the rates of a product of category shipped to a. Within
+// a region, i.e. rates with the same country, state and postal code, the rates of
+// the category replace those without a category. All other matching rates add up.
+func applicableRates(rates []ecommerce.TaxRate, a *ecommerce.Address, category string) []ecommerce.TaxRate {
+	type region struct {
+		state, postalCode string
+	}
+
+	generic := make(map[region][]ecommerce.TaxRate)
+	specific := make(map[region][]ecommerce.TaxRate)
+	var regions []region
+	for _, r := range rates {
+		if normalize(r.Country) != normalize(a.Country) ||
+			(r.State != "" && normalize(r.State) != normalize(a.State)) ||
+			!strings.HasPrefix(normalize(a.PostalCode), normalize(r.PostalCode)) ||
+			(r.TaxCategory != "" && r.TaxCategory != category) {
+			continue
+		}
+
+		reg := region{state: normalize(r.State), postalCode: normalize(r.PostalCode)}
+		if generic[reg] == nil && specific[reg] == nil {
+			regions = append(regions, reg)
+		}
+		if r.TaxCategory == "" {
+			generic[reg] = append(generic[reg], r)
+		} else {
+			specific[reg] = append(specific[reg], r)
+		}
+	}
+
+	var applicable []ecommerce.TaxRate
+	for _, reg := range regions {
+		if len(specific[reg]) > 0 {
+			applicable = append(applicable, specific[reg]...)
+		} else {
+			applicable = append(applicable, generic[reg]...)
+		}
+	}
+
+	return applicable
+}
+
+// calculate works out the tax of lines shipped to a under rates, which must all
+// be valid. The tax of a line is rounded half away from zero to the minor unit.
+// For exclusive rates every rate is applied to the line amount. For inclusive rates
+// the line amount already contains the tax of all rates, which is split between the
+// rates in proportion to their percentages.
+func calculate(rates []ecommerce.TaxRate, a *ecommerce.Address, lines []ecommerce.TaxableLine) (*ecommerce.TaxResult, error) {
+	res := &ecommerce.TaxResult{Lines: make([]ecommerce.LineTax, len(lines))}
+
+	var order []int
+	totals := make(map[int]ecommerce.TaxAmount)
+	for i, l := range lines {
+		category := l.TaxCategory
+		if category == "" {
+			category = ecommerce.TaxCategoryStandard
+		}
+
+		applicable := applicableRates(rates, a, category)
+		units := make([]int64, len(applicable))
+		var sum int64
+		for k, r := range applicable {
+			u, err := parseRate(r.Rate)
+			if err != nil {
+				return nil, fmt.Errorf("tax rate %d: %v", r.ID, err)
+			}
+			units[k] = u
+			sum += u
+			res.Inclusive = r.Inclusive
+		}
+
+		var amounts []ecommerce.Money
+		if res.Inclusive {
+			// tax = amount - amount / (1 + sum of rates)
+			net := l.Amount.MulFrac(fullRate, fullRate + sum)
+			amounts = l.Amount.Sub(net).Allocate(units)
+		} else {
+			amounts = make([]ecommerce.Money, len(units))
+			for k, u := range units {
+				amounts[k] = l.Amount.MulFrac(u, fullRate)
+			}
+		}
+
+		lt := ecommerce.LineTax{Tax: ecommerce.NewMoney(0, l.Amount.Currency)}
+		for k, r := range applicable {
+			lt.Tax = lt.Tax.Add(amounts[k])
+			lt.Taxes = append(lt.Taxes, ecommerce.TaxAmount{RateID: r.ID, Name: r.Name, Rate: r.Rate, Amount: amounts[k]})
+
+			t, ok := totals[r.ID]
+			if !ok {
+				order = append(order, r.ID)
+				t = ecommerce.TaxAmount{RateID: r.ID, Name: r.Name, Rate: r.Rate}
+			}
+			t.Amount = t.Amount.Add(amounts[k])
+			totals[r.ID] = t
+		}
+
+		res.Lines[i] = lt
+		res.Tax = res.Tax.Add(lt.Tax)
+	}
+
+	for _, id := range order {
+		res.Taxes = append(res.Taxes, totals[id])
+	}
+
+	return res, nil
+}
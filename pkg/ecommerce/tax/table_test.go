@@ -0,0 +1,157 @@
+package tax
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"reflect"
+	"testing"
+)
+
+func usd(amount int64) ecommerce.Money {
+	return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+}
+
+// testRates are a state rate, a county rate for postal codes starting with 900, a
+// reduced state rate for books and a rate of another state.
+var testRates = []ecommerce.TaxRate{
+	{ID: 1, Name: "CA state", Country: "US", State: "CA", Rate: "6"},
+	{ID: 2, Name: "LA county", Country: "US", State: "CA", PostalCode: "900", Rate: "3.5"},
+	{ID: 3, Name: "CA books", Country: "US", State: "CA", TaxCategory: "books", Rate: "1"},
+	{ID: 4, Name: "NY state", Country: "US", State: "NY", Rate: "4"},
+}
+
+var vatRates = []ecommerce.TaxRate{
+	{ID: 5, Name: "DE VAT", Country: "DE", Rate: "19", Inclusive: true},
+	{ID: 6, Name: "DE reduced VAT", Country: "DE", TaxCategory: "books", Rate: "7", Inclusive: true},
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in string
+		units int64
+		ok bool
+	}{
+		{"8.875", 88750, true},
+		{"0", 0, true},
+		{"100", 1000000, true},
+		{" 7.5 ", 75000, true},
+		{"100.0001", 0, false},
+		{"1.23456", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{".5", 0, false},
+		{"abc", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			units, err := parseRate(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("wanted ok %v, got error %v", tt.ok, err)
+			}
+			if units != tt.units {
+				t.Fatalf("wanted %v, got %v", tt.units, units)
+			}
+			if tt.ok && formatRate(units) != formatRate(tt.units) {
+				t.Fatalf("wanted %v, got %v", formatRate(tt.units), formatRate(units))
+			}
+		})
+	}
+}
+
+func TestApplicableRates(t *testing.T) {
+	tests := []struct {
+		name string
+		address ecommerce.Address
+		category string
+		want []int
+	}{
+		{"state", ecommerce.Address{Country: "US", State: "CA", PostalCode: "94105"}, "standard", []int{1}},
+		{"state and county", ecommerce.Address{Country: "us", State: "ca", PostalCode: "90012"}, "standard", []int{1, 2}},
+		{"category replaces state rate", ecommerce.Address{Country: "US", State: "CA", PostalCode: "90012"}, "books", []int{3, 2}},
+		{"other state", ecommerce.Address{Country: "US", State: "NY", PostalCode: "90012"}, "standard", []int{4}},
+		{"no rates", ecommerce.Address{Country: "US", State: "TX"}, "standard", nil},
+		{"other country", ecommerce.Address{Country: "CA", State: "CA"}, "standard", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, r := range applicableRates(testRates, &tt.address, tt.category) {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name string
+		rates []ecommerce.TaxRate
+		address ecommerce.Address
+		lines []ecommerce.TaxableLine
+		inclusive bool
+		lineTaxes []int64
+		taxes map[int]int64
+	}{
+		{
+			name: "exclusive",
+			rates: testRates,
+			address: ecommerce.Address{Country: "US", State: "CA", PostalCode: "90012"},
+			lines: []ecommerce.TaxableLine{{Amount: usd(1000)}, {TaxCategory: "books", Amount: usd(2550)}},
+			// 60 + 35; 26 (25.5 rounded) + 89 (89.25)
+			lineTaxes: []int64{95, 115},
+			taxes: map[int]int64{1: 60, 2: 124, 3: 26},
+		},
+		{
+			name: "inclusive",
+			rates: vatRates,
+			address: ecommerce.Address{Country: "DE"},
+			lines: []ecommerce.TaxableLine{{Amount: usd(11900)}, {TaxCategory: "books", Amount: usd(1070)}},
+			inclusive: true,
+			lineTaxes: []int64{1900, 70},
+			taxes: map[int]int64{5: 1900, 6: 70},
+		},
+		{
+			name: "no rates",
+			rates: testRates,
+			address: ecommerce.Address{Country: "US", State: "TX"},
+			lines: []ecommerce.TaxableLine{{Amount: usd(1000)}},
+			lineTaxes: []int64{0},
+			taxes: map[int]int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := calculate(tt.rates, &tt.address, tt.lines)
+			if err != nil {
+				t.Fatalf("wanted no error, got %v", err)
+			}
+			if res.Inclusive != tt.inclusive {
+				t.Fatalf("wanted inclusive %v, got %v", tt.inclusive, res.Inclusive)
+			}
+
+			var total int64
+			for i, lt := range res.Lines {
+				if lt.Tax.Amount != tt.lineTaxes[i] {
+					t.Fatalf("wanted line %d tax %v, got %v", i, tt.lineTaxes[i], lt.Tax.Amount)
+				}
+				total += lt.Tax.Amount
+			}
+			if res.Tax.Amount != total {
+				t.Fatalf("wanted tax %v, got %v", total, res.Tax.Amount)
+			}
+
+			taxes := make(map[int]int64)
+			for _, ta := range res.Taxes {
+				taxes[ta.RateID] = ta.Amount.Amount
+			}
+			if !reflect.DeepEqual(taxes, tt.taxes) {
+				t.Fatalf("wanted %v, got %v", tt.taxes, taxes)
+			}
+		})
+	}
+}
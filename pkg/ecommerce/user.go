@@ -2,6 +2,8 @@ package ecommerce
 
 import (
 	"context"
+	"database/sql"
+	"ecommerce/pkg/slice"
 	"errors"
 	"github.com/dgrijalva/jwt-go"
 	"time"
@@ -9,27 +11,149 @@ import (
 
 const (
 	RoleCustomer = 1
+	RoleAdmin = 2
+)
+
+// Purposes of the single use tokens emailed to users, see UserToken.
+const (
+	UserTokenEmailVerification = "email_verification"
+	UserTokenPasswordReset = "password_reset"
+	// UserTokenTwoFactorChallenge tokens are not emailed, they are handed out after the
+	// password of a user with two-factor authentication was checked.
+	UserTokenTwoFactorChallenge = "two_factor_challenge"
+)
+
+// SessionValidFor is how long a user stays logged in with a session.
+const SessionValidFor = 60 * time.Hour * 24 * 3
+
+// Scopes failed logins are counted in: per account, by email address whether or not
+// there is an account with it, and per IP address.
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP = "ip"
+)
+
+// Reasons of failed login attempts.
+const (
+	LoginFailedPassword = "password"
+	LoginFailedLocked = "locked"
+	LoginFailedTwoFactor = "two_factor"
 )
 type UserService interface {
 	CreateCustomer(c *User, password string) (int, error)
-	EmailMatchPassword(email string, password string) (bool, int, error)
+	// EmailMatchPassword returns true and the id of the user with email if password is
+	// theirs. Failed attempts are counted per account and per ip, and once there are too
+	// many it fails with RateLimited without checking the password.
+	EmailMatchPassword(email, password, ip string) (bool, int, error)
+	// LoginAttempts returns the recent failed logins to the account of a user, newest first.
+	LoginAttempts(uid int) ([]LoginAttempt, error)
+	// UnlockLogin lifts the lockout of the account of a user after failed logins.
+	UnlockLogin(uid int) error
+	// LoginChallenge returns a short-lived challenge token if the user, whose password
+	// was checked, has two-factor authentication, or an empty string if they do not.
+	LoginChallenge(uid int) (string, error)
+	// CompleteLoginChallenge checks code, a TOTP code or recovery code, against a
+	// challenge token from ip and returns the id of the user. The challenge is used up
+	// by a wrong code too, and failures count towards the login lockout.
+	CompleteLoginChallenge(challenge, code, ip string) (int, error)
+	// EnrollTOTP starts setting up TOTP two-factor authentication for a user. It is not
+	// required until confirmed with ConfirmTOTP.
+	EnrollTOTP(uid int) (*TOTPEnrollment, error)
+	// ConfirmTOTP turns on two-factor authentication if code is a current code of the
+	// enrolled secret and returns recovery codes, which are not shown again.
+	ConfirmTOTP(uid int, code string) ([]string, error)
+	// DisableTOTP turns off two-factor authentication if password is the user's.
+	DisableTOTP(uid int, password string) error
+	// RegenerateRecoveryCodes replaces the recovery codes of a user if code is a current
+	// TOTP code.
+	RegenerateRecoveryCodes(uid int, code string) ([]string, error)
+	// IdentityProviders returns the names of the identity providers users can log in with.
+	IdentityProviders() []string
+	// StartExternalLogin returns the URL to send a user to, to log in with provider, and
+	// a secret binding the login to the browser of the user, which keeps it until the
+	// login is completed.
+	StartExternalLogin(provider string) (string, string, error)
+	// CompleteExternalLogin finishes a login with provider the user came back from with
+	// code and state in the browser with binding, and returns their id. A user new to the
+	// provider is linked to the user with the email the provider verified, or signed up
+	// if there is none.
+	CompleteExternalLogin(provider, code, state, binding string) (int, error)
 	User(uid int) (*User, error)
 	UpdateUser(user *User) error
 	SaveCreditCard(c *CreditCard, custID int) (int, error)
 	CreditCards(uid int) ([]CreditCard, error)
 	DeleteCreditCard(id int) error
-	UpdateCustomerAddress(custID int, a *Address) error
+	// Addresses returns the address book of a customer, oldest address first.
+	Addresses(custID int) ([]Address, error)
+	// Address returns the address with id if it belongs to the customer.
+	Address(custID, id int) (*Address, error)
+	// CreateAddress adds a to the address book of a customer. The first address of a
+	// customer becomes their default shipping and billing address.
+	CreateAddress(custID int, a *Address) (int, error)
+	// UpdateAddress updates an address of a customer. A default flag set on a makes it
+	// the default of its kind, unset flags leave the defaults as they are.
+	UpdateAddress(custID int, a *Address) error
+	// DeleteAddress deletes an address of a customer. If it was a default, the oldest
+	// remaining address takes its place.
+	DeleteAddress(custID, id int) error
+	// CustomerAddress returns the default shipping address of a customer, or nil if
+	// they have none.
 	CustomerAddress(custID int) (*Address, error)
-	DeleteCustomerAddress(custID int) error
 	OrdersByCustID(custID int) ([]Order, error)
+	Order(orderID int) (*Order, error)
+	UpdateOrderStatus(orderID int, status string) error
 	CartItems(custID int) ([]CartItem, error)
-	AddCartItems(custID, productID int) error
+	AddCartItems(custID, productID, variantID int) error
+	ClearCartWithTx(tx *sql.Tx, custID int) error
+	// AddCartItemWithTx adds quantity units of a product to the cart of a customer.
+	AddCartItemWithTx(tx *sql.Tx, custID, productID, variantID, quantity int) error
+	// RemoveCartItemWithTx removes a line from the cart of a customer.
+	RemoveCartItemWithTx(tx *sql.Tx, custID, productID, variantID int) error
 	CartItemCount(custID int) (int, error)
+	// RequestEmailVerification emails a link to verify their email address to a user.
+	RequestEmailVerification(uid int) error
+	// VerifyEmail marks the email address a verification token was issued for as verified.
+	VerifyEmail(token string) error
+	// RequestPasswordReset emails a link to reset their password to the user with email.
+	// It does not tell whether there is such a user, so that it cannot be used to find
+	// out who has an account.
+	RequestPasswordReset(email string) error
+	// ResetPassword sets the password of the user a password reset token was issued for.
+	ResetPassword(token, password string) error
+	// ChangePassword sets the password of a user if current is their password, and
+	// revokes the sessions of the user but the one with keepSessionID.
+	ChangePassword(uid, keepSessionID int, current, password string) error
+	// StartSession logs in a user from a device with ip and userAgent and returns the
+	// id of the session, which their auth token carries.
+	StartSession(uid int, ip, userAgent string) (int, error)
+	// Sessions returns the sessions a user is logged in with, last seen first.
+	Sessions(uid int) ([]Session, error)
+	// RevokeSession logs out the session of a user with id.
+	RevokeSession(uid, id int) error
+	// RevokeOtherSessions logs out the sessions of a user but the one with keepID.
+	RevokeOtherSessions(uid, keepID int) error
+	// ExportPersonalData returns the data the shop has about a user.
+	ExportPersonalData(uid int) (*PersonalData, error)
+	// RequestAccountDeletion schedules the deletion of the account of a user if password
+	// is theirs or sessionID is a session they just logged in with, logs out their
+	// sessions and returns when the account is deleted. Until then the user can log in
+	// and cancel it with CancelAccountDeletion.
+	RequestAccountDeletion(uid, sessionID int, password string) (time.Time, error)
+	CancelAccountDeletion(uid int) error
+	// PurgeDeletedAccounts deletes the accounts that are due for deletion and returns
+	// how many it deleted. Their orders are kept without the personal data of the user.
+	PurgeDeletedAccounts() (int, error)
+	// SessionRevoked returns true if the session of a user with id no longer works,
+	// because it was revoked or expired, and records that it was seen from ip otherwise.
+	// The answer may be cached for a short while.
+	SessionRevoked(uid, id int, ip string) (bool, error)
 }
 
 type UserClaims struct {
 	UserID         int   `json:"user_id"`
 	Roles          []int `json:"roles"`
+	TwoFactor bool `json:"two_factor,omitempty"`
+	SessionID int `json:"sid"`
 	jwt.StandardClaims
 }
 
@@ -38,8 +162,96 @@ type User struct {
 	FirstName string `json:"first_name"`
 	LastName string `json:"last_name"`
 	Email string `json:"email"`
+	EmailVerified bool `json:"email_verified"`
 	Roles []int `json:"roles"`
-	AddressID int `json:"address_id"`
+	// TwoFactor is true if the user logged in with a second factor. It is carried by
+	// auth tokens only.
+	TwoFactor bool `json:"-"`
+	// SessionID is the session the user is logged in with. It is carried by auth tokens
+	// only.
+	SessionID int `json:"-"`
+	// DeletionScheduledAt is when the account of the user is deleted, if they asked for it.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// PersonalData is the data the shop has about a user, for them to take elsewhere.
+type PersonalData struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Profile *User `json:"profile"`
+	Addresses []Address `json:"addresses"`
+	// CreditCards are masked, see CreditCard.Masked.
+	CreditCards []CreditCard `json:"credit_cards"`
+	Orders []Order `json:"orders"`
+	Reviews []Review `json:"reviews"`
+	Cart []CartItem `json:"cart"`
+}
+
+// Session is a login of a user from a device.
+type Session struct {
+	ID int `json:"id"`
+	UserID int `json:"-"`
+	// Device is a short description of the device, e.g. "Firefox on Windows", made from
+	// the user agent.
+	Device string `json:"device"`
+	// IP is the address the session was last seen from.
+	IP string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"-"`
+	// Current is true for the session the sessions are listed with.
+	Current bool `json:"current"`
+}
+
+// UserToken is a single use token emailed to a user to prove that they own their
+// email address. Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID int
+	UserID int
+	Purpose string
+	// Email is the address the token was sent to.
+	Email string
+	Hash string
+	ExpiresAt time.Time
+	UsedAt *time.Time
+	CreatedAt time.Time
+}
+
+// LoginAttempt is a failed login, kept as an audit trail.
+type LoginAttempt struct {
+	ID int `json:"id"`
+	// UserID is 0 if there is no user with Email.
+	UserID int `json:"user_id,omitempty"`
+	Email string `json:"email"`
+	IP string `json:"ip"`
+	Reason string `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TOTP is the time-based one-time password (RFC 6238) second factor of a user.
+type TOTP struct {
+	UserID int
+	Secret string
+	// ConfirmedAt is nil until the user proved with a code that they set up their
+	// authenticator, only then the second factor is required.
+	ConfirmedAt *time.Time
+	// LastStep is the time step of the last code used. Codes of earlier steps are
+	// rejected, so that a code cannot be used twice.
+	LastStep int64
+	CreatedAt time.Time
+}
+
+// TOTPEnrollment is what a user needs to set up their authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// ProvisioningURI is the otpauth URI of the secret to show as a QR code.
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// HasRole returns true if role is one of the user's roles.
+func (u *User) HasRole(role int) bool {
+	return slice.IntSliceContainsIntValue(u.Roles, role)
 }
 
 func (u *User) AuthToken() (string, error) {
@@ -65,13 +277,21 @@ func (u *User) claims() (*UserClaims, error) {
 		return nil, errors.New("invalid roles")
 	}
 
+	if u.SessionID < 1 {
+		return nil, errors.New("invalid session id")
+	}
+
 	//expirationTime := time.Now().Add(5 * time.Minute)
-	expirationTime := time.Now().Add(60 * time.Hour * 24 * 3)
+	now := time.Now()
+	expirationTime := now.Add(SessionValidFor)
 	c := &UserClaims{
 		UserID: u.ID,
 		Roles: u.Roles,
+		TwoFactor: u.TwoFactor,
+		SessionID: u.SessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
+			IssuedAt: now.Unix(),
 		},
 	}
 
@@ -108,6 +328,18 @@ func UserFromContext(ctx context.Context) (*User, bool) {
 // with only minimal info like user id, roles and org id from auth token.
 // If more user info is needed, the DB should be queried.
 func UserFromAuthToken(authToken string) (*User, error) {
+	c, err := ParseAuthToken(authToken)
+	if err != nil {
+		// user is not logged in
+		return nil, err
+	}
+
+	// user is logged in
+	return c.User(), nil
+}
+
+// ParseAuthToken returns the claims of authToken if it is valid.
+func ParseAuthToken(authToken string) (*UserClaims, error) {
 	c := &UserClaims{}
 
 	_, err := jwt.ParseWithClaims(authToken, c, func(token *jwt.Token) (interface{}, error) {
@@ -122,16 +354,18 @@ func UserFromAuthToken(authToken string) (*User, error) {
 	}*/
 
 	if err != nil {
-		// user is not logged in
 		return nil, err
 	}
 
-	// user is logged in
-	var u2 *User
-	u2 = &User{
+	return c, nil
+}
+
+// User returns the user the claims are about, with only their id and roles.
+func (c *UserClaims) User() *User {
+	return &User{
 		ID:    c.UserID,
 		Roles: c.Roles,
+		TwoFactor: c.TwoFactor,
+		SessionID: c.SessionID,
 	}
-
-	return u2, nil
 }
@@ -0,0 +1,33 @@
+package user
+
+import "ecommerce/pkg/ecommerce"
+
+// addressByID returns the address of aa with id, or nil if there is none.
+func addressByID(aa []ecommerce.Address, id int) *ecommerce.Address {
+	for i := range aa {
+		if aa[i].ID == id {
+			return &aa[i]
+		}
+	}
+
+	return nil
+}
+
+// nextDefault returns the oldest address of aa other than deleted with the defaults of
+// deleted added, or nil if deleted was no default or there is no other address.
+func nextDefault(aa []ecommerce.Address, deleted *ecommerce.Address) *ecommerce.Address {
+	if !deleted.DefaultShipping && !deleted.DefaultBilling {
+		return nil
+	}
+
+	for _, a := range aa {
+		if a.ID == deleted.ID {
+			continue
+		}
+		a.DefaultShipping = a.DefaultShipping || deleted.DefaultShipping
+		a.DefaultBilling = a.DefaultBilling || deleted.DefaultBilling
+		return &a
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package user
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+func TestNextDefault(t *testing.T) {
+	aa := []ecommerce.Address{
+		{ID: 1, DefaultShipping: true},
+		{ID: 2, DefaultBilling: true},
+		{ID: 3},
+	}
+
+	tests := []struct {
+		name string
+		deleted int
+		want *ecommerce.Address
+	}{
+		{"default shipping moves to the oldest other address", 1, &ecommerce.Address{ID: 2, DefaultShipping: true, DefaultBilling: true}},
+		{"default billing moves to the oldest other address", 2, &ecommerce.Address{ID: 1, DefaultShipping: true, DefaultBilling: true}},
+		{"no default", 3, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextDefault(aa, addressByID(aa, tt.deleted))
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Fatalf("wanted %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package user
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"sort"
+	"time"
+)
+
+// AddIdentityProvider lets users log in with p under name.
+func (s *service) AddIdentityProvider(name string, p ecommerce.IdentityProvider) {
+	if s.providers == nil {
+		s.providers = map[string]ecommerce.IdentityProvider{}
+	}
+
+	s.providers[name] = p
+}
+
+func (s *service) IdentityProviders() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// StartExternalLogin saves the state, nonce and PKCE code verifier of the login. The
+// state travels through the provider, so it is saved hashed together with the binding,
+// which only the browser the login was started in has, and the login can only be
+// completed with both.
+func (s *service) StartExternalLogin(provider string) (string, string, error) {
+	const op = "userService.StartExternalLogin"
+
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", errors2.Wrap(&errors2.NotFound{Err: errors.New("unknown identity provider")}, op, "getting provider")
+	}
+
+	var values [4]string
+	for i := range values {
+		v, _, err := newToken()
+		if err != nil {
+			return "", "", errors2.Wrap(err, op, "generating token")
+		}
+		values[i] = v
+	}
+	state, binding, nonce, verifier := values[0], values[1], values[2], values[3]
+
+	now := time.Now()
+	l := ecommerce.ExternalLogin{StateHash: boundStateHash(state, binding), Provider: provider, Nonce: nonce,
+		CodeVerifier: verifier, ExpiresAt: now.Add(ecommerce.ExternalLoginValidFor)}
+	if err := s.r.SaveExternalLogin(&l, now); err != nil {
+		return "", "", errors2.Wrap(err, op, "saving login")
+	}
+
+	u, err := p.AuthURL(state, nonce, verifier)
+	return u, binding, errors2.Wrap(err, op, "getting auth url")
+}
+
+// boundStateHash returns the hash an external login with state and binding is saved
+// under. Both are tokens, which cannot contain the separator.
+func boundStateHash(state, binding string) string {
+	return hashToken(state + "." + binding)
+}
+
+func (s *service) CompleteExternalLogin(provider, code, state, binding string) (int, error) {
+	const op = "userService.CompleteExternalLogin"
+
+	p, ok := s.providers[provider]
+	if !ok {
+		return 0, errors2.Wrap(&errors2.NotFound{Err: errors.New("unknown identity provider")}, op, "getting provider")
+	}
+
+	now := time.Now()
+	l, err := s.r.UseExternalLogin(boundStateHash(state, binding), provider, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		// a login started in another browser is not found either
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("the login expired, please try again")}, op, "using login")
+	} else if err != nil {
+		return 0, errors2.Wrap(err, op, "using login")
+	}
+
+	c, err := p.Exchange(code, l.CodeVerifier, l.Nonce)
+	if err != nil {
+		// the details are logged, the client only learns that it failed
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("the login with the provider failed, please try again")}, op, err.Error())
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	id, err := s.r.IdentityWithTx(tx, provider, c.Subject)
+	if err == nil {
+		return id.UserID, errors2.Wrap(tx.Commit(), op, "committing tx")
+	} else if _, ok := errors2.Unwrap(err).(*errors2.NotFound); !ok {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "getting identity")
+	}
+
+	// a new identity is linked by email, which only works if the provider vouches for it
+	if c.Email == "" || !c.EmailVerified {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("the provider did not verify your email address")}, op, "checking email")
+	}
+
+	uid, _, err := s.r.UserIDAndPasswordByEmail(c.Email)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		uid, err = s.createExternalUserWithTx(tx, c)
+	} else if err == nil {
+		err = s.linkUserWithTx(tx, uid, now)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "getting user")
+	}
+
+	err = s.r.SetEmailVerifiedWithTx(tx, uid, c.Email, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); err != nil && !ok {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "verifying email")
+	}
+
+	_, err = s.r.SaveIdentityWithTx(tx, &ecommerce.Identity{UserID: uid, Provider: provider, Subject: c.Subject, Email: c.Email,
+		CreatedAt: now})
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving identity")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, errors2.Wrap(err, op, "committing tx")
+	}
+
+	// the sessions of a linked user may have been logged out, see linkUserWithTx
+	s.sessions.forgetUser(uid, 0, time.Now())
+	return uid, nil
+}
+
+// createExternalUserWithTx signs up the customer with the claims of a provider. They
+// get a password nobody knows, which they can reset to log in without the provider.
+func (s *service) createExternalUserWithTx(tx *sql.Tx, c *ecommerce.IdentityClaims) (int, error) {
+	hash, err := s.unusablePassword()
+	if err != nil {
+		return 0, err
+	}
+
+	u := &ecommerce.User{FirstName: c.GivenName, LastName: c.FamilyName, Email: c.Email}
+	id, err := s.r.SaveUserWithTx(tx, u, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = s.r.UpdateRolesWithTx(tx, id, []int{ecommerce.RoleCustomer}); err != nil {
+		return 0, err
+	}
+
+	err = s.mailService.EnqueueWithTx(tx, c.Email, ecommerce.EmailWelcome, &ecommerce.WelcomeEmail{Name: c.GivenName})
+	return id, err
+}
+
+// linkUserWithTx prepares the user with uid to be linked to an identity with their
+// email. If they never verified their email, whoever set their password did not prove
+// to own the address, so the password is replaced and their sessions are logged out.
+func (s *service) linkUserWithTx(tx *sql.Tx, uid int, now time.Time) error {
+	u, err := s.r.User(uid)
+	if err != nil || u.EmailVerified {
+		return err
+	}
+
+	hash, err := s.unusablePassword()
+	if err != nil {
+		return err
+	}
+
+	if err = s.r.UpdatePasswordWithTx(tx, uid, hash); err != nil {
+		return err
+	}
+
+	return s.revokeSessionsWithTx(tx, uid, 0, now)
+}
+
+// unusablePassword returns the hash of a random password.
+func (s *service) unusablePassword() (string, error) {
+	password, _, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	return s.policy.Hash(password)
+}
@@ -0,0 +1,122 @@
+package user
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is how much of a password bcrypt uses, the rest would be ignored.
+const maxPasswordBytes = 72
+
+// sha1Line matches a line of a breached password list in the format of Have I Been
+// Pwned, a SHA-1 hash optionally followed by how often the password was seen.
+var sha1Line = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:[0-9]+)?$`)
+
+// PasswordPolicy is what the passwords of users must satisfy and how they are hashed.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters of a password.
+	MinLength int
+	// Cost is the bcrypt cost passwords are hashed with. Passwords hashed with another
+	// cost are rehashed when their user logs in.
+	Cost int
+	// breached are the SHA-1 hashes of passwords known from data breaches.
+	breached map[[sha1.Size]byte]struct{}
+	// dummy is a hash with Cost that logins to unknown accounts are checked against.
+	dummy []byte
+}
+
+// NewPasswordPolicy returns a policy for passwords of at least minLength characters
+// hashed with cost. If breached is not nil, it is read as a list of breached
+// passwords that are rejected, one per line, either in plain text or as the SHA-1
+// hashes of the downloadable Have I Been Pwned lists.
+func NewPasswordPolicy(minLength, cost int, breached io.Reader) (*PasswordPolicy, error) {
+	if minLength < 1 || minLength > maxPasswordBytes {
+		return nil, fmt.Errorf("minimum password length must be between 1 and %d", maxPasswordBytes)
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	dummy, err := bcrypt.GenerateFromPassword([]byte("dummy password"), cost)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PasswordPolicy{MinLength: minLength, Cost: cost, breached: map[[sha1.Size]byte]struct{}{}, dummy: dummy}
+	if breached == nil {
+		return p, nil
+	}
+
+	sc := bufio.NewScanner(breached)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if !sha1Line.MatchString(line) {
+			p.breached[sha1.Sum([]byte(line))] = struct{}{}
+			continue
+		}
+
+		var sum [sha1.Size]byte
+		_, _ = hex.Decode(sum[:], []byte(line[:2*sha1.Size]))
+		p.breached[sum] = struct{}{}
+	}
+
+	return p, sc.Err()
+}
+
+// Validate returns an Invalid error if password does not satisfy p for the user with
+// email.
+func (p *PasswordPolicy) Validate(password, email string) error {
+	var msg string
+	switch {
+	case utf8.RuneCountInString(password) < p.MinLength:
+		msg = fmt.Sprintf("password must be at least %d characters", p.MinLength)
+	case len(password) > maxPasswordBytes:
+		msg = fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes)
+	case email != "" && strings.EqualFold(password, strings.TrimSpace(email)):
+		msg = "password must not be your email address"
+	case p.Breached(password):
+		msg = "password appeared in a data breach, please choose another one"
+	default:
+		return nil
+	}
+
+	return &errors2.Invalid{Err: errors.New(msg)}
+}
+
+// Breached returns true if password is on the breached password list of p.
+func (p *PasswordPolicy) Breached(password string) bool {
+	_, ok := p.breached[sha1.Sum([]byte(password))]
+	return ok
+}
+
+// Hash returns the bcrypt hash of password with the cost of p.
+func (p *PasswordPolicy) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+	return string(hash), err
+}
+
+// NeedsRehash returns true if hash was not made with the cost of p.
+func (p *PasswordPolicy) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost != p.Cost
+}
+
+// CompareDummy compares password with a hash of p and ignores the result. It takes as
+// long as checking a password, so that checking one of an unknown account cannot be
+// told apart by how long it took.
+func (p *PasswordPolicy) CompareDummy(password string) {
+	_ = bcrypt.CompareHashAndPassword(p.dummy, []byte(password))
+}
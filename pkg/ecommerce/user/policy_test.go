@@ -0,0 +1,93 @@
+package user
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	list := "correct horse\n\n" + strings.ToUpper(hexSHA1("P@ssw0rd!")) + ":12\n"
+	p, err := NewPasswordPolicy(8, bcrypt.MinCost, strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		valid bool
+	}{
+		{"", false},
+		{"short", false},
+		// characters are counted, not bytes
+		{"äöüäöüä", false},
+		{"äöüäöüäö", true},
+		{strings.Repeat("a", 73), false},
+		{"correct horse", false},
+		{"P@ssw0rd!", false},
+		{"ADA@example.com", false},
+		{"correct horse battery", true},
+	}
+
+	for _, tt := range tests {
+		err := p.Validate(tt.password, "ada@example.com")
+		if tt.valid && err != nil {
+			t.Errorf("wanted %q to be valid, got %v", tt.password, err)
+		} else if !tt.valid {
+			if _, ok := errors2.Unwrap(err).(*errors2.Invalid); !ok {
+				t.Errorf("wanted %q to be invalid, got %v", tt.password, err)
+			}
+		}
+	}
+}
+
+func TestPasswordPolicyReadsHashes(t *testing.T) {
+	p, err := NewPasswordPolicy(8, bcrypt.MinCost, strings.NewReader(strings.ToLower(hexSHA1("hunter22"))+":7\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Breached("hunter22") || p.Breached("hunter23") {
+		t.Fatal("wanted only the password with the listed hash to be breached")
+	}
+}
+
+func TestPasswordPolicyRehash(t *testing.T) {
+	p, err := NewPasswordPolicy(8, bcrypt.MinCost+1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := p.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NeedsRehash(hash) {
+		t.Fatal("wanted a hash with the cost of the policy not to need rehashing")
+	}
+
+	old, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.NeedsRehash(string(old)) {
+		t.Fatal("wanted a hash with another cost to need rehashing")
+	}
+}
+
+func TestNewPasswordPolicyChecksSettings(t *testing.T) {
+	if _, err := NewPasswordPolicy(0, bcrypt.DefaultCost, nil); err == nil {
+		t.Fatal("wanted an error for a minimum length of 0")
+	}
+	if _, err := NewPasswordPolicy(8, bcrypt.MaxCost+1, nil); err == nil {
+		t.Fatal("wanted an error for a cost bcrypt does not support")
+	}
+}
+
+func hexSHA1(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
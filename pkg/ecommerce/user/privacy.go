@@ -0,0 +1,220 @@
+package user
+
+import (
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+const (
+	// purgeBatch is how many accounts PurgeDeletedAccounts deletes at most per run.
+	purgeBatch = 100
+	// freshLoginFor is how long after logging in users can delete their account without
+	// their password, which users who signed up with an identity provider do not know.
+	freshLoginFor = 10 * time.Minute
+)
+
+func (s *service) ExportPersonalData(uid int) (*ecommerce.PersonalData, error) {
+	const op = "userService.ExportPersonalData"
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting user")
+	}
+
+	d := &ecommerce.PersonalData{ExportedAt: time.Now(), Profile: u}
+
+	if d.Addresses, err = s.addressRepo.Addresses(uid); err != nil {
+		return nil, errors2.Wrap(err, op, "getting addresses")
+	}
+
+	cc, err := s.r.CreditCards(uid)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting credit cards")
+	}
+	for _, c := range cc {
+		d.CreditCards = append(d.CreditCards, c.Masked())
+	}
+
+	if d.Orders, err = s.OrdersByCustID(uid); err != nil {
+		return nil, errors2.Wrap(err, op, "getting orders")
+	}
+
+	if d.Reviews, err = s.r.CustomerReviews(uid); err != nil {
+		return nil, errors2.Wrap(err, op, "getting reviews")
+	}
+
+	if d.Cart, err = s.r.CartItems(uid); err != nil {
+		return nil, errors2.Wrap(err, op, "getting cart")
+	}
+
+	return d, nil
+}
+
+// RequestAccountDeletion asks for the password unless the user just logged in, so that
+// a session left open on another device is not enough to delete the account.
+func (s *service) RequestAccountDeletion(uid, sessionID int, password string) (time.Time, error) {
+	const op = "userService.RequestAccountDeletion"
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return time.Time{}, errors2.Wrap(err, op, "getting user")
+	} else if u.DeletionScheduledAt != nil {
+		return time.Time{}, errors2.Wrap(&errors2.Invalid{Err: errors.New("the deletion of your account is already scheduled")}, op, "checking user")
+	}
+
+	fresh, err := s.freshLogin(uid, sessionID, time.Now())
+	if err != nil {
+		return time.Time{}, errors2.Wrap(err, op, "checking session")
+	} else if !fresh && password == "" {
+		return time.Time{}, errors2.Wrap(&errors2.Invalid{Err: errors.New("enter your password or log in again to delete your account")}, op, "checking password")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return time.Time{}, errors2.Wrap(err, op, "getting tx")
+	}
+
+	if !fresh {
+		hash, err := s.r.PasswordWithTx(tx, uid)
+		if err != nil {
+			_ = tx.Rollback()
+			return time.Time{}, errors2.Wrap(err, op, "getting password")
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			_ = tx.Rollback()
+			return time.Time{}, errors2.Wrap(&errors2.Invalid{Err: errors.New("the password is incorrect")}, op, "checking password")
+		} else if err != nil {
+			_ = tx.Rollback()
+			return time.Time{}, errors2.Wrap(err, op, "checking password")
+		}
+	}
+
+	now := time.Now()
+	at := now.Add(s.deletionGrace)
+	if err = s.r.ScheduleDeletionWithTx(tx, uid, &at); err != nil {
+		_ = tx.Rollback()
+		return time.Time{}, errors2.Wrap(err, op, "scheduling deletion")
+	}
+
+	if err = s.revokeSessionsWithTx(tx, uid, 0, now); err != nil {
+		_ = tx.Rollback()
+		return time.Time{}, errors2.Wrap(err, op, "revoking sessions")
+	}
+
+	err = s.mailService.EnqueueWithTx(tx, u.Email, ecommerce.EmailAccountDeletion, &ecommerce.AccountDeletionEmail{
+		Name: u.FirstName, DeleteAt: at})
+	if err != nil {
+		_ = tx.Rollback()
+		return time.Time{}, errors2.Wrap(err, op, "enqueueing email")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return time.Time{}, errors2.Wrap(err, op, "committing tx")
+	}
+
+	s.sessions.forgetUser(uid, 0, time.Now())
+	return at, nil
+}
+
+// freshLogin reports whether the session with sessionID of the user with uid started
+// less than freshLoginFor before now, after a login with all its steps.
+func (s *service) freshLogin(uid, sessionID int, now time.Time) (bool, error) {
+	ss, err := s.r.Sessions(uid, now)
+	if err != nil {
+		return false, err
+	}
+
+	for _, se := range ss {
+		if se.ID == sessionID {
+			return now.Sub(se.CreatedAt) < freshLoginFor, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *service) CancelAccountDeletion(uid int) error {
+	const op = "userService.CancelAccountDeletion"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	if err = s.r.ScheduleDeletionWithTx(tx, uid, nil); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "cancelling deletion")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// PurgeDeletedAccounts deletes each account in a transaction of its own, so that an
+// account that fails does not hold up the others. The first error is returned after
+// all accounts were tried. An account whose deletion was cancelled since it was looked
+// up is skipped.
+func (s *service) PurgeDeletedAccounts() (int, error) {
+	const op = "userService.PurgeDeletedAccounts"
+
+	now := time.Now()
+	ids, err := s.r.UsersDueForDeletion(now, purgeBatch)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting users")
+	}
+
+	var n int
+	var failed []int
+	var firstErr error
+	for _, id := range ids {
+		purged, err := s.purge(id, now)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed = append(failed, id)
+		} else if purged {
+			n++
+		}
+	}
+
+	return n, errors2.Wrap(firstErr, op, fmt.Sprintf("purging users %v", failed))
+}
+
+// purge deletes the user with id if their account is due for deletion at now. Their
+// orders lose their customer and address but for the country and state, which the
+// shop needs for its tax records.
+func (s *service) purge(id int, now time.Time) (bool, error) {
+	u, err := s.r.User(id)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return false, err
+	}
+
+	err = s.r.PurgeUserWithTx(tx, id, u.Email, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		_ = tx.Rollback()
+		return false, nil
+	} else if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	s.sessions.forgetUser(id, 0, time.Now())
+	return true, nil
+}
@@ -6,6 +6,18 @@ import (
 	errors2 "ecommerce/pkg/ecommerce/errors"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// verificationValidFor and resetValidFor are how long email verification and
+	// password reset tokens work.
+	verificationValidFor = 48 * time.Hour
+	resetValidFor = time.Hour
+	// tokensPerHour is how many tokens of each purpose a user is emailed per hour at most.
+	tokensPerHour = 3
 )
 
 type repository interface {
@@ -20,41 +32,154 @@ type repository interface {
 	//Product(id int) (*ecommerce.Product, error)
 	CustOrderIDs(id int) ([]int, error)
 	CartItems(custID int) ([]ecommerce.CartItem, error)
-	AddCartItems(custID, productID int) error
+	AddCartItems(custID, productID, variantID int) error
+	DeleteCartItemsWithTx(tx *sql.Tx, custID int) error
+	AddCartItemWithTx(tx *sql.Tx, custID, productID, variantID, quantity int) error
+	DeleteCartItemWithTx(tx *sql.Tx, custID, productID, variantID int) error
 	CartItemCount(custID int) (int, error)
+	// PasswordWithTx returns the hashed password of a user and locks the user until tx ends.
+	PasswordWithTx(tx *sql.Tx, uid int) (string, error)
+	UpdatePasswordWithTx(tx *sql.Tx, uid int, hashedPassword string) error
+	// SaveSession saves se and deletes the sessions of its user that ended before now.
+	SaveSession(se *ecommerce.Session, now time.Time) (int, error)
+	// Sessions returns the sessions of a user that work at now, last seen first.
+	Sessions(uid int, now time.Time) ([]ecommerce.Session, error)
+	// TouchSession marks the session with id as last seen at now from ip and returns it.
+	TouchSession(id int, ip string, now time.Time) (*ecommerce.Session, error)
+	// RevokeSession revokes the unrevoked session of a user with id at now.
+	RevokeSession(uid, id int, now time.Time) error
+	// RevokeSessionsWithTx revokes the unrevoked sessions of a user at now but the one
+	// with keepID.
+	RevokeSessionsWithTx(tx *sql.Tx, uid, keepID int, now time.Time) error
+	SaveLoginAttemptWithTx(tx *sql.Tx, a *ecommerce.LoginAttempt) (int, error)
+	// LoginAttempts returns up to limit failed logins to the account of a user, newest first.
+	LoginAttempts(uid int, limit int) ([]ecommerce.LoginAttempt, error)
+	// LoginLockedUntil returns until when logins of subject in scope are locked, or nil
+	// if they are not.
+	LoginLockedUntil(scope, subject string) (*time.Time, error)
+	// AddLoginFailureWithTx counts a failed login of subject in scope at now and returns
+	// the number of failures since the last reset. Failures are reset if there was none
+	// since staleBefore.
+	AddLoginFailureWithTx(tx *sql.Tx, scope, subject string, now, staleBefore time.Time) (int, error)
+	LockLoginWithTx(tx *sql.Tx, scope, subject string, until time.Time) error
+	ResetLoginFailures(scope, subject string) error
+	TOTP(uid int) (*ecommerce.TOTP, error)
+	// TOTPWithTx returns the TOTP of a user and locks it until tx ends.
+	TOTPWithTx(tx *sql.Tx, uid int) (*ecommerce.TOTP, error)
+	// SaveTOTPWithTx saves t, replacing the TOTP the user had.
+	SaveTOTPWithTx(tx *sql.Tx, t *ecommerce.TOTP) error
+	UpdateTOTPWithTx(tx *sql.Tx, t *ecommerce.TOTP) error
+	DeleteTOTPWithTx(tx *sql.Tx, uid int) error
+	// ReplaceRecoveryCodesWithTx replaces the recovery codes of a user with ones with
+	// hashes.
+	ReplaceRecoveryCodesWithTx(tx *sql.Tx, uid int, hashes []string, now time.Time) error
+	// UseRecoveryCodeWithTx marks the unused recovery code of a user with hash as used.
+	UseRecoveryCodeWithTx(tx *sql.Tx, uid int, hash string, now time.Time) error
+	// SaveExternalLogin saves l and deletes the logins that expired before now.
+	SaveExternalLogin(l *ecommerce.ExternalLogin, now time.Time) error
+	// UseExternalLogin deletes the unexpired login with the state hash for provider and
+	// returns it.
+	UseExternalLogin(stateHash, provider string, now time.Time) (*ecommerce.ExternalLogin, error)
+	IdentityWithTx(tx *sql.Tx, provider, subject string) (*ecommerce.Identity, error)
+	SaveIdentityWithTx(tx *sql.Tx, i *ecommerce.Identity) (int, error)
+	// SetEmailVerifiedWithTx marks the email of a user as verified if it still is email.
+	SetEmailVerifiedWithTx(tx *sql.Tx, uid int, email string, at time.Time) error
+	CustomerReviews(custID int) ([]ecommerce.Review, error)
+	// ScheduleDeletionWithTx sets when the account of a user is deleted, nil to cancel it.
+	ScheduleDeletionWithTx(tx *sql.Tx, uid int, at *time.Time) error
+	// UsersDueForDeletion returns the ids of up to limit users whose account is due for
+	// deletion at now.
+	UsersDueForDeletion(now time.Time, limit int) ([]int, error)
+	// PurgeUserWithTx deletes the user with uid and email if their account is due for
+	// deletion at now, and anonymizes their orders.
+	PurgeUserWithTx(tx *sql.Tx, uid int, email string, now time.Time) error
+	SaveTokenWithTx(tx *sql.Tx, t *ecommerce.UserToken) (int, error)
+	// TokenCountSince returns the number of tokens for purpose issued to a user since then.
+	TokenCountSince(uid int, purpose string, since time.Time) (int, error)
+	// UseTokenWithTx marks the unused, unexpired token with hash for purpose as used at
+	// now and returns it.
+	UseTokenWithTx(tx *sql.Tx, hash, purpose string, now time.Time) (*ecommerce.UserToken, error)
+	// InvalidateTokensWithTx marks the unused tokens for purpose of a user as used at now.
+	InvalidateTokensWithTx(tx *sql.Tx, uid int, purpose string, now time.Time) error
 	Tx() (*sql.Tx, error)
 }
 
 type addressRepo interface {
 	SaveAddressWithTx(tx *sql.Tx, a *ecommerce.Address) (int, error)
-	UpdateAddress(a *ecommerce.Address) error
+	UpdateAddressWithTx(tx *sql.Tx, a *ecommerce.Address) error
+	ClearDefaultsWithTx(tx *sql.Tx, custID int, shipping, billing bool) error
 	Address(id int) (*ecommerce.Address, error)
-	DeleteAddress(tx *sql.Tx, id int) error
+	Addresses(custID int) ([]ecommerce.Address, error)
+	AddressesWithTx(tx *sql.Tx, custID int) ([]ecommerce.Address, error)
+	DeleteAddressWithTx(tx *sql.Tx, id int) error
+	Tx() (*sql.Tx, error)
 }
 
 type orderRepo interface {
-	SaveOrder(tx *sql.Tx, o *ecommerce.Order) (int, error)
+	Order(id int) (*ecommerce.Order, error)
 	Orders(ids []int) ([]ecommerce.Order, error)
+	UpdateOrderStatus(id int, status string) error
 }
 
-func New(db *sql.DB, repo repository, addressRepo addressRepo, orderRepo orderRepo, productService ecommerce.ProductService) *service {
-	return &service{db: db, r: repo, addressRepo: addressRepo, orderRepo: orderRepo, productService: productService}
+func New(
+	db *sql.DB,
+	repo repository,
+	addressRepo addressRepo,
+	addressValidator ecommerce.AddressValidator,
+	orderRepo orderRepo,
+	productService ecommerce.ProductService,
+	mailService ecommerce.MailService,
+	shopName, shopURL string,
+	policy *PasswordPolicy,
+	deletionGrace time.Duration) *service {
+	return &service{
+		db: db,
+		r: repo,
+		addressRepo: addressRepo,
+		addressValidator: addressValidator,
+		orderRepo: orderRepo,
+		productService: productService,
+		mailService: mailService,
+		shopName: shopName,
+		shopURL: strings.TrimRight(shopURL, "/"),
+		policy: policy,
+		deletionGrace: deletionGrace,
+	}
 }
 
 type service struct {
 	db *sql.DB
 	r repository
 	addressRepo addressRepo
+	addressValidator ecommerce.AddressValidator
 	orderRepo orderRepo
 	productService ecommerce.ProductService
+	mailService ecommerce.MailService
+	// shopName is the issuer authenticator apps show for TOTP secrets.
+	shopName string
+	// shopURL is the base URL of the shop front end, which has the pages the links
+	// of verification and password reset emails lead to.
+	shopURL string
+	policy *PasswordPolicy
+	// deletionGrace is how long after a user asks for it their account is deleted.
+	deletionGrace time.Duration
+	// providers are the identity providers users can log in with by name.
+	providers map[string]ecommerce.IdentityProvider
+	sessions sessionCache
 }
 
+// CreateCustomer creates a customer account and sends a welcome email with a link to
+// verify the email address of the customer.
 func (s *service) CreateCustomer(c *ecommerce.User, password string) (int, error) {
 	const op = "userService.CreateCustomer"
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err := s.policy.Validate(password, c.Email); err != nil {
+		return 0, errors2.Wrap(err, op, "validating password")
+	}
+
+	hash, err := s.policy.Hash(password)
 	if err != nil {
-		return 0, err
+		return 0, errors2.Wrap(err, op, "hashing password")
 	}
 
 	tx, err := s.r.Tx()
@@ -63,7 +188,7 @@ func (s *service) CreateCustomer(c *ecommerce.User, password string) (int, error
 	}
 
 	// create user
-	id, err := s.r.SaveUserWithTx(tx, c, string(hash))
+	id, err := s.r.SaveUserWithTx(tx, c, hash)
 	if err != nil {
 		_ = tx.Rollback()
 		return 0, err
@@ -76,35 +201,370 @@ func (s *service) CreateCustomer(c *ecommerce.User, password string) (int, error
 		return 0, err
 	}
 
+	token, err := s.issueTokenWithTx(tx, id, c.Email, ecommerce.UserTokenEmailVerification, verificationValidFor)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "issuing verification token")
+	}
+
+	err = s.mailService.EnqueueWithTx(tx, c.Email, ecommerce.EmailWelcome, &ecommerce.WelcomeEmail{Name: c.FirstName,
+		VerifyURL: s.link("/verify-email", token), ValidFor: verificationValidFor})
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "enqueueing welcome email")
+	}
+
 	return id, errors2.Wrap(tx.Commit(), op, "committing tx")
 }
 
-func (s *service) EmailMatchPassword(email string, password string) (bool, int, error) {
-	op := "userService.EmailMatchPassword"
+func (s *service) RequestEmailVerification(uid int) error {
+	const op = "userService.RequestEmailVerification"
 
-	// todo:: validate email and password
+	u, err := s.r.User(uid)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting user")
+	} else if u.EmailVerified {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("the email address is verified already")}, op, "checking user")
+	}
 
-	uid, hashedPassword, err := s.r.UserIDAndPasswordByEmail(email)
+	if err = s.checkTokenRate(u.ID, ecommerce.UserTokenEmailVerification); err != nil {
+		return errors2.Wrap(err, op, "checking rate")
+	}
+
+	tx, err := s.r.Tx()
 	if err != nil {
-		switch errors2.Unwrap(err).(type) {
-		case *errors2.NotFound:
-			return false, 0, nil
-		default:
-			return false, 0, err
-		}
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	token, err := s.issueTokenWithTx(tx, u.ID, u.Email, ecommerce.UserTokenEmailVerification, verificationValidFor)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "issuing token")
+	}
+
+	err = s.mailService.EnqueueWithTx(tx, u.Email, ecommerce.EmailVerification, &ecommerce.EmailVerificationEmail{
+		Name: u.FirstName, VerifyURL: s.link("/verify-email", token), ValidFor: verificationValidFor})
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "enqueueing email")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// VerifyEmail uses up a verification token. The token only verifies the address it
+// was sent to, so it stops working if the user changes their email address.
+func (s *service) VerifyEmail(token string) error {
+	const op = "userService.VerifyEmail"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	now := time.Now()
+	t, err := s.useTokenWithTx(tx, token, ecommerce.UserTokenEmailVerification, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "using token")
 	}
 
-	// compare user provided and stored password
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	err = s.r.SetEmailVerifiedWithTx(tx, t.UserID, t.Email, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("the email address changed since the link was sent")}, op, "verifying email")
+	} else if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "verifying email")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// RequestPasswordReset emails a password reset link to the user with email, unless
+// there is no such user or they asked for too many links already, which the caller
+// is not told either.
+func (s *service) RequestPasswordReset(email string) error {
+	const op = "userService.RequestPasswordReset"
+
+	uid, _, err := s.r.UserIDAndPasswordByEmail(strings.TrimSpace(email))
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return nil
+	} else if err != nil {
+		return errors2.Wrap(err, op, "getting user")
+	}
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting user")
+	}
+
+	err = s.checkTokenRate(u.ID, ecommerce.UserTokenPasswordReset)
+	if _, ok := errors2.Unwrap(err).(*errors2.RateLimited); ok {
+		return nil
+	} else if err != nil {
+		return errors2.Wrap(err, op, "checking rate")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	token, err := s.issueTokenWithTx(tx, u.ID, u.Email, ecommerce.UserTokenPasswordReset, resetValidFor)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "issuing token")
+	}
+
+	err = s.mailService.EnqueueWithTx(tx, u.Email, ecommerce.EmailPasswordReset, &ecommerce.PasswordResetEmail{
+		Name: u.FirstName, ResetURL: s.link("/reset-password", token), ValidFor: resetValidFor})
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "enqueueing email")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// ResetPassword uses up a password reset token and sets the password of its user. The
+// other reset tokens and the sessions of the user stop working, and since the token
+// proves that the user receives email at their address, the address is verified too.
+func (s *service) ResetPassword(token, password string) error {
+	const op = "userService.ResetPassword"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	now := time.Now()
+	t, err := s.useTokenWithTx(tx, token, ecommerce.UserTokenPasswordReset, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "using token")
+	}
+
+	if err = s.setPasswordWithTx(tx, t.UserID, 0, t.Email, password, now); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "setting password")
+	}
+
+	err = s.r.SetEmailVerifiedWithTx(tx, t.UserID, t.Email, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); err != nil && !ok {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "verifying email")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors2.Wrap(err, op, "committing tx")
+	}
+
+	s.sessions.forgetUser(t.UserID, 0, time.Now())
+	return nil
+}
+
+// ChangePassword sets the password of a user who knows their current password. The
+// other sessions of the user are logged out.
+func (s *service) ChangePassword(uid, keepSessionID int, current, password string) error {
+	const op = "userService.ChangePassword"
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting user")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	hash, err := s.r.PasswordWithTx(tx, uid)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "getting password")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(current))
 	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return false, 0, nil
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("the current password is incorrect")}, op, "checking password")
 	} else if err != nil {
-		return false, 0, errors2.Wrap(err, op, "hashing password")
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "checking password")
+	}
+
+	if current == password {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("the new password must differ from the current one")}, op, "checking password")
+	}
+
+	if err = s.setPasswordWithTx(tx, uid, keepSessionID, u.Email, password, time.Now()); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "setting password")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors2.Wrap(err, op, "committing tx")
+	}
+
+	s.sessions.forgetUser(uid, keepSessionID, time.Now())
+	return nil
+}
+
+// setPasswordWithTx validates and sets the password of a user with email and logs out
+// their sessions but the one with keepSessionID and outstanding password reset links
+// as of now. The caller forgets the cached sessions once tx is committed.
+func (s *service) setPasswordWithTx(tx *sql.Tx, uid, keepSessionID int, email, password string, now time.Time) error {
+	if err := s.policy.Validate(password, email); err != nil {
+		return err
+	}
+
+	hash, err := s.policy.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if err = s.r.UpdatePasswordWithTx(tx, uid, hash); err != nil {
+		return err
+	}
+
+	if err = s.revokeSessionsWithTx(tx, uid, keepSessionID, now); err != nil {
+		return err
+	}
+
+	return s.r.InvalidateTokensWithTx(tx, uid, ecommerce.UserTokenPasswordReset, now)
+}
+
+// checkTokenRate returns a RateLimited error if a user was issued tokensPerHour tokens
+// for purpose in the last hour.
+func (s *service) checkTokenRate(uid int, purpose string) error {
+	n, err := s.r.TokenCountSince(uid, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	} else if n >= tokensPerHour {
+		return &errors2.RateLimited{Err: errors.New("too many emails were requested, please try again later"), RetryAfter: time.Hour}
+	}
+
+	return nil
+}
+
+// issueTokenWithTx saves a new token for purpose sent to email and returns it.
+func (s *service) issueTokenWithTx(tx *sql.Tx, uid int, email, purpose string, validFor time.Duration) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	t := ecommerce.UserToken{UserID: uid, Purpose: purpose, Email: email, Hash: hash, ExpiresAt: now.Add(validFor), CreatedAt: now}
+	_, err = s.r.SaveTokenWithTx(tx, &t)
+
+	return token, err
+}
+
+// useTokenWithTx uses up token for purpose, failing with Invalid if it is unknown, used
+// or expired.
+func (s *service) useTokenWithTx(tx *sql.Tx, token, purpose string, now time.Time) (*ecommerce.UserToken, error) {
+	t, err := s.r.UseTokenWithTx(tx, hashToken(token), purpose, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return nil, &errors2.Invalid{Err: errors.New("the link is invalid or has expired")}
+	}
+
+	return t, err
+}
+
+// link returns the URL of the page at path of the shop front end with token.
+func (s *service) link(path, token string) string {
+	return s.shopURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// EmailMatchPassword checks a login with email and password from ip. Checking the
+// password of an unknown email takes as long as checking a wrong one, and the failed
+// logins of unknown emails are counted like others, so that the responses do not tell
+// whether there is an account with an email.
+// A password hashed with another cost than the one of the policy is rehashed.
+func (s *service) EmailMatchPassword(email, password, ip string) (bool, int, error) {
+	const op = "userService.EmailMatchPassword"
+
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false, 0, nil
+	}
+
+	uid, hashedPassword, err := s.r.UserIDAndPasswordByEmail(email)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); err != nil && !ok {
+		return false, 0, errors2.Wrap(err, op, "getting user")
+	}
+
+	now := time.Now()
+	if err := s.checkLoginLock(email, ip, now); err != nil {
+		if _, ok := errors2.Unwrap(err).(*errors2.RateLimited); ok {
+			if err := s.recordLoginFailure(uid, email, ip, ecommerce.LoginFailedLocked, now); err != nil {
+				return false, 0, errors2.Wrap(err, op, "recording failure")
+			}
+		}
+		return false, 0, errors2.Wrap(err, op, "checking lock")
+	}
+
+	// no password longer than bcrypt uses could have been set
+	match := false
+	if hashedPassword == "" || len(password) > maxPasswordBytes {
+		s.policy.CompareDummy(password)
+	} else {
+		err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if err != nil && err != bcrypt.ErrMismatchedHashAndPassword {
+			return false, 0, errors2.Wrap(err, op, "comparing password")
+		}
+		match = err == nil && password != ""
+	}
+
+	if !match {
+		if err := s.recordLoginFailure(uid, email, ip, ecommerce.LoginFailedPassword, now); err != nil {
+			return false, 0, errors2.Wrap(err, op, "recording failure")
+		}
+		return false, 0, nil
+	}
+
+	// failures of the ip are kept, or one account could be used to reset them, and
+	// those of accounts with two-factor authentication once the code was checked too
+	twoFactor, err := s.twoFactorEnabled(uid)
+	if err != nil {
+		return false, 0, errors2.Wrap(err, op, "checking two-factor authentication")
+	} else if !twoFactor {
+		if err := s.r.ResetLoginFailures(ecommerce.LoginScopeAccount, strings.ToLower(email)); err != nil {
+			return false, 0, errors2.Wrap(err, op, "resetting failures")
+		}
+	}
+
+	if s.policy.NeedsRehash(hashedPassword) {
+		// the old hash still works, so if this fails the next login tries again
+		_ = s.rehash(uid, password)
 	}
 
 	return true, uid, nil
 }
 
+// rehash hashes the password of a user with the cost of the policy.
+func (s *service) rehash(uid int, password string) error {
+	hash, err := s.policy.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return err
+	}
+
+	if err = s.r.UpdatePasswordWithTx(tx, uid, hash); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (s *service) User(uid int) (*ecommerce.User, error) {
 	const op = "userService.User"
 
@@ -152,122 +612,158 @@ func (s *service) DeleteCreditCard(id int) error {
 	return errors2.Wrap(s.r.DeleteCreditCard(id), op, "deleting card via repo")
 }
 
-func (s *service) UpdateCustomerAddress(custID int, a *ecommerce.Address) error {
-	const op = "userService.UpdateCustomerAddress"
+func (s *service) Addresses(custID int) ([]ecommerce.Address, error) {
+	const op = "userService.Addresses"
 
-	if a.ID > 0 {
-		// update address
-		// todo:: check that user actually owns address before updating
-		return errors2.Wrap(s.addressRepo.UpdateAddress(a), op, "updating address from repo")
-	} else {
-		// create new address
-		u, err := s.r.User(custID)
-		if err != nil {
-			return errors2.Wrap(err, op, "getting user from repo")
-		} else if u.AddressID > 0 {
-			return errors2.Wrap(errors.New("can update but not create new address"), op, "checking user address")
-		}
+	aa, err := s.addressRepo.Addresses(custID)
+	return aa, errors2.Wrap(err, op, "getting addresses from repo")
+}
 
-		tx, err := s.r.Tx()
-		if err != nil {
-			return errors2.Wrap(err, op, "getting tx")
-		}
+func (s *service) Address(custID, id int) (*ecommerce.Address, error) {
+	const op = "userService.Address"
 
-		addressID, err := s.addressRepo.SaveAddressWithTx(tx, a)
-		if err != nil {
-			_ = tx.Rollback()
-			return errors2.Wrap(err, op, "saving address from repo")
-		}
+	a, err := s.addressRepo.Address(id)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting address from repo")
+	} else if a.CustomerID != custID {
+		// addresses of other customers are treated as if they did not exist
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "checking owner")
+	}
 
-		u.AddressID = addressID
+	return a, nil
+}
 
-		// update user with new address
-		err = s.r.UpdateUserWithTx(tx, u)
-		if err != nil {
-			_ = tx.Rollback()
-			return errors2.Wrap(err, op, "updating user via repo")
-		}
+func (s *service) CreateAddress(custID int, a *ecommerce.Address) (int, error) {
+	const op = "userService.CreateAddress"
 
-		return errors2.Wrap(tx.Commit(), op, "committing tx")
+	if err := s.addressValidator.Validate(a); err != nil {
+		return 0, errors2.Wrap(err, op, "validating address")
 	}
-}
 
-func (s *service) CustomerAddress(custID int) (*ecommerce.Address, error) {
-	const op = "userService.CustomerAddress"
+	tx, err := s.addressRepo.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
 
-	u, err := s.r.User(custID)
+	aa, err := s.addressRepo.AddressesWithTx(tx, custID)
 	if err != nil {
-		return nil, errors2.Wrap(err, op, "getting user form repo")
-	} else if u.AddressID < 1 {
-		return nil, nil
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "locking addresses")
+	}
+
+	if len(aa) < 1 {
+		a.DefaultShipping = true
+		a.DefaultBilling = true
+	}
+	if err = s.addressRepo.ClearDefaultsWithTx(tx, custID, a.DefaultShipping, a.DefaultBilling); err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "clearing defaults")
 	}
 
-	a, err := s.addressRepo.Address(u.AddressID)
-	return a, errors2.Wrap(err, op, "getting address from repo")
+	a.CustomerID = custID
+	a.ID, err = s.addressRepo.SaveAddressWithTx(tx, a)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving address via repo")
+	}
+
+	return a.ID, errors2.Wrap(tx.Commit(), op, "committing tx")
 }
 
-func (s *service) DeleteCustomerAddress(custID int) error {
-	const op = "userService.DeleteAddress"
+func (s *service) UpdateAddress(custID int, a *ecommerce.Address) error {
+	const op = "userService.UpdateAddress"
 
-	u, err := s.r.User(custID)
-	if err != nil {
-		return errors2.Wrap(err, op, "getting user form repo")
+	if err := s.addressValidator.Validate(a); err != nil {
+		return errors2.Wrap(err, op, "validating address")
 	}
 
-	tx, err := s.r.Tx()
+	tx, err := s.addressRepo.Tx()
 	if err != nil {
 		return errors2.Wrap(err, op, "getting tx")
 	}
 
-	// update user
-	addressID := u.AddressID // save address id before overwriting
-	u.AddressID = 0
-	err = s.r.UpdateUserWithTx(tx, u)
+	aa, err := s.addressRepo.AddressesWithTx(tx, custID)
 	if err != nil {
-		tx.Rollback()
-		return errors2.Wrap(err, op, "updating user via repo")
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "locking addresses")
+	}
+
+	current := addressByID(aa, a.ID)
+	if current == nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "checking owner")
 	}
 
-	// delete address
-	err = s.addressRepo.DeleteAddress(tx, addressID)
+	// only flags that are newly set move the defaults, so that there always is one
+	err = s.addressRepo.ClearDefaultsWithTx(tx, custID, a.DefaultShipping && !current.DefaultShipping,
+		a.DefaultBilling && !current.DefaultBilling)
 	if err != nil {
-		tx.Rollback()
-		return errors2.Wrap(err, op, "deleting address from repo")
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "clearing defaults")
+	}
+
+	a.CustomerID = custID
+	a.DefaultShipping = a.DefaultShipping || current.DefaultShipping
+	a.DefaultBilling = a.DefaultBilling || current.DefaultBilling
+	if err = s.addressRepo.UpdateAddressWithTx(tx, a); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "updating address via repo")
 	}
 
 	return errors2.Wrap(tx.Commit(), op, "committing tx")
 }
 
-func (s *service) CreateOrder(o *ecommerce.Order) (int, error) {
-	const op = "userService.CreateOrder"
+func (s *service) DeleteAddress(custID, id int) error {
+	const op = "userService.DeleteAddress"
 
-	p, err := s.productService.Product(o.Product.ID)
+	tx, err := s.addressRepo.Tx()
 	if err != nil {
-		return 0, errors2.Wrap(err, op, "getting product")
+		return errors2.Wrap(err, op, "getting tx")
 	}
 
-	tx, err := s.r.Tx()
+	aa, err := s.addressRepo.AddressesWithTx(tx, custID)
 	if err != nil {
-		return 0, errors2.Wrap(err, op, "obtaining tx")
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "locking addresses")
 	}
 
-	p.Quantity = p.Quantity - o.Quantity
+	a := addressByID(aa, id)
+	if a == nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "checking owner")
+	}
 
-	// update product quantity
-	err = s.productService.UpdateProductWithTx(tx, p)
-	if err != nil {
-		tx.Rollback()
-		return 0, errors2.Wrap(err, op, "updating product quantity")
+	if err = s.addressRepo.DeleteAddressWithTx(tx, id); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "deleting address via repo")
+	}
+
+	// orders keep a snapshot of their address, so only the defaults need to be moved
+	if next := nextDefault(aa, a); next != nil {
+		if err = s.addressRepo.UpdateAddressWithTx(tx, next); err != nil {
+			_ = tx.Rollback()
+			return errors2.Wrap(err, op, "moving defaults")
+		}
 	}
 
-	// save order
-	orderID, err := s.orderRepo.SaveOrder(tx, o)
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) CustomerAddress(custID int) (*ecommerce.Address, error) {
+	const op = "userService.CustomerAddress"
+
+	aa, err := s.addressRepo.Addresses(custID)
 	if err != nil {
-		tx.Rollback()
-		return 0, errors2.Wrap(err, op, "saving order")
+		return nil, errors2.Wrap(err, op, "getting addresses from repo")
 	}
 
-	return orderID, errors2.Wrap(tx.Commit(), op, "committing tx")
+	for i := range aa {
+		if aa[i].DefaultShipping {
+			return &aa[i], nil
+		}
+	}
+
+	return nil, nil
 }
 
 func (s *service) OrdersByCustID(custID int) ([]ecommerce.Order, error) {
@@ -282,6 +778,27 @@ func (s *service) OrdersByCustID(custID int) ([]ecommerce.Order, error) {
 	return oo, errors2.Wrap(err, op, "getting orders")
 }
 
+func (s *service) Order(orderID int) (*ecommerce.Order, error) {
+	const op = "userService.Order"
+
+	o, err := s.orderRepo.Order(orderID)
+	return o, errors2.Wrap(err, op, "getting order via repo")
+}
+
+func (s *service) UpdateOrderStatus(orderID int, status string) error {
+	const op = "userService.UpdateOrderStatus"
+
+	if !ecommerce.ValidOrderStatus(status) {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("unknown order status")}, op, "validating status")
+	}
+
+	if _, err := s.orderRepo.Order(orderID); err != nil {
+		return errors2.Wrap(err, op, "getting order")
+	}
+
+	return errors2.Wrap(s.orderRepo.UpdateOrderStatus(orderID, status), op, "updating status via repo")
+}
+
 func (s *service) CartItems(custID int) ([]ecommerce.CartItem, error) {
 	const op = "userService.CartItems"
 
@@ -314,10 +831,70 @@ func (s *service) CartItems(custID int) ([]ecommerce.CartItem, error) {
 	return cc, nil
 }
 
-func (s *service) AddCartItems(custID, productID int) error {
+func (s *service) AddCartItems(custID, productID, variantID int) error {
 	const op = "userService.AddCartItems"
 
-	return errors2.Wrap(s.r.AddCartItems(custID, productID), op, "adding cart item via repo")
+	p, err := s.productService.Product(productID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting product")
+	}
+
+	if _, err := selectedVariant(p, variantID); err != nil {
+		return errors2.Wrap(err, op, "checking variant")
+	}
+
+	return errors2.Wrap(s.r.AddCartItems(custID, productID, variantID), op, "adding cart item via repo")
+}
+
+// ClearCartWithTx removes all items from the cart of a customer.
+func (s *service) ClearCartWithTx(tx *sql.Tx, custID int) error {
+	const op = "userService.ClearCartWithTx"
+
+	return errors2.Wrap(s.r.DeleteCartItemsWithTx(tx, custID), op, "deleting cart items via repo")
+}
+
+func (s *service) AddCartItemWithTx(tx *sql.Tx, custID, productID, variantID, quantity int) error {
+	const op = "userService.AddCartItemWithTx"
+
+	if quantity < 1 {
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("quantity must be at least 1")}, op, "validating quantity")
+	}
+
+	p, err := s.productService.Product(productID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting product")
+	}
+
+	if _, err := selectedVariant(p, variantID); err != nil {
+		return errors2.Wrap(err, op, "checking variant")
+	}
+
+	return errors2.Wrap(s.r.AddCartItemWithTx(tx, custID, productID, variantID, quantity), op, "adding cart item via repo")
+}
+
+func (s *service) RemoveCartItemWithTx(tx *sql.Tx, custID, productID, variantID int) error {
+	const op = "userService.RemoveCartItemWithTx"
+
+	return errors2.Wrap(s.r.DeleteCartItemWithTx(tx, custID, productID, variantID), op, "deleting cart item via repo")
+}
+
+// selectedVariant returns the variant of p with variantID. It returns an error if p has
+// variants but none is selected or if the variant does not belong to p, and nil
+// if p has no variants.
+func selectedVariant(p *ecommerce.Product, variantID int) (*ecommerce.ProductVariant, error) {
+	if variantID < 1 {
+		if len(p.Variants) > 0 {
+			return nil, &errors2.Invalid{Err: errors.New("a product variant must be selected")}
+		}
+		return nil, nil
+	}
+
+	v := p.Variant(variantID)
+	if v == nil {
+		return nil, &errors2.Invalid{Err: errors.New("variant does not belong to product")}
+	}
+
+	return v, nil
 }
 
 func (s *service) CartItemCount(custID int) (int, error) {
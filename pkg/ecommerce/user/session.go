@@ -0,0 +1,269 @@
+package user
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// sessionCacheFor is how long the state of a session is cached, and so how often it is
+// marked as seen. A session revoked through another instance of the API keeps working
+// here for up to this long.
+const sessionCacheFor = time.Minute
+
+// StartSession saves a session of a user from a device, deleting the sessions of the
+// user that ended.
+func (s *service) StartSession(uid int, ip, userAgent string) (int, error) {
+	const op = "userService.StartSession"
+
+	now := time.Now()
+	se := ecommerce.Session{UserID: uid, Device: deviceName(userAgent), IP: ip, UserAgent: truncate(userAgent, 512),
+		CreatedAt: now, LastSeenAt: now, ExpiresAt: now.Add(ecommerce.SessionValidFor)}
+	id, err := s.r.SaveSession(&se, now)
+
+	return id, errors2.Wrap(err, op, "saving session")
+}
+
+func (s *service) Sessions(uid int) ([]ecommerce.Session, error) {
+	const op = "userService.Sessions"
+
+	ss, err := s.r.Sessions(uid, time.Now())
+	return ss, errors2.Wrap(err, op, "getting sessions")
+}
+
+func (s *service) RevokeSession(uid, id int) error {
+	const op = "userService.RevokeSession"
+
+	err := s.r.RevokeSession(uid, id, time.Now())
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return errors2.Wrap(&errors2.NotFound{Err: errors.New("session not found")}, op, "revoking session")
+	} else if err != nil {
+		return errors2.Wrap(err, op, "revoking session")
+	}
+
+	s.sessions.forget(uid, id, time.Now())
+	return nil
+}
+
+func (s *service) RevokeOtherSessions(uid, keepID int) error {
+	const op = "userService.RevokeOtherSessions"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	if err = s.revokeSessionsWithTx(tx, uid, keepID, time.Now()); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "revoking sessions")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors2.Wrap(err, op, "committing tx")
+	}
+
+	s.sessions.forgetUser(uid, keepID, time.Now())
+	return nil
+}
+
+// SessionRevoked looks the session up at most once per sessionCacheFor, which is also
+// when it is marked as seen, so that checking a session does not cost a write per
+// request.
+func (s *service) SessionRevoked(uid, id int, ip string) (bool, error) {
+	const op = "userService.SessionRevoked"
+
+	now := time.Now()
+	if c, ok := s.sessions.get(id, now); ok {
+		return !c.valid(uid, now), nil
+	}
+
+	se, err := s.r.TouchSession(id, ip, now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		// the session ended and was deleted, or the user was
+		return true, nil
+	} else if err != nil {
+		return false, errors2.Wrap(err, op, "touching session")
+	}
+
+	c := cachedSession{userID: se.UserID, expiresAt: se.ExpiresAt, revoked: se.RevokedAt != nil, cachedAt: now}
+	s.sessions.set(id, c)
+
+	return !c.valid(uid, now), nil
+}
+
+// revokeSessionsWithTx revokes the sessions of a user but the one with keepID, 0 to
+// revoke all of them. The sessions stay cached until the caller forgets them with
+// s.sessions.forgetUser after committing tx, forgetting them earlier would let a
+// request in between cache them again as they were before tx.
+func (s *service) revokeSessionsWithTx(tx *sql.Tx, uid, keepID int, now time.Time) error {
+	return s.r.RevokeSessionsWithTx(tx, uid, keepID, now)
+}
+
+// sessionCache caches the state of sessions by id. Its zero value is ready to use.
+type sessionCache struct {
+	mu sync.Mutex
+	sessions map[int]cachedSession
+	// forgottenAt holds when the sessions of a user were last forgotten by user id, so
+	// that lookups that started before are not cached.
+	forgottenAt map[int]time.Time
+	// sessionForgottenAt holds when single sessions were last forgotten by session id,
+	// for the same reason.
+	sessionForgottenAt map[int]time.Time
+	sweptAt time.Time
+}
+
+type cachedSession struct {
+	userID int
+	expiresAt time.Time
+	revoked bool
+	cachedAt time.Time
+}
+
+// valid returns true if the session belongs to the user with uid and works at now.
+func (c cachedSession) valid(uid int, now time.Time) bool {
+	return c.userID == uid && !c.revoked && now.Before(c.expiresAt)
+}
+
+func (c *sessionCache) get(id int, now time.Time) (cachedSession, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	se, ok := c.sessions[id]
+	if !ok || now.Sub(se.cachedAt) >= sessionCacheFor {
+		return cachedSession{}, false
+	}
+
+	return se, true
+}
+
+// set caches se, dropping the sessions cached too long ago every sessionCacheFor.
+func (c *sessionCache) set(id int, se cachedSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sessions == nil {
+		c.sessions = map[int]cachedSession{}
+	}
+
+	if se.cachedAt.Sub(c.sweptAt) >= sessionCacheFor {
+		for k, v := range c.sessions {
+			if se.cachedAt.Sub(v.cachedAt) >= sessionCacheFor {
+				delete(c.sessions, k)
+			}
+		}
+		for k, at := range c.forgottenAt {
+			if se.cachedAt.Sub(at) >= sessionCacheFor {
+				delete(c.forgottenAt, k)
+			}
+		}
+		for k, at := range c.sessionForgottenAt {
+			if se.cachedAt.Sub(at) >= sessionCacheFor {
+				delete(c.sessionForgottenAt, k)
+			}
+		}
+		c.sweptAt = se.cachedAt
+	}
+
+	if at, ok := c.forgottenAt[se.userID]; ok && se.cachedAt.Before(at) {
+		// the session was looked up before it was revoked, e.g. while tx was committed
+		return
+	}
+	if at, ok := c.sessionForgottenAt[id]; ok && se.cachedAt.Before(at) {
+		return
+	}
+
+	c.sessions[id] = se
+}
+
+// forget forgets the session with id of the user with uid at now and ignores its
+// lookups that started before.
+func (c *sessionCache) forget(uid, id int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sessionForgottenAt == nil {
+		c.sessionForgottenAt = map[int]time.Time{}
+	}
+	c.sessionForgottenAt[id] = now
+
+	if se, ok := c.sessions[id]; ok && se.userID == uid {
+		delete(c.sessions, id)
+	}
+}
+
+// forgetUser forgets the sessions of the user with uid but the one with keepID at now
+// and ignores their lookups that started before.
+func (c *sessionCache) forgetUser(uid, keepID int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.forgottenAt == nil {
+		c.forgottenAt = map[int]time.Time{}
+	}
+	c.forgottenAt[uid] = now
+
+	for id, se := range c.sessions {
+		if se.userID == uid && id != keepID {
+			delete(c.sessions, id)
+		}
+	}
+}
+
+// deviceName describes the device with userAgent as the browser on the operating
+// system, e.g. "Firefox on Windows", or by the user agent itself if it is neither.
+func deviceName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	var browser string
+	// the order matters, since e.g. Edge also claims to be Chrome and Chrome to be Safari
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"}, {"opr/", "Opera"}, {"firefox/", "Firefox"}, {"chrome/", "Chrome"}, {"crios/", "Chrome"},
+		{"safari/", "Safari"}, {"curl/", "curl"}, {"okhttp/", "OkHttp"}, {"python-requests/", "Python"}, {"go-http-client/", "Go"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	var system string
+	for _, o := range []struct{ token, name string }{
+		{"iphone", "iPhone"}, {"ipad", "iPad"}, {"android", "Android"}, {"windows", "Windows"}, {"mac os x", "macOS"},
+		{"cros", "ChromeOS"}, {"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			system = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case userAgent == "":
+		return "Unknown device"
+	}
+
+	return truncate(userAgent, 64)
+}
+
+// truncate returns s cut to at most n bytes, without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,157 @@
+package user
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeviceName(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/118.0", "Firefox on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36", "Chrome on macOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", "Safari on iPhone"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.4.0", "curl"},
+		{"", "Unknown device"},
+		{"ShopApp", "ShopApp"},
+	}
+
+	for _, tt := range tests {
+		if got := deviceName(tt.userAgent); got != tt.want {
+			t.Errorf("%q: wanted %q, got %q", tt.userAgent, tt.want, got)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("héllo", 2); got != "h" {
+		t.Fatalf("wanted the cut not to split é, got %q", got)
+	}
+	if got := truncate("hello", 10); got != "hello" {
+		t.Fatalf("wanted a short string as it is, got %q", got)
+	}
+}
+
+func TestSessionCache(t *testing.T) {
+	var c sessionCache
+	now := time.Now()
+
+	c.set(1, cachedSession{userID: 7, expiresAt: now.Add(time.Hour), cachedAt: now})
+	c.set(2, cachedSession{userID: 7, expiresAt: now.Add(time.Hour), cachedAt: now})
+	c.set(3, cachedSession{userID: 8, expiresAt: now.Add(time.Hour), cachedAt: now})
+
+	se, ok := c.get(1, now)
+	if !ok || !se.valid(7, now) {
+		t.Fatalf("wanted session 1 cached and valid, got %+v, %v", se, ok)
+	}
+	if se.valid(8, now) {
+		t.Fatal("wanted a session to be invalid for another user")
+	}
+	if se.valid(7, now.Add(2*time.Hour)) {
+		t.Fatal("wanted an expired session to be invalid")
+	}
+
+	if _, ok = c.get(1, now.Add(sessionCacheFor)); ok {
+		t.Fatal("wanted a session cached too long ago to be looked up again")
+	}
+
+	// forgetting the sessions of a user keeps the one they revoked them from
+	c.forgetUser(7, 2, now.Add(time.Second))
+	if _, ok = c.get(1, now); ok {
+		t.Fatal("wanted session 1 forgotten")
+	}
+	if _, ok = c.get(2, now); !ok {
+		t.Fatal("wanted session 2 kept")
+	}
+
+	// a lookup that started before the sessions were forgotten may have read them
+	// before they were revoked
+	c.set(1, cachedSession{userID: 7, expiresAt: now.Add(time.Hour), cachedAt: now})
+	if _, ok = c.get(1, now); ok {
+		t.Fatal("wanted a lookup from before the sessions were forgotten not cached")
+	}
+	c.set(1, cachedSession{userID: 7, expiresAt: now.Add(time.Hour), revoked: true, cachedAt: now.Add(2*time.Second)})
+	if _, ok = c.get(1, now.Add(2*time.Second)); !ok {
+		t.Fatal("wanted a lookup from after the sessions were forgotten cached")
+	}
+
+	// a user cannot forget the session of another
+	c.forget(7, 3, now.Add(time.Second))
+	if _, ok = c.get(3, now); !ok {
+		t.Fatal("wanted session 3 of another user kept")
+	}
+
+	// nor is a lookup of a single session that started before it was forgotten
+	c.forget(8, 3, now.Add(time.Second))
+	c.set(3, cachedSession{userID: 8, expiresAt: now.Add(time.Hour), cachedAt: now})
+	if _, ok = c.get(3, now); ok {
+		t.Fatal("wanted a lookup from before session 3 was forgotten not cached")
+	}
+}
+
+// sessionRepo stores a single session. Its lookups can be paused after reading it to
+// revoke it in between.
+type sessionRepo struct {
+	repository
+	mu sync.Mutex
+	se ecommerce.Session
+	read chan struct{}
+	resume chan struct{}
+}
+
+func (r *sessionRepo) TouchSession(id int, ip string, now time.Time) (*ecommerce.Session, error) {
+	r.mu.Lock()
+	se := r.se
+	r.mu.Unlock()
+
+	if r.read != nil {
+		r.read <- struct{}{}
+		<-r.resume
+	}
+	return &se, nil
+}
+
+func (r *sessionRepo) RevokeSession(uid, id int, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.se.RevokedAt = &now
+	return nil
+}
+
+func TestRevokeSessionDuringLookup(t *testing.T) {
+	now := time.Now()
+	r := &sessionRepo{se: ecommerce.Session{ID: 1, UserID: 7, ExpiresAt: now.Add(time.Hour)},
+		read: make(chan struct{}), resume: make(chan struct{})}
+	s := &service{r: r}
+
+	// the lookup reads the session before it is revoked and caches it after
+	done := make(chan error)
+	go func() {
+		_, err := s.SessionRevoked(7, 1, "127.0.0.1")
+		done <- err
+	}()
+	<-r.read
+	if err := s.RevokeSession(7, 1); err != nil {
+		t.Fatal(err)
+	}
+	close(r.resume)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	r.read = nil
+	revoked, err := s.SessionRevoked(7, 1, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Fatal("wanted the session revoked, not the state read before cached")
+	}
+}
@@ -0,0 +1,145 @@
+package user
+
+import (
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// failureWindow is how long failed logins are counted, a failure after a longer
+	// pause starts counting anew.
+	failureWindow = 24 * time.Hour
+	// accountFreeFailures and ipFreeFailures are how many failed logins there may be
+	// before logins are locked. IP addresses get more since they may be shared.
+	accountFreeFailures = 5
+	ipFreeFailures = 50
+	// firstLockout is how long logins are locked after the first failure too many, the
+	// lockout doubles with every further failure up to the max of the scope.
+	firstLockout = 30 * time.Second
+	accountMaxLockout = 30 * time.Minute
+	ipMaxLockout = time.Hour
+	// loginAttemptsLimit is how many failed logins LoginAttempts returns at most.
+	loginAttemptsLimit = 100
+)
+
+// loginThrottle is a scope failed logins are counted in and the subject they are
+// counted for in it.
+type loginThrottle struct {
+	scope string
+	subject string
+	free int
+	max time.Duration
+}
+
+// loginThrottles returns the throttles a login with email from ip counts towards.
+func loginThrottles(email, ip string) []loginThrottle {
+	return []loginThrottle{
+		{ecommerce.LoginScopeAccount, strings.ToLower(email), accountFreeFailures, accountMaxLockout},
+		{ecommerce.LoginScopeIP, ip, ipFreeFailures, ipMaxLockout},
+	}
+}
+
+// lockout returns how long logins are locked after failures failed ones in a row if
+// free are allowed and logins are locked for max at most.
+func lockout(failures, free int, max time.Duration) time.Duration {
+	if failures <= free {
+		return 0
+	}
+
+	d := firstLockout
+	for i := free + 1; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+// checkLoginLock returns a RateLimited error if logins with email from ip are locked
+// at now.
+func (s *service) checkLoginLock(email, ip string, now time.Time) error {
+	var retryAfter time.Duration
+	for _, t := range loginThrottles(email, ip) {
+		until, err := s.r.LoginLockedUntil(t.scope, t.subject)
+		if err != nil {
+			return err
+		}
+		if until != nil && until.Sub(now) > retryAfter {
+			retryAfter = until.Sub(now)
+		}
+	}
+
+	if retryAfter > 0 {
+		return &errors2.RateLimited{Err: errors.New("too many failed logins, please try again later"), RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// recordLoginFailure saves a failed login to the user with uid, which is 0 if there is
+// none with email, and locks further logins if there were too many.
+func (s *service) recordLoginFailure(uid int, email, ip, reason string, now time.Time) error {
+	tx, err := s.r.Tx()
+	if err != nil {
+		return err
+	}
+
+	a := ecommerce.LoginAttempt{UserID: uid, Email: email, IP: ip, Reason: reason, CreatedAt: now}
+	if a.ID, err = s.r.SaveLoginAttemptWithTx(tx, &a); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// attempts while locked out only go into the audit trail, so that the lockout
+	// does not grow while someone keeps trying
+	if reason == ecommerce.LoginFailedLocked {
+		return tx.Commit()
+	}
+
+	for _, t := range loginThrottles(email, ip) {
+		failures, err := s.r.AddLoginFailureWithTx(tx, t.scope, t.subject, now, now.Add(-failureWindow))
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if d := lockout(failures, t.free, t.max); d > 0 {
+			if err = s.r.LockLoginWithTx(tx, t.scope, t.subject, now.Add(d)); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) LoginAttempts(uid int) ([]ecommerce.LoginAttempt, error) {
+	const op = "userService.LoginAttempts"
+
+	if _, err := s.r.User(uid); err != nil {
+		return nil, errors2.Wrap(err, op, "getting user")
+	}
+
+	aa, err := s.r.LoginAttempts(uid, loginAttemptsLimit)
+	return aa, errors2.Wrap(err, op, "getting login attempts")
+}
+
+// UnlockLogin clears the failed logins counted for the account of a user, so that they
+// can log in right away. Failures counted for IP addresses are kept.
+func (s *service) UnlockLogin(uid int) error {
+	const op = "userService.UnlockLogin"
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting user")
+	}
+
+	err = s.r.ResetLoginFailures(ecommerce.LoginScopeAccount, strings.ToLower(u.Email))
+	return errors2.Wrap(err, op, "resetting failures")
+}
@@ -0,0 +1,34 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	tests := []struct {
+		failures int
+		want time.Duration
+	}{
+		{0, 0},
+		{accountFreeFailures, 0},
+		{accountFreeFailures + 1, firstLockout},
+		{accountFreeFailures + 2, 2 * firstLockout},
+		{accountFreeFailures + 4, 8 * firstLockout},
+		{accountFreeFailures + 7, accountMaxLockout},
+		{accountFreeFailures + 100, accountMaxLockout},
+	}
+
+	for _, tt := range tests {
+		if got := lockout(tt.failures, accountFreeFailures, accountMaxLockout); got != tt.want {
+			t.Errorf("%d failures: wanted a lockout of %v, got %v", tt.failures, tt.want, got)
+		}
+	}
+}
+
+func TestLoginThrottles(t *testing.T) {
+	tt := loginThrottles("Ada@Example.com", "192.0.2.1")
+	if len(tt) != 2 || tt[0].subject != "ada@example.com" || tt[1].subject != "192.0.2.1" {
+		t.Fatalf("wanted an account throttle by lower case email and one by ip, got %+v", tt)
+	}
+}
@@ -0,0 +1,28 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// newToken returns a random token to email to a user and its hash to store.
+func newToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of token. Tokens are random, so a fast
+// hash is enough to keep them from being usable if the database leaks. The emails that
+// carry them keep them in the outbox until they are sent, see the mail service.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,25 @@
+package user
+
+import "testing"
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token) != 43 {
+		t.Fatalf("wanted a 43 character token, got %q", token)
+	}
+	if hash != hashToken(token) || len(hash) != 64 {
+		t.Fatalf("wanted the hash of the token, got %q", hash)
+	}
+
+	other, _, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Fatal("wanted tokens to differ")
+	}
+}
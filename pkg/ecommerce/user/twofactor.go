@@ -0,0 +1,334 @@
+package user
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/totp"
+	"encoding/base32"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"time"
+)
+
+const (
+	// challengeValidFor is how long a user has to enter their code after their password.
+	challengeValidFor = 5 * time.Minute
+	// totpSkew is how many time steps a code may be off, for clocks that are.
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes a user gets, each works once.
+	recoveryCodeCount = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// LoginChallenge issues the challenge as a single use token like the emailed ones, so
+// that a challenge only allows one guess at the code.
+func (s *service) LoginChallenge(uid int) (string, error) {
+	const op = "userService.LoginChallenge"
+
+	enabled, err := s.twoFactorEnabled(uid)
+	if err != nil || !enabled {
+		return "", errors2.Wrap(err, op, "checking two-factor authentication")
+	}
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return "", errors2.Wrap(err, op, "getting user")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return "", errors2.Wrap(err, op, "getting tx")
+	}
+
+	token, err := s.issueTokenWithTx(tx, uid, u.Email, ecommerce.UserTokenTwoFactorChallenge, challengeValidFor)
+	if err != nil {
+		_ = tx.Rollback()
+		return "", errors2.Wrap(err, op, "issuing token")
+	}
+
+	return token, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) CompleteLoginChallenge(challenge, code, ip string) (int, error) {
+	const op = "userService.CompleteLoginChallenge"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	now := time.Now()
+	t, err := s.useTokenWithTx(tx, challenge, ecommerce.UserTokenTwoFactorChallenge, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "using challenge")
+	}
+
+	if err := s.checkLoginLock(t.Email, ip, now); err != nil {
+		_ = tx.Rollback()
+		if _, ok := errors2.Unwrap(err).(*errors2.RateLimited); ok {
+			if err := s.recordLoginFailure(t.UserID, t.Email, ip, ecommerce.LoginFailedLocked, now); err != nil {
+				return 0, errors2.Wrap(err, op, "recording failure")
+			}
+		}
+		return 0, errors2.Wrap(err, op, "checking lock")
+	}
+
+	ok, err := s.checkSecondFactorWithTx(tx, t.UserID, code, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "checking code")
+	}
+
+	// a wrong code uses up the challenge too
+	if err = tx.Commit(); err != nil {
+		return 0, errors2.Wrap(err, op, "committing tx")
+	}
+
+	if !ok {
+		if err := s.recordLoginFailure(t.UserID, t.Email, ip, ecommerce.LoginFailedTwoFactor, now); err != nil {
+			return 0, errors2.Wrap(err, op, "recording failure")
+		}
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("the code is incorrect, please log in again")}, op, "checking code")
+	}
+
+	err = s.r.ResetLoginFailures(ecommerce.LoginScopeAccount, strings.ToLower(t.Email))
+	return t.UserID, errors2.Wrap(err, op, "resetting failures")
+}
+
+func (s *service) EnrollTOTP(uid int) (*ecommerce.TOTPEnrollment, error) {
+	const op = "userService.EnrollTOTP"
+
+	u, err := s.r.User(uid)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting user")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "generating secret")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting tx")
+	}
+
+	t, err := s.r.TOTPWithTx(tx, uid)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); err != nil && !ok {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "getting totp")
+	} else if err == nil && t.ConfirmedAt != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("two-factor authentication is enabled already")}, op, "checking totp")
+	}
+
+	// an unconfirmed enrollment is replaced, e.g. if the user lost the QR code
+	err = s.r.SaveTOTPWithTx(tx, &ecommerce.TOTP{UserID: uid, Secret: secret, CreatedAt: time.Now()})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "saving totp")
+	}
+
+	e := &ecommerce.TOTPEnrollment{Secret: secret, ProvisioningURI: totp.URI(s.shopName, u.Email, secret)}
+	return e, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) ConfirmTOTP(uid int, code string) ([]string, error) {
+	const op = "userService.ConfirmTOTP"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting tx")
+	}
+
+	t, err := s.r.TOTPWithTx(tx, uid)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("two-factor authentication was not set up")}, op, "getting totp")
+	} else if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "getting totp")
+	} else if t.ConfirmedAt != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("two-factor authentication is enabled already")}, op, "checking totp")
+	}
+
+	now := time.Now()
+	if err = s.useTOTPCodeWithTx(tx, t, code, now); err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "checking code")
+	}
+
+	codes, err := s.replaceRecoveryCodesWithTx(tx, uid, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "creating recovery codes")
+	}
+
+	return codes, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) DisableTOTP(uid int, password string) error {
+	const op = "userService.DisableTOTP"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	hash, err := s.r.PasswordWithTx(tx, uid)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "getting password")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		_ = tx.Rollback()
+		return errors2.Wrap(&errors2.Invalid{Err: errors.New("the password is incorrect")}, op, "checking password")
+	} else if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "checking password")
+	}
+
+	if err = s.r.DeleteTOTPWithTx(tx, uid); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "deleting totp")
+	}
+
+	if err = s.r.ReplaceRecoveryCodesWithTx(tx, uid, nil, time.Now()); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "deleting recovery codes")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) RegenerateRecoveryCodes(uid int, code string) ([]string, error) {
+	const op = "userService.RegenerateRecoveryCodes"
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting tx")
+	}
+
+	t, err := s.r.TOTPWithTx(tx, uid)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok || err == nil && t.ConfirmedAt == nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(&errors2.Invalid{Err: errors.New("two-factor authentication is not enabled")}, op, "getting totp")
+	} else if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "getting totp")
+	}
+
+	now := time.Now()
+	if err = s.useTOTPCodeWithTx(tx, t, code, now); err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "checking code")
+	}
+
+	codes, err := s.replaceRecoveryCodesWithTx(tx, uid, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "creating recovery codes")
+	}
+
+	return codes, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+// twoFactorEnabled returns true if a user has confirmed TOTP.
+func (s *service) twoFactorEnabled(uid int) (bool, error) {
+	t, err := s.r.TOTP(uid)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return t.ConfirmedAt != nil, nil
+}
+
+// checkSecondFactorWithTx returns true if code is a current TOTP code or an unused
+// recovery code of a user, and uses it up.
+func (s *service) checkSecondFactorWithTx(tx *sql.Tx, uid int, code string, now time.Time) (bool, error) {
+	t, err := s.r.TOTPWithTx(tx, uid)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok || err == nil && t.ConfirmedAt == nil {
+		// two-factor authentication was turned off since the challenge was issued
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		err = s.useTOTPCodeWithTx(tx, t, code, now)
+		if _, ok := errors2.Unwrap(err).(*errors2.Invalid); ok {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	err = s.r.UseRecoveryCodeWithTx(tx, uid, hashRecoveryCode(code), now)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// useTOTPCodeWithTx checks that code is a current code of t that was not used yet and
+// records its time step as used.
+func (s *service) useTOTPCodeWithTx(tx *sql.Tx, t *ecommerce.TOTP, code string, now time.Time) error {
+	step, ok := totp.Validate(t.Secret, strings.TrimSpace(code), now, totpSkew, t.LastStep)
+	if !ok {
+		return &errors2.Invalid{Err: errors.New("the code is incorrect")}
+	}
+
+	t.LastStep = step
+	if t.ConfirmedAt == nil {
+		t.ConfirmedAt = &now
+	}
+
+	return s.r.UpdateTOTPWithTx(tx, t)
+}
+
+// replaceRecoveryCodesWithTx replaces the recovery codes of a user with new ones and
+// returns them. Only their hashes are stored.
+func (s *service) replaceRecoveryCodesWithTx(tx *sql.Tx, uid int, now time.Time) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i], hashes[i] = code, hashRecoveryCode(code)
+	}
+
+	return codes, s.r.ReplaceRecoveryCodesWithTx(tx, uid, hashes, now)
+}
+
+// newRecoveryCode returns a random code of 50 bits in two groups of 5 characters,
+// e.g. "k3x9p-2mfqa". Unlike passwords, the codes are random enough to be stored as a
+// plain SHA-256 hash.
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode returns the hash of code ignoring case, spaces and dashes, which
+// users may type differently.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+	return hashToken(strings.Replace(code, "-", "", -1))
+}
@@ -0,0 +1,36 @@
+package user
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewRecoveryCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`).MatchString(code) {
+			t.Fatalf("wanted two groups of 5 lower case base32 characters, got %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("wanted codes to differ, got %q twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := hashRecoveryCode("k3x9p-2mfqa")
+	for _, typed := range []string{"K3X9P-2MFQA", "k3x9p2mfqa", " k3x9p 2mfqa "} {
+		if hashRecoveryCode(typed) != want {
+			t.Errorf("wanted %q to hash like the code", typed)
+		}
+	}
+	if hashRecoveryCode("k3x9p-2mfqb") == want || strings.Contains(want, "k3x9p") {
+		t.Fatal("wanted a hash that differs for other codes and does not contain the code")
+	}
+}
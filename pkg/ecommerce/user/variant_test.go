@@ -0,0 +1,42 @@
+package user
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+func TestSelectedVariant(t *testing.T) {
+	plain := &ecommerce.Product{ID: 1}
+	withVariants := &ecommerce.Product{ID: 2, Variants: []ecommerce.ProductVariant{{ID: 10, SKU: "TEE-S"}, {ID: 11, SKU: "TEE-M"}}}
+
+	tests := []struct {
+		name string
+		p *ecommerce.Product
+		variantID int
+		want int
+		ok bool
+	}{
+		{name: "product without variants", p: plain, ok: true},
+		{name: "variant of a product without variants", p: plain, variantID: 10},
+		{name: "variant of the product", p: withVariants, variantID: 11, want: 11, ok: true},
+		{name: "no variant of a product with variants", p: withVariants},
+		{name: "variant of another product", p: withVariants, variantID: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := selectedVariant(tt.p, tt.variantID)
+			if (err == nil) != tt.ok {
+				t.Fatalf("wanted ok %t, got %v", tt.ok, err)
+			}
+
+			var got int
+			if v != nil {
+				got = v.ID
+			}
+			if got != tt.want {
+				t.Fatalf("wanted variant %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package ecommerce
+
+import "time"
+
+// WishlistService handles the named wishlists of customers. Items move between a
+// wishlist and the cart, and a wishlist can be shared through a link with an
+// unguessable token.
+type WishlistService interface {
+	CreateWishlist(custID int, name string) (*Wishlist, error)
+	// Wishlists returns the wishlists of a customer, oldest first.
+	Wishlists(custID int) ([]Wishlist, error)
+	Wishlist(custID, id int) (*Wishlist, error)
+	// UpdateWishlist renames a wishlist and turns its share link on or off. Turning the
+	// link off revokes it, turning it on again creates a new one.
+	UpdateWishlist(custID int, w *Wishlist) error
+	DeleteWishlist(custID, id int) error
+	// AddWishlistItem adds a product to a wishlist, or adds to its quantity if the
+	// wishlist has it already.
+	AddWishlistItem(custID, wishlistID int, item *WishlistItem) (int, error)
+	RemoveWishlistItem(custID, wishlistID, itemID int) error
+	// MoveToCart puts an item of a wishlist into the cart and takes it off the wishlist.
+	MoveToCart(custID, wishlistID, itemID int) error
+	// SaveForLater moves a line of the cart to a wishlist, or to the oldest wishlist of
+	// the customer if wishlistID is 0, which is created if they have none.
+	SaveForLater(custID, productID, variantID, wishlistID int) (*WishlistItem, error)
+	// SharedWishlist returns the wishlist with share token.
+	SharedWishlist(token string) (*Wishlist, error)
+}
+
+type Wishlist struct {
+	ID int `json:"id"`
+	CustomerID int `json:"-"`
+	Name string `json:"name"`
+	Shared bool `json:"shared"`
+	// ShareToken identifies the wishlist in its share link. It is empty if the wishlist
+	// is not shared.
+	ShareToken string `json:"share_token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Items []WishlistItem `json:"items"`
+}
+
+// WishlistItem is a product on a wishlist. The flags compare the current product data
+// with the product as it was when the item was added.
+type WishlistItem struct {
+	ID int `json:"id"`
+	Product Product `json:"product"`
+	VariantID int `json:"variant_id,omitempty"`
+	Quantity int `json:"quantity"`
+	// AddedPrice is the unit price when the item was added.
+	AddedPrice Money `json:"added_price"`
+	AddedInStock bool `json:"-"`
+	AddedAt time.Time `json:"added_at"`
+	InStock bool `json:"in_stock"`
+	PriceDropped bool `json:"price_dropped"`
+	BackInStock bool `json:"back_in_stock"`
+}
@@ -0,0 +1,36 @@
+package wishlist
+
+import "ecommerce/pkg/ecommerce"
+
+// current returns the unit price of the variant with variantID of p, or of p if it is
+// 0, and whether it is in stock. A product with variants but none selected is in stock
+// if any of its variants is.
+func current(p *ecommerce.Product, variantID int) (ecommerce.Money, bool) {
+	if v := p.Variant(variantID); v != nil {
+		if v.Price != nil {
+			return v.Price.Current, v.Quantity > 0
+		}
+		return p.Price.Current, v.Quantity > 0
+	}
+
+	if len(p.Variants) > 0 {
+		for _, v := range p.Variants {
+			if v.Quantity > 0 {
+				return p.Price.Current, true
+			}
+		}
+		return p.Price.Current, false
+	}
+
+	return p.Price.Current, p.Quantity > 0
+}
+
+// flag sets the flags of item from its product, which must be attached. An item is
+// back in stock if it was out of stock when it was added and is in stock now.
+func flag(item *ecommerce.WishlistItem) {
+	price, inStock := current(&item.Product, item.VariantID)
+
+	item.InStock = inStock
+	item.PriceDropped = price.Currency == item.AddedPrice.Currency && price.Cmp(item.AddedPrice) < 0
+	item.BackInStock = inStock && !item.AddedInStock
+}
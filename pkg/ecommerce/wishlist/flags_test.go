@@ -0,0 +1,44 @@
+package wishlist
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"testing"
+)
+
+func usd(amount int64) ecommerce.Money {
+	return ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+}
+
+func TestFlag(t *testing.T) {
+	variantPrice := ecommerce.Price{Current: usd(800)}
+	product := ecommerce.Product{ID: 1, Price: ecommerce.Price{Current: usd(1000)}, Quantity: 3}
+	withVariants := ecommerce.Product{ID: 2, Price: ecommerce.Price{Current: usd(1000)}, Variants: []ecommerce.ProductVariant{
+		{ID: 20, Quantity: 0},
+		{ID: 21, Quantity: 2, Price: &variantPrice},
+	}}
+
+	tests := []struct {
+		name string
+		item ecommerce.WishlistItem
+		inStock, priceDropped, backInStock bool
+	}{
+		{"unchanged", ecommerce.WishlistItem{Product: product, AddedPrice: usd(1000), AddedInStock: true}, true, false, false},
+		{"price dropped", ecommerce.WishlistItem{Product: product, AddedPrice: usd(1200), AddedInStock: true}, true, true, false},
+		{"price went up", ecommerce.WishlistItem{Product: product, AddedPrice: usd(900), AddedInStock: true}, true, false, false},
+		{"back in stock", ecommerce.WishlistItem{Product: product, AddedPrice: usd(1000)}, true, false, true},
+		{"variant out of stock", ecommerce.WishlistItem{Product: withVariants, VariantID: 20, AddedPrice: usd(1000)}, false, false, false},
+		{"variant with own price", ecommerce.WishlistItem{Product: withVariants, VariantID: 21, AddedPrice: usd(1000), AddedInStock: true}, true, true, false},
+		{"any variant in stock", ecommerce.WishlistItem{Product: withVariants, AddedPrice: usd(1000), AddedInStock: true}, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			flag(&item)
+			if item.InStock != tt.inStock || item.PriceDropped != tt.priceDropped || item.BackInStock != tt.backInStock {
+				t.Fatalf("wanted in stock %v, price dropped %v, back in stock %v, got %v, %v, %v", tt.inStock,
+					tt.priceDropped, tt.backInStock, item.InStock, item.PriceDropped, item.BackInStock)
+			}
+		})
+	}
+}
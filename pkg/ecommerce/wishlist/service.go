@@ -0,0 +1,368 @@
+package wishlist
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// savedForLater is the name of the wishlist created for items saved for later by
+// customers without a wishlist.
+const savedForLater = "Saved for later"
+
+type repository interface {
+	SaveWishlist(w *ecommerce.Wishlist) (int, error)
+	UpdateWishlist(w *ecommerce.Wishlist) error
+	DeleteWishlist(id int) error
+	Wishlist(id int) (*ecommerce.Wishlist, error)
+	WishlistByToken(token string) (*ecommerce.Wishlist, error)
+	Wishlists(custID int) ([]ecommerce.Wishlist, error)
+	SaveItemWithTx(tx *sql.Tx, wishlistID int, item *ecommerce.WishlistItem) (int, error)
+	DeleteItemWithTx(tx *sql.Tx, wishlistID, itemID int) error
+	Tx() (*sql.Tx, error)
+}
+
+func New(db *sql.DB, repo repository, userService ecommerce.UserService, productService ecommerce.ProductService) *service {
+	return &service{db: db, r: repo, userService: userService, productService: productService}
+}
+
+type service struct {
+	db *sql.DB
+	r repository
+	userService ecommerce.UserService
+	productService ecommerce.ProductService
+}
+
+func (s *service) CreateWishlist(custID int, name string) (*ecommerce.Wishlist, error) {
+	const op = "wishlistService.CreateWishlist"
+
+	name, err := validateName(name)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "validating name")
+	}
+
+	w := &ecommerce.Wishlist{CustomerID: custID, Name: name, CreatedAt: time.Now(), Items: []ecommerce.WishlistItem{}}
+	w.ID, err = s.r.SaveWishlist(w)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "saving wishlist")
+	}
+
+	return w, nil
+}
+
+func (s *service) Wishlists(custID int) ([]ecommerce.Wishlist, error) {
+	const op = "wishlistService.Wishlists"
+
+	ww, err := s.r.Wishlists(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting wishlists from repo")
+	}
+
+	return ww, errors2.Wrap(s.attachProducts(ww), op, "attaching products")
+}
+
+func (s *service) Wishlist(custID, id int) (*ecommerce.Wishlist, error) {
+	const op = "wishlistService.Wishlist"
+
+	w, err := s.owned(custID, id)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	return w, errors2.Wrap(s.attachProducts([]ecommerce.Wishlist{*w}), op, "attaching products")
+}
+
+func (s *service) UpdateWishlist(custID int, w *ecommerce.Wishlist) error {
+	const op = "wishlistService.UpdateWishlist"
+
+	name, err := validateName(w.Name)
+	if err != nil {
+		return errors2.Wrap(err, op, "validating name")
+	}
+
+	current, err := s.owned(custID, w.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	current.Name = name
+	current.Shared = w.Shared
+	if !w.Shared {
+		current.ShareToken = ""
+	} else if current.ShareToken == "" {
+		if current.ShareToken, err = newToken(); err != nil {
+			return errors2.Wrap(err, op, "creating share token")
+		}
+	}
+
+	if err = s.r.UpdateWishlist(current); err != nil {
+		return errors2.Wrap(err, op, "updating wishlist")
+	}
+	*w = *current
+
+	return nil
+}
+
+func (s *service) DeleteWishlist(custID, id int) error {
+	const op = "wishlistService.DeleteWishlist"
+
+	if _, err := s.owned(custID, id); err != nil {
+		return errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	return errors2.Wrap(s.r.DeleteWishlist(id), op, "deleting wishlist")
+}
+
+func (s *service) AddWishlistItem(custID, wishlistID int, item *ecommerce.WishlistItem) (int, error) {
+	const op = "wishlistService.AddWishlistItem"
+
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	if item.Quantity < 1 || item.Quantity > 99 {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("quantity must be between 1 and 99")}, op, "validating quantity")
+	}
+
+	if _, err := s.owned(custID, wishlistID); err != nil {
+		return 0, errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	p, err := s.productService.Product(item.Product.ID)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting product")
+	} else if item.VariantID > 0 && p.Variant(item.VariantID) == nil {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("variant does not belong to product")}, op, "checking variant")
+	}
+
+	item.Product = *p
+	item.AddedPrice, item.AddedInStock = current(p, item.VariantID)
+	item.AddedAt = time.Now()
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "getting tx")
+	}
+
+	item.ID, err = s.r.SaveItemWithTx(tx, wishlistID, item)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, errors2.Wrap(err, op, "saving item")
+	}
+	flag(item)
+
+	return item.ID, errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) RemoveWishlistItem(custID, wishlistID, itemID int) error {
+	const op = "wishlistService.RemoveWishlistItem"
+
+	if _, err := s.owned(custID, wishlistID); err != nil {
+		return errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	if err = s.r.DeleteItemWithTx(tx, wishlistID, itemID); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "deleting item")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) MoveToCart(custID, wishlistID, itemID int) error {
+	const op = "wishlistService.MoveToCart"
+
+	w, err := s.owned(custID, wishlistID)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	var item *ecommerce.WishlistItem
+	for i := range w.Items {
+		if w.Items[i].ID == itemID {
+			item = &w.Items[i]
+		}
+	}
+	if item == nil {
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting item")
+	}
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting tx")
+	}
+
+	// the item is deleted first, so that moving it twice concurrently fails for one of them
+	if err = s.r.DeleteItemWithTx(tx, wishlistID, itemID); err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "deleting item")
+	}
+
+	err = s.userService.AddCartItemWithTx(tx, custID, item.Product.ID, item.VariantID, item.Quantity)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors2.Wrap(err, op, "adding item to cart")
+	}
+
+	return errors2.Wrap(tx.Commit(), op, "committing tx")
+}
+
+func (s *service) SaveForLater(custID, productID, variantID, wishlistID int) (*ecommerce.WishlistItem, error) {
+	const op = "wishlistService.SaveForLater"
+
+	cc, err := s.userService.CartItems(custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting cart")
+	}
+
+	var line *ecommerce.CartItem
+	for i := range cc {
+		if cc[i].Product.ID == productID && cc[i].VariantID == variantID {
+			line = &cc[i]
+		}
+	}
+	if line == nil {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting cart item")
+	}
+
+	if wishlistID > 0 {
+		_, err = s.owned(custID, wishlistID)
+	} else {
+		wishlistID, err = s.defaultWishlist(custID)
+	}
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting wishlist")
+	}
+
+	item := &ecommerce.WishlistItem{Product: line.Product, VariantID: variantID, Quantity: line.Quantity, AddedAt: time.Now()}
+	item.AddedPrice, item.AddedInStock = current(&line.Product, variantID)
+
+	tx, err := s.r.Tx()
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting tx")
+	}
+
+	item.ID, err = s.r.SaveItemWithTx(tx, wishlistID, item)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "saving item")
+	}
+
+	if err = s.userService.RemoveCartItemWithTx(tx, custID, productID, variantID); err != nil {
+		_ = tx.Rollback()
+		return nil, errors2.Wrap(err, op, "removing item from cart")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors2.Wrap(err, op, "committing tx")
+	}
+	flag(item)
+
+	return item, nil
+}
+
+func (s *service) SharedWishlist(token string) (*ecommerce.Wishlist, error) {
+	const op = "wishlistService.SharedWishlist"
+
+	if token == "" {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "checking token")
+	}
+
+	w, err := s.r.WishlistByToken(token)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting wishlist from repo")
+	}
+
+	return w, errors2.Wrap(s.attachProducts([]ecommerce.Wishlist{*w}), op, "attaching products")
+}
+
+// owned returns the wishlist with id if it belongs to the customer. Wishlists of other
+// customers are treated as if they did not exist.
+func (s *service) owned(custID, id int) (*ecommerce.Wishlist, error) {
+	w, err := s.r.Wishlist(id)
+	if err != nil {
+		return nil, err
+	} else if w.CustomerID != custID {
+		return nil, &errors2.NotFound{Err: sql.ErrNoRows}
+	}
+
+	return w, nil
+}
+
+// defaultWishlist returns the id of the oldest wishlist of a customer and creates one
+// if they have none.
+func (s *service) defaultWishlist(custID int) (int, error) {
+	ww, err := s.r.Wishlists(custID)
+	if err != nil {
+		return 0, err
+	} else if len(ww) > 0 {
+		return ww[0].ID, nil
+	}
+
+	w, err := s.CreateWishlist(custID, savedForLater)
+	if err != nil {
+		return 0, err
+	}
+
+	return w.ID, nil
+}
+
+// attachProducts attaches the current products to the items of ww and flags them. The
+// items share their backing arrays with ww, so copies of ww see the products too.
+func (s *service) attachProducts(ww []ecommerce.Wishlist) error {
+	var ids []int
+	for _, w := range ww {
+		for _, item := range w.Items {
+			ids = append(ids, item.Product.ID)
+		}
+	}
+	if len(ids) < 1 {
+		return nil
+	}
+
+	pp, err := s.productService.ProductsFromIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range ww {
+		for i := range w.Items {
+			for _, p := range pp {
+				if p.ID == w.Items[i].Product.ID {
+					w.Items[i].Product = p
+				}
+			}
+			flag(&w.Items[i])
+		}
+	}
+
+	return nil
+}
+
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", &errors2.Invalid{Err: errors.New("name is required and must be at most 64 characters")}
+	}
+
+	return name, nil
+}
+
+// newToken returns a random, URL safe token of 256 bits.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,163 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### EMAIL VERIFICATION AND PASSWORD RESET ####
+func (h Http) requestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err := h.UserService.RequestEmailVerification(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusAccepted, nil, nil)
+}
+
+func (h Http) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err := h.UserService.VerifyEmail(data.Token)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+// requestPasswordReset responds the same whether or not there is an account with the
+// email address, so that it cannot be used to find out who has one.
+func (h Http) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Email string `json:"email"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err := h.UserService.RequestPasswordReset(data.Email)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusAccepted, nil, nil)
+}
+
+func (h Http) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Token string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err := h.UserService.ResetPassword(data.Token, data.Password)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+// changePassword logs out the sessions of the user but the one the password was
+// changed in.
+func (h Http) changePassword(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		CurrentPassword string `json:"current_password"`
+		Password string `json:"password"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err := h.UserService.ChangePassword(u.ID, u.SessionID, data.CurrentPassword, data.Password)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+// #### LOGIN LOCKOUTS ####
+func (h Http) getLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.Atoi(mux.Vars(r)["uid"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	aa, err := h.UserService.LoginAttempts(uid)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, aa)
+}
+
+func (h Http) unlockLogin(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.Atoi(mux.Vars(r)["uid"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	err = h.UserService.UnlockLogin(uid)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### ADDRESS BOOK ####
+func (h Http) getAddresses(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	aa, err := h.UserService.Addresses(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if aa == nil { aa = []ecommerce.Address{} }
+
+	h.Response.respond(w, http.StatusOK, nil, aa)
+}
+
+func (h Http) getAddress(w http.ResponseWriter, r *http.Request) {
+	addressID, err := strconv.Atoi(mux.Vars(r)["addressID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid address id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	a, err := h.UserService.Address(u.ID, addressID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, a)
+}
+
+func (h Http) createAddress(w http.ResponseWriter, r *http.Request) {
+	var a ecommerce.Address
+	if err := decodeJSONBody(w, r, &a); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	_, err := h.UserService.CreateAddress(u.ID, &a)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, a)
+}
+
+func (h Http) updateAddress(w http.ResponseWriter, r *http.Request) {
+	addressID, err := strconv.Atoi(mux.Vars(r)["addressID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid address id")
+		return
+	}
+
+	var a ecommerce.Address
+	if err := decodeJSONBody(w, r, &a); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	a.ID = addressID
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.UserService.UpdateAddress(u.ID, &a)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, a)
+}
+
+func (h Http) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	addressID, err := strconv.Atoi(mux.Vars(r)["addressID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid address id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.UserService.DeleteAddress(u.ID, addressID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// #### API KEYS ####
+
+// createAPIKey responds with the key, which cannot be shown again.
+func (h Http) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Name string `json:"name"`
+		Scopes []string `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	k := ecommerce.APIKey{Name: data.Name, Scopes: data.Scopes, ExpiresAt: data.ExpiresAt, CreatedBy: u.ID}
+	key, err := h.APIKeyService.CreateAPIKey(&k)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, struct {
+		ecommerce.APIKey
+		Key string `json:"key"`
+	}{APIKey: k, Key: key})
+}
+
+func (h Http) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	kk, err := h.APIKeyService.APIKeys()
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if kk == nil { kk = []ecommerce.APIKey{} }
+
+	h.Response.respond(w, http.StatusOK, nil, kk)
+}
+
+func (h Http) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["keyID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid api key id")
+		return
+	}
+
+	err = h.APIKeyService.RevokeAPIKey(id)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### CATEGORIES ####
+func (h Http) getCategories(w http.ResponseWriter, r *http.Request) {
+	cc, err := h.ProductService.Categories()
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if cc == nil { cc = []ecommerce.Category{} }
+
+	h.Response.respond(w, http.StatusOK, nil, cc)
+}
+
+func (h Http) getCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	c, err := h.ProductService.Category(categoryID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	crumbs, err := h.ProductService.CategoryBreadcrumbs(categoryID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, struct {
+		*ecommerce.Category
+		Breadcrumbs []ecommerce.Category `json:"breadcrumbs"`
+	}{Category: c, Breadcrumbs: crumbs})
+}
+
+func (h Http) createCategory(w http.ResponseWriter, r *http.Request) {
+	var c ecommerce.Category
+	if err := decodeJSONBody(w, r, &c); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	c.Children = nil
+
+	id, err := h.ProductService.CreateCategory(&c)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, struct{
+		ID int `json:"id"`
+		Slug string `json:"slug"`
+	}{ID:id, Slug: c.Slug})
+}
+
+func (h Http) moveCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	var data struct {
+		ParentID int `json:"parent_id"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err = h.ProductService.MoveCategory(categoryID, data.ParentID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) getAttributeDefinitions(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	dd, err := h.ProductService.AttributeDefinitions(categoryID)
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if dd == nil { dd = []ecommerce.AttributeDefinition{} }
+
+	h.Response.respond(w, http.StatusOK, nil, dd)
+}
+
+func (h Http) createAttributeDefinition(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(mux.Vars(r)["categoryID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	var d ecommerce.AttributeDefinition
+	if err := decodeJSONBody(w, r, &d); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	d.CategoryID = categoryID
+
+	id, err := h.ProductService.CreateAttributeDefinition(&d)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, struct{
+		ID int `json:"id"`
+	}{ID:id})
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+)
+
+// #### CURRENCIES ####
+
+// displayRate returns the rate to show prices of the request with. The currency query
+// parameter takes precedence over the Accept-Currency header, which lists currencies
+// in order of preference, e.g. "EUR, GBP". Currencies without a rate are an error in
+// the query parameter and skipped in the header, falling back to the catalog currency.
+func (h Http) displayRate(r *http.Request) (*ecommerce.ExchangeRate, error) {
+	if c := r.URL.Query().Get("currency"); c != "" {
+		rate, err := h.CurrencyService.Rate(c)
+		if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+			return nil, &malformedRequest{status: http.StatusBadRequest, msg: fmt.Sprintf("currency %s is not available", c)}
+		}
+		return rate, err
+	}
+
+	for _, c := range strings.Split(r.Header.Get("Accept-Currency"), ",") {
+		// ignore parameters like q=0.5, the list is already in order of preference
+		c = strings.TrimSpace(strings.SplitN(c, ";", 2)[0])
+		if c == "" {
+			continue
+		}
+
+		rate, err := h.CurrencyService.Rate(c)
+		if err == nil {
+			return rate, nil
+		} else if _, ok := errors2.Unwrap(err).(*errors2.NotFound); !ok {
+			return nil, err
+		}
+	}
+
+	return ecommerce.BaseRate(), nil
+}
+
+// rateError responds to an error of displayRate.
+func (h Http) rateError(w http.ResponseWriter, err error) {
+	var mr *malformedRequest
+	if errors.As(err, &mr) {
+		h.Response.clientError(w, mr.status, mr.msg)
+	} else {
+		h.Response.serverError(w, err)
+	}
+}
+
+func (h Http) getExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rr, err := h.CurrencyService.Rates()
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if rr == nil { rr = []ecommerce.ExchangeRate{} }
+
+	h.Response.respond(w, http.StatusOK, nil, rr)
+}
+
+func (h Http) setExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var rate ecommerce.ExchangeRate
+	if err := decodeJSONBody(w, r, &rate); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	rate.Currency = mux.Vars(r)["currency"]
+
+	err := h.CurrencyService.SetRate(&rate)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, rate)
+}
+
+func (h Http) deleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	err := h.CurrencyService.DeleteRate(mux.Vars(r)["currency"])
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+// importExchangeRates sets the rates of a text/csv request body.
+func (h Http) importExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "text/csv") {
+		h.Response.clientError(w, http.StatusUnsupportedMediaType, "Content-Type header is not text/csv")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+
+	n, err := h.CurrencyService.ImportRates(r.Body)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, struct{
+		Imported int `json:"imported"`
+	}{Imported: n})
+}
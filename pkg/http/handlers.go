@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -55,6 +57,7 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
+		var moneyError *ecommerce.MoneyError
 
 		switch {
 		case errors.As(err, &syntaxError):
@@ -69,6 +72,10 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 			msg := fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshalTypeError.Field, unmarshalTypeError.Offset)
 			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
 
+		case errors.As(err, &moneyError):
+			msg := fmt.Sprintf("Request body contains an invalid amount: %s", moneyError)
+			return &malformedRequest{status: http.StatusBadRequest, msg: msg}
+
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
@@ -95,11 +102,52 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) err
 	return nil
 }
 
+// bracketParams collects query parameters of the form name[key]=value into a map
+// of key to values, e.g. option[size]=M&option[size]=L => {"size": ["M", "L"]}.
+// Empty keys and values are ignored.
+func bracketParams(form url.Values, name string) map[string][]string {
+	params := make(map[string][]string)
+	for k, vv := range form {
+		if !strings.HasPrefix(k, name + "[") || !strings.HasSuffix(k, "]") {
+			continue
+		}
+
+		key := strings.TrimSuffix(strings.TrimPrefix(k, name + "["), "]")
+		if key == "" {
+			continue
+		}
+
+		for _, v := range vv {
+			if v != "" {
+				params[key] = append(params[key], v)
+			}
+		}
+	}
+
+	return params
+}
 
 type Http struct {
 	Response       *response
 	ProductService ecommerce.ProductService
 	UserService ecommerce.UserService
+	MediaService ecommerce.MediaService
+	ReviewService ecommerce.ReviewService
+	PromotionService ecommerce.PromotionService
+	CheckoutService ecommerce.CheckoutService
+	CurrencyService ecommerce.CurrencyService
+	TaxService ecommerce.TaxService
+	ShippingService ecommerce.ShippingService
+	FulfilmentService ecommerce.FulfilmentService
+	ReturnService ecommerce.ReturnService
+	WishlistService ecommerce.WishlistService
+	SubscriptionService ecommerce.SubscriptionService
+	APIKeyService ecommerce.APIKeyService
+	// RequireAdminTwoFactor makes admins log in with a second factor to use admin routes.
+	RequireAdminTwoFactor bool
+	// AllowedOrigins are the origins of the front ends allowed to call the API from a
+	// browser, with credentials, e.g. http://localhost:4200.
+	AllowedOrigins []string
 }
 
 func NewServer(response *response) *Http {
@@ -128,15 +176,63 @@ func (h Http) authenticate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check if email and password match
-	match, uid, err := h.UserService.EmailMatchPassword(data.Email, data.Password)
+	match, uid, err := h.UserService.EmailMatchPassword(data.Email, data.Password, clientIP(r))
 	if err != nil {
-		h.Response.serverError(w, err)
+		h.Response.serviceError(w, err)
 		return
 	} else if !match {
 		h.Response.clientError(w, http.StatusUnauthorized, "email and password didn't match")
 		return
 	}
 
+	h.respondLogin(w, r, uid)
+}
+
+// respondLogin responds to the first step of a login of the user with uid. Users with
+// two-factor authentication get a challenge for their code instead of an auth token.
+func (h Http) respondLogin(w http.ResponseWriter, r *http.Request, uid int) {
+	challenge, err := h.UserService.LoginChallenge(uid)
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	} else if challenge != "" {
+		h.Response.respond(w, http.StatusOK, nil, struct {
+			TwoFactorRequired bool `json:"two_factor_required"`
+			ChallengeToken string `json:"challenge_token"`
+		}{TwoFactorRequired: true, ChallengeToken: challenge})
+		return
+	}
+
+	h.respondAuthenticated(w, r, uid, false)
+}
+
+func (h Http) authenticateTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code string `json:"code"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	uid, err := h.UserService.CompleteLoginChallenge(data.ChallengeToken, data.Code, clientIP(r))
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.respondAuthenticated(w, r, uid, true)
+}
+
+// respondAuthenticated starts a session of the user with uid on the device of r and
+// responds with the user and an auth token for the session.
+func (h Http) respondAuthenticated(w http.ResponseWriter, r *http.Request, uid int, twoFactor bool) {
 	// get user
 	u, err := h.UserService.User(uid)
 	if err != nil {
@@ -144,7 +240,15 @@ func (h Http) authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sid, err := h.UserService.StartSession(uid, clientIP(r), r.UserAgent())
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
 	// get auth token
+	u.TwoFactor = twoFactor
+	u.SessionID = sid
 	authToken, err := u.AuthToken()
 	if err != nil {
 		h.Response.serverError(w, err)
@@ -162,6 +266,17 @@ func (h Http) authenticate(w http.ResponseWriter, r *http.Request) {
 	h.Response.respond(w, http.StatusOK, nil, o)
 }
 
+// clientIP returns the IP address of the client of r. Forwarding headers are not
+// trusted, since any client could set them to dodge the per IP login limits.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func (h Http) createCustomer(w http.ResponseWriter, r *http.Request) {
 	data := &struct {
 		Customer  ecommerce.User `json:"customer"`
@@ -179,7 +294,7 @@ func (h Http) createCustomer(w http.ResponseWriter, r *http.Request) {
 
 	id, err := h.UserService.CreateCustomer(&data.Customer, data.Password)
 	if err != nil {
-		h.Response.serverError(w, err)
+		h.Response.serviceError(w, err)
 		return
 	}
 
@@ -251,9 +366,16 @@ func (h Http) updateCustomerAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.UserService.UpdateCustomerAddress(u.ID, &a)
+	// the single address of the old API is the default shipping address of the address book
+	var err error
+	if a.ID > 0 {
+		err = h.UserService.UpdateAddress(u.ID, &a)
+	} else {
+		a.DefaultShipping = true
+		_, err = h.UserService.CreateAddress(u.ID, &a)
+	}
 	if err != nil {
-		h.Response.serverError(w, err)
+		h.Response.serviceError(w, err)
 		return
 	}
 
@@ -268,9 +390,12 @@ func (h Http) deleteCustomerAddress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.UserService.DeleteCustomerAddress(u.ID)
+	a, err := h.UserService.CustomerAddress(u.ID)
+	if err == nil && a != nil {
+		err = h.UserService.DeleteAddress(u.ID, a.ID)
+	}
 	if err != nil {
-		h.Response.serverError(w, err)
+		h.Response.serviceError(w, err)
 		return
 	}
 
@@ -364,19 +489,73 @@ func (h Http) getCustomerOrders(w http.ResponseWriter, r *http.Request) {
 	h.Response.respond(w, http.StatusOK, nil, oo)
 }
 
+func (h Http) getOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	o, err := h.UserService.Order(orderID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, o)
+}
+
+func (h Http) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	var data struct {
+		Status string `json:"status"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err = h.UserService.UpdateOrderStatus(orderID, data.Status)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
 func (h Http) getProducts(w http.ResponseWriter, r *http.Request) {
 	const op = "http.getProducts"
 
 	const size = 20
 	var err error
-	var page, categoryID int
+	var page int
 
-	if r.FormValue("category") != "" {
-		categoryID, err = strconv.Atoi(r.FormValue("category"))
-		if err != nil {
-			h.Response.clientError(w, http.StatusBadRequest, "category id")
-			return
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	categoryID, filter, err := productFilter(r, rate)
+	if err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
 		}
+		return
 	}
 
 	if r.FormValue("page") != "" {
@@ -389,31 +568,65 @@ func (h Http) getProducts(w http.ResponseWriter, r *http.Request) {
 		page = 1
 	}
 
-	var minPrice, maxPrice float32
+	pp, err := h.ProductService.Products(categoryID, r.FormValue("q"), filter, page, size)
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if pp == nil {
+		pp = []ecommerce.Product{}
+	}
+
+	for i := range pp {
+		if err = rate.ConvertProduct(&pp[i]); err != nil {
+			h.Response.serverError(w, err)
+			return
+		}
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, pp)
+}
+
+// productFilter parses the category and filter query parameters shared by the product
+// listing and its facets. Prices are in the currency of rate.
+func productFilter(r *http.Request, rate *ecommerce.ExchangeRate) (int, *ecommerce.ProductFilter, error) {
+	var err error
+	var categoryID int
+
+	if r.FormValue("category") != "" {
+		categoryID, err = strconv.Atoi(r.FormValue("category"))
+		if err != nil {
+			return 0, nil, &malformedRequest{status: http.StatusBadRequest, msg: "category id"}
+		}
+	}
+
+	var minPrice, maxPrice ecommerce.Money
 	var discount int
 	if r.FormValue("min-price") != "" {
-		p, err := strconv.ParseFloat(r.FormValue("min-price"), 32)
-		minPrice = float32(p)
+		minPrice, err = ecommerce.ParseMoney(r.FormValue("min-price"), rate.Currency)
+		if err == nil {
+			minPrice, err = rate.ToBase(minPrice)
+		}
 		if err != nil {
-			h.Response.clientError(w, http.StatusBadRequest, "invalid min price")
-			return
+			return 0, nil, &malformedRequest{status: http.StatusBadRequest, msg: "invalid min price"}
 		}
 	}
 
 	if r.FormValue("max-price") != "" {
-		p, err := strconv.ParseFloat(r.FormValue("max-price"), 32)
-		maxPrice = float32(p)
+		maxPrice, err = ecommerce.ParseMoney(r.FormValue("max-price"), rate.Currency)
+		if err == nil {
+			maxPrice, err = rate.ToBase(maxPrice)
+		}
 		if err != nil {
-			h.Response.clientError(w, http.StatusBadRequest, "invalid max price")
-			return
+			return 0, nil, &malformedRequest{status: http.StatusBadRequest, msg: "invalid max price"}
 		}
 	}
 
 	if r.FormValue("discount") != "" {
 		discount, err = strconv.Atoi(r.FormValue("discount"))
 		if err != nil {
-			h.Response.clientError(w, http.StatusBadRequest, "invalid discount")
-			return
+			return 0, nil, &malformedRequest{status: http.StatusBadRequest, msg: "invalid discount"}
 		}
 	}
 
@@ -421,19 +634,42 @@ func (h Http) getProducts(w http.ResponseWriter, r *http.Request) {
 		MinPrice: minPrice,
 		MaxPrice: maxPrice,
 		Discount: discount,
+		Options:  bracketParams(r.Form, "option"),
+		Attributes: bracketParams(r.Form, "attr"),
 	}
 
-	pp, err := h.ProductService.Products(categoryID, r.FormValue("q"), filter, page, size)
+	return categoryID, filter, nil
+}
+
+func (h Http) getProductFacets(w http.ResponseWriter, r *http.Request) {
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	categoryID, filter, err := productFilter(r, rate)
+	if err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	ff, err := h.ProductService.ProductFacets(categoryID, r.FormValue("q"), filter)
 	if err != nil {
 		h.Response.serverError(w, err)
 		return
 	}
 
-	if pp == nil {
-		pp = []ecommerce.Product{}
+	if ff == nil {
+		ff = []ecommerce.Facet{}
 	}
 
-	h.Response.respond(w, http.StatusOK, nil, pp)
+	h.Response.respond(w, http.StatusOK, nil, ff)
 }
 
 func (h Http) getProduct(w http.ResponseWriter, r *http.Request) {
@@ -445,8 +681,19 @@ func (h Http) getProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
 	p, err := h.ProductService.Product(pdtID)
 	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if err = rate.ConvertProduct(p); err != nil {
 		h.Response.serverError(w, err)
 		return
 	}
@@ -454,6 +701,57 @@ func (h Http) getProduct(w http.ResponseWriter, r *http.Request) {
 	h.Response.respond(w, http.StatusOK, nil, p)
 }
 
+func (h Http) createProduct(w http.ResponseWriter, r *http.Request) {
+	var p ecommerce.Product
+	if err := decodeJSONBody(w, r, &p); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	id, err := h.ProductService.CreateProduct(&p)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, struct{
+		ID int `json:"id"`
+	}{ID:id})
+}
+
+func (h Http) updateProduct(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var p ecommerce.Product
+	if err := decodeJSONBody(w, r, &p); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	p.ID = pdtID
+
+	err = h.ProductService.UpdateProduct(&p)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
 func (h Http) getCartItems(w http.ResponseWriter, r *http.Request) {
 
 	// get user from request context
@@ -463,6 +761,12 @@ func (h Http) getCartItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
 	cc, err := h.UserService.CartItems(u.ID)
 	if err != nil {
 		h.Response.serverError(w, err)
@@ -471,6 +775,13 @@ func (h Http) getCartItems(w http.ResponseWriter, r *http.Request) {
 
 	if cc == nil { cc = []ecommerce.CartItem{} }
 
+	for i := range cc {
+		if err = rate.ConvertProduct(&cc[i].Product); err != nil {
+			h.Response.serverError(w, err)
+			return
+		}
+	}
+
 	h.Response.respond(w, http.StatusOK, nil, cc)
 }
 
@@ -478,6 +789,7 @@ func (h Http) addCartItems(w http.ResponseWriter, r *http.Request) {
 
 	var data struct {
 		ProductID int `json:"product_id"`
+		VariantID int `json:"variant_id"`
 	}
 	if err := decodeJSONBody(w, r, &data); err != nil {
 		var mr *malformedRequest
@@ -496,9 +808,9 @@ func (h Http) addCartItems(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.UserService.AddCartItems(u.ID, data.ProductID)
+	err := h.UserService.AddCartItems(u.ID, data.ProductID, data.VariantID)
 	if err != nil {
-		h.Response.serverError(w, err)
+		h.Response.serviceError(w, err)
 		return
 	}
 
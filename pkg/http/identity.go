@@ -0,0 +1,77 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// #### EXTERNAL LOGIN ####
+func (h Http) getIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	h.Response.respond(w, http.StatusOK, nil, h.UserService.IdentityProviders())
+}
+
+// externalLoginCookie binds an external login to the browser it was started in, so that
+// a code and state sent to another browser cannot complete it there.
+const externalLoginCookie = "external_login"
+
+// startExternalLogin responds with the URL of the provider the front end sends the
+// user to. The provider sends them back to the front end, which completes the login
+// with completeExternalLogin. Both requests must be sent with credentials, so that the
+// browser keeps and sends the cookie binding the login to it.
+func (h Http) startExternalLogin(w http.ResponseWriter, r *http.Request) {
+	u, binding, err := h.UserService.StartExternalLogin(mux.Vars(r)["provider"])
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name: externalLoginCookie,
+		Value: binding,
+		Path: "/users/authentication/providers/",
+		MaxAge: int(ecommerce.ExternalLoginValidFor / time.Second),
+		Secure: r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	h.Response.respond(w, http.StatusOK, nil, struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}{AuthorizationURL: u})
+}
+
+func (h Http) completeExternalLogin(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Code string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	var binding string
+	if c, err := r.Cookie(externalLoginCookie); err == nil {
+		binding = c.Value
+	}
+
+	uid, err := h.UserService.CompleteExternalLogin(mux.Vars(r)["provider"], data.Code, data.State, binding)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	// the login is used up, so the browser can drop the binding
+	http.SetCookie(w, &http.Cookie{Name: externalLoginCookie, Path: "/users/authentication/providers/", MaxAge: -1,
+		Secure: r.TLS != nil, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+
+	h.respondLogin(w, r, uid)
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const frontEnd = "http://localhost:4200"
+
+// externalLoginUsers is a user service that starts external logins with a fixed
+// binding and only completes them with it.
+type externalLoginUsers struct {
+	ecommerce.UserService
+	binding       string
+	completedWith string
+}
+
+func (u *externalLoginUsers) StartExternalLogin(provider string) (string, string, error) {
+	return "https://id.example.com/authorize?state=s", u.binding, nil
+}
+
+func (u *externalLoginUsers) CompleteExternalLogin(provider, code, state, binding string) (int, error) {
+	u.completedWith = binding
+	return 7, nil
+}
+
+func (u *externalLoginUsers) LoginChallenge(uid int) (string, error) {
+	return "", nil
+}
+
+func (u *externalLoginUsers) User(uid int) (*ecommerce.User, error) {
+	return &ecommerce.User{ID: uid, Roles: []int{ecommerce.RoleCustomer}}, nil
+}
+
+func (u *externalLoginUsers) StartSession(uid int, ip, userAgent string) (int, error) {
+	return 1, nil
+}
+
+func TestExternalLoginFromFrontEnd(t *testing.T) {
+	users := &externalLoginUsers{binding: "b1nd1ng"}
+	h := Http{Response: NewResponse(log.New(ioutil.Discard, "", 0)), UserService: users, AllowedOrigins: []string{frontEnd}}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	checkCORS := func(res *http.Response) {
+		t.Helper()
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != frontEnd {
+			t.Fatalf("wanted the front end origin allowed, got %q", got)
+		}
+		if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Fatalf("wanted credentials allowed, got %q", got)
+		}
+	}
+
+	// the browser asks before sending the JSON request with credentials
+	req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/users/authentication/providers/google", nil)
+	req.Header.Set("Origin", frontEnd)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	checkCORS(res)
+
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/users/authentication/providers/google", nil)
+	req.Header.Set("Origin", frontEnd)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	checkCORS(res)
+
+	var cookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == externalLoginCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != users.binding || !cookie.HttpOnly {
+		t.Fatalf("wanted an HttpOnly cookie with the binding, got %+v", cookie)
+	}
+
+	body := strings.NewReader(`{"code": "c", "state": "s"}`)
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/users/authentication/providers/google/callback", body)
+	req.Header.Set("Origin", frontEnd)
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	checkCORS(res)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("wanted the login completed, got status %d", res.StatusCode)
+	}
+	if users.completedWith != users.binding {
+		t.Fatalf("wanted the login completed with the binding of the cookie, got %q", users.completedWith)
+	}
+}
+
+func TestCORSRejectsOtherOrigins(t *testing.T) {
+	h := Http{Response: NewResponse(log.New(ioutil.Discard, "", 0)), UserService: &externalLoginUsers{}, AllowedOrigins: []string{frontEnd}}
+	srv := httptest.NewServer(h.Routes())
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/users/authentication/providers/google", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("wanted another origin not allowed, got %q", got)
+	}
+}
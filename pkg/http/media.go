@@ -0,0 +1,115 @@
+package http
+
+import (
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/ecommerce/media"
+	"errors"
+	"github.com/gorilla/mux"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// #### PRODUCT MEDIA ####
+func (h Http) uploadProductImage(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	// leave some room for the multipart envelope around the image
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxImageSize + 1<<20)
+	f, _, err := r.FormFile("image")
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			h.Response.clientError(w, http.StatusRequestEntityTooLarge, "image is too large")
+			return
+		}
+		h.Response.clientError(w, http.StatusBadRequest, "request must be multipart form data with an image field")
+		return
+	}
+	defer f.Close()
+
+	img, err := h.MediaService.UploadProductImage(pdtID, f)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, img)
+}
+
+func (h Http) deleteProductImage(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	imageID, err := strconv.Atoi(mux.Vars(r)["imageID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid image id")
+		return
+	}
+
+	err = h.MediaService.DeleteProductImage(pdtID, imageID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) reorderProductImages(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var data struct {
+		ImageIDs []int `json:"image_ids"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err = h.MediaService.ReorderProductImages(pdtID, data.ImageIDs)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) getMedia(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	rc, err := h.MediaService.Blob(key)
+	if err != nil {
+		if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.Response.serverError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	_, _ = io.Copy(w, rc)
+}
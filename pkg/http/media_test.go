@@ -0,0 +1,38 @@
+package http
+
+import (
+	"bytes"
+	"ecommerce/pkg/ecommerce/media"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadProductImageTooLarge(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("image", "huge.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(make([]byte, media.MaxImageSize+2<<20)); err != nil {
+		t.Fatal(err)
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/products/1/images", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r = mux.SetURLVars(r, map[string]string{"productID": "1"})
+	w := httptest.NewRecorder()
+
+	h := Http{Response: NewResponse(log.New(ioutil.Discard, "", 0))}
+	h.uploadProductImage(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("wanted status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
@@ -2,8 +2,10 @@ package http
 
 import (
 	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
 	"errors"
 	"fmt"
+	"github.com/justinas/alice"
 	"net/http"
 	"strings"
 )
@@ -45,14 +47,29 @@ func (h Http) setReqCtxUser(next http.Handler) http.Handler {
 		}
 
 		authToken := bearerTokenSlice[1]
-		u, err := ecommerce.UserFromAuthToken(authToken)
+		if ecommerce.IsAPIKey(authToken) {
+			h.setReqCtxAPIKey(next, w, r, authToken)
+			return
+		}
+
+		c, err := ecommerce.ParseAuthToken(authToken)
 		if err != nil {
 			// user is not logged in
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		ctx := ecommerce.NewUserContext(r.Context(), u)
+		revoked, err := h.UserService.SessionRevoked(c.UserID, c.SessionID, clientIP(r))
+		if err != nil {
+			h.Response.serverError(w, err)
+			return
+		} else if revoked {
+			// the session was logged out, e.g. from another device of the user
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := ecommerce.NewUserContext(r.Context(), c.User())
 		next.ServeHTTP(w, r.WithContext(ctx))
 		return
 	}
@@ -60,6 +77,59 @@ func (h Http) setReqCtxUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(f)
 }
 
+// setReqCtxAPIKey serves r with the API key key in its context. Unlike auth tokens, a
+// key that does not work is an error rather than an anonymous request, since the
+// systems keys are issued to would not notice otherwise.
+func (h Http) setReqCtxAPIKey(next http.Handler, w http.ResponseWriter, r *http.Request, key string) {
+	k, err := h.APIKeyService.AuthenticateAPIKey(key)
+	if _, ok := errors2.Unwrap(err).(*errors2.NotFound); ok {
+		h.Response.clientError(w, http.StatusUnauthorized, "invalid API key")
+		return
+	} else if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	ctx := ecommerce.NewAPIKeyContext(r.Context(), k)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// scoped lets requests with an API key through only if the key has scope. Requests
+// without a key are left to the routes.
+func (h Http) scoped(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if k, ok := ecommerce.APIKeyFromContext(r.Context()); ok && !k.HasScope(scope) {
+				h.Response.clientError(w, http.StatusForbidden, "the API key does not have the scope "+scope)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(f)
+	}
+}
+
+// adminOrScoped lets through admins and requests with an API key that has scope.
+func (h Http) adminOrScoped(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		admin := h.adminOnly(next)
+		scoped := h.scoped(scope)(next)
+
+		f := func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := ecommerce.APIKeyFromContext(r.Context()); ok {
+				scoped.ServeHTTP(w, r)
+				return
+			}
+
+			admin.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(f)
+	}
+}
+
 func (h Http) authenticatedOnly(next http.Handler) http.Handler {
 	const op = "server.authenticatedOnly"
 
@@ -74,3 +144,29 @@ func (h Http) authenticatedOnly(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(f)
 }
+
+func (h Http) adminOnly(next http.Handler) http.Handler {
+	const op = "server.adminOnly"
+
+	f := func(w http.ResponseWriter, r *http.Request) {
+		u, ok := ecommerce.UserFromContext(r.Context())
+		if !ok {
+			h.Response.clientError(w, http.StatusUnauthorized, "")
+			return
+		}
+
+		if !u.HasRole(ecommerce.RoleAdmin) {
+			h.Response.clientError(w, http.StatusForbidden, "")
+			return
+		}
+
+		if h.RequireAdminTwoFactor && !u.TwoFactor {
+			h.Response.clientError(w, http.StatusForbidden, "admins must log in with two-factor authentication")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(f)
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"ecommerce/pkg/ecommerce"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// #### PERSONAL DATA ####
+
+// exportPersonalData responds with the data of the user as JSON, or with ?format=zip
+// as a ZIP archive with a JSON file per kind of data.
+func (h Http) exportPersonalData(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		h.Response.clientError(w, http.StatusBadRequest, "format must be json or zip")
+		return
+	}
+
+	d, err := h.UserService.ExportPersonalData(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if format != "zip" {
+		h.Response.respond(w, http.StatusOK, nil, d)
+		return
+	}
+
+	// the archive is built in memory, so that an error does not cut a response short
+	var buf bytes.Buffer
+	if err = writePersonalDataZip(&buf, d); err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="personal-data-%d.zip"`, u.ID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+func writePersonalDataZip(buf *bytes.Buffer, d *ecommerce.PersonalData) error {
+	z := zip.NewWriter(buf)
+	for _, f := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", d.Profile},
+		{"addresses.json", d.Addresses},
+		{"credit_cards.json", d.CreditCards},
+		{"orders.json", d.Orders},
+		{"reviews.json", d.Reviews},
+		{"cart.json", d.Cart},
+	} {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: d.ExportedAt})
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+// requestAccountDeletion logs out all sessions of the user, who logs in again to
+// cancel the deletion. The password can be left out right after logging in.
+func (h Http) requestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Password string `json:"password"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	at, err := h.UserService.RequestAccountDeletion(u.ID, u.SessionID, data.Password)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusAccepted, nil, struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}{DeletionScheduledAt: at})
+}
+
+func (h Http) cancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err := h.UserService.CancelAccountDeletion(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
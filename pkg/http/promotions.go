@@ -0,0 +1,215 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### PROMOTIONS ####
+func (h Http) getPromotions(w http.ResponseWriter, r *http.Request) {
+	pp, err := h.PromotionService.Promotions()
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if pp == nil { pp = []ecommerce.Promotion{} }
+
+	h.Response.respond(w, http.StatusOK, nil, pp)
+}
+
+func (h Http) getPromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["promotionID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid promotion id")
+		return
+	}
+
+	p, err := h.PromotionService.Promotion(promotionID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, p)
+}
+
+func (h Http) createPromotion(w http.ResponseWriter, r *http.Request) {
+	var p ecommerce.Promotion
+	if err := decodeJSONBody(w, r, &p); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	_, err := h.PromotionService.CreatePromotion(&p)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, p)
+}
+
+func (h Http) updatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := strconv.Atoi(mux.Vars(r)["promotionID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid promotion id")
+		return
+	}
+
+	var p ecommerce.Promotion
+	if err := decodeJSONBody(w, r, &p); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	p.ID = promotionID
+
+	err = h.PromotionService.UpdatePromotion(&p)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, p)
+}
+
+// #### CART TOTALS AND COUPONS ####
+func (h Http) getCartTotals(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	t, err := h.CheckoutService.CartTotals(u.ID, rate.Currency)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, t)
+}
+
+func (h Http) applyCoupon(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Code string `json:"code"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	_, err = h.PromotionService.ApplyCoupon(u.ID, data.Code)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	t, err := h.CheckoutService.CartTotals(u.ID, rate.Currency)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, t)
+}
+
+func (h Http) removeCoupon(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	err = h.PromotionService.RemoveCoupon(u.ID, mux.Vars(r)["code"])
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	t, err := h.CheckoutService.CartTotals(u.ID, rate.Currency)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, t)
+}
+
+// #### CHECKOUT ####
+func (h Http) checkout(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ShippingMethodID int `json:"shipping_method_id"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	o, err := h.CheckoutService.Checkout(u.ID, rate.Currency, data.ShippingMethodID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, o)
+}
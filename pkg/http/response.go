@@ -1,11 +1,14 @@
 package http
 
 import (
+	errors2 "ecommerce/pkg/ecommerce/errors"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 )
 
 type response struct {
@@ -104,5 +107,33 @@ func (r response) serverError(w http.ResponseWriter, err error) {
 	w.WriteHeader(http.StatusInternalServerError)
 }
 
+// serviceError responds with a client error for errors returned by services that the
+// client can act upon (not found, failed validation, rate limits) and a server error
+// otherwise.
+func (r response) serviceError(w http.ResponseWriter, err error) {
+	switch e := errors2.Unwrap(err).(type) {
+	case *errors2.NotFound:
+		r.clientError(w, http.StatusNotFound, "not found")
+	case *errors2.Invalid:
+		if fe, ok := e.Err.(errors2.FieldErrors); ok {
+			// field errors are sent as an object of messages keyed by field
+			r.clientError(w, http.StatusUnprocessableEntity, fe)
+			return
+		}
+		r.clientError(w, http.StatusUnprocessableEntity, e.Error())
+	case *errors2.RateLimited:
+		if e.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		}
+		r.clientError(w, http.StatusTooManyRequests, e.Error())
+	default:
+		trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+		_ = r.errorLog.Output(2, trace)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 type responseHeaders []map[string]string
 
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### RETURNS ####
+func (h Http) requestReturn(w http.ResponseWriter, r *http.Request) {
+	var ret ecommerce.Return
+	if err := decodeJSONBody(w, r, &ret); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+	ret.CustomerID = u.ID
+
+	_, err := h.ReturnService.RequestReturn(&ret)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, ret)
+}
+
+func (h Http) getCustomerReturns(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	rr, err := h.ReturnService.Returns(u.ID, r.FormValue("status"))
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if rr == nil { rr = []ecommerce.Return{} }
+
+	h.Response.respond(w, http.StatusOK, nil, rr)
+}
+
+func (h Http) getReturns(w http.ResponseWriter, r *http.Request) {
+	rr, err := h.ReturnService.Returns(0, r.FormValue("status"))
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if rr == nil { rr = []ecommerce.Return{} }
+
+	h.Response.respond(w, http.StatusOK, nil, rr)
+}
+
+func (h Http) getReturn(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(mux.Vars(r)["returnID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	ret, err := h.ReturnService.Return(returnID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, ret)
+}
+
+func (h Http) updateReturnStatus(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(mux.Vars(r)["returnID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	var data struct {
+		Status string `json:"status"`
+		Note string `json:"note"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.ReturnService.UpdateReturnStatus(returnID, u.ID, data.Status, data.Note)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) refundReturn(w http.ResponseWriter, r *http.Request) {
+	returnID, err := strconv.Atoi(mux.Vars(r)["returnID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid return id")
+		return
+	}
+
+	var data struct {
+		Amount ecommerce.Money `json:"amount"`
+		Note string `json:"note"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	ret, err := h.ReturnService.Refund(returnID, u.ID, data.Amount, data.Note)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, ret)
+}
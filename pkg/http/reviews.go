@@ -0,0 +1,164 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### REVIEWS ####
+func (h Http) createReview(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	var rv ecommerce.Review
+	if err := decodeJSONBody(w, r, &rv); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	rv.ProductID = pdtID
+	rv.CustomerID = u.ID
+
+	id, err := h.ReviewService.CreateReview(&rv)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, struct{
+		ID int `json:"id"`
+		Status string `json:"status"`
+	}{ID: id, Status: rv.Status})
+}
+
+func (h Http) getProductReviews(w http.ResponseWriter, r *http.Request) {
+	const size = 20
+
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	page, ok := pageParam(r)
+	if !ok {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid page number")
+		return
+	}
+
+	rr, err := h.ReviewService.ProductReviews(pdtID, r.FormValue("sort"), page, size)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if rr == nil { rr = []ecommerce.Review{} }
+
+	h.Response.respond(w, http.StatusOK, nil, rr)
+}
+
+func (h Http) getReviews(w http.ResponseWriter, r *http.Request) {
+	const size = 50
+
+	page, ok := pageParam(r)
+	if !ok {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid page number")
+		return
+	}
+
+	status := r.FormValue("status")
+	if status == "" {
+		status = ecommerce.ReviewStatusPending
+	}
+
+	rr, err := h.ReviewService.ReviewsByStatus(status, page, size)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if rr == nil { rr = []ecommerce.Review{} }
+
+	h.Response.respond(w, http.StatusOK, nil, rr)
+}
+
+func (h Http) moderateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["reviewID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid review id")
+		return
+	}
+
+	var data struct {
+		Status string `json:"status"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err = h.ReviewService.ModerateReview(reviewID, data.Status)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) voteReviewHelpful(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["reviewID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid review id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	count, err := h.ReviewService.VoteReviewHelpful(reviewID, u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, struct{
+		HelpfulCount int `json:"helpful_count"`
+	}{HelpfulCount: count})
+}
+
+// pageParam returns the page query parameter, which defaults to 1. It reports false
+// if the parameter is not a number.
+func pageParam(r *http.Request) (int, bool) {
+	if r.FormValue("page") == "" {
+		return 1, true
+	}
+
+	page, err := strconv.Atoi(r.FormValue("page"))
+
+	return page, err == nil
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"ecommerce/pkg/ecommerce"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	"github.com/rs/cors"
@@ -9,7 +10,12 @@ import (
 
 func (h Http) Routes() http.Handler {
 	standardMiddleWare := alice.New(h.recoverPanic , h.setReqCtxUser)
-	//authOnlyMiddleWare := alice.New(/*s.checkJWT, */s.authenticatedOnly)
+	authOnlyMiddleWare := alice.New(h.authenticatedOnly)
+	adminOnlyMiddleWare := alice.New(h.adminOnly)
+	catalogReadMiddleWare := alice.New(h.scoped(ecommerce.ScopeCatalogRead))
+	catalogWriteMiddleWare := alice.New(h.adminOrScoped(ecommerce.ScopeCatalogWrite))
+	ordersReadMiddleWare := alice.New(h.adminOrScoped(ecommerce.ScopeOrdersRead))
+	inventoryWriteMiddleWare := alice.New(h.adminOrScoped(ecommerce.ScopeInventoryWrite))
 
 	r := mux.NewRouter()
 
@@ -25,29 +31,232 @@ func (h Http) Routes() http.Handler {
 
 	r.Handle("/customers/{uid:[0-9]+}/address", http.HandlerFunc(h.getCustomerAddress))
 
+	r.Handle("/customers/{uid:[0-9]+}/addresses", authOnlyMiddleWare.ThenFunc(h.createAddress)).Methods("POST")
+
+	r.Handle("/customers/{uid:[0-9]+}/addresses", authOnlyMiddleWare.ThenFunc(h.getAddresses))
+
+	r.Handle("/customers/{uid:[0-9]+}/addresses/{addressID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.updateAddress)).Methods("PUT")
+
+	r.Handle("/customers/{uid:[0-9]+}/addresses/{addressID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.deleteAddress)).Methods("DELETE")
+
+	r.Handle("/customers/{uid:[0-9]+}/addresses/{addressID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.getAddress))
+
 	r.Handle("/customers/{uid:[0-9]+}/cart", http.HandlerFunc(h.addCartItems)).Methods("POST")
 
 	r.Handle("/customers/{uid:[0-9]+}/cart", http.HandlerFunc(h.getCartItems))
 
 	r.Handle("/customers/{uid:[0-9]+}/cart/count", http.HandlerFunc(h.cartItemCount))
 
+	r.Handle("/customers/{uid:[0-9]+}/cart/totals", authOnlyMiddleWare.ThenFunc(h.getCartTotals))
+
+	r.Handle("/customers/{uid:[0-9]+}/cart/shipping-options", authOnlyMiddleWare.ThenFunc(h.getShippingOptions))
+
+	r.Handle("/customers/{uid:[0-9]+}/cart/coupon", authOnlyMiddleWare.ThenFunc(h.applyCoupon)).Methods("POST")
+
+	r.Handle("/customers/{uid:[0-9]+}/cart/coupon/{code}", authOnlyMiddleWare.ThenFunc(h.removeCoupon)).Methods("DELETE")
+
+	r.Handle("/customers/{uid:[0-9]+}/cart/saved", authOnlyMiddleWare.ThenFunc(h.saveCartItemForLater)).Methods("POST")
+
+	r.Handle("/customers/{uid:[0-9]+}/orders", authOnlyMiddleWare.ThenFunc(h.checkout)).Methods("POST")
+
 	r.Handle("/customers/{uid:[0-9]+}/orders", http.HandlerFunc(h.getCustomerOrders))
 
+	r.Handle("/customers/{uid:[0-9]+}/orders/{orderID:[0-9]+}/tracking", authOnlyMiddleWare.ThenFunc(h.getOrderTracking))
+
+	r.Handle("/customers/{uid:[0-9]+}/returns", authOnlyMiddleWare.ThenFunc(h.requestReturn)).Methods("POST")
+
+	r.Handle("/customers/{uid:[0-9]+}/returns", authOnlyMiddleWare.ThenFunc(h.getCustomerReturns))
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists", authOnlyMiddleWare.ThenFunc(h.createWishlist)).Methods("POST")
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists", authOnlyMiddleWare.ThenFunc(h.getWishlists))
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists/{wishlistID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.updateWishlist)).Methods("PUT")
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists/{wishlistID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.deleteWishlist)).Methods("DELETE")
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists/{wishlistID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.getWishlist))
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists/{wishlistID:[0-9]+}/items", authOnlyMiddleWare.ThenFunc(h.addWishlistItem)).Methods("POST")
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists/{wishlistID:[0-9]+}/items/{itemID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.removeWishlistItem)).Methods("DELETE")
+
+	r.Handle("/customers/{uid:[0-9]+}/wishlists/{wishlistID:[0-9]+}/items/{itemID:[0-9]+}/cart", authOnlyMiddleWare.ThenFunc(h.moveWishlistItemToCart)).Methods("POST")
+
+	r.Handle("/wishlists/shared/{token:[A-Za-z0-9_-]+}", http.HandlerFunc(h.getSharedWishlist))
+
 	r.Handle("/customers/cards", http.HandlerFunc(h.getCreditCard))
 
+	r.Handle("/orders/{orderID:[0-9]+}", ordersReadMiddleWare.ThenFunc(h.getOrder))
+
+	r.Handle("/orders/{orderID:[0-9]+}/status", adminOnlyMiddleWare.ThenFunc(h.updateOrderStatus)).Methods("PUT")
+
+	r.Handle("/orders/{orderID:[0-9]+}/shipments", adminOnlyMiddleWare.ThenFunc(h.createShipment)).Methods("POST")
+
+	r.Handle("/orders/{orderID:[0-9]+}/shipments", ordersReadMiddleWare.ThenFunc(h.getShipments))
+
+	r.Handle("/orders/{orderID:[0-9]+}/shipments/{shipmentID:[0-9]+}/status", adminOnlyMiddleWare.ThenFunc(h.updateShipmentStatus)).Methods("PUT")
+
+	r.Handle("/returns", adminOnlyMiddleWare.ThenFunc(h.getReturns))
+
+	r.Handle("/returns/{returnID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.getReturn))
+
+	r.Handle("/returns/{returnID:[0-9]+}/status", adminOnlyMiddleWare.ThenFunc(h.updateReturnStatus)).Methods("PUT")
+
+	r.Handle("/returns/{returnID:[0-9]+}/refunds", adminOnlyMiddleWare.ThenFunc(h.refundReturn)).Methods("POST")
+
 	r.Handle("/users/{uid:[0-9]+}", http.HandlerFunc(h.updateCustomer)).Methods("PUT")
 
+	r.Handle("/users/{uid:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.requestAccountDeletion)).Methods("DELETE")
+
+	r.Handle("/users/{uid:[0-9]+}/deletion", authOnlyMiddleWare.ThenFunc(h.cancelAccountDeletion)).Methods("DELETE")
+
+	r.Handle("/users/{uid:[0-9]+}/export", authOnlyMiddleWare.ThenFunc(h.exportPersonalData))
+
 	r.Handle("/users/authentication", http.HandlerFunc(h.authenticate)).Methods("POST")
 
-	r.Handle("/products", http.HandlerFunc(h.getProducts))
+	r.Handle("/users/authentication/providers", http.HandlerFunc(h.getIdentityProviders))
+
+	r.Handle("/users/authentication/providers/{provider}", http.HandlerFunc(h.startExternalLogin)).Methods("POST")
+
+	r.Handle("/users/authentication/providers/{provider}/callback", http.HandlerFunc(h.completeExternalLogin)).Methods("POST")
+
+	r.Handle("/users/authentication/two-factor", http.HandlerFunc(h.authenticateTwoFactor)).Methods("POST")
+
+	r.Handle("/users/{uid:[0-9]+}/totp", authOnlyMiddleWare.ThenFunc(h.enrollTOTP)).Methods("POST")
+
+	r.Handle("/users/{uid:[0-9]+}/totp", authOnlyMiddleWare.ThenFunc(h.disableTOTP)).Methods("DELETE")
+
+	r.Handle("/users/{uid:[0-9]+}/totp/confirmation", authOnlyMiddleWare.ThenFunc(h.confirmTOTP)).Methods("POST")
+
+	r.Handle("/users/{uid:[0-9]+}/recovery-codes", authOnlyMiddleWare.ThenFunc(h.regenerateRecoveryCodes)).Methods("POST")
+
+	r.Handle("/users/{uid:[0-9]+}/email-verification", authOnlyMiddleWare.ThenFunc(h.requestEmailVerification)).Methods("POST")
+
+	r.Handle("/users/{uid:[0-9]+}/password", authOnlyMiddleWare.ThenFunc(h.changePassword)).Methods("PUT")
+
+	r.Handle("/users/{uid:[0-9]+}/sessions", authOnlyMiddleWare.ThenFunc(h.revokeOtherSessions)).Methods("DELETE")
+
+	r.Handle("/users/{uid:[0-9]+}/sessions", authOnlyMiddleWare.ThenFunc(h.getSessions))
+
+	r.Handle("/users/{uid:[0-9]+}/sessions/{sessionID:[0-9]+}", authOnlyMiddleWare.ThenFunc(h.revokeSession)).Methods("DELETE")
+
+	r.Handle("/users/{uid:[0-9]+}/login-attempts", adminOnlyMiddleWare.ThenFunc(h.getLoginAttempts))
+
+	r.Handle("/users/{uid:[0-9]+}/lockout", adminOnlyMiddleWare.ThenFunc(h.unlockLogin)).Methods("DELETE")
+
+	r.Handle("/users/email-verification", http.HandlerFunc(h.verifyEmail)).Methods("POST")
+
+	r.Handle("/users/password-reset-requests", http.HandlerFunc(h.requestPasswordReset)).Methods("POST")
+
+	r.Handle("/users/password-reset", http.HandlerFunc(h.resetPassword)).Methods("POST")
+
+	r.Handle("/api-keys", adminOnlyMiddleWare.ThenFunc(h.createAPIKey)).Methods("POST")
+
+	r.Handle("/api-keys", adminOnlyMiddleWare.ThenFunc(h.getAPIKeys))
+
+	r.Handle("/api-keys/{keyID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.revokeAPIKey)).Methods("DELETE")
+
+	r.Handle("/products", catalogWriteMiddleWare.ThenFunc(h.createProduct)).Methods("POST")
+
+	r.Handle("/products", catalogReadMiddleWare.ThenFunc(h.getProducts))
+
+	r.Handle("/products/facets", catalogReadMiddleWare.ThenFunc(h.getProductFacets))
+
+	r.Handle("/products/{productID:[0-9]+}", catalogWriteMiddleWare.ThenFunc(h.updateProduct)).Methods("PUT")
+
+	r.Handle("/products/{productID:[0-9]+}", catalogReadMiddleWare.ThenFunc(h.getProduct))
+
+	r.Handle("/products/{productID:[0-9]+}/options", catalogWriteMiddleWare.ThenFunc(h.createProductOption)).Methods("POST")
+
+	r.Handle("/products/{productID:[0-9]+}/variants", catalogWriteMiddleWare.ThenFunc(h.createProductVariant)).Methods("POST")
+
+	r.Handle("/products/{productID:[0-9]+}/variants/{variantID:[0-9]+}", catalogWriteMiddleWare.ThenFunc(h.updateProductVariant)).Methods("PUT")
+
+	r.Handle("/products/{productID:[0-9]+}/variants/{variantID:[0-9]+}", catalogWriteMiddleWare.ThenFunc(h.deleteProductVariant)).Methods("DELETE")
+
+	r.Handle("/products/{productID:[0-9]+}/variants/{variantID:[0-9]+}/quantity", inventoryWriteMiddleWare.ThenFunc(h.setVariantQuantity)).Methods("PUT")
+
+	r.Handle("/products/{productID:[0-9]+}/images", catalogWriteMiddleWare.ThenFunc(h.uploadProductImage)).Methods("POST")
+
+	r.Handle("/products/{productID:[0-9]+}/images/order", catalogWriteMiddleWare.ThenFunc(h.reorderProductImages)).Methods("PUT")
+
+	r.Handle("/products/{productID:[0-9]+}/images/{imageID:[0-9]+}", catalogWriteMiddleWare.ThenFunc(h.deleteProductImage)).Methods("DELETE")
+
+	r.Handle("/products/{productID:[0-9]+}/reviews", authOnlyMiddleWare.ThenFunc(h.createReview)).Methods("POST")
+
+	r.Handle("/products/{productID:[0-9]+}/reviews", http.HandlerFunc(h.getProductReviews))
+
+	r.Handle("/products/{productID:[0-9]+}/subscriptions", http.HandlerFunc(h.subscribe)).Methods("POST")
+
+	r.Handle("/subscriptions/unsubscribe", http.HandlerFunc(h.unsubscribe))
+
+	r.Handle("/reviews", adminOnlyMiddleWare.ThenFunc(h.getReviews))
+
+	r.Handle("/reviews/{reviewID:[0-9]+}/status", adminOnlyMiddleWare.ThenFunc(h.moderateReview)).Methods("PUT")
+
+	r.Handle("/reviews/{reviewID:[0-9]+}/helpful", authOnlyMiddleWare.ThenFunc(h.voteReviewHelpful)).Methods("POST")
+
+	r.Handle("/promotions", adminOnlyMiddleWare.ThenFunc(h.createPromotion)).Methods("POST")
+
+	r.Handle("/promotions", adminOnlyMiddleWare.ThenFunc(h.getPromotions))
+
+	r.Handle("/promotions/{promotionID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.updatePromotion)).Methods("PUT")
+
+	r.Handle("/promotions/{promotionID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.getPromotion))
+
+	r.Handle("/exchange-rates", http.HandlerFunc(h.getExchangeRates))
+
+	r.Handle("/exchange-rates/import", adminOnlyMiddleWare.ThenFunc(h.importExchangeRates)).Methods("POST")
+
+	r.Handle("/exchange-rates/{currency:[A-Za-z]{3}}", adminOnlyMiddleWare.ThenFunc(h.setExchangeRate)).Methods("PUT")
+
+	r.Handle("/exchange-rates/{currency:[A-Za-z]{3}}", adminOnlyMiddleWare.ThenFunc(h.deleteExchangeRate)).Methods("DELETE")
+
+	r.Handle("/tax-rates", adminOnlyMiddleWare.ThenFunc(h.createTaxRate)).Methods("POST")
+
+	r.Handle("/tax-rates", adminOnlyMiddleWare.ThenFunc(h.getTaxRates))
+
+	r.Handle("/tax-rates/{rateID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.updateTaxRate)).Methods("PUT")
+
+	r.Handle("/tax-rates/{rateID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.deleteTaxRate)).Methods("DELETE")
+
+	r.Handle("/shipping-zones", adminOnlyMiddleWare.ThenFunc(h.createShippingZone)).Methods("POST")
+
+	r.Handle("/shipping-zones", adminOnlyMiddleWare.ThenFunc(h.getShippingZones))
+
+	r.Handle("/shipping-zones/{zoneID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.updateShippingZone)).Methods("PUT")
+
+	r.Handle("/shipping-zones/{zoneID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.deleteShippingZone)).Methods("DELETE")
+
+	r.Handle("/shipping-zones/{zoneID:[0-9]+}/methods", adminOnlyMiddleWare.ThenFunc(h.createShippingMethod)).Methods("POST")
+
+	r.Handle("/shipping-zones/{zoneID:[0-9]+}/methods/{methodID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.updateShippingMethod)).Methods("PUT")
+
+	r.Handle("/shipping-zones/{zoneID:[0-9]+}/methods/{methodID:[0-9]+}", adminOnlyMiddleWare.ThenFunc(h.deleteShippingMethod)).Methods("DELETE")
+
+	r.Handle("/media/{key:.+}", http.HandlerFunc(h.getMedia)).Methods("GET")
+
+	r.Handle("/categories", catalogWriteMiddleWare.ThenFunc(h.createCategory)).Methods("POST")
+
+	r.Handle("/categories", catalogReadMiddleWare.ThenFunc(h.getCategories))
+
+	r.Handle("/categories/{categoryID:[0-9]+}", catalogReadMiddleWare.ThenFunc(h.getCategory))
+
+	r.Handle("/categories/{categoryID:[0-9]+}/parent", catalogWriteMiddleWare.ThenFunc(h.moveCategory)).Methods("PUT")
+
+	r.Handle("/categories/{categoryID:[0-9]+}/attributes", catalogWriteMiddleWare.ThenFunc(h.createAttributeDefinition)).Methods("POST")
 
-	r.Handle("/products/{productID:[0-9]+}", http.HandlerFunc(h.getProduct))
+	r.Handle("/categories/{categoryID:[0-9]+}/attributes", catalogReadMiddleWare.ThenFunc(h.getAttributeDefinitions))
 
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"http://localhost:4200", "*"}, // todo:: adjust before production
+		// browsers only send cookies cross origin if the origin is echoed, never with *
+		AllowedOrigins: h.AllowedOrigins,
 		AllowedMethods: []string{"GET", "POST", "DELETE", "PUT"},
 		//AllowedHeaders: []string{"Authorization", "User-Agent", "Sec-Fetch-Dest", "Referer", "Content-Type", "Accept"},
 		AllowedHeaders: []string{"*"},
+		// external logins are bound to the browser with a cookie, see startExternalLogin
+		AllowCredentials: true,
 	})
 	return c.Handler(standardMiddleWare.Then(r))
 	//return cors.Default().Handler(globalMiddleware.Then(r))
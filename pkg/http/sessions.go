@@ -0,0 +1,69 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### SESSIONS ####
+func (h Http) getSessions(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	ss, err := h.UserService.Sessions(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	for i := range ss {
+		ss[i].Current = ss[i].ID == u.SessionID
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, ss)
+}
+
+// revokeSession logs out a session of the user, which may be the current one.
+func (h Http) revokeSession(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	sid, err := strconv.Atoi(mux.Vars(r)["sessionID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	err = h.UserService.RevokeSession(u.ID, sid)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+// revokeOtherSessions logs out the sessions of the user but the current one.
+func (h Http) revokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err := h.UserService.RevokeOtherSessions(u.ID, u.SessionID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### SHIPMENTS ####
+func (h Http) createShipment(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	var sh ecommerce.Shipment
+	if err := decodeJSONBody(w, r, &sh); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	sh.OrderID = orderID
+
+	_, err = h.FulfilmentService.CreateShipment(&sh)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, sh)
+}
+
+func (h Http) getShipments(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	ss, err := h.FulfilmentService.Shipments(orderID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if ss == nil { ss = []ecommerce.Shipment{} }
+
+	h.Response.respond(w, http.StatusOK, nil, ss)
+}
+
+func (h Http) updateShipmentStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	shipmentID, err := strconv.Atoi(mux.Vars(r)["shipmentID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipment id")
+		return
+	}
+
+	var data struct {
+		Status string `json:"status"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err = h.FulfilmentService.UpdateShipmentStatus(orderID, shipmentID, data.Status)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) getOrderTracking(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["orderID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+
+	t, err := h.FulfilmentService.Tracking(u.ID, orderID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, t)
+}
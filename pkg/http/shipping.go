@@ -0,0 +1,196 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### SHIPPING ####
+func (h Http) getShippingOptions(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	rate, err := h.displayRate(r)
+	if err != nil {
+		h.rateError(w, err)
+		return
+	}
+
+	qq, err := h.CheckoutService.ShippingOptions(u.ID, rate.Currency)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if qq == nil { qq = []ecommerce.ShippingQuote{} }
+
+	h.Response.respond(w, http.StatusOK, nil, qq)
+}
+
+func (h Http) getShippingZones(w http.ResponseWriter, r *http.Request) {
+	zz, err := h.ShippingService.Zones()
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if zz == nil { zz = []ecommerce.ShippingZone{} }
+
+	h.Response.respond(w, http.StatusOK, nil, zz)
+}
+
+func (h Http) createShippingZone(w http.ResponseWriter, r *http.Request) {
+	var z ecommerce.ShippingZone
+	if err := decodeJSONBody(w, r, &z); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	_, err := h.ShippingService.CreateZone(&z)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, z)
+}
+
+func (h Http) updateShippingZone(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := strconv.Atoi(mux.Vars(r)["zoneID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping zone id")
+		return
+	}
+
+	var z ecommerce.ShippingZone
+	if err := decodeJSONBody(w, r, &z); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	z.ID = zoneID
+
+	err = h.ShippingService.UpdateZone(&z)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, z)
+}
+
+func (h Http) deleteShippingZone(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := strconv.Atoi(mux.Vars(r)["zoneID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping zone id")
+		return
+	}
+
+	err = h.ShippingService.DeleteZone(zoneID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) createShippingMethod(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := strconv.Atoi(mux.Vars(r)["zoneID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping zone id")
+		return
+	}
+
+	var m ecommerce.ShippingMethod
+	if err := decodeJSONBody(w, r, &m); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	m.ZoneID = zoneID
+
+	_, err = h.ShippingService.CreateMethod(&m)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, m)
+}
+
+func (h Http) updateShippingMethod(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := strconv.Atoi(mux.Vars(r)["zoneID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping zone id")
+		return
+	}
+
+	methodID, err := strconv.Atoi(mux.Vars(r)["methodID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping method id")
+		return
+	}
+
+	var m ecommerce.ShippingMethod
+	if err := decodeJSONBody(w, r, &m); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	m.ID = methodID
+	m.ZoneID = zoneID
+
+	err = h.ShippingService.UpdateMethod(&m)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, m)
+}
+
+func (h Http) deleteShippingMethod(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := strconv.Atoi(mux.Vars(r)["zoneID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping zone id")
+		return
+	}
+
+	methodID, err := strconv.Atoi(mux.Vars(r)["methodID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid shipping method id")
+		return
+	}
+
+	err = h.ShippingService.DeleteMethod(zoneID, methodID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### SUBSCRIPTIONS ####
+func (h Http) subscribe(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var s ecommerce.Subscription
+	if err := decodeJSONBody(w, r, &s); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	s.ID = 0
+	s.ProductID = pdtID
+
+	// signed in customers are subscribed with their own address unless they give another
+	if u, ok := ecommerce.UserFromContext(r.Context()); ok && s.Email == "" {
+		customer, err := h.UserService.User(u.ID)
+		if err != nil {
+			h.Response.serviceError(w, err)
+			return
+		}
+		s.Email = customer.Email
+	}
+
+	_, err = h.SubscriptionService.Subscribe(&s)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, s)
+}
+
+// unsubscribe is linked to from alert emails, so it takes the token from the query
+// string and answers GET requests.
+func (h Http) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	if token == "" {
+		h.Response.clientError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	err := h.SubscriptionService.Unsubscribe(token)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### TAX RATES ####
+func (h Http) getTaxRates(w http.ResponseWriter, r *http.Request) {
+	rr, err := h.TaxService.Rates(r.FormValue("country"))
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	if rr == nil { rr = []ecommerce.TaxRate{} }
+
+	h.Response.respond(w, http.StatusOK, nil, rr)
+}
+
+func (h Http) createTaxRate(w http.ResponseWriter, r *http.Request) {
+	var rate ecommerce.TaxRate
+	if err := decodeJSONBody(w, r, &rate); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	_, err := h.TaxService.CreateRate(&rate)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, rate)
+}
+
+func (h Http) updateTaxRate(w http.ResponseWriter, r *http.Request) {
+	rateID, err := strconv.Atoi(mux.Vars(r)["rateID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid tax rate id")
+		return
+	}
+
+	var rate ecommerce.TaxRate
+	if err := decodeJSONBody(w, r, &rate); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	rate.ID = rateID
+
+	err = h.TaxService.UpdateRate(&rate)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, rate)
+}
+
+func (h Http) deleteTaxRate(w http.ResponseWriter, r *http.Request) {
+	rateID, err := strconv.Atoi(mux.Vars(r)["rateID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid tax rate id")
+		return
+	}
+
+	err = h.TaxService.DeleteRate(rateID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
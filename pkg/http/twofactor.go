@@ -0,0 +1,125 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"net/http"
+)
+
+// #### TWO-FACTOR AUTHENTICATION ####
+func (h Http) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	e, err := h.UserService.EnrollTOTP(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, e)
+}
+
+// confirmTOTP responds with the recovery codes and a new auth token, since the user
+// just proved the second factor.
+func (h Http) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Code string `json:"code"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	codes, err := h.UserService.ConfirmTOTP(u.ID, data.Code)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	u.TwoFactor = true
+	authToken, err := u.AuthToken()
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+		AuthorizationToken string `json:"auth_token"`
+	}{RecoveryCodes: codes, AuthorizationToken: authToken})
+}
+
+func (h Http) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Password string `json:"password"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err := h.UserService.DisableTOTP(u.ID, data.Password)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Code string `json:"code"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	codes, err := h.UserService.RegenerateRecoveryCodes(u.ID, data.Code)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{RecoveryCodes: codes})
+}
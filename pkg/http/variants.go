@@ -0,0 +1,168 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### PRODUCT OPTIONS AND VARIANTS ####
+func (h Http) createProductOption(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var data struct {
+		Name   string   `json:"name"`
+		Values []string `json:"values"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	o := &ecommerce.ProductOption{Name: data.Name}
+	for _, v := range data.Values {
+		o.Values = append(o.Values, ecommerce.ProductOptionValue{Value: v})
+	}
+
+	_, err = h.ProductService.CreateOption(pdtID, o)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, o)
+}
+
+func (h Http) createProductVariant(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var v ecommerce.ProductVariant
+	if err := decodeJSONBody(w, r, &v); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	id, err := h.ProductService.CreateVariant(pdtID, &v)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, struct{
+		ID int `json:"id"`
+	}{ID:id})
+}
+
+func (h Http) updateProductVariant(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	variantID, err := strconv.Atoi(mux.Vars(r)["variantID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid variant id")
+		return
+	}
+
+	var v ecommerce.ProductVariant
+	if err := decodeJSONBody(w, r, &v); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	v.ID = variantID
+	v.ProductID = pdtID
+
+	err = h.ProductService.UpdateVariant(&v)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+// setVariantQuantity sets the stock of a variant, for inventory systems that only
+// manage stock.
+func (h Http) setVariantQuantity(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	variantID, err := strconv.Atoi(mux.Vars(r)["variantID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid variant id")
+		return
+	}
+
+	var data struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	err = h.ProductService.SetVariantQuantity(pdtID, variantID, data.Quantity)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) deleteProductVariant(w http.ResponseWriter, r *http.Request) {
+	pdtID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	variantID, err := strconv.Atoi(mux.Vars(r)["variantID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid variant id")
+		return
+	}
+
+	err = h.ProductService.DeleteVariant(pdtID, variantID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
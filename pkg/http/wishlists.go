@@ -0,0 +1,278 @@
+package http
+
+import (
+	"ecommerce/pkg/ecommerce"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// #### WISHLISTS ####
+func (h Http) createWishlist(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	wl, err := h.WishlistService.CreateWishlist(u.ID, data.Name)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, wl)
+}
+
+func (h Http) getWishlists(w http.ResponseWriter, r *http.Request) {
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	ww, err := h.WishlistService.Wishlists(u.ID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	if ww == nil { ww = []ecommerce.Wishlist{} }
+
+	h.Response.respond(w, http.StatusOK, nil, ww)
+}
+
+func (h Http) getWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["wishlistID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid wishlist id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	wl, err := h.WishlistService.Wishlist(u.ID, wishlistID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, wl)
+}
+
+func (h Http) updateWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["wishlistID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid wishlist id")
+		return
+	}
+
+	var wl ecommerce.Wishlist
+	if err := decodeJSONBody(w, r, &wl); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+	wl.ID = wishlistID
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.WishlistService.UpdateWishlist(u.ID, &wl)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, wl)
+}
+
+func (h Http) deleteWishlist(w http.ResponseWriter, r *http.Request) {
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["wishlistID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid wishlist id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.WishlistService.DeleteWishlist(u.ID, wishlistID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) addWishlistItem(w http.ResponseWriter, r *http.Request) {
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["wishlistID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid wishlist id")
+		return
+	}
+
+	var data struct {
+		ProductID int `json:"product_id"`
+		VariantID int `json:"variant_id"`
+		Quantity int `json:"quantity"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	item := ecommerce.WishlistItem{Product: ecommerce.Product{ID: data.ProductID}, VariantID: data.VariantID, Quantity: data.Quantity}
+	_, err = h.WishlistService.AddWishlistItem(u.ID, wishlistID, &item)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusCreated, nil, item)
+}
+
+func (h Http) removeWishlistItem(w http.ResponseWriter, r *http.Request) {
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["wishlistID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid wishlist id")
+		return
+	}
+
+	itemID, err := strconv.Atoi(mux.Vars(r)["itemID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.WishlistService.RemoveWishlistItem(u.ID, wishlistID, itemID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, nil)
+}
+
+func (h Http) moveWishlistItemToCart(w http.ResponseWriter, r *http.Request) {
+	wishlistID, err := strconv.Atoi(mux.Vars(r)["wishlistID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid wishlist id")
+		return
+	}
+
+	itemID, err := strconv.Atoi(mux.Vars(r)["itemID"])
+	if err != nil {
+		h.Response.clientError(w, http.StatusBadRequest, "invalid item id")
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	err = h.WishlistService.MoveToCart(u.ID, wishlistID, itemID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	count, err := h.UserService.CartItemCount(u.ID)
+	if err != nil {
+		h.Response.serverError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, struct {
+		Count int `json:"count"`
+	}{Count: count})
+}
+
+func (h Http) saveCartItemForLater(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		ProductID int `json:"product_id"`
+		VariantID int `json:"variant_id"`
+		WishlistID int `json:"wishlist_id"`
+	}
+	if err := decodeJSONBody(w, r, &data); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			h.Response.clientError(w, mr.status, mr.msg)
+		} else {
+			h.Response.serverError(w, err)
+		}
+		return
+	}
+
+	u, ok := ecommerce.UserFromContext(r.Context())
+	if !ok {
+		h.Response.serverError(w, ErrUserNotFoundInRequestCtx)
+		return
+	}
+
+	item, err := h.WishlistService.SaveForLater(u.ID, data.ProductID, data.VariantID, data.WishlistID)
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, item)
+}
+
+func (h Http) getSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	wl, err := h.WishlistService.SharedWishlist(mux.Vars(r)["token"])
+	if err != nil {
+		h.Response.serviceError(w, err)
+		return
+	}
+
+	h.Response.respond(w, http.StatusOK, nil, wl)
+}
@@ -14,7 +14,9 @@ func New() ecommerce.Email {
 
 type email struct {}
 
-func (e *email) Send(msg string) error {
+// Send writes the HTML body of m to a file in /tmp/emails, with the recipient and
+// subject in a comment at the top.
+func (e *email) Send(m *ecommerce.EmailMessage) error {
 	// make directory if not exist
 	err := os.MkdirAll("/tmp/emails", os.ModePerm)
 	if err != nil {
@@ -22,10 +24,14 @@ func (e *email) Send(msg string) error {
 	}
 
 	// write file
-	err = ioutil.WriteFile(fmt.Sprintf("/tmp/emails/email-%d.html", time.Now().UnixNano()), []byte(msg), 0644)
+	err = ioutil.WriteFile(fmt.Sprintf("/tmp/emails/email-%d.html", time.Now().UnixNano()), []byte(msg(m)), 0644)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func msg(m *ecommerce.EmailMessage) string {
+	return fmt.Sprintf("<!--\nTo: %s\nSubject: %s\n-->\n%s", m.To, m.Subject, m.HTML)
+}
@@ -46,7 +46,7 @@ func (m *Mock) createCategories(number int) ([]int, error) {
 
 	for i := 0; i < number; i++ {
 		name := faker.Commerce().Department()
-		id, err := m.ProductService.CreateCategory(name)
+		id, err := m.ProductService.CreateCategory(&ecommerce.Category{Name: name})
 		if err != nil {
 			return nil, err
 		}
@@ -62,7 +62,7 @@ func (m *Mock) createProducts(categoryIDs []int, number int) error {
 			p := &ecommerce.Product{
 				Name:        faker.Commerce().ProductName(),
 				CategoryID:  catID,
-				Price:       ecommerce.Price{Current: faker.Commerce().Price()},
+				Price:       ecommerce.Price{Current: ecommerce.NewMoney(int64(faker.RandomInt(100, 100000)), ecommerce.DefaultCurrency)},
 				Description: strings.Join(faker.Lorem().Paragraphs(3), "\n"),
 				Quantity:    faker.RandomInt(10, 1000),
 			}
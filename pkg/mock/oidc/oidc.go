@@ -0,0 +1,173 @@
+// Package oidc is a stub OpenID Connect provider for tests and local development. It
+// logs in whoever it is told to without asking and issues ID tokens signed with a key
+// it generates.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"ecommerce/pkg/ecommerce"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Provider serves the discovery document, keys, authorization and token endpoints of
+// a provider at Issuer, which has to be set to the URL it is served at.
+type Provider struct {
+	Issuer string
+	ClientID string
+	ClientSecret string
+	// Audience is who ID tokens are issued to, the client if empty. Tests set it to
+	// check that tokens for other clients are rejected.
+	Audience string
+
+	key *rsa.PrivateKey
+	kid string
+
+	mu sync.Mutex
+	// user is who logs in at the authorization endpoint.
+	user ecommerce.IdentityClaims
+	grants map[string]grant
+}
+
+// grant is an authorization code that was issued and not redeemed yet.
+type grant struct {
+	user ecommerce.IdentityClaims
+	redirectURI string
+	nonce string
+	codeChallenge string
+}
+
+// NewProvider returns a provider for the client with clientID and clientSecret.
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{ClientID: clientID, ClientSecret: clientSecret, key: key, kid: "stub-1", grants: map[string]grant{}}, nil
+}
+
+// LogIn makes u the user who logs in at the authorization endpoint.
+func (p *Provider) LogIn(u ecommerce.IdentityClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.user = u
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer": p.Issuer,
+			"authorization_endpoint": p.Issuer + "/authorize",
+			"token_endpoint": p.Issuer + "/token",
+			"jwks_uri": p.Issuer + "/jwks",
+		})
+	case "/jwks":
+		e := big.NewInt(int64(p.key.E)).Bytes()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": p.kid,
+			"n": base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(e),
+		}}})
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorize logs in the user at once and sends them back with a code.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	code := hex.EncodeToString(buf)
+
+	p.mu.Lock()
+	p.grants[code] = grant{user: p.user, redirectURI: q.Get("redirect_uri"), nonce: q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge")}
+	p.mu.Unlock()
+
+	v := url.Values{}
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+v.Encode(), http.StatusFound)
+}
+
+// token redeems a code once for an ID token, checking the client and PKCE verifier.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if id, _ = url.QueryUnescape(id); !ok || id != p.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if secret, _ = url.QueryUnescape(secret); secret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.grants[r.PostFormValue("code")]
+	delete(p.grants, r.PostFormValue("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	aud := p.Audience
+	if aud == "" {
+		aud = p.ClientID
+	}
+
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": p.Issuer,
+		"sub": g.user.Subject,
+		"aud": []string{aud},
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+		"nonce": g.nonce,
+		"email": g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"given_name": g.user.GivenName,
+		"family_name": g.user.FamilyName,
+	})
+	t.Header["kid"] = p.kid
+
+	idToken, err := t.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access_token": "stub", "token_type": "Bearer", "expires_in": 3600,
+		"id_token": idToken})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,338 @@
+// Package oidc logs users in with OpenID Connect providers using the authorization
+// code flow with PKCE. The configuration of a provider is discovered from its issuer
+// URL, and ID tokens are verified with the RSA keys the provider publishes.
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"ecommerce/pkg/ecommerce"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config is the configuration of a provider.
+type Config struct {
+	Name string `json:"name"`
+	Issuer string `json:"issuer"`
+	ClientID string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL is where the provider sends users back to, a page of the shop front
+	// end that passes the code and state on to the API.
+	RedirectURL string `json:"redirect_url"`
+}
+
+// ReadConfig reads a JSON list of provider configurations from r. Providers without a
+// redirect URL get the one returned by defaultRedirectURL for their name.
+func ReadConfig(r io.Reader, defaultRedirectURL func(name string) string) ([]Config, error) {
+	var cc []Config
+	if err := json.NewDecoder(r).Decode(&cc); err != nil {
+		return nil, err
+	}
+
+	for i := range cc {
+		if cc[i].Name == "" || cc[i].Issuer == "" || cc[i].ClientID == "" {
+			return nil, fmt.Errorf("provider %d needs a name, issuer and client id", i+1)
+		}
+		if cc[i].RedirectURL == "" {
+			cc[i].RedirectURL = defaultRedirectURL(cc[i].Name)
+		}
+	}
+
+	return cc, nil
+}
+
+// New returns the provider with c. Its configuration is discovered on first use.
+func New(c Config, client *http.Client) ecommerce.IdentityProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &provider{config: c, client: client}
+}
+
+// CodeChallenge returns the S256 PKCE code challenge of verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type provider struct {
+	config Config
+	client *http.Client
+
+	mu sync.Mutex
+	discovery *discovery
+	keys map[string]*rsa.PublicKey
+}
+
+// discovery is the part of the OpenID provider metadata that is used.
+type discovery struct {
+	Issuer string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+func (p *provider) AuthURL(state, nonce, codeVerifier string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", "openid email profile")
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", CodeChallenge(codeVerifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+func (p *provider) Exchange(code, codeVerifier, nonce string) (*ecommerce.IdentityClaims, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic, the default client authentication of OpenID Connect
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	} else if token.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s", token.Error, token.ErrorDescription)
+	} else if res.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint responded %s without an id token", res.Status)
+	}
+
+	return p.verify(d, token.IDToken, nonce)
+}
+
+// idClaims are the claims of an ID token that are used.
+type idClaims struct {
+	Issuer string `json:"iss"`
+	Subject string `json:"sub"`
+	Audience audience `json:"aud"`
+	ExpiresAt int64 `json:"exp"`
+	Nonce string `json:"nonce"`
+	Email string `json:"email"`
+	EmailVerified boolish `json:"email_verified"`
+	GivenName string `json:"given_name"`
+	FamilyName string `json:"family_name"`
+}
+
+// Valid is called by jwt.Parse, the claims that depend on the provider are checked
+// by verify.
+func (c *idClaims) Valid() error {
+	if time.Now().Unix() >= c.ExpiresAt {
+		return errors.New("id token is expired")
+	}
+
+	return nil
+}
+
+// verify returns the claims of idToken if it is signed by the provider with d, issued
+// by it for the client and has nonce.
+func (p *provider) verify(d *discovery, idToken, nonce string) (*ecommerce.IdentityClaims, error) {
+	c := &idClaims{}
+	_, err := jwt.ParseWithClaims(idToken, c, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(d, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.Issuer != d.Issuer:
+		return nil, fmt.Errorf("id token issued by %q, wanted %q", c.Issuer, d.Issuer)
+	case !c.Audience.contains(p.config.ClientID):
+		return nil, errors.New("id token is not for this client")
+	case nonce == "" || c.Nonce != nonce:
+		return nil, errors.New("id token nonce does not match")
+	case c.Subject == "":
+		return nil, errors.New("id token has no subject")
+	}
+
+	return &ecommerce.IdentityClaims{
+		Subject: c.Subject,
+		Email: c.Email,
+		EmailVerified: bool(c.EmailVerified),
+		GivenName: c.GivenName,
+		FamilyName: c.FamilyName,
+	}, nil
+}
+
+// discover returns the configuration of the provider, fetched once.
+func (p *provider) discover() (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	issuer := strings.TrimRight(p.config.Issuer, "/")
+	if err := p.get(issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != p.config.Issuer && d.Issuer != issuer {
+		return nil, fmt.Errorf("provider claims to be issuer %q, configured as %q", d.Issuer, p.config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("provider configuration is incomplete")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the key of the provider with id kid. The keys are fetched again for an
+// unknown id, since providers rotate their keys.
+func (p *provider) key(d *discovery, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N string `json:"n"`
+			E string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.get(d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// get decodes the JSON document at u into v.
+func (p *provider) get(u string, v interface{}) error {
+	res, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, res.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
+
+// audience is the aud claim, which is a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// boolish is the email_verified claim, which some providers send as a string.
+type boolish bool
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case bool:
+		*b = boolish(v)
+	case string:
+		*b = v == "true"
+	}
+
+	return nil
+}
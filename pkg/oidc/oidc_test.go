@@ -0,0 +1,118 @@
+package oidc
+
+import (
+	"ecommerce/pkg/ecommerce"
+	stub "ecommerce/pkg/mock/oidc"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const verifier = "dBjftJeZ4CK-P1Ahv9Gsvx5xbFJ0jX0ZorV0GEvVTnI"
+
+// setup returns a provider for a stub provider that logs in ada, and the stub.
+func setup(t *testing.T) (*provider, *stub.Provider) {
+	s, err := stub.NewProvider("shop", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	s.Issuer = srv.URL
+	s.LogIn(ecommerce.IdentityClaims{Subject: "1234", Email: "ada@example.com", EmailVerified: true, GivenName: "Ada",
+		FamilyName: "Lovelace"})
+
+	p := New(Config{Name: "stub", Issuer: srv.URL, ClientID: "shop", ClientSecret: "secret",
+		RedirectURL: "https://shop.example/login/stub"}, srv.Client())
+
+	return p.(*provider), s
+}
+
+// authorize sends the user to the provider with state and nonce and returns the code
+// they are sent back with.
+func authorize(t *testing.T, p *provider, state, nonce string) string {
+	u, err := p.AuthURL(state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(back.String(), "https://shop.example/login/stub?") {
+		t.Fatalf("wanted to be sent back to the redirect url, got %q (%v)", res.Header.Get("Location"), err)
+	}
+	if back.Query().Get("state") != state {
+		t.Fatalf("wanted state %q back, got %q", state, back.Query().Get("state"))
+	}
+
+	return back.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	p, _ := setup(t)
+
+	code := authorize(t, p, "state1", "nonce1")
+	c, err := p.Exchange(code, verifier, "nonce1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "1234" || c.Email != "ada@example.com" || !c.EmailVerified || c.GivenName != "Ada" {
+		t.Fatalf("wanted the claims of ada, got %+v", c)
+	}
+
+	if _, err = p.Exchange(code, verifier, "nonce1"); err == nil {
+		t.Fatal("wanted an error redeeming a code twice")
+	}
+}
+
+func TestExchangeChecksNonce(t *testing.T) {
+	p, _ := setup(t)
+
+	code := authorize(t, p, "state1", "nonce1")
+	if _, err := p.Exchange(code, verifier, "nonce2"); err == nil {
+		t.Fatal("wanted an error for an id token with another nonce")
+	}
+}
+
+func TestExchangeChecksCodeVerifier(t *testing.T) {
+	p, _ := setup(t)
+
+	code := authorize(t, p, "state1", "nonce1")
+	if _, err := p.Exchange(code, "another verifier of enough length for pkce", "nonce1"); err == nil {
+		t.Fatal("wanted an error for a wrong code verifier")
+	}
+}
+
+func TestExchangeChecksAudience(t *testing.T) {
+	p, s := setup(t)
+
+	// a token the provider issued to another client is rejected even if signed by it
+	s.Audience = "other"
+	code := authorize(t, p, "state1", "nonce1")
+	if _, err := p.Exchange(code, verifier, "nonce1"); err == nil || !strings.Contains(err.Error(), "client") {
+		t.Fatalf("wanted an error for an id token of another client, got %v", err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	cc, err := ReadConfig(strings.NewReader(`[{"name": "google", "issuer": "https://accounts.google.com", "client_id": "id"}]`),
+		func(name string) string { return "https://shop.example/login/" + name })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc) != 1 || cc[0].RedirectURL != "https://shop.example/login/google" {
+		t.Fatalf("wanted the default redirect url, got %+v", cc)
+	}
+
+	if _, err = ReadConfig(strings.NewReader(`[{"name": "google"}]`), nil); err == nil {
+		t.Fatal("wanted an error for a provider without issuer")
+	}
+}
@@ -0,0 +1,200 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"ecommerce/pkg/ecommerce"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	smtp2 "net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeout is how long sending a message may take at most, from connecting to the
+// server to quitting, so that a server that hangs does not hold up the outbox, which
+// keeps the messages it sends locked.
+const timeout = 30 * time.Second
+
+// New returns an ecommerce.Email that sends messages from the address from through
+// the SMTP server at addr (host:port). The server is authenticated with if username
+// is not empty, which net/smtp only does over TLS or to localhost.
+func New(addr, username, password, from string) ecommerce.Email {
+	e := &email{addr: addr, from: from, timeout: timeout}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		e.auth = smtp2.PlainAuth("", username, password, host)
+	}
+
+	return e
+}
+
+type email struct {
+	addr string
+	auth smtp2.Auth
+	from string
+	timeout time.Duration
+}
+
+func (e *email) Send(m *ecommerce.EmailMessage) error {
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(e.from)
+	if err != nil {
+		return err
+	}
+
+	msg, err := message(from, to, m)
+	if err != nil {
+		return err
+	}
+
+	return e.send(from.Address, to.Address, msg)
+}
+
+// send sends msg like smtp.SendMail does, but gives up once e.timeout passed.
+func (e *email) send(from, to string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", e.addr, e.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(e.timeout)); err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(e.addr)
+	c, err := smtp2.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server does not support AUTH")
+		}
+		if err = c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns m as a multipart/alternative MIME message with a text and an HTML part.
+func message(from, to *mail.Address, m *ecommerce.EmailMessage) ([]byte, error) {
+	var b bytes.Buffer
+	body := multipart.NewWriter(&b)
+
+	headers := map[string]string{
+		"From": from.String(),
+		"To": to.String(),
+		"Subject": mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date": time.Now().Format(time.RFC1123Z),
+		"Message-Id": messageID(from),
+		"Mime-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + body.Boundary(),
+	}
+	for k, v := range m.Headers {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		if _, ok := headers[k]; ok {
+			return nil, fmt.Errorf("header %s cannot be set", k)
+		}
+		headers[k] = v
+	}
+
+	keys := make([]string, 0, len(headers))
+	for k, v := range headers {
+		if strings.ContainsAny(k + v, "\r\n") || strings.ContainsAny(k, ": ") {
+			return nil, errors.New("headers cannot contain line breaks")
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var msg bytes.Buffer
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(&msg, "%s: %s\r\n", k, headers[k])
+	}
+	_, _ = msg.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	_, _ = msg.Write(b.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// messageID returns a random message id in the domain of from.
+func messageID(from *mail.Address) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+
+	return "<" + hex.EncodeToString(buf) + "@" + domain + ">"
+}
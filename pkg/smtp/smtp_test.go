@@ -0,0 +1,192 @@
+package smtp
+
+import (
+	"bufio"
+	"ecommerce/pkg/ecommerce"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is a message the test server accepted.
+type received struct {
+	from string
+	to []string
+	data string
+}
+
+// serve accepts one SMTP session on l and sends the message of it to out. The server
+// does not offer any extensions, so the client neither authenticates nor starts TLS.
+func serve(t *testing.T, l net.Listener, out chan<- received) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	c := textproto.NewConn(conn)
+	var r received
+	reply := func(line string) {
+		if err := c.PrintfLine("%s", line); err != nil {
+			t.Error(err)
+		}
+	}
+
+	reply("220 localhost test server")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			r.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			r.to = append(r.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			r.data = string(data)
+			reply("250 OK")
+			out <- r
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	out := make(chan received, 1)
+	go serve(t, l, out)
+
+	e := New(l.Addr().String(), "", "", "Shop <shop@example.com>")
+	err = e.Send(&ecommerce.EmailMessage{
+		To: "ada@example.com",
+		Subject: "Your order #7 – confirmed",
+		Text: "Hi Ada,\n\nthank you for your order.\n",
+		HTML: "<p>Hi Ada,</p><p>thank you for your order.</p>",
+		Headers: map[string]string{"Auto-Submitted": "auto-generated"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-out
+	if r.from != "shop@example.com" || len(r.to) != 1 || r.to[0] != "ada@example.com" {
+		t.Fatalf("wanted envelope from shop@example.com to ada@example.com, got %s to %v", r.from, r.to)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(r.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Your order #7 – confirmed" {
+		t.Fatalf("wanted the subject to survive encoding, got %q (%v)", subject, err)
+	}
+	if got := msg.Header.Get("Auto-Submitted"); got != "auto-generated" {
+		t.Fatalf("wanted the Auto-Submitted header, got %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("wanted a multipart/alternative message, got %q (%v)", mediaType, err)
+	}
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(quotedprintable.NewReader(bufio.NewReader(p)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[contentType] = string(content)
+	}
+
+	if !strings.Contains(parts["text/plain"], "thank you for your order") {
+		t.Fatalf("wanted the text part, got %q", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], "<p>thank you for your order.</p>") {
+		t.Fatalf("wanted the html part, got %q", parts["text/html"])
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	e := New("127.0.0.1:1", "", "", "shop@example.com")
+
+	err := e.Send(&ecommerce.EmailMessage{To: "ada@example.com", Subject: "Hi",
+		Headers: map[string]string{"X-Campaign": "a\r\nBcc: eve@example.com"}})
+	if err == nil {
+		t.Fatal("wanted an error for a header with a line break")
+	}
+
+	err = e.Send(&ecommerce.EmailMessage{To: "ada@example.com", Subject: "Hi", Headers: map[string]string{"to": "eve@example.com"}})
+	if err == nil {
+		t.Fatal("wanted an error for overriding a standard header")
+	}
+}
+
+func TestSendTimesOut(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// the server accepts the connection but never greets the client
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = ioutil.ReadAll(conn)
+	}()
+
+	e := &email{addr: l.Addr().String(), from: "shop@example.com", timeout: 100 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Send(&ecommerce.EmailMessage{To: "ada@example.com", Subject: "Hi", Text: "Hi", HTML: "<p>Hi</p>"})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("wanted an error from a server that hangs")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wanted the send to give up")
+	}
+}
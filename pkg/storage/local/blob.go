@@ -0,0 +1,107 @@
+package local
+
+import (
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// NewBlobStore returns a blob store keeping objects as files below root
+// that are served from baseURL.
+func NewBlobStore(root, baseURL string) *blobStore {
+	return &blobStore{root: root, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+type blobStore struct {
+	root    string
+	baseURL string
+}
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Put writes the content of r to a temporary file first and renames it once
+// complete so that readers never see a partially written object.
+func (s *blobStore) Put(key string, r io.Reader) error {
+	const op = "blobStore.Put"
+
+	p, err := s.path(key)
+	if err != nil {
+		return errors2.Wrap(err, op, "resolving path")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return errors2.Wrap(err, op, "creating directory")
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return errors2.Wrap(err, op, "creating temp file")
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return errors2.Wrap(err, op, "writing temp file")
+	}
+
+	if err = os.Rename(f.Name(), p); err != nil {
+		_ = os.Remove(f.Name())
+		return errors2.Wrap(err, op, "renaming temp file")
+	}
+
+	return nil
+}
+
+func (s *blobStore) Get(key string) (io.ReadCloser, error) {
+	const op = "blobStore.Get"
+
+	p, err := s.path(key)
+	if err != nil {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: err}, op, "resolving path")
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: err}, op, "opening file")
+	}
+
+	return f, errors2.Wrap(err, op, "opening file")
+}
+
+// Delete removes the object stored under key, deleting a missing object is not an error.
+func (s *blobStore) Delete(key string) error {
+	const op = "blobStore.Delete"
+
+	p, err := s.path(key)
+	if err != nil {
+		return errors2.Wrap(err, op, "resolving path")
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return errors2.Wrap(err, op, "removing file")
+}
+
+func (s *blobStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// path maps key to a file below root, rejecting keys that would escape it.
+func (s *blobStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
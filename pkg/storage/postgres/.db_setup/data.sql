@@ -1,4 +1,5 @@
 INSERT INTO roles (id, name)
     VALUES
-        (1, 'customer');
+        (1, 'customer'),
+        (2, 'admin');
 
@@ -0,0 +1,326 @@
+-- Brings an existing database created before the money migration up to date with the catalog,
+-- review and promotion tables: categories get slugs and parents, products get options, variants,
+-- images, attributes and rating totals, and orders of a single product become orders with items.
+-- Fresh databases created from tables.sql already have this layout.
+BEGIN;
+
+-- categories
+ALTER TABLE product_categories
+    ADD COLUMN slug VARCHAR(64),
+    ADD COLUMN parent_id int REFERENCES product_categories (id) ON DELETE CASCADE;
+
+-- existing categories get a slug from their name, made unique with their id where names collide
+UPDATE product_categories SET slug = trim(both '-' from regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'));
+UPDATE product_categories c SET slug = CASE WHEN c.slug = '' THEN 'category' ELSE c.slug END || '-' || c.id
+    WHERE c.slug = '' OR EXISTS (SELECT 1 FROM product_categories o WHERE o.slug = c.slug AND o.id < c.id);
+
+ALTER TABLE product_categories
+    ALTER COLUMN slug SET NOT NULL,
+    ADD UNIQUE (slug);
+
+CREATE INDEX product_categories_parent_id_idx ON product_categories (parent_id);
+
+-- options and variants
+CREATE TABLE product_options
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    name varchar (32) NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (product_id, name),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_option_values
+(
+    id SERIAL,
+    option_id int NOT NULL,
+    value varchar (32) NOT NULL,
+    position smallint NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id),
+    UNIQUE (option_id, value),
+    FOREIGN KEY (option_id)
+        REFERENCES product_options (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_variants
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    sku varchar (64) NOT NULL,
+    price float,
+    old_price float,
+    quantity int NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id),
+    UNIQUE (sku),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX product_variants_product_id_idx ON product_variants (product_id);
+
+CREATE TABLE product_variant_option_values
+(
+    variant_id int NOT NULL,
+    option_value_id int NOT NULL,
+
+    UNIQUE (variant_id, option_value_id),
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (option_value_id)
+        REFERENCES product_option_values (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_variant_images
+(
+    variant_id int NOT NULL,
+    url varchar (512) NOT NULL,
+    position smallint NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE
+);
+
+-- images
+CREATE TABLE product_images
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    position smallint NOT NULL DEFAULT 0,
+    content_type varchar (32) NOT NULL,
+    original_key varchar (256) NOT NULL,
+    thumbnail_key varchar (256) NOT NULL,
+    medium_key varchar (256) NOT NULL,
+    large_key varchar (256) NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+-- attributes
+CREATE TABLE attribute_definitions
+(
+    id SERIAL,
+    category_id int NOT NULL,
+    code varchar (32) NOT NULL,
+    name varchar (64) NOT NULL,
+    type varchar (16) NOT NULL,
+    filterable boolean NOT NULL DEFAULT false,
+
+    PRIMARY KEY (id),
+    UNIQUE (category_id, code),
+    CHECK (type IN ('string', 'number', 'boolean')),
+    FOREIGN KEY (category_id)
+        REFERENCES product_categories (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_attribute_values
+(
+    product_id int NOT NULL,
+    attribute_id int NOT NULL,
+    value_text varchar (256) NOT NULL,
+    value_number float,
+    value_bool boolean,
+
+    UNIQUE (product_id, attribute_id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (attribute_id)
+        REFERENCES attribute_definitions (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX product_attribute_values_lookup_idx ON product_attribute_values (attribute_id, lower(value_text));
+
+-- orders hold a single product, which becomes their only item; purchased_at was its unit price
+ALTER TABLE orders
+    ADD COLUMN status varchar(16) NOT NULL DEFAULT 'pending',
+    ADD COLUMN subtotal float NOT NULL DEFAULT 0,
+    ADD COLUMN discount float NOT NULL DEFAULT 0,
+    ADD COLUMN total float NOT NULL DEFAULT 0,
+    ADD COLUMN free_shipping boolean NOT NULL DEFAULT false;
+
+CREATE TABLE order_items
+(
+    id SERIAL,
+    order_id int NOT NULL,
+    product_id int NOT NULL,
+    variant_id int,
+    quantity smallint NOT NULL,
+    unit_price float NOT NULL,
+    discount float NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE SET NULL
+);
+
+INSERT INTO order_items (order_id, product_id, quantity, unit_price)
+    SELECT id, product_id, quantity, purchased_at FROM orders;
+UPDATE orders SET subtotal = purchased_at * quantity, total = purchased_at * quantity;
+
+ALTER TABLE orders
+    ALTER COLUMN subtotal DROP DEFAULT,
+    ALTER COLUMN total DROP DEFAULT,
+    DROP COLUMN product_id,
+    DROP COLUMN quantity,
+    DROP COLUMN purchased_at;
+
+-- carts hold variants, a product without variants has a NULL variant_id
+ALTER TABLE cart_items
+    ADD COLUMN variant_id int REFERENCES product_variants (id) ON DELETE CASCADE,
+    DROP CONSTRAINT cart_items_product_id_customer_id_key;
+
+CREATE UNIQUE INDEX cart_items_product_variant_customer_idx ON cart_items (product_id, customer_id, COALESCE(variant_id, 0));
+
+-- reviews
+ALTER TABLE products
+    ADD COLUMN rating_sum int NOT NULL DEFAULT 0,
+    ADD COLUMN review_count int NOT NULL DEFAULT 0;
+
+CREATE TABLE reviews
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    customer_id int NOT NULL,
+    rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title varchar(128) NOT NULL,
+    body varchar(4096) NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    helpful_count int NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (product_id, customer_id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE review_votes
+(
+    review_id int NOT NULL,
+    user_id int NOT NULL,
+
+    UNIQUE (review_id, user_id),
+    FOREIGN KEY (review_id)
+        REFERENCES reviews (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+-- promotions
+CREATE TABLE promotions
+(
+    id SERIAL,
+    code varchar(32) UNIQUE,
+    name varchar(64) NOT NULL,
+    type varchar(16) NOT NULL,
+    value float NOT NULL DEFAULT 0,
+    buy_quantity int NOT NULL DEFAULT 0,
+    get_quantity int NOT NULL DEFAULT 0,
+    min_spend float NOT NULL DEFAULT 0,
+    usage_limit int NOT NULL DEFAULT 0,
+    per_customer_limit int NOT NULL DEFAULT 0,
+    starts_at timestamp,
+    ends_at timestamp,
+    stackable boolean NOT NULL DEFAULT false,
+    priority int NOT NULL DEFAULT 0,
+    active boolean NOT NULL DEFAULT true,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE promotion_products
+(
+    promotion_id int NOT NULL,
+    product_id int NOT NULL,
+
+    UNIQUE (promotion_id, product_id),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE promotion_categories
+(
+    promotion_id int NOT NULL,
+    category_id int NOT NULL,
+
+    UNIQUE (promotion_id, category_id),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (category_id)
+        REFERENCES product_categories (id)
+        ON DELETE CASCADE
+);
+
+-- coupons customers applied to their cart
+CREATE TABLE cart_promotions
+(
+    customer_id int NOT NULL,
+    promotion_id int NOT NULL,
+
+    UNIQUE (customer_id, promotion_id),
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE promotion_redemptions
+(
+    id SERIAL,
+    promotion_id int NOT NULL,
+    customer_id int NOT NULL,
+    order_id int NOT NULL,
+    discount float NOT NULL,
+    redeemed_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE
+);
+
+INSERT INTO roles (id, name) VALUES (2, 'admin') ON CONFLICT DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Moves prices and amounts of an existing database from floats to integer minor units (cents).
+-- Fresh databases created from tables.sql already have this layout.
+BEGIN;
+
+ALTER TABLE products
+    ALTER COLUMN price TYPE bigint USING round(price * 100)::bigint,
+    ALTER COLUMN old_price TYPE bigint USING round(old_price * 100)::bigint;
+
+ALTER TABLE product_variants
+    ALTER COLUMN price TYPE bigint USING round(price * 100)::bigint,
+    ALTER COLUMN old_price TYPE bigint USING round(old_price * 100)::bigint;
+
+ALTER TABLE orders
+    ADD COLUMN currency char(3) NOT NULL DEFAULT 'USD',
+    ALTER COLUMN subtotal TYPE bigint USING round(subtotal * 100)::bigint,
+    ALTER COLUMN discount TYPE bigint USING round(discount * 100)::bigint,
+    ALTER COLUMN total TYPE bigint USING round(total * 100)::bigint;
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE order_items
+    ALTER COLUMN unit_price TYPE bigint USING round(unit_price * 100)::bigint,
+    ALTER COLUMN discount TYPE bigint USING round(discount * 100)::bigint;
+
+-- fixed amount promotions kept their amount in value, which now only holds percentages
+ALTER TABLE promotions
+    ADD COLUMN amount bigint NOT NULL DEFAULT 0,
+    ALTER COLUMN min_spend TYPE bigint USING round(min_spend * 100)::bigint;
+UPDATE promotions SET amount = round(value * 100)::bigint, value = 0 WHERE type = 'fixed_amount';
+
+ALTER TABLE promotion_redemptions
+    ALTER COLUMN discount TYPE bigint USING round(discount * 100)::bigint;
+
+COMMIT;
@@ -0,0 +1,18 @@
+-- Adds exchange rates and the rate orders were placed with to an existing database.
+BEGIN;
+
+CREATE TABLE exchange_rates
+(
+    currency char(3) NOT NULL,
+    rate numeric(18, 8) NOT NULL,
+    rounding int NOT NULL DEFAULT 1,
+    updated_at timestamp NOT NULL,
+
+    PRIMARY KEY (currency),
+    CHECK (rate > 0),
+    CHECK (rounding > 0)
+);
+
+ALTER TABLE orders ADD COLUMN exchange_rate numeric(18, 8) NOT NULL DEFAULT 1;
+
+COMMIT;
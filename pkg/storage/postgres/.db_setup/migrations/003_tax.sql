@@ -0,0 +1,47 @@
+-- Adds tax rates, product tax categories and the tax of orders to an existing database.
+BEGIN;
+
+ALTER TABLE products ADD COLUMN tax_category varchar(32) NOT NULL DEFAULT 'standard';
+
+ALTER TABLE orders
+    ADD COLUMN tax bigint NOT NULL DEFAULT 0,
+    ADD COLUMN tax_inclusive boolean NOT NULL DEFAULT false;
+
+ALTER TABLE order_items ADD COLUMN tax bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE tax_rates
+(
+    id SERIAL,
+    name varchar(64) NOT NULL,
+    country varchar(64) NOT NULL,
+    state varchar(64) NOT NULL DEFAULT '',
+    postal_code varchar(16) NOT NULL DEFAULT '',
+    tax_category varchar(32),
+    rate numeric(7, 4) NOT NULL,
+    inclusive boolean NOT NULL DEFAULT false,
+
+    PRIMARY KEY (id),
+    CHECK (rate >= 0 AND rate <= 100)
+);
+
+CREATE INDEX tax_rates_country_idx ON tax_rates (country);
+
+CREATE TABLE order_item_taxes
+(
+    id SERIAL,
+    order_item_id int NOT NULL,
+    tax_rate_id int,
+    name varchar(64) NOT NULL,
+    rate numeric(7, 4) NOT NULL,
+    amount bigint NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_item_id)
+        REFERENCES order_items (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (tax_rate_id)
+        REFERENCES tax_rates (id)
+        ON DELETE SET NULL
+);
+
+COMMIT;
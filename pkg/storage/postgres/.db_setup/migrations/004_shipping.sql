@@ -0,0 +1,63 @@
+-- Adds shipping zones and methods, product weights and the shipping of orders to an existing database.
+BEGIN;
+
+ALTER TABLE products ADD COLUMN weight int NOT NULL DEFAULT 0;
+
+-- a region with an empty state covers the whole country, see ecommerce.ShippingZone
+CREATE TABLE shipping_zones
+(
+    id SERIAL,
+    name varchar(64) NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE shipping_zone_regions
+(
+    zone_id int NOT NULL,
+    country varchar(64) NOT NULL,
+    state varchar(64) NOT NULL DEFAULT '',
+
+    PRIMARY KEY (country, state),
+    FOREIGN KEY (zone_id)
+        REFERENCES shipping_zones (id)
+        ON DELETE CASCADE
+);
+
+-- rate, free_over and the tier amounts are in minor units of the catalog currency
+CREATE TABLE shipping_methods
+(
+    id SERIAL,
+    zone_id int NOT NULL,
+    name varchar(64) NOT NULL,
+    type varchar(16) NOT NULL,
+    rate_type varchar(16) NOT NULL,
+    rate bigint NOT NULL DEFAULT 0,
+    free_over bigint NOT NULL DEFAULT 0,
+    active boolean NOT NULL DEFAULT true,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (zone_id)
+        REFERENCES shipping_zones (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE shipping_method_tiers
+(
+    method_id int NOT NULL,
+    min_weight int NOT NULL DEFAULT 0,
+    min_subtotal bigint NOT NULL DEFAULT 0,
+    rate bigint NOT NULL,
+
+    PRIMARY KEY (method_id, min_weight, min_subtotal),
+    FOREIGN KEY (method_id)
+        REFERENCES shipping_methods (id)
+        ON DELETE CASCADE
+);
+
+ALTER TABLE orders
+    ADD COLUMN shipping_method_id int REFERENCES shipping_methods (id) ON DELETE SET NULL,
+    ADD COLUMN shipping_method varchar(64) NOT NULL DEFAULT '',
+    ADD COLUMN shipping_cost bigint NOT NULL DEFAULT 0;
+
+COMMIT;
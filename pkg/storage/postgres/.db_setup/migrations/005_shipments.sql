@@ -0,0 +1,42 @@
+-- Adds shipments to an existing database.
+BEGIN;
+
+-- room for partially_shipped
+ALTER TABLE orders ALTER COLUMN status TYPE varchar(32);
+
+CREATE TABLE shipments
+(
+    id SERIAL,
+    order_id int NOT NULL,
+    carrier varchar(64) NOT NULL,
+    tracking_number varchar(64) NOT NULL,
+    tracking_url varchar(512),
+    status varchar(16) NOT NULL DEFAULT 'shipped',
+    shipped_at timestamp NOT NULL,
+    delivered_at timestamp,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX shipments_order_id_idx ON shipments (order_id);
+
+CREATE TABLE shipment_items
+(
+    shipment_id int NOT NULL,
+    order_item_id int NOT NULL,
+    quantity int NOT NULL,
+
+    PRIMARY KEY (shipment_id, order_item_id),
+    FOREIGN KEY (shipment_id)
+        REFERENCES shipments (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id)
+        REFERENCES order_items (id)
+        ON DELETE CASCADE,
+    CHECK (quantity > 0)
+);
+
+COMMIT;
@@ -0,0 +1,60 @@
+-- Adds returns and refunds to an existing database.
+BEGIN;
+
+CREATE TABLE returns
+(
+    id SERIAL,
+    order_id int NOT NULL,
+    customer_id int NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'requested',
+    reason varchar(1024) NOT NULL,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX returns_order_id_idx ON returns (order_id);
+
+CREATE TABLE return_items
+(
+    return_id int NOT NULL,
+    order_item_id int NOT NULL,
+    quantity int NOT NULL,
+
+    PRIMARY KEY (return_id, order_item_id),
+    FOREIGN KEY (return_id)
+        REFERENCES returns (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id)
+        REFERENCES order_items (id)
+        ON DELETE CASCADE,
+    CHECK (quantity > 0)
+);
+
+-- audit trail of returns, amount is the refunded amount in minor units of the order currency
+CREATE TABLE return_events
+(
+    id SERIAL,
+    return_id int NOT NULL,
+    status varchar(16) NOT NULL,
+    actor_id int,
+    note varchar(1024),
+    amount bigint,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (return_id)
+        REFERENCES returns (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (actor_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL
+);
+
+COMMIT;
@@ -0,0 +1,44 @@
+-- Turns the single address of a customer into an address book and copies the
+-- shipping address onto orders.
+BEGIN;
+
+ALTER TABLE addresses
+    ADD COLUMN customer_id int REFERENCES users (id) ON DELETE CASCADE,
+    ADD COLUMN is_default_shipping boolean NOT NULL DEFAULT false,
+    ADD COLUMN is_default_billing boolean NOT NULL DEFAULT false;
+
+-- the address of a customer becomes their default shipping and billing address
+UPDATE addresses a SET customer_id = u.id, is_default_shipping = true, is_default_billing = true
+    FROM users u WHERE u.address_id = a.id;
+
+ALTER TABLE orders
+    ADD COLUMN shipping_country varchar(32),
+    ADD COLUMN shipping_state varchar(32),
+    ADD COLUMN shipping_city varchar(32),
+    ADD COLUMN shipping_postal_code varchar(8),
+    ADD COLUMN shipping_address varchar(64);
+
+UPDATE orders o SET shipping_country = a.country, shipping_state = a.state, shipping_city = a.city,
+        shipping_postal_code = a.postal_code, shipping_address = a.address
+    FROM addresses a WHERE a.id = o.shipping_address_id;
+
+ALTER TABLE orders
+    ALTER COLUMN shipping_country SET NOT NULL,
+    ALTER COLUMN shipping_state SET NOT NULL,
+    ALTER COLUMN shipping_city SET NOT NULL,
+    ALTER COLUMN shipping_postal_code SET NOT NULL,
+    ALTER COLUMN shipping_address SET NOT NULL,
+    DROP COLUMN shipping_address_id;
+
+ALTER TABLE users DROP COLUMN address_id;
+
+-- addresses no customer refers to anymore cannot be assigned to anyone
+DELETE FROM addresses WHERE customer_id IS NULL;
+
+ALTER TABLE addresses ALTER COLUMN customer_id SET NOT NULL;
+
+CREATE INDEX addresses_customer_id_idx ON addresses (customer_id);
+CREATE UNIQUE INDEX addresses_default_shipping_idx ON addresses (customer_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX addresses_default_billing_idx ON addresses (customer_id) WHERE is_default_billing;
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Makes room for postal codes with separators such as US ZIP+4 codes.
+BEGIN;
+
+ALTER TABLE addresses ALTER COLUMN postal_code TYPE varchar(16);
+ALTER TABLE orders ALTER COLUMN shipping_postal_code TYPE varchar(16);
+
+COMMIT;
@@ -0,0 +1,50 @@
+-- Adds wishlists to an existing database.
+BEGIN;
+
+-- a wishlist is shared while it has a share_token
+CREATE TABLE wishlists
+(
+    id SERIAL,
+    customer_id int NOT NULL,
+    name varchar(64) NOT NULL,
+    share_token varchar(64),
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (share_token),
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX wishlists_customer_id_idx ON wishlists (customer_id);
+
+-- added_price (in minor units of the default currency) and added_in_stock are the
+-- product data the price-drop and back-in-stock flags are computed against
+CREATE TABLE wishlist_items
+(
+    id SERIAL,
+    wishlist_id int NOT NULL,
+    product_id int NOT NULL,
+    variant_id int,
+    quantity smallint NOT NULL DEFAULT 1,
+    added_price bigint NOT NULL,
+    added_in_stock boolean NOT NULL,
+    added_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (wishlist_id)
+        REFERENCES wishlists (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE,
+    CHECK (quantity > 0)
+);
+
+CREATE UNIQUE INDEX wishlist_items_product_variant_idx ON wishlist_items (wishlist_id, product_id, COALESCE(variant_id, 0));
+
+COMMIT;
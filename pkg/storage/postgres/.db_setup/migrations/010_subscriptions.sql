@@ -0,0 +1,52 @@
+-- Adds back-in-stock and price-drop subscriptions to an existing database.
+BEGIN;
+
+-- price-drop subscriptions alert when the price drops to or below threshold (in minor
+-- units of the default currency), back-in-stock subscriptions have no threshold
+CREATE TABLE subscriptions
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    variant_id int,
+    type varchar(16) NOT NULL,
+    email varchar(128) NOT NULL,
+    threshold bigint,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE,
+    CHECK (type IN ('back_in_stock', 'price_drop')),
+    CHECK ((type = 'price_drop') = (threshold IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX subscriptions_product_variant_type_email_idx ON subscriptions (product_id, COALESCE(variant_id, 0), type, email);
+
+-- alerts wait with a null sent_at until they are emailed, a subscription has at most
+-- one waiting alert; the alerts sent in one email share their sent_at
+CREATE TABLE subscription_alerts
+(
+    id SERIAL,
+    subscription_id int NOT NULL,
+    email varchar(128) NOT NULL,
+    type varchar(16) NOT NULL,
+    product_id int NOT NULL,
+    product_name varchar(255) NOT NULL,
+    price bigint NOT NULL,
+    created_at timestamp NOT NULL,
+    sent_at timestamp,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (subscription_id)
+        REFERENCES subscriptions (id)
+        ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX subscription_alerts_pending_idx ON subscription_alerts (subscription_id) WHERE sent_at IS NULL;
+CREATE INDEX subscription_alerts_email_sent_at_idx ON subscription_alerts (email, sent_at);
+
+COMMIT;
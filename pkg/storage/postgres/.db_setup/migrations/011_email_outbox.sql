@@ -0,0 +1,27 @@
+-- Adds the transactional email outbox to an existing database.
+BEGIN;
+
+-- the transactional email outbox: messages are inserted in the transaction of the
+-- change they are about and sent afterwards. next_attempt_at is null once a message
+-- is sent (sent_at is set) or has failed too often to be retried (last_error is set).
+CREATE TABLE email_outbox
+(
+    id SERIAL,
+    template varchar(32) NOT NULL,
+    recipient varchar(128) NOT NULL,
+    subject varchar(255) NOT NULL,
+    html_body text NOT NULL,
+    text_body text NOT NULL,
+    headers jsonb NOT NULL DEFAULT '{}',
+    attempts smallint NOT NULL DEFAULT 0,
+    next_attempt_at timestamp,
+    last_error text,
+    created_at timestamp NOT NULL,
+    sent_at timestamp,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX email_outbox_next_attempt_at_idx ON email_outbox (next_attempt_at) WHERE next_attempt_at IS NOT NULL;
+
+COMMIT;
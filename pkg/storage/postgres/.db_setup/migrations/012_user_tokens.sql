@@ -0,0 +1,30 @@
+-- Adds email verification and password reset tokens to an existing database. Existing
+-- users start with an unverified email address.
+BEGIN;
+
+ALTER TABLE users ADD COLUMN email_verified_at timestamp;
+
+-- single use tokens emailed to users, only the SHA-256 hash of a token is stored.
+-- email is the address the token was sent to, used_at is set once it is used up.
+CREATE TABLE user_tokens
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    purpose varchar(32) NOT NULL,
+    email varchar(128) NOT NULL,
+    token_hash char(64) NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (token_hash),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE,
+    CHECK (purpose IN ('email_verification', 'password_reset'))
+);
+
+CREATE INDEX user_tokens_user_id_purpose_created_at_idx ON user_tokens (user_id, purpose, created_at);
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Lets users log out their other sessions by changing their password. Auth tokens of
+-- a user issued before sessions_valid_after no longer work.
+BEGIN;
+
+ALTER TABLE users ADD COLUMN sessions_valid_after timestamp;
+
+COMMIT;
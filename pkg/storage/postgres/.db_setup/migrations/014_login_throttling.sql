@@ -0,0 +1,38 @@
+-- Adds failed login tracking and lockouts to an existing database.
+BEGIN;
+
+-- failed logins, kept as an audit trail. user_id is null if there was no account with
+-- the email.
+CREATE TABLE login_attempts
+(
+    id SERIAL,
+    user_id int,
+    email varchar(128) NOT NULL,
+    ip varchar(64) NOT NULL,
+    reason varchar(16) NOT NULL,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL,
+    CHECK (reason IN ('password', 'locked'))
+);
+
+CREATE INDEX login_attempts_user_id_created_at_idx ON login_attempts (user_id, created_at);
+
+-- failed logins counted per account (by lower case email) and per ip address. Logins
+-- are locked until locked_until after too many failures.
+CREATE TABLE login_throttles
+(
+    scope varchar(16) NOT NULL,
+    subject varchar(128) NOT NULL,
+    failures int NOT NULL,
+    last_failure_at timestamp NOT NULL,
+    locked_until timestamp,
+
+    PRIMARY KEY (scope, subject),
+    CHECK (scope IN ('account', 'ip'))
+);
+
+COMMIT;
@@ -0,0 +1,46 @@
+-- Adds TOTP two-factor authentication to an existing database.
+BEGIN;
+
+-- the TOTP second factor of users. The secret has to be stored as is to compute codes.
+-- Two-factor authentication is required once confirmed_at is set, last_step is the
+-- time step of the last code used, so that a code cannot be used twice.
+CREATE TABLE user_totp
+(
+    user_id int NOT NULL,
+    secret varchar(64) NOT NULL,
+    confirmed_at timestamp,
+    last_step bigint NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+-- single use recovery codes for users who lost their authenticator, only the SHA-256
+-- hash of a code is stored.
+CREATE TABLE user_recovery_codes
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    code_hash char(64) NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (user_id, code_hash),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+ALTER TABLE user_tokens DROP CONSTRAINT user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('email_verification', 'password_reset', 'two_factor_challenge'));
+
+ALTER TABLE login_attempts DROP CONSTRAINT login_attempts_reason_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_reason_check
+    CHECK (reason IN ('password', 'locked', 'two_factor'));
+
+COMMIT;
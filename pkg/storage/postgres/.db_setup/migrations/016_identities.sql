@@ -0,0 +1,35 @@
+-- Adds logins with OpenID Connect providers to an existing database.
+BEGIN;
+
+-- accounts of users at identity providers. subject identifies the user at the provider,
+-- email is the address the provider had for them when they were linked.
+CREATE TABLE user_identities
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(128) NOT NULL,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (provider, subject),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+-- logins with identity providers users were sent to and did not come back from yet,
+-- only the SHA-256 hash of the state is stored.
+CREATE TABLE external_logins
+(
+    state_hash char(64) NOT NULL,
+    provider varchar(64) NOT NULL,
+    nonce varchar(64) NOT NULL,
+    code_verifier varchar(128) NOT NULL,
+    expires_at timestamp NOT NULL,
+
+    PRIMARY KEY (state_hash)
+);
+
+COMMIT;
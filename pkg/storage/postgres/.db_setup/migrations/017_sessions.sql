@@ -0,0 +1,28 @@
+-- Replaces revoking all sessions of a user at once with sessions users can list and
+-- revoke one by one. Auth tokens issued before carry no session and stop working, so
+-- users have to log in again.
+BEGIN;
+
+CREATE TABLE user_sessions
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    device varchar(64) NOT NULL,
+    ip varchar(45) NOT NULL,
+    user_agent varchar(512) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_seen_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    revoked_at timestamp,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX user_sessions_user_id_idx ON user_sessions (user_id);
+
+ALTER TABLE users DROP COLUMN sessions_valid_after;
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Adds API keys for server-to-server integrations to an existing database.
+BEGIN;
+
+-- keys systems of the shop use the API with instead of a user. Only the SHA-256 hash
+-- of a key is stored, prefix is its start in plain text to tell keys apart. scopes are
+-- separated by spaces.
+CREATE TABLE api_keys
+(
+    id SERIAL,
+    name varchar(64) NOT NULL,
+    prefix varchar(16) NOT NULL,
+    key_hash char(64) NOT NULL,
+    scopes varchar(255) NOT NULL,
+    created_by int,
+    created_at timestamp NOT NULL,
+    expires_at timestamp,
+    last_used_at timestamp,
+    revoked_at timestamp,
+
+    PRIMARY KEY (id),
+    UNIQUE (prefix),
+    FOREIGN KEY (created_by)
+        REFERENCES users (id)
+        ON DELETE SET NULL
+);
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Lets users delete their account. Orders, returns, reviews and promotion redemptions
+-- outlive the account of their customer instead of being deleted with it.
+BEGIN;
+
+ALTER TABLE users ADD COLUMN deletion_scheduled_at timestamp;
+
+ALTER TABLE orders ALTER COLUMN customer_id DROP NOT NULL;
+ALTER TABLE orders DROP CONSTRAINT orders_customer_id_fkey;
+ALTER TABLE orders ADD FOREIGN KEY (customer_id) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE reviews ALTER COLUMN customer_id DROP NOT NULL;
+ALTER TABLE reviews DROP CONSTRAINT reviews_customer_id_fkey;
+ALTER TABLE reviews ADD FOREIGN KEY (customer_id) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE promotion_redemptions ALTER COLUMN customer_id DROP NOT NULL;
+ALTER TABLE promotion_redemptions DROP CONSTRAINT promotion_redemptions_customer_id_fkey;
+ALTER TABLE promotion_redemptions ADD FOREIGN KEY (customer_id) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE returns ALTER COLUMN customer_id DROP NOT NULL;
+ALTER TABLE returns DROP CONSTRAINT returns_customer_id_fkey;
+ALTER TABLE returns ADD FOREIGN KEY (customer_id) REFERENCES users (id) ON DELETE SET NULL;
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Clears the bodies of sent or given up emails that can carry single use tokens, which the
+-- outbox now does when it is done with them.
+BEGIN;
+
+UPDATE email_outbox SET html_body = '', text_body = ''
+    WHERE template IN ('welcome', 'email_verification', 'password_reset') AND next_attempt_at IS NULL;
+
+COMMIT;
@@ -1,15 +1,3 @@
-CREATE TABLE addresses
-(
-    id SERIAL,
-    country VARCHAR(32) NOT NULL,
-    state VARCHAR (32) NOT NULL,
-    city VARCHAR (32) NOT NULL,
-    postal_code VARCHAR (8) NOT NULL,
-    address VARCHAR (64) NOT NULL,
-
-    PRIMARY KEY (id)
-);
-
 CREATE TABLE users
 (
     id SERIAL,
@@ -17,15 +5,37 @@ CREATE TABLE users
     last_name VARCHAR (64) NOT NULL,
     email VARCHAR (128) NOT NULL,
     password CHAR(60) NOT NULL,
-    address_id int,
+    email_verified_at timestamp,
+    -- when the account is deleted, if the user asked for it
+    deletion_scheduled_at timestamp,
+
+    PRIMARY KEY (id),
+    UNIQUE (email)
+);
+
+CREATE TABLE addresses
+(
+    id SERIAL,
+    customer_id int NOT NULL,
+    country VARCHAR(32) NOT NULL,
+    state VARCHAR (32) NOT NULL,
+    city VARCHAR (32) NOT NULL,
+    postal_code VARCHAR (16) NOT NULL,
+    address VARCHAR (64) NOT NULL,
+    is_default_shipping boolean NOT NULL DEFAULT false,
+    is_default_billing boolean NOT NULL DEFAULT false,
 
     PRIMARY KEY (id),
-    UNIQUE (email),
-    FOREIGN KEY (address_id)
-        REFERENCES addresses (id)
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
         ON DELETE CASCADE
 );
 
+CREATE INDEX addresses_customer_id_idx ON addresses (customer_id);
+-- a customer has at most one default of each kind
+CREATE UNIQUE INDEX addresses_default_shipping_idx ON addresses (customer_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX addresses_default_billing_idx ON addresses (customer_id) WHERE is_default_billing;
+
 CREATE SEQUENCE role_id_seq;
 CREATE TABLE roles
 (
@@ -53,27 +63,164 @@ CREATE TABLE product_categories
 (
     id SERIAL,
     name VARCHAR(32) NOT NULL,
+    slug VARCHAR(64) NOT NULL,
+    parent_id int,
 
-    PRIMARY KEY(id)
+    PRIMARY KEY(id),
+    UNIQUE (slug),
+    FOREIGN KEY (parent_id)
+        REFERENCES product_categories (id)
+        ON DELETE CASCADE
 );
 
+CREATE INDEX product_categories_parent_id_idx ON product_categories (parent_id);
+
+-- prices and other amounts are in minor units of their currency, e.g. cents
 CREATE TABLE products
 (
     id SERIAL,
     name varchar (32) NOT NULL,
     category_id int NOT NULL,
-    price float NOT NULL,
-    old_price float,
+    price bigint NOT NULL,
+    old_price bigint,
     rating smallint,
+    rating_sum int NOT NULL DEFAULT 0,
+    review_count int NOT NULL DEFAULT 0,
     description varchar(2048),
     quantity int,
+    tax_category varchar(32) NOT NULL DEFAULT 'standard',
+    -- shipping weight in grams
+    weight int NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (category_id)
+        REFERENCES product_categories (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_options
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    name varchar (32) NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (product_id, name),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_option_values
+(
+    id SERIAL,
+    option_id int NOT NULL,
+    value varchar (32) NOT NULL,
+    position smallint NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (id),
+    UNIQUE (option_id, value),
+    FOREIGN KEY (option_id)
+        REFERENCES product_options (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_variants
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    sku varchar (64) NOT NULL,
+    price bigint,
+    old_price bigint,
+    quantity int NOT NULL DEFAULT 0,
 
     PRIMARY KEY (id),
+    UNIQUE (sku),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX product_variants_product_id_idx ON product_variants (product_id);
+
+CREATE TABLE product_variant_option_values
+(
+    variant_id int NOT NULL,
+    option_value_id int NOT NULL,
+
+    UNIQUE (variant_id, option_value_id),
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (option_value_id)
+        REFERENCES product_option_values (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_variant_images
+(
+    variant_id int NOT NULL,
+    url varchar (512) NOT NULL,
+    position smallint NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE product_images
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    position smallint NOT NULL DEFAULT 0,
+    content_type varchar (32) NOT NULL,
+    original_key varchar (256) NOT NULL,
+    thumbnail_key varchar (256) NOT NULL,
+    medium_key varchar (256) NOT NULL,
+    large_key varchar (256) NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE attribute_definitions
+(
+    id SERIAL,
+    category_id int NOT NULL,
+    code varchar (32) NOT NULL,
+    name varchar (64) NOT NULL,
+    type varchar (16) NOT NULL,
+    filterable boolean NOT NULL DEFAULT false,
+
+    PRIMARY KEY (id),
+    UNIQUE (category_id, code),
+    CHECK (type IN ('string', 'number', 'boolean')),
     FOREIGN KEY (category_id)
         REFERENCES product_categories (id)
         ON DELETE CASCADE
 );
 
+CREATE TABLE product_attribute_values
+(
+    product_id int NOT NULL,
+    attribute_id int NOT NULL,
+    value_text varchar (256) NOT NULL,
+    value_number float,
+    value_bool boolean,
+
+    UNIQUE (product_id, attribute_id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (attribute_id)
+        REFERENCES attribute_definitions (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX product_attribute_values_lookup_idx ON product_attribute_values (attribute_id, lower(value_text));
+
 CREATE TABLE credit_cards
 (
     id SERIAL,
@@ -89,39 +236,682 @@ CREATE TABLE credit_cards
         ON DELETE CASCADE
 );
 
+-- a region with an empty state covers the whole country, see ecommerce.ShippingZone
+CREATE TABLE shipping_zones
+(
+    id SERIAL,
+    name varchar(64) NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE shipping_zone_regions
+(
+    zone_id int NOT NULL,
+    country varchar(64) NOT NULL,
+    state varchar(64) NOT NULL DEFAULT '',
+
+    PRIMARY KEY (country, state),
+    FOREIGN KEY (zone_id)
+        REFERENCES shipping_zones (id)
+        ON DELETE CASCADE
+);
+
+-- rate, free_over and the tier amounts are in minor units of the catalog currency
+CREATE TABLE shipping_methods
+(
+    id SERIAL,
+    zone_id int NOT NULL,
+    name varchar(64) NOT NULL,
+    type varchar(16) NOT NULL,
+    rate_type varchar(16) NOT NULL,
+    rate bigint NOT NULL DEFAULT 0,
+    free_over bigint NOT NULL DEFAULT 0,
+    active boolean NOT NULL DEFAULT true,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (zone_id)
+        REFERENCES shipping_zones (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE shipping_method_tiers
+(
+    method_id int NOT NULL,
+    min_weight int NOT NULL DEFAULT 0,
+    min_subtotal bigint NOT NULL DEFAULT 0,
+    rate bigint NOT NULL,
+
+    PRIMARY KEY (method_id, min_weight, min_subtotal),
+    FOREIGN KEY (method_id)
+        REFERENCES shipping_methods (id)
+        ON DELETE CASCADE
+);
+
+-- orders outlive the account of their customer, the customer is unset and the address
+-- but for the country and state is blanked when the account is deleted
 CREATE TABLE orders
 (
     id SERIAL,
-    product_id int NOT NULL,
     ordered_at timestamp NOT NULL,
-    shipping_address_id int NOT NULL,
+    -- the address is copied so that it outlives changes to the customer's address book
+    shipping_country varchar(32) NOT NULL,
+    shipping_state varchar(32) NOT NULL,
+    shipping_city varchar(32) NOT NULL,
+    shipping_postal_code varchar(16) NOT NULL,
+    shipping_address varchar(64) NOT NULL,
+    customer_id int,
+    status varchar(32) NOT NULL DEFAULT 'pending',
+    currency char(3) NOT NULL,
+    -- rate the catalog prices were converted to currency with at checkout
+    exchange_rate numeric(18, 8) NOT NULL DEFAULT 1,
+    subtotal bigint NOT NULL,
+    discount bigint NOT NULL DEFAULT 0,
+    tax bigint NOT NULL DEFAULT 0,
+    tax_inclusive boolean NOT NULL DEFAULT false,
+    -- the name and cost are copied so that they outlive changes to the method
+    shipping_method_id int,
+    shipping_method varchar(64) NOT NULL DEFAULT '',
+    shipping_cost bigint NOT NULL DEFAULT 0,
+    total bigint NOT NULL,
+    free_shipping boolean NOT NULL DEFAULT false,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (shipping_method_id)
+        REFERENCES shipping_methods (id)
+        ON DELETE SET NULL,
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL
+);
+
+CREATE TABLE order_items
+(
+    id SERIAL,
+    order_id int NOT NULL,
+    product_id int NOT NULL,
+    variant_id int,
     quantity smallint NOT NULL,
-    customer_id int NOT NULL,
-    purchased_at float NOT NULL,
+    unit_price bigint NOT NULL,
+    discount bigint NOT NULL DEFAULT 0,
+    tax bigint NOT NULL DEFAULT 0,
 
     PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE SET NULL
+);
+
+CREATE TABLE cart_items
+(
+    product_id int NOT NULL,
+    variant_id int,
+    customer_id int NOT NULL,
+    quantity smallint NOT NULL,
+
     FOREIGN KEY (product_id)
         REFERENCES PRODUCTS (id)
         ON DELETE CASCADE,
-    FOREIGN KEY (shipping_address_id)
-        REFERENCES addresses (id)
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
         ON DELETE CASCADE,
     FOREIGN KEY (customer_id)
         REFERENCES users (id)
         ON DELETE CASCADE
 );
 
-CREATE TABLE cart_items
+-- a product without variants has a NULL variant_id, which a plain UNIQUE constraint treats as distinct
+CREATE UNIQUE INDEX cart_items_product_variant_customer_idx ON cart_items (product_id, customer_id, COALESCE(variant_id, 0));
+
+CREATE TABLE reviews
 (
+    id SERIAL,
     product_id int NOT NULL,
-    customer_id int NOT NULL,
-    quantity smallint NOT NULL,
+    customer_id int,
+    rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title varchar(128) NOT NULL,
+    body varchar(4096) NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    helpful_count int NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
 
+    PRIMARY KEY (id),
     UNIQUE (product_id, customer_id),
     FOREIGN KEY (product_id)
-        REFERENCES PRODUCTS (id)
+        REFERENCES products (id)
         ON DELETE CASCADE,
     FOREIGN KEY (customer_id)
         REFERENCES users (id)
+        ON DELETE SET NULL
+);
+
+CREATE TABLE review_votes
+(
+    review_id int NOT NULL,
+    user_id int NOT NULL,
+
+    UNIQUE (review_id, user_id),
+    FOREIGN KEY (review_id)
+        REFERENCES reviews (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE promotions
+(
+    id SERIAL,
+    code varchar(32) UNIQUE,
+    name varchar(64) NOT NULL,
+    type varchar(16) NOT NULL,
+    value float NOT NULL DEFAULT 0,
+    amount bigint NOT NULL DEFAULT 0,
+    buy_quantity int NOT NULL DEFAULT 0,
+    get_quantity int NOT NULL DEFAULT 0,
+    min_spend bigint NOT NULL DEFAULT 0,
+    usage_limit int NOT NULL DEFAULT 0,
+    per_customer_limit int NOT NULL DEFAULT 0,
+    starts_at timestamp,
+    ends_at timestamp,
+    stackable boolean NOT NULL DEFAULT false,
+    priority int NOT NULL DEFAULT 0,
+    active boolean NOT NULL DEFAULT true,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE promotion_products
+(
+    promotion_id int NOT NULL,
+    product_id int NOT NULL,
+
+    UNIQUE (promotion_id, product_id),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
         ON DELETE CASCADE
 );
+
+CREATE TABLE promotion_categories
+(
+    promotion_id int NOT NULL,
+    category_id int NOT NULL,
+
+    UNIQUE (promotion_id, category_id),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (category_id)
+        REFERENCES product_categories (id)
+        ON DELETE CASCADE
+);
+
+-- coupons customers applied to their cart
+CREATE TABLE cart_promotions
+(
+    customer_id int NOT NULL,
+    promotion_id int NOT NULL,
+
+    UNIQUE (customer_id, promotion_id),
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE promotion_redemptions
+(
+    id SERIAL,
+    promotion_id int NOT NULL,
+    customer_id int,
+    order_id int NOT NULL,
+    discount bigint NOT NULL,
+    redeemed_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotions (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL,
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE
+);
+
+-- rates of DefaultCurrency to other currencies
+CREATE TABLE exchange_rates
+(
+    currency char(3) NOT NULL,
+    rate numeric(18, 8) NOT NULL,
+    rounding int NOT NULL DEFAULT 1,
+    updated_at timestamp NOT NULL,
+
+    PRIMARY KEY (currency),
+    CHECK (rate > 0),
+    CHECK (rounding > 0)
+);
+
+-- an empty state matches every state of the country and postal_code matches postal codes starting with it
+CREATE TABLE tax_rates
+(
+    id SERIAL,
+    name varchar(64) NOT NULL,
+    country varchar(64) NOT NULL,
+    state varchar(64) NOT NULL DEFAULT '',
+    postal_code varchar(16) NOT NULL DEFAULT '',
+    tax_category varchar(32),
+    rate numeric(7, 4) NOT NULL,
+    inclusive boolean NOT NULL DEFAULT false,
+
+    PRIMARY KEY (id),
+    CHECK (rate >= 0 AND rate <= 100)
+);
+
+CREATE INDEX tax_rates_country_idx ON tax_rates (country);
+
+-- tax of order items per rate, the name and rate are copied so that they outlive changes to the rate
+CREATE TABLE order_item_taxes
+(
+    id SERIAL,
+    order_item_id int NOT NULL,
+    tax_rate_id int,
+    name varchar(64) NOT NULL,
+    rate numeric(7, 4) NOT NULL,
+    amount bigint NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_item_id)
+        REFERENCES order_items (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (tax_rate_id)
+        REFERENCES tax_rates (id)
+        ON DELETE SET NULL
+);
+
+CREATE TABLE shipments
+(
+    id SERIAL,
+    order_id int NOT NULL,
+    carrier varchar(64) NOT NULL,
+    tracking_number varchar(64) NOT NULL,
+    tracking_url varchar(512),
+    status varchar(16) NOT NULL DEFAULT 'shipped',
+    shipped_at timestamp NOT NULL,
+    delivered_at timestamp,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX shipments_order_id_idx ON shipments (order_id);
+
+CREATE TABLE shipment_items
+(
+    shipment_id int NOT NULL,
+    order_item_id int NOT NULL,
+    quantity int NOT NULL,
+
+    PRIMARY KEY (shipment_id, order_item_id),
+    FOREIGN KEY (shipment_id)
+        REFERENCES shipments (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id)
+        REFERENCES order_items (id)
+        ON DELETE CASCADE,
+    CHECK (quantity > 0)
+);
+
+CREATE TABLE returns
+(
+    id SERIAL,
+    order_id int NOT NULL,
+    customer_id int,
+    status varchar(16) NOT NULL DEFAULT 'requested',
+    reason varchar(1024) NOT NULL,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES orders (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX returns_order_id_idx ON returns (order_id);
+
+CREATE TABLE return_items
+(
+    return_id int NOT NULL,
+    order_item_id int NOT NULL,
+    quantity int NOT NULL,
+
+    PRIMARY KEY (return_id, order_item_id),
+    FOREIGN KEY (return_id)
+        REFERENCES returns (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (order_item_id)
+        REFERENCES order_items (id)
+        ON DELETE CASCADE,
+    CHECK (quantity > 0)
+);
+
+-- audit trail of returns, amount is the refunded amount in minor units of the order currency
+CREATE TABLE return_events
+(
+    id SERIAL,
+    return_id int NOT NULL,
+    status varchar(16) NOT NULL,
+    actor_id int,
+    note varchar(1024),
+    amount bigint,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (return_id)
+        REFERENCES returns (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (actor_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL
+);
+
+-- a wishlist is shared while it has a share_token
+CREATE TABLE wishlists
+(
+    id SERIAL,
+    customer_id int NOT NULL,
+    name varchar(64) NOT NULL,
+    share_token varchar(64),
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (share_token),
+    FOREIGN KEY (customer_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX wishlists_customer_id_idx ON wishlists (customer_id);
+
+-- added_price (in minor units of the default currency) and added_in_stock are the
+-- product data the price-drop and back-in-stock flags are computed against
+CREATE TABLE wishlist_items
+(
+    id SERIAL,
+    wishlist_id int NOT NULL,
+    product_id int NOT NULL,
+    variant_id int,
+    quantity smallint NOT NULL DEFAULT 1,
+    added_price bigint NOT NULL,
+    added_in_stock boolean NOT NULL,
+    added_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (wishlist_id)
+        REFERENCES wishlists (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE,
+    CHECK (quantity > 0)
+);
+
+CREATE UNIQUE INDEX wishlist_items_product_variant_idx ON wishlist_items (wishlist_id, product_id, COALESCE(variant_id, 0));
+
+-- price-drop subscriptions alert when the price drops to or below threshold (in minor
+-- units of the default currency), back-in-stock subscriptions have no threshold
+CREATE TABLE subscriptions
+(
+    id SERIAL,
+    product_id int NOT NULL,
+    variant_id int,
+    type varchar(16) NOT NULL,
+    email varchar(128) NOT NULL,
+    threshold bigint,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (product_id)
+        REFERENCES products (id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variants (id)
+        ON DELETE CASCADE,
+    CHECK (type IN ('back_in_stock', 'price_drop')),
+    CHECK ((type = 'price_drop') = (threshold IS NOT NULL))
+);
+
+CREATE UNIQUE INDEX subscriptions_product_variant_type_email_idx ON subscriptions (product_id, COALESCE(variant_id, 0), type, email);
+
+-- alerts wait with a null sent_at until they are emailed, a subscription has at most
+-- one waiting alert; the alerts sent in one email share their sent_at
+CREATE TABLE subscription_alerts
+(
+    id SERIAL,
+    subscription_id int NOT NULL,
+    email varchar(128) NOT NULL,
+    type varchar(16) NOT NULL,
+    product_id int NOT NULL,
+    product_name varchar(255) NOT NULL,
+    price bigint NOT NULL,
+    created_at timestamp NOT NULL,
+    sent_at timestamp,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (subscription_id)
+        REFERENCES subscriptions (id)
+        ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX subscription_alerts_pending_idx ON subscription_alerts (subscription_id) WHERE sent_at IS NULL;
+CREATE INDEX subscription_alerts_email_sent_at_idx ON subscription_alerts (email, sent_at);
+
+-- the transactional email outbox: messages are inserted in the transaction of the
+-- change they are about and sent afterwards. next_attempt_at is null once a message
+-- is sent (sent_at is set) or has failed too often to be retried (last_error is set).
+CREATE TABLE email_outbox
+(
+    id SERIAL,
+    template varchar(32) NOT NULL,
+    recipient varchar(128) NOT NULL,
+    subject varchar(255) NOT NULL,
+    html_body text NOT NULL,
+    text_body text NOT NULL,
+    headers jsonb NOT NULL DEFAULT '{}',
+    attempts smallint NOT NULL DEFAULT 0,
+    next_attempt_at timestamp,
+    last_error text,
+    created_at timestamp NOT NULL,
+    sent_at timestamp,
+
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX email_outbox_next_attempt_at_idx ON email_outbox (next_attempt_at) WHERE next_attempt_at IS NOT NULL;
+
+-- single use tokens emailed to users, only the SHA-256 hash of a token is stored.
+-- email is the address the token was sent to, used_at is set once it is used up.
+CREATE TABLE user_tokens
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    purpose varchar(32) NOT NULL,
+    email varchar(128) NOT NULL,
+    token_hash char(64) NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (token_hash),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE,
+    CHECK (purpose IN ('email_verification', 'password_reset', 'two_factor_challenge'))
+);
+
+CREATE INDEX user_tokens_user_id_purpose_created_at_idx ON user_tokens (user_id, purpose, created_at);
+
+-- failed logins, kept as an audit trail. user_id is null if there was no account with
+-- the email.
+CREATE TABLE login_attempts
+(
+    id SERIAL,
+    user_id int,
+    email varchar(128) NOT NULL,
+    ip varchar(64) NOT NULL,
+    reason varchar(16) NOT NULL,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE SET NULL,
+    CHECK (reason IN ('password', 'locked', 'two_factor'))
+);
+
+CREATE INDEX login_attempts_user_id_created_at_idx ON login_attempts (user_id, created_at);
+
+-- failed logins counted per account (by lower case email) and per ip address. Logins
+-- are locked until locked_until after too many failures.
+CREATE TABLE login_throttles
+(
+    scope varchar(16) NOT NULL,
+    subject varchar(128) NOT NULL,
+    failures int NOT NULL,
+    last_failure_at timestamp NOT NULL,
+    locked_until timestamp,
+
+    PRIMARY KEY (scope, subject),
+    CHECK (scope IN ('account', 'ip'))
+);
+
+-- the TOTP second factor of users. The secret has to be stored as is to compute codes.
+-- Two-factor authentication is required once confirmed_at is set, last_step is the
+-- time step of the last code used, so that a code cannot be used twice.
+CREATE TABLE user_totp
+(
+    user_id int NOT NULL,
+    secret varchar(64) NOT NULL,
+    confirmed_at timestamp,
+    last_step bigint NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+-- single use recovery codes for users who lost their authenticator, only the SHA-256
+-- hash of a code is stored.
+CREATE TABLE user_recovery_codes
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    code_hash char(64) NOT NULL,
+    used_at timestamp,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (user_id, code_hash),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+-- accounts of users at identity providers. subject identifies the user at the provider,
+-- email is the address the provider had for them when they were linked.
+CREATE TABLE user_identities
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    provider varchar(64) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(128) NOT NULL,
+    created_at timestamp NOT NULL,
+
+    PRIMARY KEY (id),
+    UNIQUE (provider, subject),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+-- logins with identity providers users were sent to and did not come back from yet,
+-- only the SHA-256 hash of the state and the binding of the login to the browser is stored.
+CREATE TABLE external_logins
+(
+    state_hash char(64) NOT NULL,
+    provider varchar(64) NOT NULL,
+    nonce varchar(64) NOT NULL,
+    code_verifier varchar(128) NOT NULL,
+    expires_at timestamp NOT NULL,
+
+    PRIMARY KEY (state_hash)
+);
+
+-- logins of users from devices, auth tokens carry the id of their session. ip is the
+-- address the session was last seen from.
+CREATE TABLE user_sessions
+(
+    id SERIAL,
+    user_id int NOT NULL,
+    device varchar(64) NOT NULL,
+    ip varchar(45) NOT NULL,
+    user_agent varchar(512) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_seen_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    revoked_at timestamp,
+
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id)
+        REFERENCES users (id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX user_sessions_user_id_idx ON user_sessions (user_id);
+
+-- keys systems of the shop use the API with instead of a user. Only the SHA-256 hash
+-- of a key is stored, prefix is its start in plain text to tell keys apart. scopes are
+-- separated by spaces.
+CREATE TABLE api_keys
+(
+    id SERIAL,
+    name varchar(64) NOT NULL,
+    prefix varchar(16) NOT NULL,
+    key_hash char(64) NOT NULL,
+    scopes varchar(255) NOT NULL,
+    created_by int,
+    created_at timestamp NOT NULL,
+    expires_at timestamp,
+    last_used_at timestamp,
+    revoked_at timestamp,
+
+    PRIMARY KEY (id),
+    UNIQUE (prefix),
+    FOREIGN KEY (created_by)
+        REFERENCES users (id)
+        ON DELETE SET NULL
+);
@@ -1,10 +1,52 @@
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS external_logins;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+DROP TABLE IF EXISTS login_throttles;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS email_outbox;
+DROP TABLE IF EXISTS subscription_alerts;
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS wishlist_items;
+DROP TABLE IF EXISTS wishlists;
+DROP TABLE IF EXISTS return_events;
+DROP TABLE IF EXISTS return_items;
+DROP TABLE IF EXISTS returns;
+DROP TABLE IF EXISTS shipment_items;
+DROP TABLE IF EXISTS shipments;
+DROP TABLE IF EXISTS order_item_taxes;
+DROP TABLE IF EXISTS tax_rates;
+DROP TABLE IF EXISTS exchange_rates;
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS cart_promotions;
+DROP TABLE IF EXISTS promotion_categories;
+DROP TABLE IF EXISTS promotion_products;
+DROP TABLE IF EXISTS promotions;
+DROP TABLE IF EXISTS review_votes;
+DROP TABLE IF EXISTS reviews;
 DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS order_items;
 DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS shipping_method_tiers;
+DROP TABLE IF EXISTS shipping_methods;
+DROP TABLE IF EXISTS shipping_zone_regions;
+DROP TABLE IF EXISTS shipping_zones;
 DROP TABLE IF EXISTS credit_cards;
+DROP TABLE IF EXISTS product_attribute_values;
+DROP TABLE IF EXISTS attribute_definitions;
+DROP TABLE IF EXISTS product_images;
+DROP TABLE IF EXISTS product_variant_images;
+DROP TABLE IF EXISTS product_variant_option_values;
+DROP TABLE IF EXISTS product_variants;
+DROP TABLE IF EXISTS product_option_values;
+DROP TABLE IF EXISTS product_options;
 DROP TABLE IF EXISTS products;
 DROP TABLE IF EXISTS product_categories;
 DROP TABLE IF EXISTS role_user_map;
 DROP TABLE IF EXISTS roles;
 DROP SEQUENCE IF EXISTS role_id_seq;
-DROP TABLE IF EXISTS users;
 DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS users;
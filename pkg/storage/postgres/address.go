@@ -17,51 +17,117 @@ type addressStorage struct {
 }
 
 func (s *addressStorage) SaveAddressWithTx(tx *sql.Tx, a *ecommerce.Address) (int, error) {
-	const op = "userStorage.SaveAddressWithTx"
+	const op = "addressStorage.SaveAddressWithTx"
 
 	if tx == nil {
 		return 0, errors2.Wrap(errors.New("transaction is nil"), op, "")
 	}
 
-	query := "INSERT INTO addresses (country, state, city, postal_code, address) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	query := `INSERT INTO addresses (customer_id, country, state, city, postal_code, address, is_default_shipping, is_default_billing)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
 	var id int
-	err := tx.QueryRow(query, a.Country, a.State, a.City, a.PostalCode, a.Address).Scan(&id)
+	err := tx.QueryRow(query, a.CustomerID, a.Country, a.State, a.City, a.PostalCode, a.Address,
+		a.DefaultShipping, a.DefaultBilling).Scan(&id)
 
 	return id, errors2.Wrap(err, op, "executing query")
 }
 
-func (s *addressStorage) UpdateAddress(a *ecommerce.Address) error {
-	const op = "userStorage.UpdateAddress"
+func (s *addressStorage) UpdateAddressWithTx(tx *sql.Tx, a *ecommerce.Address) error {
+	const op = "addressStorage.UpdateAddressWithTx"
 
-	query := "UPDATE addresses SET country = $1, state = $2, city = $3, postal_code = $4, address = $5 WHERE id = $6"
-	_, err := s.db.Exec(query, a.Country, a.State, a.City, a.PostalCode, a.Address, a.ID)
+	query := `UPDATE addresses SET country = $1, state = $2, city = $3, postal_code = $4, address = $5,
+				is_default_shipping = $6, is_default_billing = $7
+			WHERE id = $8`
+	_, err := tx.Exec(query, a.Country, a.State, a.City, a.PostalCode, a.Address, a.DefaultShipping, a.DefaultBilling, a.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// ClearDefaultsWithTx unsets the default shipping and/or billing flag on every address
+// of a customer.
+func (s *addressStorage) ClearDefaultsWithTx(tx *sql.Tx, custID int, shipping, billing bool) error {
+	const op = "addressStorage.ClearDefaultsWithTx"
+
+	query := fmt.Sprintf(`UPDATE addresses SET is_default_shipping = is_default_shipping AND NOT $1,
+				is_default_billing = is_default_billing AND NOT $2
+			WHERE customer_id = %d`, custID)
+	_, err := tx.Exec(query, shipping, billing)
 
 	return errors2.Wrap(err, op, "executing query")
 }
 
 func (s *addressStorage) Address(id int) (*ecommerce.Address, error) {
-	const op = "userStorage.Address"
+	const op = "addressStorage.Address"
 
-	query := fmt.Sprintf("SELECT country, state, city, postal_code, address FROM addresses WHERE id = %d", id)
+	query := fmt.Sprintf(`SELECT id, customer_id, country, state, city, postal_code, address, is_default_shipping, is_default_billing
+			FROM addresses WHERE id = %d`, id)
 
-	var a ecommerce.Address
-	a.ID = id
-	err := s.db.QueryRow(query).Scan(&a.Country, &a.State, &a.City, &a.PostalCode, &a.Address)
-	if err == sql.ErrNoRows {
-		return &a, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	aa, err := s.addresses(s.db, query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting addresses")
+	} else if len(aa) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting addresses")
 	}
 
-	return &a, errors2.Wrap(err, op, "executing query")
+	return &aa[0], nil
+}
+
+// Addresses returns the addresses of a customer, oldest first.
+func (s *addressStorage) Addresses(custID int) ([]ecommerce.Address, error) {
+	const op = "addressStorage.Addresses"
+
+	aa, err := s.addresses(s.db, addressesQuery(custID, false))
+
+	return aa, errors2.Wrap(err, op, "getting addresses")
 }
 
-func (s *addressStorage) DeleteAddress(tx *sql.Tx, id int) error {
-	const op = "userStorage.DeleteAddress"
+// AddressesWithTx returns the addresses of a customer, oldest first, and locks them for
+// the rest of tx.
+func (s *addressStorage) AddressesWithTx(tx *sql.Tx, custID int) ([]ecommerce.Address, error) {
+	const op = "addressStorage.AddressesWithTx"
+
+	aa, err := s.addresses(tx, addressesQuery(custID, true))
+
+	return aa, errors2.Wrap(err, op, "getting addresses")
+}
+
+func addressesQuery(custID int, lock bool) string {
+	query := fmt.Sprintf(`SELECT id, customer_id, country, state, city, postal_code, address, is_default_shipping, is_default_billing
+			FROM addresses WHERE customer_id = %d ORDER BY id`, custID)
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	return query
+}
+
+func (s *addressStorage) addresses(q querier, query string) ([]ecommerce.Address, error) {
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aa []ecommerce.Address
+	for rows.Next() {
+		var a ecommerce.Address
+		err = rows.Scan(&a.ID, &a.CustomerID, &a.Country, &a.State, &a.City, &a.PostalCode, &a.Address,
+			&a.DefaultShipping, &a.DefaultBilling)
+		if err != nil {
+			return nil, err
+		}
+		aa = append(aa, a)
+	}
+
+	return aa, rows.Err()
+}
+
+func (s *addressStorage) DeleteAddressWithTx(tx *sql.Tx, id int) error {
+	const op = "addressStorage.DeleteAddressWithTx"
 
 	query := fmt.Sprintf("DELETE FROM addresses WHERE id = %d", id)
-	fmt.Println(query)
-	_, err := s.db.Exec(query)
 
-	return errors2.Wrap(err, op, "executing query")
+	return errors2.Wrap(deleted(tx.Exec(query)), op, "executing query")
 }
 
 func (s *addressStorage) Tx() (*sql.Tx, error) {
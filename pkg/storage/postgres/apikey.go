@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"strings"
+	"time"
+)
+
+func NewAPIKeyStorage(db *sql.DB) *apiKeyStorage {
+	return &apiKeyStorage{db: db}
+}
+
+type apiKeyStorage struct {
+	db *sql.DB
+}
+
+// SaveAPIKey stores the scopes of k separated by spaces.
+func (s *apiKeyStorage) SaveAPIKey(k *ecommerce.APIKey, hash string) (int, error) {
+	const op = "apiKeyStorage.SaveAPIKey"
+
+	query := `INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id int
+	err := s.db.QueryRow(query, k.Name, k.Prefix, hash, strings.Join(k.Scopes, " "), k.CreatedBy, k.CreatedAt,
+		k.ExpiresAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *apiKeyStorage) APIKeys() ([]ecommerce.APIKey, error) {
+	const op = "apiKeyStorage.APIKeys"
+
+	query := `SELECT id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at
+			FROM api_keys WHERE revoked_at IS NULL ORDER BY created_at DESC, id DESC`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var kk []ecommerce.APIKey
+	for rows.Next() {
+		var k ecommerce.APIKey
+		if err = scanAPIKey(rows, &k); err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		kk = append(kk, k)
+	}
+
+	return kk, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+func (s *apiKeyStorage) APIKeyByPrefix(prefix string) (*ecommerce.APIKey, string, error) {
+	const op = "apiKeyStorage.APIKeyByPrefix"
+
+	query := `SELECT id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at, key_hash
+			FROM api_keys WHERE prefix = $1`
+	var k ecommerce.APIKey
+	var hash string
+	err := scanAPIKey(s.db.QueryRow(query, prefix), &k, &hash)
+	if err == sql.ErrNoRows {
+		return nil, "", errors2.Wrap(&errors2.NotFound{Err: errors.New("api key not found")}, op, "scanning into var")
+	} else if err != nil {
+		return nil, "", errors2.Wrap(err, op, "scanning into var")
+	}
+
+	return &k, hash, nil
+}
+
+func (s *apiKeyStorage) RevokeAPIKey(id int, now time.Time) error {
+	const op = "apiKeyStorage.RevokeAPIKey"
+
+	res, err := s.db.Exec("UPDATE api_keys SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", id, now)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *apiKeyStorage) TouchAPIKey(id int, now, usedSince time.Time) error {
+	const op = "apiKeyStorage.TouchAPIKey"
+
+	query := "UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)"
+	_, err := s.db.Exec(query, id, now, usedSince)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// scanAPIKey scans the columns of a key into k, followed by extra.
+func scanAPIKey(row interface{ Scan(...interface{}) error }, k *ecommerce.APIKey, extra ...interface{}) error {
+	var scopes string
+	var createdBy sql.NullInt64
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	dest := append([]interface{}{&k.ID, &k.Name, &k.Prefix, &scopes, &createdBy, &k.CreatedAt, &expiresAt, &lastUsedAt,
+		&revokedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	k.Scopes = strings.Fields(scopes)
+	// the admin who created the key may have been deleted
+	k.CreatedBy = int(createdBy.Int64)
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+
+	return nil
+}
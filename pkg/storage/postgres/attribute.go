@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"fmt"
+)
+
+func (s *productStorage) CreateAttributeDefinition(d *ecommerce.AttributeDefinition) (int, error) {
+	const op = "productStorage.CreateAttributeDefinition"
+
+	query := "INSERT INTO attribute_definitions (category_id, code, name, type, filterable) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int
+	err := s.db.QueryRow(query, d.CategoryID, d.Code, d.Name, d.Type, d.Filterable).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *productStorage) AllAttributeDefinitions() ([]ecommerce.AttributeDefinition, error) {
+	const op = "productStorage.AllAttributeDefinitions"
+
+	rows, err := s.db.Query("SELECT id, category_id, code, name, type, filterable FROM attribute_definitions ORDER BY code, id")
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var dd []ecommerce.AttributeDefinition
+	for rows.Next() {
+		var d ecommerce.AttributeDefinition
+		err = rows.Scan(&d.ID, &d.CategoryID, &d.Code, &d.Name, &d.Type, &d.Filterable)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		dd = append(dd, d)
+	}
+
+	return dd, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+// ReplaceProductAttributesWithTx replaces all attribute values of a product with attrs,
+// whose codes must all be defined in defs.
+func (s *productStorage) ReplaceProductAttributesWithTx(
+	tx *sql.Tx,
+	productID int,
+	defs []ecommerce.AttributeDefinition,
+	attrs map[string]interface{}) error {
+	const op = "productStorage.ReplaceProductAttributesWithTx"
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM product_attribute_values WHERE product_id = %d", productID))
+	if err != nil {
+		return errors2.Wrap(err, op, "deleting attribute values")
+	}
+
+	query := `INSERT INTO product_attribute_values (product_id, attribute_id, value_text, value_number, value_bool)
+			VALUES ($1, $2, $3, $4, $5)`
+	for _, d := range defs {
+		v, ok := attrs[d.Code]
+		if !ok {
+			continue
+		}
+
+		var number sql.NullFloat64
+		var boolean sql.NullBool
+		switch t := v.(type) {
+		case float64:
+			number = sql.NullFloat64{Float64: t, Valid: true}
+		case bool:
+			boolean = sql.NullBool{Bool: t, Valid: true}
+		}
+
+		_, err = tx.Exec(query, productID, d.ID, ecommerce.AttributeText(v), number, boolean)
+		if err != nil {
+			return errors2.Wrap(err, op, "inserting attribute value")
+		}
+	}
+
+	return nil
+}
+
+// attributes returns the attribute values of the products with ids in idStr keyed by product id.
+func (s *productStorage) attributes(idStr string) (map[int]map[string]interface{}, error) {
+	const op = "productStorage.attributes"
+
+	query := fmt.Sprintf(`SELECT pav.product_id, ad.code, pav.value_text, pav.value_number, pav.value_bool
+			FROM product_attribute_values pav
+			JOIN attribute_definitions ad ON ad.id = pav.attribute_id
+			WHERE pav.product_id IN (%s)`, idStr)
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	attributes := make(map[int]map[string]interface{})
+	for rows.Next() {
+		var productID int
+		var code, text string
+		var number sql.NullFloat64
+		var boolean sql.NullBool
+		err = rows.Scan(&productID, &code, &text, &number, &boolean)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+
+		if attributes[productID] == nil {
+			attributes[productID] = make(map[string]interface{})
+		}
+
+		switch {
+		case number.Valid:
+			attributes[productID][code] = number.Float64
+		case boolean.Valid:
+			attributes[productID][code] = boolean.Bool
+		default:
+			attributes[productID][code] = text
+		}
+	}
+
+	return attributes, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+// AttributeFacets counts the products listed for categoryID, searchTerm and filter per value
+// of every attribute in codes. The filter on an attribute is ignored when counting its own
+// values so that selecting one value does not hide the other values of the same attribute.
+func (s *productStorage) AttributeFacets(
+	categoryID int,
+	searchTerm string,
+	filter *ecommerce.ProductFilter,
+	codes []string) ([]ecommerce.Facet, error) {
+	const op = "productStorage.AttributeFacets"
+
+	var ff []ecommerce.Facet
+	for _, code := range codes {
+		whereQuery, params := productFilterQuery(categoryID, searchTerm, filter, code)
+		params = append(params, code)
+
+		query := fmt.Sprintf(`SELECT pav.value_text, COUNT(DISTINCT pav.product_id) AS n
+				FROM product_attribute_values pav
+				JOIN attribute_definitions ad ON ad.id = pav.attribute_id
+				WHERE ad.code = $%d AND pav.product_id IN (SELECT id FROM products WHERE %s)
+				GROUP BY pav.value_text
+				ORDER BY n DESC, pav.value_text`, len(params), whereQuery)
+
+		f := ecommerce.Facet{Code: code}
+		err := func() error {
+			rows, err := s.db.Query(query, params...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var v ecommerce.FacetValue
+				if err = rows.Scan(&v.Value, &v.Count); err != nil {
+					return err
+				}
+				f.Values = append(f.Values, v)
+			}
+
+			return rows.Err()
+		}()
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "counting values of " + code)
+		}
+
+		if len(f.Values) > 0 {
+			ff = append(ff, f)
+		}
+	}
+
+	return ff, nil
+}
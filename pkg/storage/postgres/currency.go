@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"math/big"
+)
+
+func NewCurrencyStorage(db *sql.DB) *currencyStorage {
+	return &currencyStorage{db: db}
+}
+
+type currencyStorage struct {
+	db *sql.DB
+}
+
+func (s *currencyStorage) SaveRateWithTx(tx *sql.Tx, r *ecommerce.ExchangeRate) error {
+	const op = "currencyStorage.SaveRateWithTx"
+
+	query := `INSERT INTO exchange_rates (currency, rate, rounding, updated_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, rounding = EXCLUDED.rounding, updated_at = EXCLUDED.updated_at`
+	_, err := tx.Exec(query, r.Currency, r.Rate, r.Rounding, r.UpdatedAt)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *currencyStorage) DeleteRate(currency string) error {
+	const op = "currencyStorage.DeleteRate"
+
+	res, err := s.db.Exec("DELETE FROM exchange_rates WHERE currency = $1", currency)
+	if err != nil {
+		return errors2.Wrap(err, op, "executing query")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting affected rows")
+	} else if n < 1 {
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "executing query")
+	}
+
+	return nil
+}
+
+func (s *currencyStorage) Rate(currency string) (*ecommerce.ExchangeRate, error) {
+	const op = "currencyStorage.Rate"
+
+	rr, err := s.rates("WHERE currency = $1", currency)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting rates")
+	} else if len(rr) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting rates")
+	}
+
+	return &rr[0], nil
+}
+
+func (s *currencyStorage) Rates() ([]ecommerce.ExchangeRate, error) {
+	const op = "currencyStorage.Rates"
+
+	rr, err := s.rates("")
+
+	return rr, errors2.Wrap(err, op, "getting rates")
+}
+
+func (s *currencyStorage) rates(where string, args ...interface{}) ([]ecommerce.ExchangeRate, error) {
+	rows, err := s.db.Query("SELECT currency, rate, rounding, updated_at FROM exchange_rates " + where + " ORDER BY currency", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rr []ecommerce.ExchangeRate
+	for rows.Next() {
+		var r ecommerce.ExchangeRate
+		err = rows.Scan(&r.Currency, &r.Rate, &r.Rounding, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.Rate = trimRate(r.Rate)
+		rr = append(rr, r)
+	}
+
+	return rr, rows.Err()
+}
+
+func (s *currencyStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
+
+// trimRate strips the trailing zeros postgres pads numeric rates with.
+func trimRate(rate string) string {
+	rat, ok := new(big.Rat).SetString(rate)
+	if !ok {
+		return rate
+	}
+	return ecommerce.FormatRate(rat)
+}
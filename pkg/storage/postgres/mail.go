@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"encoding/json"
+	"time"
+)
+
+func NewMailStorage(db *sql.DB) *mailStorage {
+	return &mailStorage{db: db}
+}
+
+type mailStorage struct {
+	db *sql.DB
+}
+
+func (s *mailStorage) SaveMessageWithTx(tx *sql.Tx, m *ecommerce.OutboxMessage) (int, error) {
+	const op = "mailStorage.SaveMessageWithTx"
+
+	headers, err := json.Marshal(m.Message.Headers)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "encoding headers")
+	}
+
+	query := `INSERT INTO email_outbox (template, recipient, subject, html_body, text_body, headers, attempts,
+				next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	var id int
+	err = tx.QueryRow(query, m.Template, m.Message.To, m.Message.Subject, m.Message.HTML, m.Message.Text, headers,
+		m.Attempts, m.NextAttemptAt, m.CreatedAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+// DueMessagesWithTx returns up to limit unsent messages whose next attempt is due at
+// now, oldest first, and locks them until tx ends.
+func (s *mailStorage) DueMessagesWithTx(tx *sql.Tx, now time.Time, limit int) ([]ecommerce.OutboxMessage, error) {
+	const op = "mailStorage.DueMessagesWithTx"
+
+	query := `SELECT id, template, recipient, subject, html_body, text_body, headers, attempts, next_attempt_at,
+				last_error, created_at
+			FROM email_outbox WHERE next_attempt_at <= $1
+			ORDER BY next_attempt_at, id LIMIT $2 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query, now, limit)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var mm []ecommerce.OutboxMessage
+	for rows.Next() {
+		var m ecommerce.OutboxMessage
+		var headers []byte
+		var next time.Time
+		var lastError sql.NullString
+		err = rows.Scan(&m.ID, &m.Template, &m.Message.To, &m.Message.Subject, &m.Message.HTML, &m.Message.Text,
+			&headers, &m.Attempts, &next, &lastError, &m.CreatedAt)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		if err = json.Unmarshal(headers, &m.Message.Headers); err != nil {
+			return nil, errors2.Wrap(err, op, "decoding headers")
+		}
+		m.NextAttemptAt = &next
+		m.LastError = storage.NullableStrToStr(lastError)
+		mm = append(mm, m)
+	}
+
+	return mm, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+// UpdateMessageWithTx saves the attempts, next attempt, last error, sent time and bodies of m.
+func (s *mailStorage) UpdateMessageWithTx(tx *sql.Tx, m *ecommerce.OutboxMessage) error {
+	const op = "mailStorage.UpdateMessageWithTx"
+
+	query := "UPDATE email_outbox SET attempts = $1, next_attempt_at = $2, last_error = $3, sent_at = $4, " +
+		"html_body = $5, text_body = $6 WHERE id = $7"
+	_, err := tx.Exec(query, m.Attempts, m.NextAttemptAt, storage.StrToNullableStr(m.LastError), m.SentAt,
+		m.Message.HTML, m.Message.Text, m.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *mailStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
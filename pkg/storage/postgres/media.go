@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"errors"
+	"fmt"
+)
+
+func NewMediaStorage(db *sql.DB) *mediaStorage {
+	return &mediaStorage{db: db}
+}
+
+type mediaStorage struct {
+	db *sql.DB
+}
+
+func (s *mediaStorage) SaveProductImageWithTx(tx *sql.Tx, img *ecommerce.ProductImage) (int, error) {
+	const op = "mediaStorage.SaveProductImageWithTx"
+
+	if tx == nil {
+		return 0, errors2.Wrap(errors.New("transaction is nil"), op, "")
+	}
+
+	query := `INSERT INTO product_images
+			(product_id, position, content_type, original_key, thumbnail_key, medium_key, large_key)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, img.ProductID, img.Position, img.ContentType,
+		img.Keys[ecommerce.RenditionOriginal], img.Keys[ecommerce.RenditionThumbnail],
+		img.Keys[ecommerce.RenditionMedium], img.Keys[ecommerce.RenditionLarge]).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *mediaStorage) ProductImages(productID int) ([]ecommerce.ProductImage, error) {
+	const op = "mediaStorage.ProductImages"
+
+	images, err := productImages(s.db, fmt.Sprintf("%d", productID))
+
+	return images[productID], errors2.Wrap(err, op, "getting images")
+}
+
+func (s *mediaStorage) DeleteProductImage(productID, imageID int) error {
+	const op = "mediaStorage.DeleteProductImage"
+
+	query := fmt.Sprintf("DELETE FROM product_images WHERE id = %d AND product_id = %d", imageID, productID)
+	_, err := s.db.Exec(query)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *mediaStorage) UpdateImagePositionsWithTx(tx *sql.Tx, productID int, imageIDs []int) error {
+	const op = "mediaStorage.UpdateImagePositionsWithTx"
+
+	query := "UPDATE product_images SET position = $1 WHERE id = $2 AND product_id = $3"
+	for position, id := range imageIDs {
+		if _, err := tx.Exec(query, position, id, productID); err != nil {
+			return errors2.Wrap(err, op, "executing query")
+		}
+	}
+
+	return nil
+}
+
+func (s *mediaStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
+
+// productImages returns the images of the products with ids in idStr
+// keyed by product id and ordered by position.
+func productImages(db storage.Queryer, idStr string) (map[int][]ecommerce.ProductImage, error) {
+	const op = "postgres.productImages"
+
+	query := fmt.Sprintf(`SELECT id, product_id, position, content_type, original_key, thumbnail_key, medium_key, large_key
+			FROM product_images
+			WHERE product_id IN (%s)
+			ORDER BY product_id, position, id`, idStr)
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	images := make(map[int][]ecommerce.ProductImage)
+	for rows.Next() {
+		var img ecommerce.ProductImage
+		var original, thumbnail, medium, large string
+		err = rows.Scan(&img.ID, &img.ProductID, &img.Position, &img.ContentType, &original, &thumbnail, &medium, &large)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		img.Keys = map[string]string{
+			ecommerce.RenditionOriginal:  original,
+			ecommerce.RenditionThumbnail: thumbnail,
+			ecommerce.RenditionMedium:    medium,
+			ecommerce.RenditionLarge:     large,
+		}
+		images[img.ProductID] = append(images[img.ProductID], img)
+	}
+
+	return images, errors2.Wrap(rows.Err(), op, "error after scan")
+}
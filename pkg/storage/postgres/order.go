@@ -16,40 +16,63 @@ type orderStorage struct {
 	db *sql.DB
 }
 
+// SaveOrder saves an order together with its items.
 func (s *orderStorage) SaveOrder(tx *sql.Tx, o *ecommerce.Order) (int, error) {
 	const op = "orderStorage.SaveOrder"
 
-	query := "INSERT INTO orders (product_id, ordered_at, shipping_address_id, quantity, customer_id) " +
-		"VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	if o.Status == "" {
+		o.Status = ecommerce.OrderStatusPending
+	}
+
+	// amounts are stored in minor units of the order currency
+	a := o.ShippingAddress
+	query := `INSERT INTO orders (customer_id, shipping_country, shipping_state, shipping_city, shipping_postal_code,
+				shipping_address, ordered_at, status, currency, exchange_rate, subtotal, discount, tax, tax_inclusive,
+				shipping_method_id, shipping_method, shipping_cost, total, free_shipping)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id`
 	var id int
-	err := tx.QueryRow(query, o.Product.ID, o.OrderedAt, o.ShippingAddressID, o.Quantity).Scan(&id)
+	err := tx.QueryRow(query, o.CustomerID, a.Country, a.State, a.City, a.PostalCode, a.Address, o.OrderedAt, o.Status,
+		o.Total.Currency, o.ExchangeRate, o.Subtotal.Amount, o.Discount.Amount, o.Tax.Amount, o.TaxInclusive,
+		storage.IntToNullableInt(int64(o.ShippingMethodID)), o.ShippingMethod, o.ShippingCost.Amount, o.Total.Amount,
+		o.FreeShipping).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "saving order")
+	}
+
+	query = `INSERT INTO order_items (order_id, product_id, variant_id, quantity, unit_price, discount, tax)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	taxQuery := `INSERT INTO order_item_taxes (order_item_id, tax_rate_id, name, rate, amount) VALUES ($1, $2, $3, $4, $5)`
+	for i := range o.Items {
+		item := &o.Items[i]
+		err = tx.QueryRow(query, id, item.Product.ID, storage.IntToNullableInt(int64(item.VariantID)),
+			item.Quantity, item.UnitPrice.Amount, item.Discount.Amount, item.Tax.Amount).Scan(&item.ID)
+		if err != nil {
+			return 0, errors2.Wrap(err, op, "saving order item")
+		}
+
+		// the name and rate are copied so that the breakdown outlives changes to the rate
+		for _, t := range item.Taxes {
+			_, err = tx.Exec(taxQuery, item.ID, storage.IntToNullableInt(int64(t.RateID)), t.Name, t.Rate, t.Amount.Amount)
+			if err != nil {
+				return 0, errors2.Wrap(err, op, "saving order item tax")
+			}
+		}
+	}
 
-	return id, errors2.Wrap(err, op, "executing query")
+	return id, nil
 }
 
 func (s *orderStorage) Order(id int) (*ecommerce.Order, error) {
 	const op = "orderStorage.Order"
 
-	query := fmt.Sprintf(
-		`SELECT 
-					product_id, 
-					ordered_at, 
-					shipping_address_id, 
-					quantity, 
-					customer_id 
-				FROM orders JOIN PRODUC
-				WHERE id = %d`,
-		id,
-	)
-
-	var o ecommerce.Order
-	o.ID = id
-	err := s.db.QueryRow(query).Scan(&o.Product.ID, &o.OrderedAt, &o.ShippingAddressID, &o.Quantity, &o.CustomerID)
-	if err == sql.ErrNoRows {
-		return &o, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	oo, err := s.Orders([]int{id})
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting orders")
+	} else if len(oo) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting orders")
 	}
 
-	return &o, errors2.Wrap(err, op, "executing query")
+	return &oo[0], nil
 }
 
 func (s *orderStorage) Orders(ids []int) ([]ecommerce.Order, error) {
@@ -59,11 +82,14 @@ func (s *orderStorage) Orders(ids []int) ([]ecommerce.Order, error) {
 		return nil, nil
 	}
 
+	idStr := storage.IntSliceToCommaSeparatedStr(ids)
 	query := fmt.Sprintf(
-		`SELECT product_id, ordered_at, shipping_address_id, quantity, customer_id 
-					WHERE id IN (%s)`,
-		storage.IntSliceToCommaSeparatedStr(ids),
-	) // todo:: order
+		`SELECT id, COALESCE(customer_id, 0), shipping_country, shipping_state, shipping_city, shipping_postal_code, shipping_address,
+					ordered_at, status, currency, exchange_rate, subtotal, discount, tax,
+					tax_inclusive, shipping_method_id, shipping_method, shipping_cost, total, free_shipping
+				FROM orders WHERE id IN (%s) ORDER BY ordered_at DESC, id DESC`,
+		idStr,
+	)
 
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -74,15 +100,151 @@ func (s *orderStorage) Orders(ids []int) ([]ecommerce.Order, error) {
 	var oo []ecommerce.Order
 	for rows.Next() {
 		var o ecommerce.Order
-		err := rows.Scan(&o.Product.ID, &o.OrderedAt, &o.ShippingAddressID, &o.Quantity, &o.CustomerID)
-		if err == sql.ErrNoRows {
+		var currency string
+		var subtotal, discount, tax, shippingCost, total int64
+		var shippingMethodID sql.NullInt64
+		a := &o.ShippingAddress
+		err := rows.Scan(&o.ID, &o.CustomerID, &a.Country, &a.State, &a.City, &a.PostalCode, &a.Address, &o.OrderedAt,
+			&o.Status, &currency, &o.ExchangeRate, &subtotal, &discount, &tax, &o.TaxInclusive, &shippingMethodID, &o.ShippingMethod, &shippingCost, &total, &o.FreeShipping)
+		if err != nil {
 			return nil, errors2.Wrap(err, op, "scanning")
 		}
+		o.ExchangeRate = trimRate(o.ExchangeRate)
+		o.Subtotal = ecommerce.NewMoney(subtotal, currency)
+		o.Discount = ecommerce.NewMoney(discount, currency)
+		o.Tax = ecommerce.NewMoney(tax, currency)
+		o.ShippingMethodID = int(storage.NullableIntToInt(shippingMethodID))
+		o.ShippingCost = ecommerce.NewMoney(shippingCost, currency)
+		o.Total = ecommerce.NewMoney(total, currency)
 
 		oo = append(oo, o)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, errors2.Wrap(err, op, "errors after row scan")
+	}
+
+	items, err := s.orderItems(idStr)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting order items")
+	}
+	for i := range oo {
+		oo[i].Items = items[oo[i].ID]
+	}
+
+	return oo, nil
+}
+
+// orderItems returns the items of the orders in idStr keyed by order id.
+func (s *orderStorage) orderItems(idStr string) (map[int][]ecommerce.OrderItem, error) {
+	const op = "orderStorage.orderItems"
+
+	query := fmt.Sprintf(`SELECT oi.id, oi.order_id, oi.product_id, oi.variant_id, oi.quantity, oi.unit_price, oi.discount, oi.tax,
+				o.currency
+			FROM order_items oi JOIN orders o ON o.id = oi.order_id WHERE oi.order_id IN (%s) ORDER BY oi.id`, idStr)
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	items := make(map[int][]ecommerce.OrderItem)
+	for rows.Next() {
+		var item ecommerce.OrderItem
+		var orderID int
+		var variantID sql.NullInt64
+		var unitPrice, discount, tax int64
+		var currency string
+		err = rows.Scan(&item.ID, &orderID, &item.Product.ID, &variantID, &item.Quantity, &unitPrice, &discount, &tax,
+			&currency)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		item.UnitPrice = ecommerce.NewMoney(unitPrice, currency)
+		item.Discount = ecommerce.NewMoney(discount, currency)
+		item.Tax = ecommerce.NewMoney(tax, currency)
+		item.VariantID = int(storage.NullableIntToInt(variantID))
+		items[orderID] = append(items[orderID], item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors2.Wrap(err, op, "errors after row scan")
+	}
+
+	taxes, err := s.orderItemTaxes(idStr)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting order item taxes")
+	}
+	for _, ii := range items {
+		for i := range ii {
+			ii[i].Taxes = taxes[ii[i].ID]
+			if ii[i].Taxes == nil { ii[i].Taxes = []ecommerce.TaxAmount{} }
+		}
+	}
+
+	return items, nil
+}
+
+// orderItemTaxes returns the tax breakdown of the items of the orders in idStr keyed by item id.
+func (s *orderStorage) orderItemTaxes(idStr string) (map[int][]ecommerce.TaxAmount, error) {
+	query := fmt.Sprintf(`SELECT t.order_item_id, t.tax_rate_id, t.name, t.rate, t.amount, o.currency
+			FROM order_item_taxes t
+			JOIN order_items oi ON oi.id = t.order_item_id
+			JOIN orders o ON o.id = oi.order_id
+			WHERE oi.order_id IN (%s) ORDER BY t.id`, idStr)
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taxes := make(map[int][]ecommerce.TaxAmount)
+	for rows.Next() {
+		var t ecommerce.TaxAmount
+		var itemID int
+		var rateID sql.NullInt64
+		var amount int64
+		var currency string
+		err = rows.Scan(&itemID, &rateID, &t.Name, &t.Rate, &amount, &currency)
+		if err != nil {
+			return nil, err
+		}
+		t.RateID = int(storage.NullableIntToInt(rateID))
+		t.Rate = trimRate(t.Rate)
+		t.Amount = ecommerce.NewMoney(amount, currency)
+		taxes[itemID] = append(taxes[itemID], t)
+	}
+
+	return taxes, rows.Err()
+}
+
+func (s *orderStorage) UpdateOrderStatus(id int, status string) error {
+	const op = "orderStorage.UpdateOrderStatus"
+
+	_, err := s.db.Exec("UPDATE orders SET status = $1 WHERE id = $2", status, id)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *orderStorage) UpdateOrderStatusWithTx(tx *sql.Tx, id int, status string) error {
+	const op = "orderStorage.UpdateOrderStatusWithTx"
+
+	_, err := tx.Exec("UPDATE orders SET status = $1 WHERE id = $2", status, id)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// OrderStatusWithTx returns the status of an order and locks the order until tx ends.
+func (s *orderStorage) OrderStatusWithTx(tx *sql.Tx, id int) (string, error) {
+	const op = "orderStorage.OrderStatusWithTx"
+
+	var status string
+	err := tx.QueryRow(fmt.Sprintf("SELECT status FROM orders WHERE id = %d FOR UPDATE", id)).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	}
 
-	return oo, errors2.Wrap(rows.Err(), op, "errors after row scan")
+	return status, errors2.Wrap(err, op, "executing query")
 }
 
 func (s *orderStorage) Tx() (*sql.Tx, error) {
@@ -7,6 +7,9 @@ import (
 	"ecommerce/pkg/storage"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 )
 
 func NewProductStorage(db *sql.DB) *productStorage {
@@ -65,9 +68,6 @@ type productStorage struct {
 		"WHERE 1=1 %s %s %s %s %s ORDER BY id %s",
 		categoryQuery, searchQuery, minPriceQuery, maxPriceQuery, discountQuery, limitQuery)
 
-	fmt.Println(query)
-	fmt.Println("page", page)
-
 	row, err := s.db.Query(query, params...)
 	if err != nil {
 		return nil, err
@@ -104,10 +104,56 @@ func (s *productStorage) ProductIDs(
 
 	const op = "productStorage.ProductIDs"
 
+	whereQuery, params := productFilterQuery(categoryID, searchTerm, filter, "")
+
+	var limitQuery string
+	if page < 1 {
+		return nil, errors2.Wrap(errors.New("page cannot be less than one"), op, "")
+	}
+
+	if size < 1 {
+		return nil, errors.New("size cannot be less than one")
+	}
+
+	offset := (page - 1) * size
+	limitQuery = fmt.Sprintf("LIMIT %d OFFSET %d", size, offset)
+
+	query := fmt.Sprintf("SELECT id FROM products WHERE %s ORDER BY id %s", whereQuery, limitQuery)
+
+	row, err := s.db.Query(query, params...)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer row.Close()
+
+	var ids []int
+	for row.Next() {
+		var id int
+		err = row.Scan(&id)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, errors2.Wrap(row.Err(), op, "error after scan")
+}
+
+// productFilterQuery returns the WHERE clause selecting the products listed under categoryID
+// or any of its descendants that match searchTerm and filter, along with its parameters.
+// The attribute filter with code skipAttribute is left out, this is used to compute facets.
+func productFilterQuery(categoryID int, searchTerm string, filter *ecommerce.ProductFilter, skipAttribute string) (string, []interface{}) {
 	var params []interface{}
 	var categoryQuery string
 	if categoryID > 0 {
-		categoryQuery = fmt.Sprintf("AND category_id = %d", categoryID)
+		// include products of every descendant category
+		categoryQuery = fmt.Sprintf(`AND category_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM product_categories WHERE id = %d
+				UNION
+				SELECT c.id FROM product_categories c INNER JOIN subtree ON c.parent_id = subtree.id
+			)
+			SELECT id FROM subtree)`, categoryID)
 	}
 
 	var searchQuery string
@@ -118,52 +164,103 @@ func (s *productStorage) ProductIDs(
 
 	var minPriceQuery, maxPriceQuery, discountQuery string
 	if filter != nil {
-		if filter.MinPrice > 0 {
-			minPriceQuery = fmt.Sprintf("AND price >= %f", filter.MinPrice)
+		if filter.MinPrice.Amount > 0 {
+			minPriceQuery = fmt.Sprintf("AND price >= %d", filter.MinPrice.Amount)
 		}
-		if filter.MaxPrice > 0 {
-			maxPriceQuery = fmt.Sprintf("AND price <= %f", filter.MaxPrice)
+		if filter.MaxPrice.Amount > 0 {
+			maxPriceQuery = fmt.Sprintf("AND price <= %d", filter.MaxPrice.Amount)
 		}
 		/*if filter.Discount > 0 {
 			discountQuery = "AND p.price"
 		}*/
 	}
 
-	var limitQuery string
-	if page < 1 {
-		return nil, errors2.Wrap(errors.New("page cannot be less than one"), op, "")
+	var optionQuery string
+	if filter != nil && len(filter.Options) > 0 {
+		var q string
+		q, params = optionFilterQuery(filter.Options, params)
+		optionQuery = "AND id IN (" + q + ")"
 	}
 
-	if size < 1 {
-		return nil, errors.New("size cannot be less than one")
+	var attributeQuery string
+	if filter != nil && len(filter.Attributes) > 0 {
+		attributeQuery, params = attributeFilterQuery(filter.Attributes, skipAttribute, params)
 	}
 
-	offset := (page - 1) * size
-	limitQuery = fmt.Sprintf("LIMIT %d OFFSET %d", size, offset)
+	query := fmt.Sprintf("1=1 %s %s %s %s %s %s %s",
+		categoryQuery, searchQuery, minPriceQuery, maxPriceQuery, discountQuery, optionQuery, attributeQuery)
 
-	query := fmt.Sprintf("SELECT id FROM products WHERE 1=1 %s %s %s %s %s ORDER BY id %s",
-		categoryQuery, searchQuery, minPriceQuery, maxPriceQuery, discountQuery, limitQuery)
+	return query, params
+}
 
-	fmt.Println(query)
-	fmt.Println("page", page)
+// attributeFilterQuery returns conditions requiring products to have one of the
+// given values for every attribute code in attributes except skip. Values are
+// compared case insensitively to the canonical text of the stored value.
+func attributeFilterQuery(attributes map[string][]string, skip string, params []interface{}) (string, []interface{}) {
+	codes := make([]string, 0, len(attributes))
+	for code := range attributes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
 
-	row, err := s.db.Query(query, params...)
-	if err != nil {
-		return nil, errors2.Wrap(err, op, "executing query")
+	var query string
+	for _, code := range codes {
+		if code == skip || len(attributes[code]) < 1 {
+			continue
+		}
+
+		params = append(params, code)
+		codeParam := len(params)
+
+		var valueParams []string
+		for _, value := range attributes[code] {
+			params = append(params, strings.ToLower(value))
+			valueParams = append(valueParams, fmt.Sprintf("$%d", len(params)))
+		}
+
+		query += fmt.Sprintf(` AND id IN (
+			SELECT pav.product_id FROM product_attribute_values pav
+			JOIN attribute_definitions ad ON ad.id = pav.attribute_id
+			WHERE ad.code = $%d AND lower(pav.value_text) IN (%s))`,
+			codeParam, strings.Join(valueParams, ", "))
 	}
-	defer row.Close()
 
-	var ids []int
-	for row.Next() {
-		var id int
-		err = row.Scan(&id)
-		if err != nil {
-			return nil, errors2.Wrap(err, op, "scanning")
+	return query, params
+}
+
+// optionFilterQuery returns a query selecting the ids of products having at least
+// one variant that matches a value of every option in options. Option names and
+// values are compared case insensitively and appended to params.
+func optionFilterQuery(options map[string][]string, params []interface{}) (string, []interface{}) {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	query := "SELECT v.product_id FROM product_variants v WHERE 1=1"
+	for _, name := range names {
+		params = append(params, strings.ToLower(name))
+		nameParam := len(params)
+
+		var valueParams []string
+		for _, value := range options[name] {
+			params = append(params, strings.ToLower(value))
+			valueParams = append(valueParams, fmt.Sprintf("$%d", len(params)))
 		}
-		ids = append(ids, id)
+		if len(valueParams) < 1 {
+			continue
+		}
+
+		query += fmt.Sprintf(` AND EXISTS (
+			SELECT 1 FROM product_variant_option_values vov
+			JOIN product_option_values ov ON ov.id = vov.option_value_id
+			JOIN product_options o ON o.id = ov.option_id
+			WHERE vov.variant_id = v.id AND lower(o.name) = $%d AND lower(ov.value) IN (%s))`,
+			nameParam, strings.Join(valueParams, ", "))
 	}
 
-	return ids, errors2.Wrap(row.Err(), op, "error after scan")
+	return query, params
 }
 
 func (s *productStorage) ProductsFromIDs(ids []int) ([]ecommerce.Product, error) {
@@ -172,7 +269,7 @@ func (s *productStorage) ProductsFromIDs(ids []int) ([]ecommerce.Product, error)
 		return nil, nil
 	}
 
-	query := fmt.Sprintf("SELECT id, category_id, name, price, old_price, rating FROM products WHERE id IN (%s)", storage.IntSliceToCommaSeparatedStr(ids))
+	query := fmt.Sprintf("SELECT id, category_id, name, price, old_price, quantity, tax_category, weight, rating, rating_sum, review_count FROM products WHERE id IN (%s)", storage.IntSliceToCommaSeparatedStr(ids))
 
 	row, err := s.db.Query(query)
 	if err != nil {
@@ -183,14 +280,16 @@ func (s *productStorage) ProductsFromIDs(ids []int) ([]ecommerce.Product, error)
 	var pp []ecommerce.Product
 	for row.Next() {
 		var p ecommerce.Product
-		var oldPrice sql.NullFloat64
-		var rating sql.NullInt64
-		err = row.Scan(&p.ID, &p.CategoryID, &p.Name, &p.Price.Current, &oldPrice, &rating)
+		var price int64
+		var oldPrice, rating sql.NullInt64
+		var ratingSum int
+		err = row.Scan(&p.ID, &p.CategoryID, &p.Name, &price, &oldPrice, &p.Quantity, &p.TaxCategory, &p.Weight, &rating, &ratingSum, &p.ReviewCount)
 		if err != nil {
 			return nil, err
 		}
-		p.Price.Old = float32(storage.NullableFloatToFloat(oldPrice))
+		p.Price = catalogPrice(price, oldPrice)
 		p.Rating = int(storage.NullableIntToInt(rating))
+		p.AverageRating = averageRating(ratingSum, p.ReviewCount)
 		pp = append(pp, p)
 	}
 
@@ -198,14 +297,217 @@ func (s *productStorage) ProductsFromIDs(ids []int) ([]ecommerce.Product, error)
 		return nil, err
 	}
 
+	err = s.attachDetails(pp)
+	if err != nil {
+		return nil, err
+	}
+
 	return pp, nil
 }
 
-func (s *productStorage) CreateCategory(name string) (int, error) {
-	query := "INSERT INTO product_categories (name) VALUES ($1) RETURNING id"
+// attachDetails loads the options, variants, images and attributes of all products in pp
+// with a fixed number of queries regardless of the number of products.
+func (s *productStorage) attachDetails(pp []ecommerce.Product) error {
+	const op = "productStorage.attachDetails"
+
+	if len(pp) < 1 {
+		return nil
+	}
+
+	ids := make([]int, len(pp))
+	for i, p := range pp {
+		ids[i] = p.ID
+	}
+	idStr := storage.IntSliceToCommaSeparatedStr(ids)
+
+	options, err := s.options(idStr)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting options")
+	}
+
+	vv, err := s.queryVariants(fmt.Sprintf("WHERE product_id IN (%s)", idStr))
+	if err != nil {
+		return errors2.Wrap(err, op, "getting variants")
+	}
+
+	images, err := productImages(s.db, idStr)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting images")
+	}
+
+	attributes, err := s.attributes(idStr)
+	if err != nil {
+		return errors2.Wrap(err, op, "getting attributes")
+	}
+
+	for i := range pp {
+		pp[i].Attributes = attributes[pp[i].ID]
+		pp[i].Images = images[pp[i].ID]
+		pp[i].Options = options[pp[i].ID]
+		for _, v := range vv {
+			if v.ProductID == pp[i].ID {
+				pp[i].Variants = append(pp[i].Variants, v)
+			}
+		}
+	}
+
+	return nil
+}
+
+// options returns the options of the products with ids in idStr keyed by product id.
+func (s *productStorage) options(idStr string) (map[int][]ecommerce.ProductOption, error) {
+	const op = "productStorage.options"
+
+	query := fmt.Sprintf(`SELECT o.id, o.product_id, o.name, v.id, v.value
+			FROM product_options o
+			LEFT JOIN product_option_values v ON v.option_id = o.id
+			WHERE o.product_id IN (%s)
+			ORDER BY o.product_id, o.id, v.position, v.id`, idStr)
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	options := make(map[int][]ecommerce.ProductOption)
+	for rows.Next() {
+		var o ecommerce.ProductOption
+		var valueID sql.NullInt64
+		var value sql.NullString
+		err = rows.Scan(&o.ID, &o.ProductID, &o.Name, &valueID, &value)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+
+		oo := options[o.ProductID]
+		if len(oo) < 1 || oo[len(oo)-1].ID != o.ID {
+			oo = append(oo, o)
+		}
+		if valueID.Valid {
+			last := &oo[len(oo)-1]
+			last.Values = append(last.Values, ecommerce.ProductOptionValue{
+				ID:       int(valueID.Int64),
+				OptionID: o.ID,
+				Value:    storage.NullableStrToStr(value),
+			})
+		}
+		options[o.ProductID] = oo
+	}
+
+	return options, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+// queryVariants returns variants matching the where clause along with
+// their option values and images.
+func (s *productStorage) queryVariants(where string) ([]ecommerce.ProductVariant, error) {
+	const op = "productStorage.queryVariants"
+
+	query := "SELECT id, product_id, sku, price, old_price, quantity FROM product_variants " + where + " ORDER BY id"
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var vv []ecommerce.ProductVariant
+	for rows.Next() {
+		var v ecommerce.ProductVariant
+		var price, oldPrice sql.NullInt64
+		err = rows.Scan(&v.ID, &v.ProductID, &v.SKU, &price, &oldPrice, &v.Quantity)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		if price.Valid {
+			p := catalogPrice(price.Int64, oldPrice)
+			v.Price = &p
+		}
+		vv = append(vv, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors2.Wrap(err, op, "error after scan")
+	}
+
+	if len(vv) < 1 {
+		return nil, nil
+	}
+
+	variantIDs := make([]int, len(vv))
+	for i, v := range vv {
+		variantIDs[i] = v.ID
+	}
+	idStr := storage.IntSliceToCommaSeparatedStr(variantIDs)
+
+	optionValues, err := s.variantInts(fmt.Sprintf(
+		"SELECT variant_id, option_value_id FROM product_variant_option_values WHERE variant_id IN (%s) ORDER BY option_value_id", idStr))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting variant option values")
+	}
+
+	images, err := s.variantImages(idStr)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting variant images")
+	}
+
+	for i := range vv {
+		vv[i].OptionValueIDs = optionValues[vv[i].ID]
+		vv[i].Images = images[vv[i].ID]
+	}
+
+	return vv, nil
+}
+
+// variantInts runs query selecting (variant_id, int) rows and groups the second column by variant id.
+func (s *productStorage) variantInts(query string) (map[int][]int, error) {
+	const op = "productStorage.variantInts"
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	m := make(map[int][]int)
+	for rows.Next() {
+		var variantID, n int
+		if err = rows.Scan(&variantID, &n); err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		m[variantID] = append(m[variantID], n)
+	}
+
+	return m, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+func (s *productStorage) variantImages(idStr string) (map[int][]string, error) {
+	const op = "productStorage.variantImages"
+
+	query := fmt.Sprintf("SELECT variant_id, url FROM product_variant_images WHERE variant_id IN (%s) ORDER BY position", idStr)
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	m := make(map[int][]string)
+	for rows.Next() {
+		var variantID int
+		var url string
+		if err = rows.Scan(&variantID, &url); err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		m[variantID] = append(m[variantID], url)
+	}
+
+	return m, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+func (s *productStorage) CreateCategory(c *ecommerce.Category) (int, error) {
+	query := "INSERT INTO product_categories (name, slug, parent_id) VALUES ($1, $2, $3) RETURNING id"
 
 	var id int
-	err := s.db.QueryRow(query, name).Scan(&id)
+	err := s.db.QueryRow(query, c.Name, c.Slug, storage.IntToNullableInt(int64(c.ParentID))).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -213,12 +515,54 @@ func (s *productStorage) CreateCategory(name string) (int, error) {
 	return id, nil
 }
 
-func (s *productStorage) CreateProduct(p *ecommerce.Product) (int, error) {
-	query := "INSERT INTO products (name, category_id, price, description, quantity) " +
-		"VALUES ($1, $2, $3, $4, $5) RETURNING id"
+func (s *productStorage) AllCategories() ([]ecommerce.Category, error) {
+	const op = "productStorage.AllCategories"
+
+	rows, err := s.db.Query("SELECT id, name, slug, parent_id FROM product_categories ORDER BY name, id")
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var cc []ecommerce.Category
+	for rows.Next() {
+		var c ecommerce.Category
+		var parentID sql.NullInt64
+		if err = rows.Scan(&c.ID, &c.Name, &c.Slug, &parentID); err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		c.ParentID = int(storage.NullableIntToInt(parentID))
+		cc = append(cc, c)
+	}
+
+	return cc, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+func (s *productStorage) CategorySlugExists(slug string) (bool, error) {
+	const op = "productStorage.CategorySlugExists"
+
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM product_categories WHERE slug = $1)", slug).Scan(&exists)
+
+	return exists, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *productStorage) UpdateCategoryParent(id, parentID int) error {
+	const op = "productStorage.UpdateCategoryParent"
+
+	query := "UPDATE product_categories SET parent_id = $1 WHERE id = $2"
+	_, err := s.db.Exec(query, storage.IntToNullableInt(int64(parentID)), id)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *productStorage) CreateProductWithTx(tx *sql.Tx, p *ecommerce.Product) (int, error) {
+	query := "INSERT INTO products (name, category_id, price, old_price, description, quantity, tax_category, weight) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
 
+	price, oldPrice := priceColumns(&p.Price)
 	var id int
-	err := s.db.QueryRow(query, p.Name, p.CategoryID, p.Price.Current, p.Description, p.Quantity).Scan(&id)
+	err := tx.QueryRow(query, p.Name, p.CategoryID, price, oldPrice, p.Description, p.Quantity, p.TaxCategory, p.Weight).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -229,24 +573,238 @@ func (s *productStorage) CreateProduct(p *ecommerce.Product) (int, error) {
 func (s *productStorage) Product(id int) (*ecommerce.Product, error) {
 	const op  = "productStorage.Product"
 
-	query := fmt.Sprintf("SELECT name, category_id, price, description, quantity FROM products WHERE id = %d", id)
+	query := fmt.Sprintf("SELECT name, category_id, price, old_price, description, quantity, tax_category, weight, rating, rating_sum, review_count FROM products WHERE id = %d", id)
 
 	var p ecommerce.Product
+	var price int64
+	var oldPrice, rating sql.NullInt64
+	var ratingSum int
 	p.ID = id
-	err := s.db.QueryRow(query).Scan(&p.Name, &p.CategoryID, &p.Price.Current, &p.Description, &p.Quantity)
+	err := s.db.QueryRow(query).Scan(&p.Name, &p.CategoryID, &price, &oldPrice, &p.Description, &p.Quantity, &p.TaxCategory,
+		&p.Weight, &rating, &ratingSum, &p.ReviewCount)
+	if err == sql.ErrNoRows {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+
+	p.Price = catalogPrice(price, oldPrice)
+	p.Rating = int(storage.NullableIntToInt(rating))
+	p.AverageRating = averageRating(ratingSum, p.ReviewCount)
 
-	return &p, errors2.Wrap(err, op, "executing query")
+	pp := []ecommerce.Product{p}
+	err = s.attachDetails(pp)
+
+	return &pp[0], errors2.Wrap(err, op, "attaching details")
 }
 
 func (s *productStorage) UpdateProductWithTx(tx *sql.Tx, p *ecommerce.Product) error {
 	const op = "productStorage.UpdateProductWithTx"
 
-	query := "UPDATE products SET name = $1, category_id = $2, price = $3, description = $4, quantity = $5 WHERE id = $6"
-	_, err := tx.Exec(query, p.Name, p.CategoryID, p.Price.Current, p.Description, p.Quantity)
+	query := "UPDATE products SET name = $1, category_id = $2, price = $3, old_price = $4, description = $5, quantity = $6, " +
+		"tax_category = $7, weight = $8 WHERE id = $9"
+	price, oldPrice := priceColumns(&p.Price)
+	_, err := tx.Exec(query, p.Name, p.CategoryID, price, oldPrice, p.Description, p.Quantity, p.TaxCategory, p.Weight, p.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *productStorage) SaveOptionWithTx(tx *sql.Tx, o *ecommerce.ProductOption) (int, error) {
+	const op = "productStorage.SaveOptionWithTx"
+
+	if tx == nil {
+		return 0, errors2.Wrap(errors.New("transaction is nil"), op, "")
+	}
+
+	query := "INSERT INTO product_options (product_id, name) VALUES ($1, $2) RETURNING id"
+	var id int
+	err := tx.QueryRow(query, o.ProductID, o.Name).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting option")
+	}
+
+	query = "INSERT INTO product_option_values (option_id, value, position) VALUES ($1, $2, $3) RETURNING id"
+	for i := range o.Values {
+		err = tx.QueryRow(query, id, o.Values[i].Value, i).Scan(&o.Values[i].ID)
+		if err != nil {
+			return 0, errors2.Wrap(err, op, "inserting option value")
+		}
+		o.Values[i].OptionID = id
+	}
+
+	return id, nil
+}
+
+func (s *productStorage) SaveVariantWithTx(tx *sql.Tx, v *ecommerce.ProductVariant) (int, error) {
+	const op = "productStorage.SaveVariantWithTx"
+
+	if tx == nil {
+		return 0, errors2.Wrap(errors.New("transaction is nil"), op, "")
+	}
+
+	price, oldPrice := variantPrice(v)
+	query := "INSERT INTO product_variants (product_id, sku, price, old_price, quantity) VALUES ($1, $2, $3, $4, $5) RETURNING id"
+	var id int
+	err := tx.QueryRow(query, v.ProductID, v.SKU, price, oldPrice, v.Quantity).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting variant")
+	}
+
+	err = s.saveVariantRelationsWithTx(tx, id, v)
+
+	return id, errors2.Wrap(err, op, "saving variant option values and images")
+}
+
+func (s *productStorage) UpdateVariantWithTx(tx *sql.Tx, v *ecommerce.ProductVariant) error {
+	const op = "productStorage.UpdateVariantWithTx"
+
+	price, oldPrice := variantPrice(v)
+	query := "UPDATE product_variants SET sku = $1, price = $2, old_price = $3, quantity = $4 WHERE id = $5 AND product_id = $6"
+	_, err := tx.Exec(query, v.SKU, price, oldPrice, v.Quantity, v.ID, v.ProductID)
+	if err != nil {
+		return errors2.Wrap(err, op, "updating variant")
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM product_variant_option_values WHERE variant_id = %d", v.ID))
+	if err != nil {
+		return errors2.Wrap(err, op, "deleting variant option values")
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM product_variant_images WHERE variant_id = %d", v.ID))
+	if err != nil {
+		return errors2.Wrap(err, op, "deleting variant images")
+	}
+
+	return errors2.Wrap(s.saveVariantRelationsWithTx(tx, v.ID, v), op, "saving variant option values and images")
+}
+
+func (s *productStorage) saveVariantRelationsWithTx(tx *sql.Tx, variantID int, v *ecommerce.ProductVariant) error {
+	for _, valueID := range v.OptionValueIDs {
+		query := "INSERT INTO product_variant_option_values (variant_id, option_value_id) VALUES ($1, $2)"
+		if _, err := tx.Exec(query, variantID, valueID); err != nil {
+			return err
+		}
+	}
+
+	for i, url := range v.Images {
+		query := "INSERT INTO product_variant_images (variant_id, url, position) VALUES ($1, $2, $3)"
+		if _, err := tx.Exec(query, variantID, url, i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func variantPrice(v *ecommerce.ProductVariant) (sql.NullInt64, sql.NullInt64) {
+	if v.Price == nil {
+		return sql.NullInt64{}, sql.NullInt64{}
+	}
+
+	return priceColumns(v.Price)
+}
+
+// priceColumns returns the price and old_price columns of p in minor units of the catalog currency.
+func priceColumns(p *ecommerce.Price) (sql.NullInt64, sql.NullInt64) {
+	price := sql.NullInt64{Int64: p.Current.Amount, Valid: true}
+	var oldPrice sql.NullInt64
+	if p.Old != nil {
+		oldPrice = sql.NullInt64{Int64: p.Old.Amount, Valid: true}
+	}
+
+	return price, oldPrice
+}
+
+// catalogPrice builds a price from the price and old_price columns, which hold minor units
+// of the catalog currency.
+func catalogPrice(price int64, oldPrice sql.NullInt64) ecommerce.Price {
+	p := ecommerce.Price{Current: ecommerce.NewMoney(price, ecommerce.DefaultCurrency)}
+	if oldPrice.Valid {
+		old := ecommerce.NewMoney(oldPrice.Int64, ecommerce.DefaultCurrency)
+		p.Old = &old
+	}
+
+	return p
+}
+
+func (s *productStorage) UpdateVariantQuantityWithTx(tx *sql.Tx, variantID, quantity int) error {
+	const op = "productStorage.UpdateVariantQuantityWithTx"
+
+	query := "UPDATE product_variants SET quantity = $1 WHERE id = $2"
+	_, err := tx.Exec(query, quantity, variantID)
 
 	return errors2.Wrap(err, op, "executing query")
 }
 
+// AdjustProductQuantityWithTx changes the stock of a product by delta in a single statement
+// and returns the new stock. It fails with errors.NotFound if there is no such product or
+// the stock would drop below zero.
+func (s *productStorage) AdjustProductQuantityWithTx(tx *sql.Tx, productID, delta int) (int, error) {
+	const op = "productStorage.AdjustProductQuantityWithTx"
+
+	query := "UPDATE products SET quantity = quantity + $1 WHERE id = $2 AND quantity + $1 >= 0 RETURNING quantity"
+	var quantity int
+	err := tx.QueryRow(query, delta, productID).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return 0, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	}
+
+	return quantity, errors2.Wrap(err, op, "executing query")
+}
+
+// AdjustVariantQuantityWithTx is AdjustProductQuantityWithTx for a variant of a product.
+func (s *productStorage) AdjustVariantQuantityWithTx(tx *sql.Tx, productID, variantID, delta int) (int, error) {
+	const op = "productStorage.AdjustVariantQuantityWithTx"
+
+	query := "UPDATE product_variants SET quantity = quantity + $1 " +
+		"WHERE id = $2 AND product_id = $3 AND quantity + $1 >= 0 RETURNING quantity"
+	var quantity int
+	err := tx.QueryRow(query, delta, variantID, productID).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return 0, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	}
+
+	return quantity, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *productStorage) DeleteVariant(productID, variantID int) error {
+	const op = "productStorage.DeleteVariant"
+
+	query := fmt.Sprintf("DELETE FROM product_variants WHERE id = %d AND product_id = %d", variantID, productID)
+	res, err := s.db.Exec(query)
+	if err != nil {
+		return errors2.Wrap(err, op, "executing query")
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n < 1 {
+		return errors2.Wrap(&errors2.NotFound{Err: errors.New("variant not found")}, op, "checking rows affected")
+	}
+
+	return nil
+}
+
+func (s *productStorage) Variant(id int) (*ecommerce.ProductVariant, error) {
+	const op = "productStorage.Variant"
+
+	vv, err := s.queryVariants(fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "querying variants")
+	} else if len(vv) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: errors.New("variant not found")}, op, "")
+	}
+
+	return &vv[0], nil
+}
+
+// averageRating returns the mean rating rounded to two decimals or zero if there are no reviews.
+func averageRating(sum, count int) float32 {
+	if count < 1 {
+		return 0
+	}
+
+	return float32(math.Round(float64(sum)/float64(count)*100) / 100)
+}
+
 func (s *productStorage) Tx() (*sql.Tx, error) {
 	return s.db.Begin()
 }
@@ -0,0 +1,312 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+)
+
+// amount and min_spend are in minor units of the catalog currency.
+const promotionColumns = `id, code, name, type, value, amount, buy_quantity, get_quantity, min_spend, usage_limit,
+		per_customer_limit, starts_at, ends_at, stackable, priority, active`
+
+func NewPromotionStorage(db *sql.DB) *promotionStorage {
+	return &promotionStorage{db: db}
+}
+
+type promotionStorage struct {
+	db *sql.DB
+}
+
+func (s *promotionStorage) SavePromotionWithTx(tx *sql.Tx, p *ecommerce.Promotion) (int, error) {
+	const op = "promotionStorage.SavePromotionWithTx"
+
+	query := `INSERT INTO promotions (code, name, type, value, amount, buy_quantity, get_quantity, min_spend, usage_limit,
+				per_customer_limit, starts_at, ends_at, stackable, priority, active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, storage.StrToNullableStr(p.Code), p.Name, p.Type, p.Value, p.Amount.Amount, p.BuyQuantity,
+		p.GetQuantity, p.MinSpend.Amount, p.UsageLimit, p.PerCustomerLimit, p.StartsAt, p.EndsAt, p.Stackable, p.Priority, p.Active).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting promotion")
+	}
+
+	err = s.saveScopeWithTx(tx, id, p)
+
+	return id, errors2.Wrap(err, op, "saving scope")
+}
+
+func (s *promotionStorage) UpdatePromotionWithTx(tx *sql.Tx, p *ecommerce.Promotion) error {
+	const op = "promotionStorage.UpdatePromotionWithTx"
+
+	query := `UPDATE promotions SET code = $1, name = $2, type = $3, value = $4, amount = $5, buy_quantity = $6,
+				get_quantity = $7, min_spend = $8, usage_limit = $9, per_customer_limit = $10, starts_at = $11,
+				ends_at = $12, stackable = $13, priority = $14, active = $15
+			WHERE id = $16`
+	_, err := tx.Exec(query, storage.StrToNullableStr(p.Code), p.Name, p.Type, p.Value, p.Amount.Amount, p.BuyQuantity,
+		p.GetQuantity, p.MinSpend.Amount, p.UsageLimit, p.PerCustomerLimit, p.StartsAt, p.EndsAt, p.Stackable, p.Priority, p.Active, p.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "updating promotion")
+	}
+
+	for _, table := range []string{"promotion_products", "promotion_categories"} {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE promotion_id = %d", table, p.ID))
+		if err != nil {
+			return errors2.Wrap(err, op, "deleting scope")
+		}
+	}
+
+	return errors2.Wrap(s.saveScopeWithTx(tx, p.ID, p), op, "saving scope")
+}
+
+func (s *promotionStorage) saveScopeWithTx(tx *sql.Tx, id int, p *ecommerce.Promotion) error {
+	for _, productID := range p.ProductIDs {
+		_, err := tx.Exec("INSERT INTO promotion_products (promotion_id, product_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			id, productID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, categoryID := range p.CategoryIDs {
+		_, err := tx.Exec("INSERT INTO promotion_categories (promotion_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			id, categoryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *promotionStorage) Promotion(id int) (*ecommerce.Promotion, error) {
+	const op = "promotionStorage.Promotion"
+
+	pp, err := s.promotions(fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting promotions")
+	} else if len(pp) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting promotions")
+	}
+
+	return &pp[0], nil
+}
+
+func (s *promotionStorage) PromotionByCode(code string) (*ecommerce.Promotion, error) {
+	const op = "promotionStorage.PromotionByCode"
+
+	pp, err := s.promotions("WHERE code = $1", code)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting promotions")
+	} else if len(pp) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting promotions")
+	}
+
+	return &pp[0], nil
+}
+
+func (s *promotionStorage) Promotions() ([]ecommerce.Promotion, error) {
+	const op = "promotionStorage.Promotions"
+
+	pp, err := s.promotions("")
+
+	return pp, errors2.Wrap(err, op, "getting promotions")
+}
+
+// AutomaticPromotions returns the active promotions without a code.
+func (s *promotionStorage) AutomaticPromotions() ([]ecommerce.Promotion, error) {
+	const op = "promotionStorage.AutomaticPromotions"
+
+	pp, err := s.promotions("WHERE code IS NULL AND active")
+
+	return pp, errors2.Wrap(err, op, "getting promotions")
+}
+
+// CartPromotions returns the promotions whose coupons a customer applied to their cart.
+func (s *promotionStorage) CartPromotions(custID int) ([]ecommerce.Promotion, error) {
+	const op = "promotionStorage.CartPromotions"
+
+	pp, err := s.promotions(fmt.Sprintf(
+		"WHERE id IN (SELECT promotion_id FROM cart_promotions WHERE customer_id = %d)", custID))
+
+	return pp, errors2.Wrap(err, op, "getting promotions")
+}
+
+// promotions returns the promotions matching the where clause with their scope.
+func (s *promotionStorage) promotions(where string, args ...interface{}) ([]ecommerce.Promotion, error) {
+	query := fmt.Sprintf("SELECT %s FROM promotions %s ORDER BY id", promotionColumns, where)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pp []ecommerce.Promotion
+	for rows.Next() {
+		var p ecommerce.Promotion
+		var code sql.NullString
+		var startsAt, endsAt sql.NullTime
+		var amount, minSpend int64
+		err = rows.Scan(&p.ID, &code, &p.Name, &p.Type, &p.Value, &amount, &p.BuyQuantity, &p.GetQuantity, &minSpend,
+			&p.UsageLimit, &p.PerCustomerLimit, &startsAt, &endsAt, &p.Stackable, &p.Priority, &p.Active)
+		if err != nil {
+			return nil, err
+		}
+		p.Code = storage.NullableStrToStr(code)
+		if p.Type == ecommerce.PromotionTypeFixedAmount {
+			p.Amount = ecommerce.NewMoney(amount, ecommerce.DefaultCurrency)
+		}
+		p.MinSpend = ecommerce.NewMoney(minSpend, ecommerce.DefaultCurrency)
+		if startsAt.Valid {
+			p.StartsAt = &startsAt.Time
+		}
+		if endsAt.Valid {
+			p.EndsAt = &endsAt.Time
+		}
+		pp = append(pp, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(pp) < 1 {
+		return pp, nil
+	}
+
+	ids := make([]int, len(pp))
+	for i, p := range pp {
+		ids[i] = p.ID
+	}
+	idStr := storage.IntSliceToCommaSeparatedStr(ids)
+
+	products, err := promotionScope("SELECT promotion_id, product_id FROM promotion_products WHERE promotion_id IN (%s)", idStr, s.db)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := promotionScope("SELECT promotion_id, category_id FROM promotion_categories WHERE promotion_id IN (%s)", idStr, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range pp {
+		pp[i].ProductIDs = products[pp[i].ID]
+		pp[i].CategoryIDs = categories[pp[i].ID]
+		if pp[i].ProductIDs == nil { pp[i].ProductIDs = []int{} }
+		if pp[i].CategoryIDs == nil { pp[i].CategoryIDs = []int{} }
+	}
+
+	return pp, nil
+}
+
+// promotionScope runs a query selecting promotion id and scope id pairs and groups
+// the scope ids by promotion.
+func promotionScope(query, idStr string, db storage.Queryer) (map[int][]int, error) {
+	rows, err := db.Query(fmt.Sprintf(query, idStr))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scope := make(map[int][]int)
+	for rows.Next() {
+		var promotionID, id int
+		if err = rows.Scan(&promotionID, &id); err != nil {
+			return nil, err
+		}
+		scope[promotionID] = append(scope[promotionID], id)
+	}
+
+	return scope, rows.Err()
+}
+
+func (s *promotionStorage) AddCartPromotion(custID, promotionID int) error {
+	const op = "promotionStorage.AddCartPromotion"
+
+	_, err := s.db.Exec("INSERT INTO cart_promotions (customer_id, promotion_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		custID, promotionID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *promotionStorage) DeleteCartPromotion(custID, promotionID int) error {
+	const op = "promotionStorage.DeleteCartPromotion"
+
+	_, err := s.db.Exec(fmt.Sprintf("DELETE FROM cart_promotions WHERE customer_id = %d AND promotion_id = %d",
+		custID, promotionID))
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *promotionStorage) DeleteCartPromotionsWithTx(tx *sql.Tx, custID int) error {
+	const op = "promotionStorage.DeleteCartPromotionsWithTx"
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM cart_promotions WHERE customer_id = %d", custID))
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// RedemptionCounts returns the number of redemptions of the promotions with ids by all
+// customers and by the customer with custID, keyed by promotion id.
+func (s *promotionStorage) RedemptionCounts(ids []int, custID int) (map[int]int, map[int]int, error) {
+	const op = "promotionStorage.RedemptionCounts"
+
+	total := make(map[int]int)
+	customer := make(map[int]int)
+	if len(ids) < 1 {
+		return total, customer, nil
+	}
+
+	query := fmt.Sprintf(`SELECT promotion_id, COUNT(*), COUNT(*) FILTER (WHERE customer_id = %d)
+			FROM promotion_redemptions WHERE promotion_id IN (%s) GROUP BY promotion_id`,
+		custID, storage.IntSliceToCommaSeparatedStr(ids))
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, t, c int
+		if err = rows.Scan(&id, &t, &c); err != nil {
+			return nil, nil, errors2.Wrap(err, op, "scanning")
+		}
+		total[id], customer[id] = t, c
+	}
+
+	return total, customer, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+func (s *promotionStorage) LockPromotionWithTx(tx *sql.Tx, id int) error {
+	const op = "promotionStorage.LockPromotionWithTx"
+
+	_, err := tx.Exec(fmt.Sprintf("SELECT id FROM promotions WHERE id = %d FOR UPDATE", id))
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *promotionStorage) RedemptionCountWithTx(tx *sql.Tx, id, custID int) (int, int, error) {
+	const op = "promotionStorage.RedemptionCountWithTx"
+
+	query := fmt.Sprintf(`SELECT COUNT(*), COUNT(*) FILTER (WHERE customer_id = %d)
+			FROM promotion_redemptions WHERE promotion_id = %d`, custID, id)
+	var total, customer int
+	err := tx.QueryRow(query).Scan(&total, &customer)
+
+	return total, customer, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *promotionStorage) SaveRedemptionWithTx(tx *sql.Tx, promotionID, custID, orderID int, discount ecommerce.Money) error {
+	const op = "promotionStorage.SaveRedemptionWithTx"
+
+	query := `INSERT INTO promotion_redemptions (promotion_id, customer_id, order_id, discount, redeemed_at)
+			VALUES ($1, $2, $3, $4, now())`
+	_, err := tx.Exec(query, promotionID, custID, orderID, discount.Amount)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *promotionStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+	"strings"
+)
+
+func NewReturnStorage(db *sql.DB) *returnStorage {
+	return &returnStorage{db: db}
+}
+
+type returnStorage struct {
+	db *sql.DB
+}
+
+func (s *returnStorage) SaveReturnWithTx(tx *sql.Tx, r *ecommerce.Return) (int, error) {
+	const op = "returnStorage.SaveReturnWithTx"
+
+	query := `INSERT INTO returns (order_id, customer_id, status, reason, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, r.OrderID, r.CustomerID, r.Status, r.Reason, r.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting return")
+	}
+
+	for _, item := range r.Items {
+		_, err = tx.Exec("INSERT INTO return_items (return_id, order_item_id, quantity) VALUES ($1, $2, $3)",
+			id, item.OrderItemID, item.Quantity)
+		if err != nil {
+			return 0, errors2.Wrap(err, op, "inserting return item")
+		}
+	}
+
+	return id, nil
+}
+
+func (s *returnStorage) UpdateReturnStatusWithTx(tx *sql.Tx, id int, status string) error {
+	const op = "returnStorage.UpdateReturnStatusWithTx"
+
+	_, err := tx.Exec("UPDATE returns SET status = $1 WHERE id = $2", status, id)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// SaveEventWithTx adds e to the audit trail of a return. Refund amounts are stored
+// in minor units of the order currency.
+func (s *returnStorage) SaveEventWithTx(tx *sql.Tx, returnID int, e *ecommerce.ReturnEvent) error {
+	const op = "returnStorage.SaveEventWithTx"
+
+	var amount sql.NullInt64
+	if e.Amount != nil {
+		amount = sql.NullInt64{Int64: e.Amount.Amount, Valid: true}
+	}
+
+	query := `INSERT INTO return_events (return_id, status, actor_id, note, amount, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err := tx.QueryRow(query, returnID, e.Status, storage.IntToNullableInt(int64(e.ActorID)), storage.StrToNullableStr(e.Note), amount, e.CreatedAt).Scan(&e.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *returnStorage) Return(id int) (*ecommerce.Return, error) {
+	const op = "returnStorage.Return"
+
+	rr, err := s.returns(s.db, fmt.Sprintf("WHERE r.id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting returns")
+	} else if len(rr) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting returns")
+	}
+
+	return &rr[0], nil
+}
+
+// Returns returns the returns of a customer, or of all customers if custID is 0, with
+// status, or with any status if it is empty.
+func (s *returnStorage) Returns(custID int, status string) ([]ecommerce.Return, error) {
+	const op = "returnStorage.Returns"
+
+	var conds []string
+	var args []interface{}
+	if custID > 0 {
+		conds = append(conds, fmt.Sprintf("r.customer_id = %d", custID))
+	}
+	if status != "" {
+		args = append(args, status)
+		conds = append(conds, "r.status = $1")
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rr, err := s.returns(s.db, where, args...)
+
+	return rr, errors2.Wrap(err, op, "getting returns")
+}
+
+// OrderReturnsWithTx returns the returns of an order as seen by tx.
+func (s *returnStorage) OrderReturnsWithTx(tx *sql.Tx, orderID int) ([]ecommerce.Return, error) {
+	const op = "returnStorage.OrderReturnsWithTx"
+
+	rr, err := s.returns(tx, fmt.Sprintf("WHERE r.order_id = %d", orderID))
+
+	return rr, errors2.Wrap(err, op, "getting returns")
+}
+
+// returns returns the returns matching the where clause with their items and events.
+func (s *returnStorage) returns(q querier, where string, args ...interface{}) ([]ecommerce.Return, error) {
+	query := `SELECT r.id, r.order_id, COALESCE(r.customer_id, 0), r.status, r.reason, r.created_at, o.currency
+			FROM returns r JOIN orders o ON o.id = r.order_id ` + where + ` ORDER BY r.created_at DESC, r.id DESC`
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rr []ecommerce.Return
+	var ids []int
+	for rows.Next() {
+		r := ecommerce.Return{Items: []ecommerce.ReturnItem{}, Events: []ecommerce.ReturnEvent{}}
+		var currency string
+		err = rows.Scan(&r.ID, &r.OrderID, &r.CustomerID, &r.Status, &r.Reason, &r.CreatedAt, &currency)
+		if err != nil {
+			return nil, err
+		}
+		r.Refunded = ecommerce.NewMoney(0, currency)
+		rr = append(rr, r)
+		ids = append(ids, r.ID)
+	}
+	if err = rows.Err(); err != nil || len(rr) < 1 {
+		return rr, err
+	}
+	_ = rows.Close()
+
+	index := make(map[int]int)
+	for i, r := range rr {
+		index[r.ID] = i
+	}
+	idStr := storage.IntSliceToCommaSeparatedStr(ids)
+
+	items, err := q.Query(fmt.Sprintf(
+		"SELECT return_id, order_item_id, quantity FROM return_items WHERE return_id IN (%s) ORDER BY order_item_id", idStr))
+	if err != nil {
+		return nil, err
+	}
+	for items.Next() {
+		var returnID int
+		var item ecommerce.ReturnItem
+		if err = items.Scan(&returnID, &item.OrderItemID, &item.Quantity); err != nil {
+			_ = items.Close()
+			return nil, err
+		}
+		rr[index[returnID]].Items = append(rr[index[returnID]].Items, item)
+	}
+	_ = items.Close()
+	if err = items.Err(); err != nil {
+		return nil, err
+	}
+
+	events, err := q.Query(fmt.Sprintf(
+		"SELECT id, return_id, status, actor_id, note, amount, created_at FROM return_events WHERE return_id IN (%s) ORDER BY id", idStr))
+	if err != nil {
+		return nil, err
+	}
+	defer events.Close()
+
+	for events.Next() {
+		var e ecommerce.ReturnEvent
+		var returnID int
+		var note sql.NullString
+		var actorID, amount sql.NullInt64
+		if err = events.Scan(&e.ID, &returnID, &e.Status, &actorID, &note, &amount, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ActorID = int(storage.NullableIntToInt(actorID))
+		e.Note = storage.NullableStrToStr(note)
+
+		r := &rr[index[returnID]]
+		if amount.Valid {
+			m := ecommerce.NewMoney(amount.Int64, r.Refunded.Currency)
+			e.Amount = &m
+			r.Refunded = r.Refunded.Add(m)
+		}
+		r.Events = append(r.Events, e)
+	}
+
+	return rr, events.Err()
+}
+
+func (s *returnStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// reviewSortColumns maps review sort orders to ORDER BY clauses. The id is a
+// tie-breaker so that pages do not overlap.
+var reviewSortColumns = map[string]string{
+	ecommerce.ReviewSortNewest:        "created_at DESC, id DESC",
+	ecommerce.ReviewSortOldest:        "created_at, id",
+	ecommerce.ReviewSortHighestRating: "rating DESC, created_at DESC, id DESC",
+	ecommerce.ReviewSortLowestRating:  "rating, created_at DESC, id DESC",
+	ecommerce.ReviewSortMostHelpful:   "helpful_count DESC, created_at DESC, id DESC",
+}
+
+func NewReviewStorage(db *sql.DB) *reviewStorage {
+	return &reviewStorage{db: db}
+}
+
+type reviewStorage struct {
+	db *sql.DB
+}
+
+func (s *reviewStorage) SaveReview(r *ecommerce.Review) (int, error) {
+	const op = "reviewStorage.SaveReview"
+
+	query := `INSERT INTO reviews (product_id, customer_id, rating, title, body, status, helpful_count, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	var id int
+	err := s.db.QueryRow(query, r.ProductID, r.CustomerID, r.Rating, r.Title, r.Body, r.Status,
+		r.HelpfulCount, r.CreatedAt).Scan(&id)
+	// a review saved since the service checked for one breaks UNIQUE (product_id, customer_id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return 0, errors2.Wrap(&errors2.Invalid{Err: errors.New("product has already been reviewed")}, op, "executing query")
+	}
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *reviewStorage) Review(id int) (*ecommerce.Review, error) {
+	const op = "reviewStorage.Review"
+
+	query := fmt.Sprintf(`SELECT id, product_id, COALESCE(customer_id, 0), rating, title, body, status, helpful_count, created_at
+			FROM reviews WHERE id = %d`, id)
+
+	var r ecommerce.Review
+	err := s.db.QueryRow(query).Scan(&r.ID, &r.ProductID, &r.CustomerID, &r.Rating, &r.Title, &r.Body,
+		&r.Status, &r.HelpfulCount, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	}
+
+	return &r, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *reviewStorage) CustomerReviewExists(custID, productID int) (bool, error) {
+	const op = "reviewStorage.CustomerReviewExists"
+
+	query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM reviews WHERE customer_id = %d AND product_id = %d)", custID, productID)
+	var exists bool
+	err := s.db.QueryRow(query).Scan(&exists)
+
+	return exists, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *reviewStorage) HasDeliveredOrder(custID, productID int) (bool, error) {
+	const op = "reviewStorage.HasDeliveredOrder"
+
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM orders o JOIN order_items i ON i.order_id = o.id
+			WHERE o.customer_id = %d AND i.product_id = %d AND o.status = $1)`,
+		custID, productID)
+	var exists bool
+	err := s.db.QueryRow(query, ecommerce.OrderStatusDelivered).Scan(&exists)
+
+	return exists, errors2.Wrap(err, op, "executing query")
+}
+
+// ProductReviews returns a page of reviews with status. A productID of zero matches reviews
+// of all products.
+func (s *reviewStorage) ProductReviews(productID int, status string, sort string, page int, size int) ([]ecommerce.Review, error) {
+	const op = "reviewStorage.ProductReviews"
+
+	orderBy, ok := reviewSortColumns[sort]
+	if !ok {
+		orderBy = reviewSortColumns[ecommerce.ReviewSortNewest]
+	}
+
+	productCond := ""
+	if productID != 0 {
+		productCond = fmt.Sprintf("AND product_id = %d", productID)
+	}
+
+	query := fmt.Sprintf(`SELECT id, product_id, COALESCE(customer_id, 0), rating, title, body, status, helpful_count, created_at
+			FROM reviews WHERE status = $1 %s ORDER BY %s LIMIT %d OFFSET %d`,
+		productCond, orderBy, size, (page-1)*size)
+
+	rows, err := s.db.Query(query, status)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var rr []ecommerce.Review
+	for rows.Next() {
+		var r ecommerce.Review
+		err = rows.Scan(&r.ID, &r.ProductID, &r.CustomerID, &r.Rating, &r.Title, &r.Body,
+			&r.Status, &r.HelpfulCount, &r.CreatedAt)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning")
+		}
+		rr = append(rr, r)
+	}
+
+	return rr, errors2.Wrap(rows.Err(), op, "error after scan")
+}
+
+// UpdateReviewStatusWithTx moves a review from one status to another and reports false
+// if the review no longer has the status it is moved from.
+func (s *reviewStorage) UpdateReviewStatusWithTx(tx *sql.Tx, id int, from, to string) (bool, error) {
+	const op = "reviewStorage.UpdateReviewStatusWithTx"
+
+	res, err := tx.Exec("UPDATE reviews SET status = $1 WHERE id = $2 AND status = $3", to, id, from)
+	if err != nil {
+		return false, errors2.Wrap(err, op, "executing query")
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, errors2.Wrap(err, op, "getting rows affected")
+}
+
+// AdjustProductRatingWithTx adds the deltas to the rating sum and review count of a product
+// and recomputes its rounded star rating from them.
+func (s *reviewStorage) AdjustProductRatingWithTx(tx *sql.Tx, productID, ratingDelta, countDelta int) error {
+	const op = "reviewStorage.AdjustProductRatingWithTx"
+
+	query := `UPDATE products SET
+				rating_sum = rating_sum + $1,
+				review_count = review_count + $2,
+				rating = CASE WHEN review_count + $2 > 0
+					THEN round((rating_sum + $1)::numeric / (review_count + $2))
+					ELSE NULL END
+			WHERE id = $3`
+	_, err := tx.Exec(query, ratingDelta, countDelta, productID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// SaveHelpfulVoteWithTx records a helpful vote and reports false if the user already voted.
+func (s *reviewStorage) SaveHelpfulVoteWithTx(tx *sql.Tx, reviewID, userID int) (bool, error) {
+	const op = "reviewStorage.SaveHelpfulVoteWithTx"
+
+	res, err := tx.Exec("INSERT INTO review_votes (review_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		reviewID, userID)
+	if err != nil {
+		return false, errors2.Wrap(err, op, "executing query")
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, errors2.Wrap(err, op, "getting affected rows")
+}
+
+func (s *reviewStorage) IncrementHelpfulCountWithTx(tx *sql.Tx, reviewID int) (int, error) {
+	const op = "reviewStorage.IncrementHelpfulCountWithTx"
+
+	var count int
+	err := tx.QueryRow("UPDATE reviews SET helpful_count = helpful_count + 1 WHERE id = $1 RETURNING helpful_count",
+		reviewID).Scan(&count)
+
+	return count, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *reviewStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+)
+
+func NewShipmentStorage(db *sql.DB) *shipmentStorage {
+	return &shipmentStorage{db: db}
+}
+
+type shipmentStorage struct {
+	db *sql.DB
+}
+
+// querier is what *sql.DB and *sql.Tx have in common for reading.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *shipmentStorage) SaveShipmentWithTx(tx *sql.Tx, sh *ecommerce.Shipment) (int, error) {
+	const op = "shipmentStorage.SaveShipmentWithTx"
+
+	query := `INSERT INTO shipments (order_id, carrier, tracking_number, tracking_url, status, shipped_at, delivered_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, sh.OrderID, sh.Carrier, sh.TrackingNumber, storage.StrToNullableStr(sh.TrackingURL), sh.Status,
+		sh.ShippedAt, sh.DeliveredAt).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting shipment")
+	}
+
+	for _, item := range sh.Items {
+		_, err = tx.Exec("INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES ($1, $2, $3)",
+			id, item.OrderItemID, item.Quantity)
+		if err != nil {
+			return 0, errors2.Wrap(err, op, "inserting shipment item")
+		}
+	}
+
+	return id, nil
+}
+
+func (s *shipmentStorage) UpdateShipmentStatusWithTx(tx *sql.Tx, sh *ecommerce.Shipment) error {
+	const op = "shipmentStorage.UpdateShipmentStatusWithTx"
+
+	_, err := tx.Exec("UPDATE shipments SET status = $1, delivered_at = $2 WHERE id = $3", sh.Status, sh.DeliveredAt, sh.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *shipmentStorage) Shipment(id int) (*ecommerce.Shipment, error) {
+	const op = "shipmentStorage.Shipment"
+
+	ss, err := s.shipments(s.db, fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting shipments")
+	} else if len(ss) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting shipments")
+	}
+
+	return &ss[0], nil
+}
+
+func (s *shipmentStorage) Shipments(orderID int) ([]ecommerce.Shipment, error) {
+	const op = "shipmentStorage.Shipments"
+
+	ss, err := s.shipments(s.db, fmt.Sprintf("WHERE order_id = %d", orderID))
+
+	return ss, errors2.Wrap(err, op, "getting shipments")
+}
+
+// ShipmentsWithTx returns the shipments of an order as seen by tx.
+func (s *shipmentStorage) ShipmentsWithTx(tx *sql.Tx, orderID int) ([]ecommerce.Shipment, error) {
+	const op = "shipmentStorage.ShipmentsWithTx"
+
+	ss, err := s.shipments(tx, fmt.Sprintf("WHERE order_id = %d", orderID))
+
+	return ss, errors2.Wrap(err, op, "getting shipments")
+}
+
+// shipments returns the shipments matching the where clause with their items.
+func (s *shipmentStorage) shipments(q querier, where string) ([]ecommerce.Shipment, error) {
+	rows, err := q.Query("SELECT id, order_id, carrier, tracking_number, tracking_url, status, shipped_at, delivered_at FROM shipments " +
+		where + " ORDER BY shipped_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ss []ecommerce.Shipment
+	var ids []int
+	for rows.Next() {
+		sh := ecommerce.Shipment{Items: []ecommerce.ShipmentItem{}}
+		var trackingURL sql.NullString
+		var deliveredAt sql.NullTime
+		err = rows.Scan(&sh.ID, &sh.OrderID, &sh.Carrier, &sh.TrackingNumber, &trackingURL, &sh.Status, &sh.ShippedAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		sh.TrackingURL = storage.NullableStrToStr(trackingURL)
+		if deliveredAt.Valid {
+			t := deliveredAt.Time
+			sh.DeliveredAt = &t
+		}
+		ss = append(ss, sh)
+		ids = append(ids, sh.ID)
+	}
+	if err = rows.Err(); err != nil || len(ss) < 1 {
+		return ss, err
+	}
+	// a tx cannot run another query before the rows of the last one are closed
+	_ = rows.Close()
+
+	items, err := q.Query(fmt.Sprintf(
+		"SELECT shipment_id, order_item_id, quantity FROM shipment_items WHERE shipment_id IN (%s) ORDER BY order_item_id",
+		storage.IntSliceToCommaSeparatedStr(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer items.Close()
+
+	index := make(map[int]int)
+	for i, sh := range ss {
+		index[sh.ID] = i
+	}
+	for items.Next() {
+		var shipmentID int
+		var item ecommerce.ShipmentItem
+		if err = items.Scan(&shipmentID, &item.OrderItemID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		ss[index[shipmentID]].Items = append(ss[index[shipmentID]].Items, item)
+	}
+
+	return ss, items.Err()
+}
+
+func (s *shipmentStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
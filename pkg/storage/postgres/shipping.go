@@ -0,0 +1,295 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+)
+
+func NewShippingStorage(db *sql.DB) *shippingStorage {
+	return &shippingStorage{db: db}
+}
+
+type shippingStorage struct {
+	db *sql.DB
+}
+
+func (s *shippingStorage) SaveZoneWithTx(tx *sql.Tx, z *ecommerce.ShippingZone) (int, error) {
+	const op = "shippingStorage.SaveZoneWithTx"
+
+	var id int
+	err := tx.QueryRow("INSERT INTO shipping_zones (name) VALUES ($1) RETURNING id", z.Name).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting zone")
+	}
+
+	return id, errors2.Wrap(s.saveRegionsWithTx(tx, id, z.Regions), op, "saving regions")
+}
+
+func (s *shippingStorage) UpdateZoneWithTx(tx *sql.Tx, z *ecommerce.ShippingZone) error {
+	const op = "shippingStorage.UpdateZoneWithTx"
+
+	_, err := tx.Exec("UPDATE shipping_zones SET name = $1 WHERE id = $2", z.Name, z.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "updating zone")
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM shipping_zone_regions WHERE zone_id = %d", z.ID))
+	if err != nil {
+		return errors2.Wrap(err, op, "deleting regions")
+	}
+
+	return errors2.Wrap(s.saveRegionsWithTx(tx, z.ID, z.Regions), op, "saving regions")
+}
+
+func (s *shippingStorage) saveRegionsWithTx(tx *sql.Tx, zoneID int, rr []ecommerce.ShippingRegion) error {
+	for _, r := range rr {
+		_, err := tx.Exec("INSERT INTO shipping_zone_regions (zone_id, country, state) VALUES ($1, $2, $3)",
+			zoneID, r.Country, r.State)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *shippingStorage) DeleteZone(id int) error {
+	const op = "shippingStorage.DeleteZone"
+
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM shipping_zones WHERE id = %d", id))
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *shippingStorage) Zone(id int) (*ecommerce.ShippingZone, error) {
+	const op = "shippingStorage.Zone"
+
+	zz, err := s.zones(fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting zones")
+	} else if len(zz) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting zones")
+	}
+
+	return &zz[0], nil
+}
+
+// Zones returns all zones with their regions and methods.
+func (s *shippingStorage) Zones() ([]ecommerce.ShippingZone, error) {
+	const op = "shippingStorage.Zones"
+
+	zz, err := s.zones("")
+
+	return zz, errors2.Wrap(err, op, "getting zones")
+}
+
+func (s *shippingStorage) zones(where string) ([]ecommerce.ShippingZone, error) {
+	rows, err := s.db.Query("SELECT id, name FROM shipping_zones " + where + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zz []ecommerce.ShippingZone
+	var ids []int
+	for rows.Next() {
+		z := ecommerce.ShippingZone{Regions: []ecommerce.ShippingRegion{}, Methods: []ecommerce.ShippingMethod{}}
+		if err = rows.Scan(&z.ID, &z.Name); err != nil {
+			return nil, err
+		}
+		zz = append(zz, z)
+		ids = append(ids, z.ID)
+	}
+	if err = rows.Err(); err != nil || len(zz) < 1 {
+		return zz, err
+	}
+
+	idStr := storage.IntSliceToCommaSeparatedStr(ids)
+	regions, err := s.regions(idStr)
+	if err != nil {
+		return nil, err
+	}
+
+	mm, err := s.methods(fmt.Sprintf("WHERE zone_id IN (%s)", idStr))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range zz {
+		if rr := regions[zz[i].ID]; rr != nil {
+			zz[i].Regions = rr
+		}
+		for _, m := range mm {
+			if m.ZoneID == zz[i].ID {
+				zz[i].Methods = append(zz[i].Methods, m)
+			}
+		}
+	}
+
+	return zz, nil
+}
+
+// regions returns the regions of the zones in idStr keyed by zone id.
+func (s *shippingStorage) regions(idStr string) (map[int][]ecommerce.ShippingRegion, error) {
+	rows, err := s.db.Query(fmt.Sprintf(
+		"SELECT zone_id, country, state FROM shipping_zone_regions WHERE zone_id IN (%s) ORDER BY country, state", idStr))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	regions := make(map[int][]ecommerce.ShippingRegion)
+	for rows.Next() {
+		var zoneID int
+		var r ecommerce.ShippingRegion
+		if err = rows.Scan(&zoneID, &r.Country, &r.State); err != nil {
+			return nil, err
+		}
+		regions[zoneID] = append(regions[zoneID], r)
+	}
+
+	return regions, rows.Err()
+}
+
+// SaveMethodWithTx saves m with its tiers. Amounts are stored in minor units of the catalog currency.
+func (s *shippingStorage) SaveMethodWithTx(tx *sql.Tx, m *ecommerce.ShippingMethod) (int, error) {
+	const op = "shippingStorage.SaveMethodWithTx"
+
+	query := `INSERT INTO shipping_methods (zone_id, name, type, rate_type, rate, free_over, active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, m.ZoneID, m.Name, m.Type, m.RateType, m.Rate.Amount, m.FreeOver.Amount, m.Active).Scan(&id)
+	if err != nil {
+		return 0, errors2.Wrap(err, op, "inserting method")
+	}
+
+	return id, errors2.Wrap(s.saveTiersWithTx(tx, id, m.Tiers), op, "saving tiers")
+}
+
+func (s *shippingStorage) UpdateMethodWithTx(tx *sql.Tx, m *ecommerce.ShippingMethod) error {
+	const op = "shippingStorage.UpdateMethodWithTx"
+
+	query := `UPDATE shipping_methods SET name = $1, type = $2, rate_type = $3, rate = $4, free_over = $5, active = $6
+			WHERE id = $7`
+	_, err := tx.Exec(query, m.Name, m.Type, m.RateType, m.Rate.Amount, m.FreeOver.Amount, m.Active, m.ID)
+	if err != nil {
+		return errors2.Wrap(err, op, "updating method")
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM shipping_method_tiers WHERE method_id = %d", m.ID))
+	if err != nil {
+		return errors2.Wrap(err, op, "deleting tiers")
+	}
+
+	return errors2.Wrap(s.saveTiersWithTx(tx, m.ID, m.Tiers), op, "saving tiers")
+}
+
+func (s *shippingStorage) saveTiersWithTx(tx *sql.Tx, methodID int, tt []ecommerce.ShippingTier) error {
+	for _, t := range tt {
+		_, err := tx.Exec("INSERT INTO shipping_method_tiers (method_id, min_weight, min_subtotal, rate) VALUES ($1, $2, $3, $4)",
+			methodID, t.MinWeight, t.MinSubtotal.Amount, t.Rate.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *shippingStorage) DeleteMethod(zoneID, id int) error {
+	const op = "shippingStorage.DeleteMethod"
+
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM shipping_methods WHERE id = %d AND zone_id = %d", id, zoneID))
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *shippingStorage) Method(id int) (*ecommerce.ShippingMethod, error) {
+	const op = "shippingStorage.Method"
+
+	mm, err := s.methods(fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting methods")
+	} else if len(mm) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting methods")
+	}
+
+	return &mm[0], nil
+}
+
+// methods returns the methods matching the where clause with their tiers.
+func (s *shippingStorage) methods(where string) ([]ecommerce.ShippingMethod, error) {
+	rows, err := s.db.Query("SELECT id, zone_id, name, type, rate_type, rate, free_over, active FROM shipping_methods " +
+		where + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mm []ecommerce.ShippingMethod
+	var ids []int
+	for rows.Next() {
+		m := ecommerce.ShippingMethod{Tiers: []ecommerce.ShippingTier{}}
+		var rate, freeOver int64
+		err = rows.Scan(&m.ID, &m.ZoneID, &m.Name, &m.Type, &m.RateType, &rate, &freeOver, &m.Active)
+		if err != nil {
+			return nil, err
+		}
+		m.Rate = ecommerce.NewMoney(rate, ecommerce.DefaultCurrency)
+		m.FreeOver = ecommerce.NewMoney(freeOver, ecommerce.DefaultCurrency)
+		mm = append(mm, m)
+		ids = append(ids, m.ID)
+	}
+	if err = rows.Err(); err != nil || len(mm) < 1 {
+		return mm, err
+	}
+
+	tiers, err := s.db.Query(fmt.Sprintf(
+		`SELECT method_id, min_weight, min_subtotal, rate FROM shipping_method_tiers WHERE method_id IN (%s)
+			ORDER BY min_weight, min_subtotal`, storage.IntSliceToCommaSeparatedStr(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer tiers.Close()
+
+	index := make(map[int]int)
+	for i, m := range mm {
+		index[m.ID] = i
+	}
+	for tiers.Next() {
+		var methodID int
+		var t ecommerce.ShippingTier
+		var minSubtotal, rate int64
+		if err = tiers.Scan(&methodID, &t.MinWeight, &minSubtotal, &rate); err != nil {
+			return nil, err
+		}
+		t.MinSubtotal = ecommerce.NewMoney(minSubtotal, ecommerce.DefaultCurrency)
+		t.Rate = ecommerce.NewMoney(rate, ecommerce.DefaultCurrency)
+		mm[index[methodID]].Tiers = append(mm[index[methodID]].Tiers, t)
+	}
+
+	return mm, tiers.Err()
+}
+
+// deleted returns the error of a delete statement and NotFound if it did not delete anything.
+func deleted(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n < 1 {
+		return &errors2.NotFound{Err: sql.ErrNoRows}
+	}
+
+	return nil
+}
+
+func (s *shippingStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
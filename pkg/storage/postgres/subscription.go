@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+	"time"
+)
+
+func NewSubscriptionStorage(db *sql.DB) *subscriptionStorage {
+	return &subscriptionStorage{db: db}
+}
+
+type subscriptionStorage struct {
+	db *sql.DB
+}
+
+// SaveSubscription saves s. If the address is subscribed to the same alert about the
+// product already, the threshold of the existing subscription is updated instead.
+func (s *subscriptionStorage) SaveSubscription(sub *ecommerce.Subscription) (int, error) {
+	const op = "subscriptionStorage.SaveSubscription"
+
+	var threshold sql.NullInt64
+	if sub.Threshold != nil {
+		threshold = sql.NullInt64{Int64: sub.Threshold.Amount, Valid: true}
+	}
+
+	query := `INSERT INTO subscriptions (product_id, variant_id, type, email, threshold, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (product_id, COALESCE(variant_id, 0), type, email)
+				DO UPDATE SET threshold = EXCLUDED.threshold
+			RETURNING id`
+	var id int
+	err := s.db.QueryRow(query, sub.ProductID, storage.IntToNullableInt(int64(sub.VariantID)), sub.Type, sub.Email,
+		threshold, sub.CreatedAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *subscriptionStorage) DeleteSubscription(id int) error {
+	const op = "subscriptionStorage.DeleteSubscription"
+
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM subscriptions WHERE id = %d", id))
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+// SubscriptionsWithTx returns the subscriptions to alerts about the product with productID.
+func (s *subscriptionStorage) SubscriptionsWithTx(tx *sql.Tx, productID int) ([]ecommerce.Subscription, error) {
+	const op = "subscriptionStorage.SubscriptionsWithTx"
+
+	query := fmt.Sprintf(`SELECT id, product_id, variant_id, type, email, threshold, created_at
+			FROM subscriptions WHERE product_id = %d ORDER BY id`, productID)
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var ss []ecommerce.Subscription
+	for rows.Next() {
+		var sub ecommerce.Subscription
+		var variantID, threshold sql.NullInt64
+		err = rows.Scan(&sub.ID, &sub.ProductID, &variantID, &sub.Type, &sub.Email, &threshold, &sub.CreatedAt)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		sub.VariantID = int(storage.NullableIntToInt(variantID))
+		if threshold.Valid {
+			// catalog prices are in the default currency
+			m := ecommerce.NewMoney(threshold.Int64, ecommerce.DefaultCurrency)
+			sub.Threshold = &m
+		}
+		ss = append(ss, sub)
+	}
+
+	return ss, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+// QueueAlertWithTx queues a. If the subscription has an alert waiting already, that
+// alert is updated to the product name and price of a instead.
+func (s *subscriptionStorage) QueueAlertWithTx(tx *sql.Tx, a *ecommerce.SubscriptionAlert) error {
+	const op = "subscriptionStorage.QueueAlertWithTx"
+
+	query := `INSERT INTO subscription_alerts (subscription_id, email, type, product_id, product_name, price, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (subscription_id) WHERE sent_at IS NULL
+				DO UPDATE SET product_name = EXCLUDED.product_name, price = EXCLUDED.price, created_at = EXCLUDED.created_at
+			RETURNING id`
+	err := tx.QueryRow(query, a.SubscriptionID, a.Email, a.Type, a.ProductID, a.ProductName, a.Price.Amount,
+		a.CreatedAt).Scan(&a.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// PendingAlertsWithTx returns the alerts waiting to be sent, oldest first, and locks
+// them until tx ends. Alerts locked by other transactions are skipped.
+func (s *subscriptionStorage) PendingAlertsWithTx(tx *sql.Tx) ([]ecommerce.SubscriptionAlert, error) {
+	const op = "subscriptionStorage.PendingAlertsWithTx"
+
+	query := `SELECT id, subscription_id, email, type, product_id, product_name, price, created_at
+			FROM subscription_alerts WHERE sent_at IS NULL ORDER BY id FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var aa []ecommerce.SubscriptionAlert
+	for rows.Next() {
+		var a ecommerce.SubscriptionAlert
+		var price int64
+		err = rows.Scan(&a.ID, &a.SubscriptionID, &a.Email, &a.Type, &a.ProductID, &a.ProductName, &price, &a.CreatedAt)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		a.Price = ecommerce.NewMoney(price, ecommerce.DefaultCurrency)
+		aa = append(aa, a)
+	}
+
+	return aa, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+// EmailsSentSinceWithTx returns the number of alert emails sent to email since then.
+// The alerts sent together in one email share their sent_at.
+func (s *subscriptionStorage) EmailsSentSinceWithTx(tx *sql.Tx, email string, since time.Time) (int, error) {
+	const op = "subscriptionStorage.EmailsSentSinceWithTx"
+
+	query := "SELECT COUNT(DISTINCT sent_at) FROM subscription_alerts WHERE email = $1 AND sent_at >= $2"
+	var n int
+	err := tx.QueryRow(query, email, since).Scan(&n)
+
+	return n, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *subscriptionStorage) MarkAlertsSentWithTx(tx *sql.Tx, ids []int, sentAt time.Time) error {
+	const op = "subscriptionStorage.MarkAlertsSentWithTx"
+
+	if len(ids) < 1 {
+		return nil
+	}
+
+	query := fmt.Sprintf("UPDATE subscription_alerts SET sent_at = $1 WHERE id IN (%s)", storage.IntSliceToCommaSeparatedStr(ids))
+	_, err := tx.Exec(query, sentAt)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *subscriptionStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+)
+
+func NewTaxStorage(db *sql.DB) *taxStorage {
+	return &taxStorage{db: db}
+}
+
+type taxStorage struct {
+	db *sql.DB
+}
+
+func (s *taxStorage) SaveRate(r *ecommerce.TaxRate) (int, error) {
+	const op = "taxStorage.SaveRate"
+
+	query := `INSERT INTO tax_rates (name, country, state, postal_code, tax_category, rate, inclusive)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id int
+	err := s.db.QueryRow(query, r.Name, r.Country, r.State, r.PostalCode, storage.StrToNullableStr(r.TaxCategory),
+		r.Rate, r.Inclusive).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *taxStorage) UpdateRate(r *ecommerce.TaxRate) error {
+	const op = "taxStorage.UpdateRate"
+
+	query := `UPDATE tax_rates SET name = $1, country = $2, state = $3, postal_code = $4, tax_category = $5, rate = $6,
+				inclusive = $7
+			WHERE id = $8`
+	_, err := s.db.Exec(query, r.Name, r.Country, r.State, r.PostalCode, storage.StrToNullableStr(r.TaxCategory),
+		r.Rate, r.Inclusive, r.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *taxStorage) DeleteRate(id int) error {
+	const op = "taxStorage.DeleteRate"
+
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM tax_rates WHERE id = %d", id))
+	if err != nil {
+		return errors2.Wrap(err, op, "executing query")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors2.Wrap(err, op, "getting affected rows")
+	} else if n < 1 {
+		return errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "executing query")
+	}
+
+	return nil
+}
+
+func (s *taxStorage) Rate(id int) (*ecommerce.TaxRate, error) {
+	const op = "taxStorage.Rate"
+
+	rr, err := s.rates(fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting rates")
+	} else if len(rr) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting rates")
+	}
+
+	return &rr[0], nil
+}
+
+// Rates returns the rates of country, or all rates if country is empty.
+func (s *taxStorage) Rates(country string) ([]ecommerce.TaxRate, error) {
+	const op = "taxStorage.Rates"
+
+	var rr []ecommerce.TaxRate
+	var err error
+	if country == "" {
+		rr, err = s.rates("")
+	} else {
+		rr, err = s.rates("WHERE country = $1", country)
+	}
+
+	return rr, errors2.Wrap(err, op, "getting rates")
+}
+
+func (s *taxStorage) rates(where string, args ...interface{}) ([]ecommerce.TaxRate, error) {
+	query := "SELECT id, name, country, state, postal_code, tax_category, rate, inclusive FROM tax_rates " + where +
+		" ORDER BY country, state, postal_code, id"
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rr []ecommerce.TaxRate
+	for rows.Next() {
+		var r ecommerce.TaxRate
+		var category sql.NullString
+		err = rows.Scan(&r.ID, &r.Name, &r.Country, &r.State, &r.PostalCode, &category, &r.Rate, &r.Inclusive)
+		if err != nil {
+			return nil, err
+		}
+		r.TaxCategory = storage.NullableStrToStr(category)
+		r.Rate = trimRate(r.Rate)
+		rr = append(rr, r)
+	}
+
+	return rr, rows.Err()
+}
@@ -7,6 +7,7 @@ import (
 	"ecommerce/pkg/storage"
 	"errors"
 	"fmt"
+	"time"
 )
 
 func NewUserStorage(db *sql.DB) *userStorage {
@@ -37,14 +38,14 @@ func (s *userStorage) SaveUserWithTx(tx *sql.Tx, user *ecommerce.User, hashedPas
 func (s *userStorage) UpdateUserWithTx(tx *sql.Tx, user *ecommerce.User) error {
 	const op = "userStorage.UpdateUserWithTx"
 
+	// a changed email address has to be verified again
 	query := "UPDATE users SET " +
 		"first_name = $1," +
 		"last_name = $2," +
-		"email = $3," +
-		"address_id = $4" +
-		"WHERE id = $5"
-	_, err := tx.Exec(query, user.FirstName, user.LastName, user.Email,
-		storage.IntToNullableInt(int64(user.AddressID)), user.ID)
+		"email = $3, " +
+		"email_verified_at = CASE WHEN email = $3 THEN email_verified_at END " +
+		"WHERE id = $4"
+	_, err := tx.Exec(query, user.FirstName, user.LastName, user.Email, user.ID)
 	if err != nil {
 		return errors2.Wrap(err, op, "executing query")
 	}
@@ -142,7 +143,8 @@ func (s userStorage) User(uid int) (*ecommerce.User, error) {
 				users.first_name, 
 				users.last_name, 
 				users.email,
-				users.address_id,
+				users.email_verified_at IS NOT NULL,
+				users.deletion_scheduled_at,
 				role_user_map.role_id
 			FROM users
 			INNER JOIN role_user_map ON users.id = role_user_map.user_id
@@ -156,16 +158,19 @@ func (s userStorage) User(uid int) (*ecommerce.User, error) {
 
 	var u *ecommerce.User
 	var r int
+	var deletionScheduledAt sql.NullTime
 
 	if rows.Next() {
 		tempUser := ecommerce.User{}
-		var nullableAddressID sql.NullInt64
-		err = rows.Scan(&tempUser.ID, &tempUser.FirstName, &tempUser.LastName, &tempUser.Email, &nullableAddressID, &r)
+		err = rows.Scan(&tempUser.ID, &tempUser.FirstName, &tempUser.LastName, &tempUser.Email, &tempUser.EmailVerified,
+			&deletionScheduledAt, &r)
 		if err != nil {
 			return nil, errors2.Wrap(err, op, "scanning into struct")
 		}
+		if deletionScheduledAt.Valid {
+			tempUser.DeletionScheduledAt = &deletionScheduledAt.Time
+		}
 		tempUser.Roles = append(tempUser.Roles, r)
-		tempUser.AddressID = int(storage.NullableIntToInt(nullableAddressID))
 		u = &tempUser
 	} else {
 		return nil, errors2.Wrap(&errors2.NotFound{Err:errors.New("user not found")}, op, "")
@@ -173,7 +178,7 @@ func (s userStorage) User(uid int) (*ecommerce.User, error) {
 
 	for rows.Next() {
 		var dummyVar interface{}
-		err = rows.Scan(&dummyVar, &dummyVar, &dummyVar, &dummyVar, &r)
+		err = rows.Scan(&dummyVar, &dummyVar, &dummyVar, &dummyVar, &dummyVar, &dummyVar, &r)
 		if err != nil {
 			return nil, errors2.Wrap(err, op, "scanning into dummy var and role var")
 		}
@@ -270,7 +275,7 @@ func (s *userStorage) CustOrderIDs(id int) ([]int, error) {
 func (s *userStorage) CartItems(custID int) ([]ecommerce.CartItem, error) {
 	const op = "userStorage.CartItems"
 
-	query := fmt.Sprintf("SELECT product_id, quantity FROM cart_items WHERE customer_id = %d", custID)
+	query := fmt.Sprintf("SELECT product_id, variant_id, quantity FROM cart_items WHERE customer_id = %d", custID)
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, errors2.Wrap(err, op, "executing query")
@@ -280,29 +285,58 @@ func (s *userStorage) CartItems(custID int) ([]ecommerce.CartItem, error) {
 	var cc []ecommerce.CartItem
 	for rows.Next() {
 		var c ecommerce.CartItem
-		err = rows.Scan(&c.Product.ID, &c.Quantity)
+		var variantID sql.NullInt64
+		err = rows.Scan(&c.Product.ID, &variantID, &c.Quantity)
 		if err != nil {
 			return nil, errors2.Wrap(err, op, "scanning")
 		}
+		c.VariantID = int(storage.NullableIntToInt(variantID))
 		cc = append(cc, c)
 	}
 
 	return cc, errors2.Wrap(rows.Err(), op, "error after scan")
 }
 
-func (s *userStorage) AddCartItems(custID, productID int) error {
+func (s *userStorage) AddCartItems(custID, productID, variantID int) error {
 	const op = "userStorage.AddCartItems"
 
-	query := fmt.Sprintf(`INSERT INTO cart_items (product_id, customer_id, quantity) 
-			VALUES (%d, %d, 1) 
-			ON CONFLICT (product_id, customer_id) 
-				DO UPDATE SET quantity = cart_items.quantity + 1`, productID, custID)
-	fmt.Println(query)
+	query := `INSERT INTO cart_items (product_id, variant_id, customer_id, quantity) 
+			VALUES ($1, $2, $3, 1) 
+			ON CONFLICT (product_id, customer_id, COALESCE(variant_id, 0)) 
+				DO UPDATE SET quantity = cart_items.quantity + 1`
 
-	_, err := s.db.Exec(query)
+	_, err := s.db.Exec(query, productID, storage.IntToNullableInt(int64(variantID)), custID)
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) DeleteCartItemsWithTx(tx *sql.Tx, custID int) error {
+	const op = "userStorage.DeleteCartItemsWithTx"
+
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM cart_items WHERE customer_id = %d", custID))
 	return errors2.Wrap(err, op, "executing query")
 }
 
+func (s *userStorage) AddCartItemWithTx(tx *sql.Tx, custID, productID, variantID, quantity int) error {
+	const op = "userStorage.AddCartItemWithTx"
+
+	query := `INSERT INTO cart_items (product_id, variant_id, customer_id, quantity)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (product_id, customer_id, COALESCE(variant_id, 0))
+				DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity`
+
+	_, err := tx.Exec(query, productID, storage.IntToNullableInt(int64(variantID)), custID, quantity)
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) DeleteCartItemWithTx(tx *sql.Tx, custID, productID, variantID int) error {
+	const op = "userStorage.DeleteCartItemWithTx"
+
+	query := fmt.Sprintf("DELETE FROM cart_items WHERE customer_id = %d AND product_id = %d AND COALESCE(variant_id, 0) = %d",
+		custID, productID, variantID)
+
+	return errors2.Wrap(deleted(tx.Exec(query)), op, "executing query")
+}
+
 func (s *userStorage) CartItemCount(custID int) (int, error) {
 	const op = "userStorage.CartItemCount"
 
@@ -316,3 +350,481 @@ func (s *userStorage) CartItemCount(custID int) (int, error) {
 
 	return int(storage.NullableIntToInt(countNullable)), nil
 }
+
+func (s *userStorage) UpdatePasswordWithTx(tx *sql.Tx, uid int, hashedPassword string) error {
+	const op = "userStorage.UpdatePasswordWithTx"
+
+	res, err := tx.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, uid)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *userStorage) PasswordWithTx(tx *sql.Tx, uid int) (string, error) {
+	const op = "userStorage.PasswordWithTx"
+
+	var password string
+	err := tx.QueryRow("SELECT password FROM users WHERE id = $1 FOR UPDATE", uid).Scan(&password)
+	if err == sql.ErrNoRows {
+		return "", errors2.Wrap(&errors2.NotFound{Err: errors.New("user not found")}, op, "scanning into var")
+	}
+
+	return password, errors2.Wrap(err, op, "scanning into var")
+}
+
+// SaveSession keeps revoked and expired sessions until the user logs in again, so
+// that they are not deleted in the middle of being listed.
+func (s *userStorage) SaveSession(se *ecommerce.Session, now time.Time) (int, error) {
+	const op = "userStorage.SaveSession"
+
+	query := "DELETE FROM user_sessions WHERE user_id = $1 AND (expires_at < $2 OR revoked_at < $2)"
+	if _, err := s.db.Exec(query, se.UserID, now); err != nil {
+		return 0, errors2.Wrap(err, op, "deleting ended sessions")
+	}
+
+	query = `INSERT INTO user_sessions (user_id, device, ip, user_agent, created_at, last_seen_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	var id int
+	err := s.db.QueryRow(query, se.UserID, se.Device, se.IP, se.UserAgent, se.CreatedAt, se.LastSeenAt, se.ExpiresAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) Sessions(uid int, now time.Time) ([]ecommerce.Session, error) {
+	const op = "userStorage.Sessions"
+
+	query := `SELECT id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at FROM user_sessions
+			WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC, id DESC`
+	rows, err := s.db.Query(query, uid, now)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var ss []ecommerce.Session
+	for rows.Next() {
+		var se ecommerce.Session
+		err = rows.Scan(&se.ID, &se.UserID, &se.Device, &se.IP, &se.UserAgent, &se.CreatedAt, &se.LastSeenAt, &se.ExpiresAt)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		ss = append(ss, se)
+	}
+
+	return ss, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+func (s *userStorage) TouchSession(id int, ip string, now time.Time) (*ecommerce.Session, error) {
+	const op = "userStorage.TouchSession"
+
+	query := `UPDATE user_sessions SET last_seen_at = $2, ip = $3 WHERE id = $1
+			RETURNING id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at, revoked_at`
+	var se ecommerce.Session
+	var revokedAt sql.NullTime
+	err := s.db.QueryRow(query, id, now, ip).Scan(&se.ID, &se.UserID, &se.Device, &se.IP, &se.UserAgent, &se.CreatedAt,
+		&se.LastSeenAt, &se.ExpiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: errors.New("session not found")}, op, "scanning into var")
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "scanning into var")
+	}
+
+	if revokedAt.Valid {
+		se.RevokedAt = &revokedAt.Time
+	}
+
+	return &se, nil
+}
+
+func (s *userStorage) RevokeSession(uid, id int, now time.Time) error {
+	const op = "userStorage.RevokeSession"
+
+	query := "UPDATE user_sessions SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	res, err := s.db.Exec(query, id, uid, now)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *userStorage) RevokeSessionsWithTx(tx *sql.Tx, uid, keepID int, now time.Time) error {
+	const op = "userStorage.RevokeSessionsWithTx"
+
+	query := "UPDATE user_sessions SET revoked_at = $3 WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL"
+	_, err := tx.Exec(query, uid, keepID, now)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) CustomerReviews(custID int) ([]ecommerce.Review, error) {
+	const op = "userStorage.CustomerReviews"
+
+	query := `SELECT id, product_id, customer_id, rating, title, body, status, helpful_count, created_at
+			FROM reviews WHERE customer_id = $1 ORDER BY created_at DESC, id DESC`
+	rows, err := s.db.Query(query, custID)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var rr []ecommerce.Review
+	for rows.Next() {
+		var r ecommerce.Review
+		err = rows.Scan(&r.ID, &r.ProductID, &r.CustomerID, &r.Rating, &r.Title, &r.Body, &r.Status, &r.HelpfulCount, &r.CreatedAt)
+		if err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		rr = append(rr, r)
+	}
+
+	return rr, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+func (s *userStorage) ScheduleDeletionWithTx(tx *sql.Tx, uid int, at *time.Time) error {
+	const op = "userStorage.ScheduleDeletionWithTx"
+
+	res, err := tx.Exec("UPDATE users SET deletion_scheduled_at = $2 WHERE id = $1", uid, at)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *userStorage) UsersDueForDeletion(now time.Time, limit int) ([]int, error) {
+	const op = "userStorage.UsersDueForDeletion"
+
+	query := "SELECT id FROM users WHERE deletion_scheduled_at <= $1 ORDER BY deletion_scheduled_at, id LIMIT $2"
+	rows, err := s.db.Query(query, now, limit)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+// PurgeUserWithTx deletes what is kept about the user by their email address, and then
+// the user, whose orders, returns and reviews lose their customer by ON DELETE SET
+// NULL and whose other rows are deleted by ON DELETE CASCADE.
+func (s *userStorage) PurgeUserWithTx(tx *sql.Tx, uid int, email string, now time.Time) error {
+	const op = "userStorage.PurgeUserWithTx"
+
+	queries := []struct {
+		what string
+		query string
+		args []interface{}
+	}{
+		{"anonymizing orders", `UPDATE orders SET shipping_city = '', shipping_postal_code = '', shipping_address = ''
+				WHERE customer_id = $1`, []interface{}{uid}},
+		{"deleting login attempts", "DELETE FROM login_attempts WHERE user_id = $1 OR lower(email) = lower($2)",
+			[]interface{}{uid, email}},
+		{"deleting login throttles", "DELETE FROM login_throttles WHERE scope = $1 AND subject = lower($2)",
+			[]interface{}{ecommerce.LoginScopeAccount, email}},
+		{"deleting subscriptions", "DELETE FROM subscriptions WHERE lower(email) = lower($1)", []interface{}{email}},
+		{"deleting emails", "DELETE FROM email_outbox WHERE lower(recipient) = lower($1)", []interface{}{email}},
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q.query, q.args...); err != nil {
+			return errors2.Wrap(err, op, q.what)
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM users WHERE id = $1 AND deletion_scheduled_at <= $2", uid, now)
+
+	return errors2.Wrap(deleted(res, err), op, "deleting user")
+}
+
+func (s *userStorage) SetEmailVerifiedWithTx(tx *sql.Tx, uid int, email string, at time.Time) error {
+	const op = "userStorage.SetEmailVerifiedWithTx"
+
+	query := "UPDATE users SET email_verified_at = COALESCE(email_verified_at, $1) WHERE id = $2 AND email = $3"
+	res, err := tx.Exec(query, at, uid, email)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *userStorage) SaveTokenWithTx(tx *sql.Tx, t *ecommerce.UserToken) (int, error) {
+	const op = "userStorage.SaveTokenWithTx"
+
+	query := `INSERT INTO user_tokens (user_id, purpose, email, token_hash, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, t.UserID, t.Purpose, t.Email, t.Hash, t.ExpiresAt, t.CreatedAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) TokenCountSince(uid int, purpose string, since time.Time) (int, error) {
+	const op = "userStorage.TokenCountSince"
+
+	query := "SELECT COUNT(*) FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at >= $3"
+	var n int
+	err := s.db.QueryRow(query, uid, purpose, since).Scan(&n)
+
+	return n, errors2.Wrap(err, op, "executing query")
+}
+
+// UseTokenWithTx marks the token atomically, so that a token cannot be used twice by
+// concurrent requests.
+func (s *userStorage) UseTokenWithTx(tx *sql.Tx, hash, purpose string, now time.Time) (*ecommerce.UserToken, error) {
+	const op = "userStorage.UseTokenWithTx"
+
+	query := `UPDATE user_tokens SET used_at = $1
+			WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+			RETURNING id, user_id, purpose, email, token_hash, expires_at, used_at, created_at`
+	var t ecommerce.UserToken
+	var usedAt time.Time
+	err := tx.QueryRow(query, now, hash, purpose).Scan(&t.ID, &t.UserID, &t.Purpose, &t.Email, &t.Hash, &t.ExpiresAt,
+		&usedAt, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: err}, op, "executing query")
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	t.UsedAt = &usedAt
+
+	return &t, nil
+}
+
+func (s *userStorage) InvalidateTokensWithTx(tx *sql.Tx, uid int, purpose string, now time.Time) error {
+	const op = "userStorage.InvalidateTokensWithTx"
+
+	query := "UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL"
+	_, err := tx.Exec(query, now, uid, purpose)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) SaveLoginAttemptWithTx(tx *sql.Tx, a *ecommerce.LoginAttempt) (int, error) {
+	const op = "userStorage.SaveLoginAttemptWithTx"
+
+	query := `INSERT INTO login_attempts (user_id, email, ip, reason, created_at)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	var userID sql.NullInt64
+	if a.UserID > 0 {
+		userID = sql.NullInt64{Int64: int64(a.UserID), Valid: true}
+	}
+	var id int
+	err := tx.QueryRow(query, userID, a.Email, a.IP, a.Reason, a.CreatedAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) LoginAttempts(uid int, limit int) ([]ecommerce.LoginAttempt, error) {
+	const op = "userStorage.LoginAttempts"
+
+	query := `SELECT id, user_id, email, ip, reason, created_at FROM login_attempts
+			WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`
+	rows, err := s.db.Query(query, uid, limit)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "executing query")
+	}
+	defer rows.Close()
+
+	var aa []ecommerce.LoginAttempt
+	for rows.Next() {
+		var a ecommerce.LoginAttempt
+		if err = rows.Scan(&a.ID, &a.UserID, &a.Email, &a.IP, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, errors2.Wrap(err, op, "scanning rows")
+		}
+		aa = append(aa, a)
+	}
+
+	return aa, errors2.Wrap(rows.Err(), op, "iterating rows")
+}
+
+func (s *userStorage) LoginLockedUntil(scope, subject string) (*time.Time, error) {
+	const op = "userStorage.LoginLockedUntil"
+
+	var until sql.NullTime
+	err := s.db.QueryRow("SELECT locked_until FROM login_throttles WHERE scope = $1 AND subject = $2", scope, subject).Scan(&until)
+	if err == sql.ErrNoRows || err == nil && !until.Valid {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "scanning into var")
+	}
+
+	return &until.Time, nil
+}
+
+// AddLoginFailureWithTx counts the failure in one statement, so that concurrent
+// failures are all counted.
+func (s *userStorage) AddLoginFailureWithTx(tx *sql.Tx, scope, subject string, now, staleBefore time.Time) (int, error) {
+	const op = "userStorage.AddLoginFailureWithTx"
+
+	query := `INSERT INTO login_throttles (scope, subject, failures, last_failure_at) VALUES ($1, $2, 1, $3)
+			ON CONFLICT (scope, subject) DO UPDATE SET
+				failures = CASE WHEN login_throttles.last_failure_at < $4 THEN 1 ELSE login_throttles.failures + 1 END,
+				last_failure_at = $3
+			RETURNING failures`
+	var failures int
+	err := tx.QueryRow(query, scope, subject, now, staleBefore).Scan(&failures)
+
+	return failures, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) LockLoginWithTx(tx *sql.Tx, scope, subject string, until time.Time) error {
+	const op = "userStorage.LockLoginWithTx"
+
+	_, err := tx.Exec("UPDATE login_throttles SET locked_until = $1 WHERE scope = $2 AND subject = $3", until, scope, subject)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) ResetLoginFailures(scope, subject string) error {
+	const op = "userStorage.ResetLoginFailures"
+
+	_, err := s.db.Exec("DELETE FROM login_throttles WHERE scope = $1 AND subject = $2", scope, subject)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) TOTP(uid int) (*ecommerce.TOTP, error) {
+	const op = "userStorage.TOTP"
+
+	t, err := scanTOTP(s.db.QueryRow(totpQuery, uid))
+	return t, errors2.Wrap(err, op, "scanning totp")
+}
+
+func (s *userStorage) TOTPWithTx(tx *sql.Tx, uid int) (*ecommerce.TOTP, error) {
+	const op = "userStorage.TOTPWithTx"
+
+	t, err := scanTOTP(tx.QueryRow(totpQuery + " FOR UPDATE", uid))
+	return t, errors2.Wrap(err, op, "scanning totp")
+}
+
+const totpQuery = "SELECT user_id, secret, confirmed_at, last_step, created_at FROM user_totp WHERE user_id = $1"
+
+func scanTOTP(row *sql.Row) (*ecommerce.TOTP, error) {
+	var t ecommerce.TOTP
+	var confirmedAt sql.NullTime
+	err := row.Scan(&t.UserID, &t.Secret, &confirmedAt, &t.LastStep, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, &errors2.NotFound{Err: errors.New("totp not found")}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if confirmedAt.Valid {
+		t.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return &t, nil
+}
+
+func (s *userStorage) SaveTOTPWithTx(tx *sql.Tx, t *ecommerce.TOTP) error {
+	const op = "userStorage.SaveTOTPWithTx"
+
+	query := `INSERT INTO user_totp (user_id, secret, confirmed_at, last_step, created_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id) DO UPDATE SET secret = $2, confirmed_at = $3, last_step = $4, created_at = $5`
+	_, err := tx.Exec(query, t.UserID, t.Secret, t.ConfirmedAt, t.LastStep, t.CreatedAt)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) UpdateTOTPWithTx(tx *sql.Tx, t *ecommerce.TOTP) error {
+	const op = "userStorage.UpdateTOTPWithTx"
+
+	res, err := tx.Exec("UPDATE user_totp SET confirmed_at = $1, last_step = $2 WHERE user_id = $3", t.ConfirmedAt, t.LastStep, t.UserID)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *userStorage) DeleteTOTPWithTx(tx *sql.Tx, uid int) error {
+	const op = "userStorage.DeleteTOTPWithTx"
+
+	_, err := tx.Exec("DELETE FROM user_totp WHERE user_id = $1", uid)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *userStorage) ReplaceRecoveryCodesWithTx(tx *sql.Tx, uid int, hashes []string, now time.Time) error {
+	const op = "userStorage.ReplaceRecoveryCodesWithTx"
+
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = $1", uid); err != nil {
+		return errors2.Wrap(err, op, "deleting codes")
+	}
+
+	for _, h := range hashes {
+		_, err := tx.Exec("INSERT INTO user_recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)", uid, h, now)
+		if err != nil {
+			return errors2.Wrap(err, op, "inserting code")
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCodeWithTx marks the code atomically, so that a code cannot be used twice
+// by concurrent requests.
+func (s *userStorage) UseRecoveryCodeWithTx(tx *sql.Tx, uid int, hash string, now time.Time) error {
+	const op = "userStorage.UseRecoveryCodeWithTx"
+
+	res, err := tx.Exec("UPDATE user_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL",
+		now, uid, hash)
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *userStorage) SaveExternalLogin(l *ecommerce.ExternalLogin, now time.Time) error {
+	const op = "userStorage.SaveExternalLogin"
+
+	if _, err := s.db.Exec("DELETE FROM external_logins WHERE expires_at < $1", now); err != nil {
+		return errors2.Wrap(err, op, "deleting expired logins")
+	}
+
+	query := `INSERT INTO external_logins (state_hash, provider, nonce, code_verifier, expires_at)
+			VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.db.Exec(query, l.StateHash, l.Provider, l.Nonce, l.CodeVerifier, l.ExpiresAt)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+// UseExternalLogin deletes the login atomically, so that a login cannot be completed
+// twice by concurrent requests.
+func (s *userStorage) UseExternalLogin(stateHash, provider string, now time.Time) (*ecommerce.ExternalLogin, error) {
+	const op = "userStorage.UseExternalLogin"
+
+	query := `DELETE FROM external_logins WHERE state_hash = $1 AND provider = $2 AND expires_at > $3
+			RETURNING state_hash, provider, nonce, code_verifier, expires_at`
+	var l ecommerce.ExternalLogin
+	err := s.db.QueryRow(query, stateHash, provider, now).Scan(&l.StateHash, &l.Provider, &l.Nonce, &l.CodeVerifier, &l.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: errors.New("login not found")}, op, "scanning into var")
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "scanning into var")
+	}
+
+	return &l, nil
+}
+
+func (s *userStorage) IdentityWithTx(tx *sql.Tx, provider, subject string) (*ecommerce.Identity, error) {
+	const op = "userStorage.IdentityWithTx"
+
+	query := `SELECT id, user_id, provider, subject, email, created_at FROM user_identities
+			WHERE provider = $1 AND subject = $2`
+	var i ecommerce.Identity
+	err := tx.QueryRow(query, provider, subject).Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: errors.New("identity not found")}, op, "scanning into var")
+	} else if err != nil {
+		return nil, errors2.Wrap(err, op, "scanning into var")
+	}
+
+	return &i, nil
+}
+
+func (s *userStorage) SaveIdentityWithTx(tx *sql.Tx, i *ecommerce.Identity) (int, error) {
+	const op = "userStorage.SaveIdentityWithTx"
+
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	var id int
+	err := tx.QueryRow(query, i.UserID, i.Provider, i.Subject, i.Email, i.CreatedAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
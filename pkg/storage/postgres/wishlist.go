@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"database/sql"
+	"ecommerce/pkg/ecommerce"
+	errors2 "ecommerce/pkg/ecommerce/errors"
+	"ecommerce/pkg/storage"
+	"fmt"
+)
+
+func NewWishlistStorage(db *sql.DB) *wishlistStorage {
+	return &wishlistStorage{db: db}
+}
+
+type wishlistStorage struct {
+	db *sql.DB
+}
+
+func (s *wishlistStorage) SaveWishlist(w *ecommerce.Wishlist) (int, error) {
+	const op = "wishlistStorage.SaveWishlist"
+
+	query := "INSERT INTO wishlists (customer_id, name, share_token, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	var id int
+	err := s.db.QueryRow(query, w.CustomerID, w.Name, storage.StrToNullableStr(w.ShareToken), w.CreatedAt).Scan(&id)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *wishlistStorage) UpdateWishlist(w *ecommerce.Wishlist) error {
+	const op = "wishlistStorage.UpdateWishlist"
+
+	query := "UPDATE wishlists SET name = $1, share_token = $2 WHERE id = $3"
+	_, err := s.db.Exec(query, w.Name, storage.StrToNullableStr(w.ShareToken), w.ID)
+
+	return errors2.Wrap(err, op, "executing query")
+}
+
+func (s *wishlistStorage) DeleteWishlist(id int) error {
+	const op = "wishlistStorage.DeleteWishlist"
+
+	res, err := s.db.Exec(fmt.Sprintf("DELETE FROM wishlists WHERE id = %d", id))
+
+	return errors2.Wrap(deleted(res, err), op, "executing query")
+}
+
+func (s *wishlistStorage) Wishlist(id int) (*ecommerce.Wishlist, error) {
+	const op = "wishlistStorage.Wishlist"
+
+	ww, err := s.wishlists(fmt.Sprintf("WHERE id = %d", id))
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting wishlists")
+	} else if len(ww) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting wishlists")
+	}
+
+	return &ww[0], nil
+}
+
+func (s *wishlistStorage) WishlistByToken(token string) (*ecommerce.Wishlist, error) {
+	const op = "wishlistStorage.WishlistByToken"
+
+	ww, err := s.wishlists("WHERE share_token = $1", token)
+	if err != nil {
+		return nil, errors2.Wrap(err, op, "getting wishlists")
+	} else if len(ww) < 1 {
+		return nil, errors2.Wrap(&errors2.NotFound{Err: sql.ErrNoRows}, op, "getting wishlists")
+	}
+
+	return &ww[0], nil
+}
+
+// Wishlists returns the wishlists of a customer, oldest first.
+func (s *wishlistStorage) Wishlists(custID int) ([]ecommerce.Wishlist, error) {
+	const op = "wishlistStorage.Wishlists"
+
+	ww, err := s.wishlists(fmt.Sprintf("WHERE customer_id = %d", custID))
+
+	return ww, errors2.Wrap(err, op, "getting wishlists")
+}
+
+// wishlists returns the wishlists matching where with their items. The products of
+// the items only have their id set.
+func (s *wishlistStorage) wishlists(where string, args ...interface{}) ([]ecommerce.Wishlist, error) {
+	query := "SELECT id, customer_id, name, share_token, created_at FROM wishlists " + where + " ORDER BY id"
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ww []ecommerce.Wishlist
+	index := map[int]int{}
+	var ids []int
+	for rows.Next() {
+		w := ecommerce.Wishlist{Items: []ecommerce.WishlistItem{}}
+		var token sql.NullString
+		if err = rows.Scan(&w.ID, &w.CustomerID, &w.Name, &token, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.ShareToken = storage.NullableStrToStr(token)
+		w.Shared = w.ShareToken != ""
+		index[w.ID] = len(ww)
+		ids = append(ids, w.ID)
+		ww = append(ww, w)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ww) < 1 {
+		return nil, nil
+	}
+
+	query = fmt.Sprintf(`SELECT id, wishlist_id, product_id, variant_id, quantity, added_price, added_in_stock, added_at
+			FROM wishlist_items WHERE wishlist_id IN (%s) ORDER BY id`, storage.IntSliceToCommaSeparatedStr(ids))
+	items, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer items.Close()
+
+	for items.Next() {
+		var item ecommerce.WishlistItem
+		var wishlistID int
+		var variantID sql.NullInt64
+		var addedPrice int64
+		err = items.Scan(&item.ID, &wishlistID, &item.Product.ID, &variantID, &item.Quantity, &addedPrice,
+			&item.AddedInStock, &item.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		item.VariantID = int(storage.NullableIntToInt(variantID))
+		// catalog prices are in the default currency
+		item.AddedPrice = ecommerce.NewMoney(addedPrice, ecommerce.DefaultCurrency)
+		ww[index[wishlistID]].Items = append(ww[index[wishlistID]].Items, item)
+	}
+
+	return ww, items.Err()
+}
+
+// SaveItemWithTx adds item to a wishlist. If the wishlist has the product already, its
+// quantity is added to the existing item, which keeps the price it was added at.
+func (s *wishlistStorage) SaveItemWithTx(tx *sql.Tx, wishlistID int, item *ecommerce.WishlistItem) (int, error) {
+	const op = "wishlistStorage.SaveItemWithTx"
+
+	query := `INSERT INTO wishlist_items (wishlist_id, product_id, variant_id, quantity, added_price, added_in_stock, added_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (wishlist_id, product_id, COALESCE(variant_id, 0))
+				DO UPDATE SET quantity = LEAST(wishlist_items.quantity + EXCLUDED.quantity, 99)
+			RETURNING id, quantity`
+	var id int
+	err := tx.QueryRow(query, wishlistID, item.Product.ID, storage.IntToNullableInt(int64(item.VariantID)), item.Quantity,
+		item.AddedPrice.Amount, item.AddedInStock, item.AddedAt).Scan(&id, &item.Quantity)
+
+	return id, errors2.Wrap(err, op, "executing query")
+}
+
+func (s *wishlistStorage) DeleteItemWithTx(tx *sql.Tx, wishlistID, itemID int) error {
+	const op = "wishlistStorage.DeleteItemWithTx"
+
+	query := fmt.Sprintf("DELETE FROM wishlist_items WHERE id = %d AND wishlist_id = %d", itemID, wishlistID)
+
+	return errors2.Wrap(deleted(tx.Exec(query)), op, "executing query")
+}
+
+func (s *wishlistStorage) Tx() (*sql.Tx, error) {
+	return s.db.Begin()
+}
@@ -0,0 +1,117 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as used by
+// authenticator apps: 6 digit codes from HMAC-SHA1 over 30 second time steps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits of a code.
+	Digits = 6
+	// Period is how long a code is valid.
+	Period = 30 * time.Second
+	// secretSize is the number of random bytes of a secret, RFC 4226 recommends 160 bits.
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random secret encoded in base32 without padding, the way
+// authenticator apps expect it.
+func GenerateSecret() (string, error) {
+	buf := make([]byte, secretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(buf), nil
+}
+
+// URI returns the otpauth URI of secret for the account at issuer. Encoded as a QR
+// code, it is scanned by authenticator apps to set up the secret.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Step returns the time step t is in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of secret for the time step t is in.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hotp(key, uint64(Step(t)), Digits), nil
+}
+
+// Validate returns the time step code is the code of secret for, and true if that step
+// is at most skew steps away from the one t is in and after notBefore. Callers pass the
+// step of the last code used as notBefore, so that a code cannot be used twice.
+func Validate(secret, code string, t time.Time, skew int, notBefore int64) (int64, bool) {
+	key, err := decode(secret)
+	if err != nil || len(code) != Digits {
+		return 0, false
+	}
+
+	now := Step(t)
+	for i := -int64(skew); i <= int64(skew); i++ {
+		step := now + i
+		if step <= notBefore || step < 0 {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step), Digits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// decode returns the key of secret, which apps show grouped and in lower case too.
+func decode(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// hotp returns the HOTP value (RFC 4226) of key for counter with digits digits.
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
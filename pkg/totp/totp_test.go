@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestHOTP checks the SHA-1 test vectors of RFC 6238, which have 8 digits.
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		if got := hotp(key, uint64(Step(time.Unix(tt.unix, 0))), 8); got != tt.want {
+			t.Errorf("at %d: wanted %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "050471" {
+		t.Fatalf("wanted the last 6 digits of the RFC test vector, got %s", code)
+	}
+
+	step, ok := Validate(secret, code, now.Add(Period), 1, 0)
+	if !ok || step != Step(now) {
+		t.Fatalf("wanted the code to be valid a step later, got %d %v", step, ok)
+	}
+	if _, ok = Validate(secret, code, now.Add(2*Period), 1, 0); ok {
+		t.Fatal("wanted the code to be invalid two steps later")
+	}
+	if _, ok = Validate(secret, code, now, 1, Step(now)); ok {
+		t.Fatal("wanted a code of a used step to be invalid")
+	}
+	if _, ok = Validate(secret, "000000", now, 1, 0); ok {
+		t.Fatal("wanted a wrong code to be invalid")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := decode(secret)
+	if err != nil || len(key) != secretSize {
+		t.Fatalf("wanted a %d byte key, got %d (%v)", secretSize, len(key), err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("My Shop", "ada@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/My Shop:ada@example.com" {
+		t.Fatalf("wanted an otpauth totp URI labelled with issuer and account, got %s", u)
+	}
+	if q := u.Query(); q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "My Shop" || q.Get("digits") != "6" {
+		t.Fatalf("wanted secret, issuer and digits parameters, got %s", u.RawQuery)
+	}
+}